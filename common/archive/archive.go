@@ -2,6 +2,7 @@ package archive
 
 import (
 	"io"
+	"time"
 )
 
 // NamespaceHeader is a data structure that, as BSON, is found in archives where it indicates
@@ -28,6 +29,13 @@ type CollectionMetadata struct {
 type Header struct {
 	ConcurrentCollections int32  `BSON:"concurrent_collections",omitempty`
 	FormatVersion         string `BSON:"version"`
+	// DumpTimestamp is when the archive was produced. It is absent from archives
+	// written by older versions of mongodump.
+	DumpTimestamp time.Time `bson:"dumpTimestamp,omitempty"`
+	// SourceServerVersion is the version of the server the archive was dumped
+	// from. It is absent from archives written by older versions of mongodump,
+	// and when the version couldn't be found.
+	SourceServerVersion string `bson:"sourceServerVersion,omitempty"`
 }
 
 const minBSONSize = 4 + 1 // an empty BSON document should be exactly five bytes long
@@ -40,6 +48,12 @@ var terminatorBytes = []byte{0xFF, 0xFF, 0xFF, 0xFF} // TODO, rectify this with
 const MagicNumber uint32 = 0x8199e26d
 const archiveFormatVersion = "0.1"
 
+// MagicNumberOverride, if set, replaces MagicNumber for the Preludes that don't set their
+// own MagicNumber, so that a fork can build mongodump and mongorestore to write and read
+// archives with its own magic number, given in hex or decimal. Needs to be set using
+// -ldflags, e.g. -X github.com/mongodb/mongo-tools/common/archive.MagicNumberOverride=0x12345678
+var MagicNumberOverride string
+
 // Writer is the top level object to contain information about archives in mongodump
 type Writer struct {
 	Out     io.WriteCloser
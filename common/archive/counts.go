@@ -0,0 +1,67 @@
+package archive
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"io"
+)
+
+// CollectionDocCounts reads a whole archive from in and returns the number of
+// documents of each namespace in it, including the namespaces listed in the
+// prelude without any documents. Documents are counted from the block framing
+// alone, by their BSON length prefixes, without unmarshaling any of them, which
+// makes it much faster than restoring or demultiplexing the archive.
+func CollectionDocCounts(in io.Reader) (map[string]int64, error) {
+	prelude := &Prelude{}
+	err := prelude.Read(in)
+	if err != nil {
+		return nil, err
+	}
+	counter := &docCounter{counts: map[string]int64{}}
+	for _, cm := range prelude.NamespaceMetadatas {
+		counter.counts[cm.Database+"."+cm.Collection] = 0
+	}
+	parser := Parser{In: in}
+	err = parser.ReadAllBlocks(counter)
+	if err != nil {
+		return nil, err
+	}
+	return counter.counts, nil
+}
+
+// docCounter is a ParserConsumer that counts the body documents of each namespace.
+type docCounter struct {
+	counts           map[string]int64
+	currentNamespace string
+}
+
+// HeaderBSON is part of the ParserConsumer interface. Only the small namespace
+// headers are unmarshaled, to know which namespace the following bodies belong to.
+func (counter *docCounter) HeaderBSON(buf []byte) error {
+	colHeader := NamespaceHeader{}
+	err := bson.Unmarshal(buf, &colHeader)
+	if err != nil {
+		return newWrappedError("header bson doesn't unmarshal as a collection header", err)
+	}
+	if colHeader.Collection == "" {
+		return newError("collection header is missing a Collection")
+	}
+	counter.currentNamespace = colHeader.Database + "." + colHeader.Collection
+	if colHeader.EOF {
+		counter.currentNamespace = ""
+	}
+	return nil
+}
+
+// BodyBSON is part of the ParserConsumer interface.
+func (counter *docCounter) BodyBSON(buf []byte) error {
+	if counter.currentNamespace == "" {
+		return newError("collection data without a collection header")
+	}
+	counter.counts[counter.currentNamespace]++
+	return nil
+}
+
+// End is part of the ParserConsumer interface.
+func (counter *docCounter) End() error {
+	return nil
+}
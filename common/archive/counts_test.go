@@ -0,0 +1,114 @@
+package archive
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+// testBlock is a block of an archive: documents of a namespace, or its EOF.
+type testBlock struct {
+	db, collection string
+	docs           int
+	eof            bool
+}
+
+// writeTestArchive writes an archive with a prelude of the given
+// collections, followed by the given blocks.
+func writeTestArchive(collections []*CollectionMetadata, blocks []testBlock) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	prelude := &Prelude{Header: &Header{FormatVersion: archiveFormatVersion}}
+	for _, cm := range collections {
+		prelude.AddMetadata(cm)
+	}
+	So(prelude.Write(buf), ShouldBeNil)
+	for _, block := range blocks {
+		header, err := bson.Marshal(NamespaceHeader{
+			Database:   block.db,
+			Collection: block.collection,
+			EOF:        block.eof,
+		})
+		So(err, ShouldBeNil)
+		buf.Write(header)
+		for i := 0; i < block.docs; i++ {
+			doc, err := bson.Marshal(bson.D{{"_id", i}, {"ns", block.db + "." + block.collection}})
+			So(err, ShouldBeNil)
+			buf.Write(doc)
+		}
+		buf.Write(terminatorBytes)
+	}
+	return buf
+}
+
+// decodingCounter is a ParserConsumer that counts documents by fully decoding them.
+type decodingCounter struct {
+	counts map[string]int64
+}
+
+func (counter *decodingCounter) HeaderBSON(buf []byte) error {
+	return nil
+}
+
+func (counter *decodingCounter) BodyBSON(buf []byte) error {
+	doc := bson.M{}
+	err := bson.Unmarshal(buf, &doc)
+	if err != nil {
+		return err
+	}
+	counter.counts[doc["ns"].(string)]++
+	return nil
+}
+
+func (counter *decodingCounter) End() error {
+	return nil
+}
+
+func TestCollectionDocCounts(t *testing.T) {
+
+	Convey("With an archive interleaving the documents of three collections", t, func() {
+		collections := []*CollectionMetadata{
+			{Database: "db1", Collection: "c1"},
+			{Database: "db1", Collection: "c2"},
+			{Database: "db2", Collection: "c3"},
+			{Database: "db2", Collection: "empty"},
+		}
+		blocks := []testBlock{
+			{db: "db1", collection: "c1", docs: 100},
+			{db: "db2", collection: "c3", docs: 7},
+			{db: "db1", collection: "c2", docs: 40},
+			{db: "db1", collection: "c1", docs: 25},
+			{db: "db2", collection: "c3", eof: true},
+			{db: "db1", collection: "c2", docs: 1},
+			{db: "db1", collection: "c1", eof: true},
+			{db: "db1", collection: "c2", eof: true},
+			{db: "db2", collection: "empty", eof: true},
+		}
+		raw := writeTestArchive(collections, blocks).Bytes()
+
+		Convey("the fast count should match a count of the decoded documents", func() {
+			counts, err := CollectionDocCounts(bytes.NewReader(raw))
+			So(err, ShouldBeNil)
+
+			in := bytes.NewReader(raw)
+			So((&Prelude{}).Read(in), ShouldBeNil)
+			decoded := &decodingCounter{counts: map[string]int64{}}
+			So((&Parser{In: in}).ReadAllBlocks(decoded), ShouldBeNil)
+
+			So(counts, ShouldResemble, map[string]int64{
+				"db1.c1":    decoded.counts["db1.c1"],
+				"db1.c2":    decoded.counts["db1.c2"],
+				"db2.c3":    decoded.counts["db2.c3"],
+				"db2.empty": 0,
+			})
+			So(counts["db1.c1"], ShouldEqual, 125)
+			So(counts["db1.c2"], ShouldEqual, 41)
+			So(counts["db2.c3"], ShouldEqual, 7)
+		})
+
+		Convey("an archive truncated in the middle of a block should be an error", func() {
+			_, err := CollectionDocCounts(bytes.NewReader(raw[:len(raw)/2]))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -22,10 +22,20 @@ type DemuxOut interface {
 // Demultiplexer implements Parser.
 type Demultiplexer struct {
 	In io.Reader
+	// StrictEnd is passed on to the Parser, see Parser.StrictEnd
+	StrictEnd bool
+	// Prelude, if set, lists the namespaces in the archive. Bytes after the last
+	// block are only treated as trailing bytes once all of them have been read.
+	Prelude *Prelude
+	// NamespaceBufferSize is the number of documents that may be queued for each
+	// RegularCollectionReceiver before the demultiplexer blocks waiting on it.
+	// This bounds the memory held for a collection that is slow to be restored.
+	NamespaceBufferSize int
 	//TODO wrap up these three into a structure
 	outs               map[string]DemuxOut
 	hashes             map[string]hash.Hash64
 	lengths            map[string]int64
+	finished           map[string]bool
 	currentNamespace   string
 	buf                [db.MaxBSONSize]byte
 	NamespaceChan      chan string
@@ -34,7 +44,7 @@ type Demultiplexer struct {
 
 // Run creates and runs a parser with the Demultiplexer as a consumer
 func (demux *Demultiplexer) Run() error {
-	parser := Parser{In: demux.In}
+	parser := Parser{In: demux.In, StrictEnd: demux.StrictEnd}
 	err := parser.ReadAllBlocks(demux)
 	if len(demux.outs) > 0 {
 		log.Logf(log.Always, "demux finishing when there are still outs (%v)", len(demux.outs))
@@ -118,6 +128,10 @@ func (demux *Demultiplexer) HeaderBSON(buf []byte) error {
 		delete(demux.outs, demux.currentNamespace)
 		delete(demux.hashes, demux.currentNamespace)
 		delete(demux.lengths, demux.currentNamespace)
+		if demux.finished == nil {
+			demux.finished = make(map[string]bool)
+		}
+		demux.finished[demux.currentNamespace] = true
 		// in case we get a BSONBody with this block,
 		// we want to ensure that that causes an error
 		demux.currentNamespace = ""
@@ -142,6 +156,20 @@ func (demux *Demultiplexer) End() error {
 	return nil
 }
 
+// Complete is part of the ParserCompleter interface. It returns true once every
+// namespace in the Prelude has been read up to its EOF block.
+func (demux *Demultiplexer) Complete() bool {
+	if demux.Prelude == nil {
+		return false
+	}
+	for _, cm := range demux.Prelude.NamespaceMetadatas {
+		if !demux.finished[cm.Database+"."+cm.Collection] {
+			return false
+		}
+	}
+	return true
+}
+
 // BodyBSON is part of the ParserConsumer interface and receives BSON bodies from the parser.
 // Its main role is to dispatch the body to the Read() function of the current DemuxOut.
 func (demux *Demultiplexer) BodyBSON(buf []byte) error {
@@ -184,54 +212,27 @@ func (demux *Demultiplexer) Open(ns string, out DemuxOut) {
 // RegularCollectionReceiver implements the intents.file interface.
 // RegularCollectionReceivers get paired with RegularCollectionSenders.
 type RegularCollectionReceiver struct {
-	readLenChan      <-chan int
-	readBufChan      chan<- []byte
-	Intent           *intents.Intent
-	Demux            *Demultiplexer
-	partialReadArray [db.MaxBSONSize]byte
-	partialReadBuf   []byte
-	isOpen           bool
+	docChan        <-chan []byte
+	Intent         *intents.Intent
+	Demux          *Demultiplexer
+	partialReadBuf []byte
+	isOpen         bool
 }
 
+// Read is part of the intents.file interface. It copies out the documents sent by
+// the regularCollectionSender, a document at a time, caching the remainder of a
+// document that doesn't fit in r for the next Read.
 func (receiver *RegularCollectionReceiver) Read(r []byte) (int, error) {
-	if receiver.partialReadBuf != nil && len(receiver.partialReadBuf) > 0 {
-		wLen := len(receiver.partialReadBuf)
-		copyLen := copy(r, receiver.partialReadBuf)
-		if wLen == copyLen {
-			receiver.partialReadBuf = nil
-		} else {
-			receiver.partialReadBuf = receiver.partialReadBuf[copyLen:]
+	if len(receiver.partialReadBuf) == 0 {
+		doc, ok := <-receiver.docChan
+		if !ok {
+			return 0, io.EOF
 		}
-		return copyLen, nil
+		receiver.partialReadBuf = doc
 	}
-	// Since we're the "reader" here, not the "writer" we need to start with a read, in case the chan is closed
-	wLen, ok := <-receiver.readLenChan
-	if !ok {
-		close(receiver.readBufChan)
-		return 0, io.EOF
-	}
-	if wLen > db.MaxBSONSize {
-		return 0, fmt.Errorf("incomming buffer size is too big %v", wLen)
-	}
-	rLen := len(r)
-	if wLen > rLen {
-		// if the incomming write size is larger then the incomming read buffer then we need to accept
-		// the write in a larger buffer, fill the read buffer, then cache the remainder
-		receiver.partialReadBuf = receiver.partialReadArray[:wLen]
-		receiver.readBufChan <- receiver.partialReadBuf
-		writtenLength := <-receiver.readLenChan
-		if wLen != writtenLength {
-			return 0, fmt.Errorf("regularCollectionSender didn't send what it said it would")
-		}
-		copy(r, receiver.partialReadBuf)
-		receiver.partialReadBuf = receiver.partialReadBuf[rLen:]
-		return rLen, nil
-	}
-	// Send the read buff to the BodyBSON ParserConsumer to fill
-	receiver.readBufChan <- r
-	// Receiver the wLen of data written
-	wLen = <-receiver.readLenChan
-	return wLen, nil
+	copyLen := copy(r, receiver.partialReadBuf)
+	receiver.partialReadBuf = receiver.partialReadBuf[copyLen:]
+	return copyLen, nil
 }
 
 // Close is part of the intents.file interface. It currently does nothing. We can't close the
@@ -241,7 +242,7 @@ func (receiver *RegularCollectionReceiver) Close() error {
 	return nil
 }
 
-// Open is part of the intents.file interface.  It creates the chan's in the
+// Open is part of the intents.file interface.  It creates the chan in the
 // RegularCollectionReceiver and adds the RegularCollectionReceiver to the set of
 // RegularCollectonReceivers in the demultiplexer
 func (receiver *RegularCollectionReceiver) Open() error {
@@ -252,11 +253,9 @@ func (receiver *RegularCollectionReceiver) Open() error {
 	if receiver.isOpen {
 		return nil
 	}
-	readLenChan := make(chan int)
-	readBufChan := make(chan []byte)
-	receiver.readLenChan = readLenChan
-	receiver.readBufChan = readBufChan
-	sender := &regularCollectionSender{readLenChan: readLenChan, readBufChan: readBufChan}
+	docChan := make(chan []byte, receiver.Demux.NamespaceBufferSize)
+	receiver.docChan = docChan
+	sender := &regularCollectionSender{docChan: docChan}
 	receiver.Demux.Open(receiver.Intent.Namespace(), sender)
 	receiver.isOpen = true
 	return nil
@@ -270,32 +269,25 @@ func (receiver *RegularCollectionReceiver) Write([]byte) (int, error) {
 
 // regularCollectionSender implements DemuxOut
 type regularCollectionSender struct {
-	readLenChan chan<- int
-	readBufChan <-chan []byte
+	docChan chan<- []byte
 }
 
-// Write is part of the DemuxOut interface.
+// Write is part of the DemuxOut interface. The parser reuses buf, so it is copied
+// before being queued for the receiver. Once NamespaceBufferSize documents are
+// queued, Write blocks until the receiver catches up, which in turn stops the
+// parser from reading any further in to the archive.
 func (sender *regularCollectionSender) Write(buf []byte) (int, error) {
-	//  As a writer, we need to write first, so that the reader can properly detect EOF
-	//  Additionally, the reader needs to know the write size, so that it can give us a
-	//  properly sized buffer. Sending the incomming buffersize fills both of these needs.
-	sender.readLenChan <- len(buf)
-	// Receive from the reader a buffer to put the bytes into
-	readBuf := <-sender.readBufChan
-	if len(readBuf) < len(buf) {
-		return 0, fmt.Errorf("readbuf is not large enough for incoming BodyBSON (%v<%v)",
-			len(readBuf), len(buf))
-	}
-	copy(readBuf, buf)
-	// Send back the length of the data copied in to the buffer
-	sender.readLenChan <- len(buf)
+	doc := make([]byte, len(buf))
+	copy(doc, buf)
+	sender.docChan <- doc
 	return len(buf), nil
 }
 
-// Close is part of the DemuxOut interface. It only closes the readLenChan, as that is what will
-// cause the RegularCollectionReceiver.Read() to receive EOF
+// Close is part of the DemuxOut interface. It closes the docChan, which is what will
+// cause the RegularCollectionReceiver.Read() to receive EOF, once it has read all of
+// the queued documents
 func (sender *regularCollectionSender) Close() error {
-	close(sender.readLenChan)
+	close(sender.docChan)
 	return nil
 }
 
@@ -0,0 +1,322 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FS is a read-only io/fs view of an archive, laid out as the PreludeExplorer
+// explores it: like the dump directory the archive could have been made from, with
+// a directory for each database holding a .bson file for each of its collections
+// and a .metadata.json file for those with metadata. Top level collections, such
+// as the oplog, are at the root.
+//
+// The archive has no index of where each collection's documents are, so opening a
+// .bson file reads the archive's body from the start, keeping the documents of
+// that collection in memory, and the sizes of the .bson files are found by reading
+// the whole body once. Files are opened one at a time.
+type FS struct {
+	prelude   *Prelude
+	in        io.ReadSeeker
+	bodyStart int64
+	bodySizes map[string]int64
+	mutex     sync.Mutex
+}
+
+// NewFS reads the prelude of the archive in and returns an FS view of the archive.
+func NewFS(in io.ReadSeeker) (*FS, error) {
+	prelude := &Prelude{}
+	err := prelude.Read(in)
+	if err != nil {
+		return nil, err
+	}
+	// the parser reads no further than the end of the prelude
+	bodyStart, err := in.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("error finding the end of the archive prelude: %v", err)
+	}
+	return &FS{prelude: prelude, in: in, bodyStart: bodyStart}, nil
+}
+
+// Open is part of the fs.FS interface.
+func (archiveFS *FS) Open(name string) (fs.File, error) {
+	pe, err := archiveFS.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if pe.IsDir() {
+		return &fsDir{fsFile: fsFile{archiveFS: archiveFS, pe: pe}}, nil
+	}
+	var contents []byte
+	if pe.isMetadata {
+		contents, err = archiveFS.readMetadata(pe)
+	} else {
+		contents, err = archiveFS.readBody(pe)
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsFile{archiveFS: archiveFS, pe: pe, reader: bytes.NewReader(contents), size: int64(len(contents))}, nil
+}
+
+// ReadDir is part of the fs.ReadDirFS interface. The entries are sorted by name.
+func (archiveFS *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	pe, err := archiveFS.lookup(name)
+	if err == nil && !pe.IsDir() {
+		err = fmt.Errorf("not a directory")
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return archiveFS.readDir(pe)
+}
+
+// lookup finds the PreludeExplorer at the given path, returning fs.ErrNotExist if
+// there is nothing there.
+func (archiveFS *FS) lookup(name string) (*PreludeExplorer, error) {
+	if !fs.ValidPath(name) {
+		return nil, fs.ErrInvalid
+	}
+	pe, _ := archiveFS.prelude.NewPreludeExplorer()
+	if name == "." {
+		return pe, nil
+	}
+	for _, part := range strings.Split(name, "/") {
+		if !pe.IsDir() {
+			return nil, fs.ErrNotExist
+		}
+		children, err := pe.ReadDir()
+		if err != nil {
+			return nil, fs.ErrNotExist
+		}
+		found := false
+		for _, child := range children {
+			if child.Name() == part {
+				pe, found = child.(*PreludeExplorer), true
+				break
+			}
+		}
+		if !found {
+			return nil, fs.ErrNotExist
+		}
+	}
+	return pe, nil
+}
+
+func (archiveFS *FS) readDir(pe *PreludeExplorer) ([]fs.DirEntry, error) {
+	children, err := pe.ReadDir()
+	if err != nil {
+		return nil, err
+	}
+	entries := []fs.DirEntry{}
+	for _, child := range children {
+		info := &fsFileInfo{archiveFS: archiveFS, pe: child.(*PreludeExplorer)}
+		if info.pe.isMetadata {
+			metadata, err := archiveFS.readMetadata(info.pe)
+			if err != nil {
+				return nil, err
+			}
+			info.size = int64(len(metadata))
+		} else if !info.pe.IsDir() {
+			info.size, err = archiveFS.bodySize(info.pe)
+			if err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Sort(byEntryName(entries))
+	return entries, nil
+}
+
+// byEntryName sorts directory entries by name, as the io/fs interfaces require.
+type byEntryName []fs.DirEntry
+
+func (entries byEntryName) Len() int           { return len(entries) }
+func (entries byEntryName) Swap(i, j int)      { entries[i], entries[j] = entries[j], entries[i] }
+func (entries byEntryName) Less(i, j int) bool { return entries[i].Name() < entries[j].Name() }
+
+// readMetadata returns the metadata json the prelude holds for a collection.
+func (archiveFS *FS) readMetadata(pe *PreludeExplorer) ([]byte, error) {
+	mpf := &MetadataPreludeFile{
+		Intent:  &intents.Intent{DB: pe.database, C: pe.collection},
+		Prelude: archiveFS.prelude,
+	}
+	if err := mpf.Open(); err != nil {
+		return nil, fs.ErrNotExist
+	}
+	defer mpf.Close()
+	return mpf.Bytes(), nil
+}
+
+// readBody reads the body of the archive from the start, returning the
+// documents of the collection concatenated as they would be in a .bson file.
+func (archiveFS *FS) readBody(pe *PreludeExplorer) ([]byte, error) {
+	archiveFS.mutex.Lock()
+	defer archiveFS.mutex.Unlock()
+	collector := &bodyCollector{db: pe.database, collection: pe.collection}
+	if err := archiveFS.readAllBlocks(collector); err != nil {
+		return nil, err
+	}
+	return collector.body.Bytes(), nil
+}
+
+// bodySize returns the size of the collection's .bson file. The sizes of all of
+// the collections are found the first time.
+func (archiveFS *FS) bodySize(pe *PreludeExplorer) (int64, error) {
+	archiveFS.mutex.Lock()
+	defer archiveFS.mutex.Unlock()
+	if archiveFS.bodySizes == nil {
+		collector := &bodyCollector{sizes: map[string]int64{}}
+		if err := archiveFS.readAllBlocks(collector); err != nil {
+			return 0, err
+		}
+		archiveFS.bodySizes = collector.sizes
+	}
+	return archiveFS.bodySizes[pe.database+"."+pe.collection], nil
+}
+
+// readAllBlocks reads the body of the archive from the start, passing its blocks to consumer.
+func (archiveFS *FS) readAllBlocks(consumer ParserConsumer) error {
+	if _, err := archiveFS.in.Seek(archiveFS.bodyStart, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking to the start of the archive body: %v", err)
+	}
+	parser := Parser{In: archiveFS.in}
+	return parser.ReadAllBlocks(consumer)
+}
+
+// bodyCollector is a ParserConsumer that keeps the body documents of one collection,
+// or, if it has sizes, adds up the size of the body documents of every collection.
+type bodyCollector struct {
+	db, collection string
+	sizes          map[string]int64
+	inCollection   bool
+	body           bytes.Buffer
+}
+
+// HeaderBSON is part of the ParserConsumer interface.
+func (collector *bodyCollector) HeaderBSON(buf []byte) error {
+	colHeader := NamespaceHeader{}
+	err := bson.Unmarshal(buf, &colHeader)
+	if err != nil {
+		return newWrappedError("header bson doesn't unmarshal as a collection header", err)
+	}
+	if collector.sizes != nil {
+		collector.db, collector.collection = colHeader.Database, colHeader.Collection
+	}
+	collector.inCollection = !colHeader.EOF &&
+		colHeader.Database == collector.db && colHeader.Collection == collector.collection
+	return nil
+}
+
+// BodyBSON is part of the ParserConsumer interface.
+func (collector *bodyCollector) BodyBSON(buf []byte) error {
+	switch {
+	case !collector.inCollection:
+	case collector.sizes != nil:
+		collector.sizes[collector.db+"."+collector.collection] += int64(len(buf))
+	default:
+		collector.body.Write(buf)
+	}
+	return nil
+}
+
+// End is part of the ParserConsumer interface.
+func (collector *bodyCollector) End() error {
+	return nil
+}
+
+// fsFileInfo is the fs.FileInfo of a PreludeExplorer. Files and directories have
+// the time the archive was dumped as their modification time, if it's known.
+type fsFileInfo struct {
+	archiveFS *FS
+	pe        *PreludeExplorer
+	size      int64
+}
+
+func (info *fsFileInfo) Name() string {
+	if info.pe.database == "" && info.pe.collection == "" {
+		return "."
+	}
+	return info.pe.Name()
+}
+
+func (info *fsFileInfo) Size() int64 { return info.size }
+
+func (info *fsFileInfo) Mode() fs.FileMode {
+	if info.pe.IsDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (info *fsFileInfo) ModTime() time.Time {
+	dumpTime, _ := info.archiveFS.prelude.DumpTime()
+	return dumpTime
+}
+
+func (info *fsFileInfo) IsDir() bool      { return info.pe.IsDir() }
+func (info *fsFileInfo) Sys() interface{} { return nil }
+
+// fsFile is an opened file of an FS, read from memory.
+type fsFile struct {
+	archiveFS *FS
+	pe        *PreludeExplorer
+	reader    *bytes.Reader
+	size      int64
+}
+
+func (file *fsFile) Stat() (fs.FileInfo, error) {
+	return &fsFileInfo{archiveFS: file.archiveFS, pe: file.pe, size: file.size}, nil
+}
+
+func (file *fsFile) Read(p []byte) (int, error) {
+	if file.reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: file.pe.Path(), Err: fmt.Errorf("is a directory")}
+	}
+	return file.reader.Read(p)
+}
+
+func (file *fsFile) Close() error {
+	return nil
+}
+
+// fsDir is an opened directory of an FS.
+type fsDir struct {
+	fsFile
+	entries []fs.DirEntry
+	read    bool
+}
+
+// ReadDir is part of the fs.ReadDirFile interface.
+func (dir *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !dir.read {
+		entries, err := dir.archiveFS.readDir(dir.pe)
+		if err != nil {
+			return nil, err
+		}
+		dir.entries, dir.read = entries, true
+	}
+	if n <= 0 {
+		entries := dir.entries
+		dir.entries = nil
+		return entries, nil
+	}
+	if len(dir.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(dir.entries) {
+		n = len(dir.entries)
+	}
+	entries := dir.entries[:n]
+	dir.entries = dir.entries[n:]
+	return entries, nil
+}
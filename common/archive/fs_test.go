@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+
+	Convey("With an archive of two databases and a top level oplog", t, func() {
+		collections := []*CollectionMetadata{
+			{Database: "", Collection: "oplog"},
+			{Database: "db1", Collection: "c1", Metadata: `{"indexes":[]}`},
+			{Database: "db1", Collection: "c2"},
+			{Database: "db2", Collection: "c1", Metadata: `{"options":{"capped":true},"indexes":[]}`},
+		}
+		buf := writeTestArchive(collections, []testBlock{
+			{db: "db1", collection: "c1", docs: 2},
+			{db: "db2", collection: "c1", docs: 3},
+			{db: "db1", collection: "c1", docs: 1},
+			{db: "db1", collection: "c1", eof: true},
+			{db: "db2", collection: "c1", eof: true},
+		})
+		archiveFS, err := NewFS(bytes.NewReader(buf.Bytes()))
+		So(err, ShouldBeNil)
+
+		Convey("fs.WalkDir should find the files of a dump directory", func() {
+			paths := []string{}
+			err := fs.WalkDir(archiveFS, ".", func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if entry.IsDir() {
+					path += "/"
+				}
+				paths = append(paths, path)
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(paths, ShouldResemble, []string{
+				"./",
+				"db1/",
+				"db1/c1.bson",
+				"db1/c1.metadata.json",
+				"db1/c2.bson",
+				"db2/",
+				"db2/c1.bson",
+				"db2/c1.metadata.json",
+				"oplog.bson",
+			})
+		})
+
+		Convey("a .bson file should hold the documents of its collection", func() {
+			contents, err := fs.ReadFile(archiveFS, "db1/c1.bson")
+			So(err, ShouldBeNil)
+			entries, err := archiveFS.ReadDir("db1")
+			So(err, ShouldBeNil)
+			So(entries[0].Name(), ShouldEqual, "c1.bson")
+			info, err := entries[0].Info()
+			So(err, ShouldBeNil)
+			So(info.Size(), ShouldEqual, len(contents))
+
+			count := 0
+			for len(contents) > 0 {
+				doc := bson.M{}
+				size := int(contents[0]) | int(contents[1])<<8 | int(contents[2])<<16 | int(contents[3])<<24
+				So(bson.Unmarshal(contents[:size], &doc), ShouldBeNil)
+				So(doc["ns"], ShouldEqual, "db1.c1")
+				contents = contents[size:]
+				count++
+			}
+			So(count, ShouldEqual, 3)
+
+			contents, err = fs.ReadFile(archiveFS, "db1/c2.bson")
+			So(err, ShouldBeNil)
+			So(contents, ShouldBeEmpty)
+		})
+
+		Convey("a .metadata.json file should hold the metadata from the prelude", func() {
+			file, err := archiveFS.Open("db2/c1.metadata.json")
+			So(err, ShouldBeNil)
+			contents, err := ioutil.ReadAll(file)
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, `{"options":{"capped":true},"indexes":[]}`)
+			info, err := file.Stat()
+			So(err, ShouldBeNil)
+			So(info.Name(), ShouldEqual, "c1.metadata.json")
+			So(info.Size(), ShouldEqual, len(contents))
+			So(file.Close(), ShouldBeNil)
+		})
+
+		Convey("the view should behave as the io/fs interfaces require", func() {
+			So(fstest.TestFS(archiveFS, "db1/c1.bson", "db2/c1.metadata.json", "oplog.bson"), ShouldBeNil)
+		})
+
+		Convey("missing and invalid paths should be errors", func() {
+			for _, path := range []string{"db3", "db1/c3.bson", "db2/c1.bson/x", "/db1", "db1/../db2"} {
+				_, err := archiveFS.Open(path)
+				So(err, ShouldNotBeNil)
+			}
+			_, err := archiveFS.ReadDir("db1/c1.bson")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -11,7 +11,9 @@ import (
 	"hash/crc32"
 	"io"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var testIntents = []*intents.Intent{
@@ -256,3 +258,158 @@ func TestParallelMux(t *testing.T) {
 	})
 	return
 }
+
+// countingDemuxOut wraps a DemuxOut and keeps track of the number of bytes written
+// to it that have not yet been read back out
+type countingDemuxOut struct {
+	DemuxOut
+	outstanding    *int64
+	maxOutstanding *int64
+}
+
+func (out *countingDemuxOut) Write(buf []byte) (int, error) {
+	n, err := out.DemuxOut.Write(buf)
+	current := atomic.AddInt64(out.outstanding, int64(n))
+	for {
+		max := atomic.LoadInt64(out.maxOutstanding)
+		if current <= max || atomic.CompareAndSwapInt64(out.maxOutstanding, max, current) {
+			break
+		}
+	}
+	return n, err
+}
+
+func TestDemuxBackpressure(t *testing.T) {
+
+	Convey("with an archive containing a slow and a fast collection", t, func() {
+		buf := &closingBuffer{bytes.Buffer{}}
+		mux := NewMultiplexer(buf)
+		go mux.Run()
+
+		slow, fast := testIntents[0], testIntents[1]
+		maxDocSize := 0
+		for _, dbc := range []*intents.Intent{slow, fast} {
+			muxIn := &MuxIn{Intent: dbc, Mux: mux}
+			So(muxIn.Open(), ShouldBeNil)
+			for i := 0; i < 500; i++ {
+				bsonBytes, _ := bson.Marshal(testDoc{Bar: i, Baz: dbc.Namespace()})
+				if len(bsonBytes) > maxDocSize {
+					maxDocSize = len(bsonBytes)
+				}
+				_, err := muxIn.Write(bsonBytes)
+				So(err, ShouldBeNil)
+			}
+			So(muxIn.Close(), ShouldBeNil)
+		}
+		close(mux.Control)
+		So(<-mux.Completed, ShouldBeNil)
+
+		Convey("the demultiplexer should not buffer more than NamespaceBufferSize documents", func() {
+			demux := &Demultiplexer{In: buf, NamespaceBufferSize: 4}
+			var outstanding, maxOutstanding int64
+			errChan := make(chan error)
+			for _, dbc := range []*intents.Intent{slow, fast} {
+				receiver := &RegularCollectionReceiver{Intent: dbc, Demux: demux}
+				So(receiver.Open(), ShouldBeNil)
+				ns := dbc.Namespace()
+				if dbc == slow {
+					demux.outs[ns] = &countingDemuxOut{
+						DemuxOut:       demux.outs[ns],
+						outstanding:    &outstanding,
+						maxOutstanding: &maxOutstanding,
+					}
+				}
+				isSlow := dbc == slow
+				go func() {
+					bs := make([]byte, db.MaxBSONSize)
+					for {
+						length, err := receiver.Read(bs)
+						if err == io.EOF {
+							errChan <- nil
+							return
+						}
+						if err != nil {
+							errChan <- err
+							return
+						}
+						if isSlow {
+							atomic.AddInt64(&outstanding, -int64(length))
+							time.Sleep(time.Millisecond)
+						}
+					}
+				}()
+			}
+			So(demux.Run(), ShouldBeNil)
+			So(<-errChan, ShouldBeNil)
+			So(<-errChan, ShouldBeNil)
+			So(maxOutstanding, ShouldBeGreaterThan, 0)
+			So(maxOutstanding, ShouldBeLessThanOrEqualTo, (demux.NamespaceBufferSize+1)*maxDocSize)
+		})
+	})
+}
+
+// muxedBlocks returns the archive blocks of a collection holding n documents
+func muxedBlocks(intent *intents.Intent, n int) []byte {
+	buf := &closingBuffer{bytes.Buffer{}}
+	mux := NewMultiplexer(buf)
+	go mux.Run()
+	muxIn := &MuxIn{Intent: intent, Mux: mux}
+	So(muxIn.Open(), ShouldBeNil)
+	for i := 0; i < n; i++ {
+		bsonBytes, _ := bson.Marshal(testDoc{Bar: i, Baz: intent.Namespace()})
+		_, err := muxIn.Write(bsonBytes)
+		So(err, ShouldBeNil)
+	}
+	So(muxIn.Close(), ShouldBeNil)
+	close(mux.Control)
+	So(<-mux.Completed, ShouldBeNil)
+	return buf.Bytes()
+}
+
+func TestDemuxCorruptBlock(t *testing.T) {
+
+	Convey("with an archive of three collections and a demultiplexer given its prelude", t, func() {
+		prelude := &Prelude{}
+		blocks := [][]byte{}
+		for _, dbc := range testIntents[:3] {
+			prelude.AddMetadata(&CollectionMetadata{Database: dbc.DB, Collection: dbc.C})
+			blocks = append(blocks, muxedBlocks(dbc, 10))
+		}
+		demux := &Demultiplexer{Prelude: prelude}
+		// only the first collection is opened up front, as mongorestore opens the
+		// others once the demultiplexer reaches them
+		demux.Open(testIntents[0].Namespace(), &MutedCollection{Intent: testIntents[0], Demux: demux})
+
+		Convey("an intact archive should be demultiplexed", func() {
+			for _, dbc := range testIntents[1:3] {
+				demux.Open(dbc.Namespace(), &MutedCollection{Intent: dbc, Demux: demux})
+			}
+			demux.In = bytes.NewReader(bytes.Join(blocks, nil))
+			So(demux.Run(), ShouldBeNil)
+			So(demux.Complete(), ShouldBeTrue)
+		})
+		Convey("a bad length at the start of the second collection should be an error", func() {
+			copy(blocks[1], []byte{0x01, 0x02, 0x03, 0x04})
+			demux.In = bytes.NewReader(bytes.Join(blocks, nil))
+			err := demux.Run()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "neither a valid bson length nor a archive terminator")
+			So(demux.Complete(), ShouldBeFalse)
+		})
+		Convey("a terminator before the second collection should be an error", func() {
+			blocks[1] = append([]byte{0xFF, 0xFF, 0xFF, 0xFF}, blocks[1]...)
+			demux.In = bytes.NewReader(bytes.Join(blocks, nil))
+			err := demux.Run()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "consecutive terminators")
+		})
+		Convey("trailing bytes after the last collection should only cause a warning", func() {
+			for _, dbc := range testIntents[1:3] {
+				demux.Open(dbc.Namespace(), &MutedCollection{Intent: dbc, Demux: demux})
+			}
+			blocks = append(blocks, []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06})
+			demux.In = bytes.NewReader(bytes.Join(blocks, nil))
+			So(demux.Run(), ShouldBeNil)
+		})
+	})
+}
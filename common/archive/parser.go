@@ -3,7 +3,9 @@ package archive
 import (
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
 	"io"
+	"io/ioutil"
 )
 
 // parser.go implements the parsing of the low-level archive format
@@ -20,16 +22,41 @@ type ParserConsumer interface {
 	End() error
 }
 
+// ParserCompleter can be implemented by a ParserConsumer that knows when it has
+// been given everything the archive holds. Data that doesn't start a new block is
+// only treated as trailing bytes once the consumer is complete, and is a parser
+// error before that.
+type ParserCompleter interface {
+	Complete() bool
+}
+
+// ProgressReporter can be given to a Parser to follow how much of the archive it has read.
+type ProgressReporter interface {
+	// ParserProgress is called after each BSON document or terminator is read,
+	// with the total number of bytes, and of complete blocks, read so far.
+	ParserProgress(bytesRead int64, blocksRead int)
+}
+
 // Parser encapsulates the small amount of state that the parser needs to keep
 type Parser struct {
-	In     io.Reader
-	buf    [db.MaxBSONSize]byte
-	length int
+	In io.Reader
+	// StrictEnd causes bytes following the last complete block to be an error,
+	// rather than a warning
+	StrictEnd bool
+	// Progress, if set, is told how far the parser has read as it reads each block
+	Progress   ProgressReporter
+	buf        [db.MaxBSONSize]byte
+	length     int
+	blocksRead int
+	bytesRead  int64
 }
 
 type parserError struct {
 	Err error
 	Msg string
+	// notBSON is set when the data read doesn't start with a bson length, so
+	// isn't a corrupt document but no document at all
+	notBSON bool
 }
 
 // Error is part of the Error interface. It formats a parserError for human readability.
@@ -62,13 +89,13 @@ func newParserWrappedError(msg string, err error) error {
 // then the remainder of the BSON document are read in to the parser, otherwise
 // an error is returned.
 func (parse *Parser) readBSONOrTerminator() (isTerminator bool, err error) {
-	parse.length = 0
-	_, err = io.ReadFull(parse.In, parse.buf[0:4])
+	parse.length, err = io.ReadFull(parse.In, parse.buf[0:4])
 	if err == io.EOF {
 		return false, err
 	}
 	if err != nil {
-		return false, newParserWrappedError("I/O error reading length or terminator", err)
+		return false, &parserError{Err: err, Msg: "I/O error reading length or terminator",
+			notBSON: err == io.ErrUnexpectedEOF}
 	}
 	size := int32(
 		(uint32(parse.buf[0]) << 0) |
@@ -77,15 +104,18 @@ func (parse *Parser) readBSONOrTerminator() (isTerminator bool, err error) {
 			(uint32(parse.buf[3]) << 24),
 	)
 	if size == terminator {
+		parse.bytesRead += 4
 		return true, nil
 	}
 	if size < minBSONSize || size > db.MaxBSONSize {
-		return false, newParserError(fmt.Sprintf("%v is neither a valid bson length nor a archive terminator", size))
+		return false, &parserError{Msg: fmt.Sprintf("%v is neither a valid bson length nor a archive terminator", size),
+			notBSON: true}
 	}
 	// TODO Because we're reusing this same buffer for all of our IO, we are basically guaranteeing that we'll
 	// copy the bytes twice.  At some point we should fix this. It's slightly complex, because we'll need consumer
 	// methods closing one buffer and acquiring another
-	_, err = io.ReadFull(parse.In, parse.buf[4:size])
+	n, err := io.ReadFull(parse.In, parse.buf[4:size])
+	parse.length += n
 	if err != nil {
 		// any error, including EOF is an error so we wrap it up
 		return false, newParserWrappedError("read bson", err)
@@ -94,9 +124,17 @@ func (parse *Parser) readBSONOrTerminator() (isTerminator bool, err error) {
 		return false, newParserError(fmt.Sprintf("bson (size: %v, byte: %d) doesn't end with a null byte", size, parse.buf[size-1]))
 	}
 	parse.length = int(size)
+	parse.bytesRead += int64(size)
 	return false, nil
 }
 
+// reportProgress tells the parser's ProgressReporter, if it has one, how far it has read.
+func (parse *Parser) reportProgress() {
+	if parse.Progress != nil {
+		parse.Progress.ParserProgress(parse.bytesRead, parse.blocksRead)
+	}
+}
+
 // ReadAllBlocks calls ReadBlock() until it returns an error.
 // If the error is EOF, then nil is returned, otherwise it returns the error
 func (parse *Parser) ReadAllBlocks(consumer ParserConsumer) (err error) {
@@ -115,7 +153,10 @@ func (parse *Parser) ReadAllBlocks(consumer ParserConsumer) (err error) {
 // It returns nil if a whole block was read, io.EOF if nothing was read,
 // and a parserError if there was any io error in the middle of the block,
 // if either of the consumer methods return error, or if there was any sort of
-// parsing failure.
+// parsing failure. Data that doesn't start a new block, because it is a terminator
+// or doesn't start with a bson length, is treated as trailing bytes, see
+// readTrailingBytes, if the consumer is a ParserCompleter that is complete.
+// Otherwise it, like a corrupt bson document, is an error.
 func (parse *Parser) ReadBlock(consumer ParserConsumer) (err error) {
 	isTerminator, err := parse.readBSONOrTerminator()
 	if err == io.EOF {
@@ -125,6 +166,11 @@ func (parse *Parser) ReadBlock(consumer ParserConsumer) (err error) {
 		}
 		return err
 	}
+	if (isTerminator || isNotBSON(err)) && isComplete(consumer) {
+		// the consumer already has everything the archive holds,
+		// so whatever we just read is not part of the archive
+		return parse.readTrailingBytes(consumer)
+	}
 	if err != nil {
 		return err
 	}
@@ -135,17 +181,68 @@ func (parse *Parser) ReadBlock(consumer ParserConsumer) (err error) {
 	if err != nil {
 		return newParserWrappedError("ParserConsumer.HeaderBSON()", err)
 	}
+	parse.reportProgress()
+	return parse.readBody(consumer)
+}
+
+// ResumeBlock reads the rest of a block whose header, and possibly part of whose
+// body, was already read, such as by a Parser that failed part way through the
+// block. In must be positioned at the start of a body BSON or of the terminator.
+func (parse *Parser) ResumeBlock(consumer ParserConsumer) error {
+	return parse.readBody(consumer)
+}
+
+// readBody reads the body BSONs of a block up to and including its terminator,
+// calling consumer.BodyBSON() on each.
+func (parse *Parser) readBody(consumer ParserConsumer) error {
 	for {
-		isTerminator, err = parse.readBSONOrTerminator()
+		isTerminator, err := parse.readBSONOrTerminator()
 		if err != nil { // all errors, including EOF are errors here
 			return newParserWrappedError("ParserConsumer.BodyBSON()", err)
 		}
 		if isTerminator {
+			parse.blocksRead++
+			parse.reportProgress()
 			return nil
 		}
 		err = consumer.BodyBSON(parse.buf[:parse.length])
 		if err != nil {
 			return newParserWrappedError("ParserConsumer.BodyBSON()", err)
 		}
+		parse.reportProgress()
+	}
+}
+
+// isComplete returns true if consumer is a ParserCompleter that has been given
+// everything the archive holds
+func isComplete(consumer ParserConsumer) bool {
+	completer, ok := consumer.(ParserCompleter)
+	return ok && completer.Complete()
+}
+
+// isNotBSON returns true if err came from data that doesn't start with a bson
+// length, as opposed to from a corrupt document or a failure of the underlying reader
+func isNotBSON(err error) bool {
+	pe, ok := err.(*parserError)
+	return ok && pe.notBSON
+}
+
+// readTrailingBytes consumes the rest of the input after the last complete block.
+// The trailing bytes are reported as an error if StrictEnd is set. Otherwise a
+// warning is logged and the consumer is ended as if EOF was reached.
+func (parse *Parser) readTrailingBytes(consumer ParserConsumer) error {
+	n, err := io.Copy(ioutil.Discard, parse.In)
+	if err != nil {
+		return newParserWrappedError("I/O error reading trailing bytes", err)
+	}
+	n += int64(parse.length)
+	if parse.StrictEnd {
+		return newParserError(fmt.Sprintf("%v trailing bytes after archive terminator", n))
+	}
+	log.Logf(log.Always, "warning: %v trailing bytes after archive terminator", n)
+	err = consumer.End()
+	if err != nil {
+		return newParserWrappedError("ParserConsumer.End", err)
 	}
+	return io.EOF
 }
@@ -13,6 +13,8 @@ type testConsumer struct {
 	headers []string // header data
 	bodies  []string // body data
 	eof     bool
+	// complete is what Complete returns
+	complete bool
 }
 
 func (tc *testConsumer) HeaderBSON(b []byte) error {
@@ -37,6 +39,10 @@ func (tc *testConsumer) End() (err error) {
 	return err
 }
 
+func (tc *testConsumer) Complete() bool {
+	return tc.complete
+}
+
 type strStruct struct {
 	Str string
 }
@@ -144,6 +150,85 @@ func TestParsing(t *testing.T) {
 			So(tc.headers[0], ShouldEqual, "header")
 			So(tc.bodies, ShouldBeNil)
 		})
+		Convey("trailing bytes after the last block", func() {
+			buf := bytes.Buffer{}
+			b, _ := bson.Marshal(strStruct{"header"})
+			buf.Write(b)
+			b, _ = bson.Marshal(strStruct{"body"})
+			buf.Write(b)
+			buf.Write(term)
+			buf.Write([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06})
+			parser.In = &buf
+			tc.complete = true
+			Convey("should only cause a warning by default", func() {
+				err := parser.ReadAllBlocks(tc)
+				So(err, ShouldBeNil)
+				So(tc.eof, ShouldBeTrue)
+				So(tc.bodies[0], ShouldEqual, "body")
+			})
+			Convey("should cause an error with StrictEnd", func() {
+				parser.StrictEnd = true
+				err := parser.ReadAllBlocks(tc)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "6 trailing bytes after archive terminator")
+				So(tc.eof, ShouldBeFalse)
+			})
+		})
+		Convey("a corrupt block after the last complete block", func() {
+			buf := bytes.Buffer{}
+			b, _ := bson.Marshal(strStruct{"header"})
+			buf.Write(b)
+			buf.Write(term)
+			// a header whose length is valid, but which was cut short
+			b, _ = bson.Marshal(strStruct{"header"})
+			buf.Write(b[:len(b)-3])
+			parser.In = &buf
+			tc.complete = true
+			Convey("should still be an error by default", func() {
+				err := parser.ReadAllBlocks(tc)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "read bson")
+				So(tc.eof, ShouldBeFalse)
+			})
+		})
+		Convey("a double terminator after the last block", func() {
+			buf := bytes.Buffer{}
+			b, _ := bson.Marshal(strStruct{"header"})
+			buf.Write(b)
+			buf.Write(term)
+			buf.Write(term)
+			parser.In = &buf
+			tc.complete = true
+			Convey("should only cause a warning by default", func() {
+				err := parser.ReadAllBlocks(tc)
+				So(err, ShouldBeNil)
+				So(tc.eof, ShouldBeTrue)
+			})
+			Convey("should cause an error with StrictEnd", func() {
+				parser.StrictEnd = true
+				err := parser.ReadAllBlocks(tc)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "4 trailing bytes after archive terminator")
+			})
+		})
+		Convey("a double terminator before the consumer is complete", func() {
+			buf := bytes.Buffer{}
+			b, _ := bson.Marshal(strStruct{"header"})
+			buf.Write(b)
+			buf.Write(term)
+			buf.Write(term)
+			b, _ = bson.Marshal(strStruct{"header"})
+			buf.Write(b)
+			buf.Write(term)
+			parser.In = &buf
+			Convey("should be an error", func() {
+				err := parser.ReadAllBlocks(tc)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "consecutive terminators")
+				So(tc.eof, ShouldBeFalse)
+				So(len(tc.headers), ShouldEqual, 1)
+			})
+		})
 	})
 	return
 }
@@ -8,6 +8,8 @@ import (
 	"gopkg.in/mgo.v2/bson"
 	"io"
 	"path/filepath"
+	"strconv"
+	"time"
 )
 
 //MetadataFile implements intents.file
@@ -41,11 +43,74 @@ type Prelude struct {
 	DBS                    []string
 	NamespaceMetadatas     []*CollectionMetadata
 	NamespaceMetadatasByDB map[string][]*CollectionMetadata
+
+	// ClassifyTopLevel, if set, replaces DefaultClassifyTopLevel when exploring the prelude.
+	ClassifyTopLevel func(collection string) TopLevelKind
+
+	// Progress, if set, is told how much of the prelude has been read while reading it.
+	Progress ProgressReporter
+
+	// MagicNumber, if set, replaces the package's MagicNumber, and any
+	// MagicNumberOverride, as the number archives are written with and must be read
+	// with, so that a fork's archives are told apart from upstream ones.
+	MagicNumber uint32
+}
+
+// magicNumber returns the magic number the prelude is read and written with.
+func (prelude *Prelude) magicNumber() (uint32, error) {
+	if prelude.MagicNumber != 0 {
+		return prelude.MagicNumber, nil
+	}
+	if MagicNumberOverride != "" {
+		magicNumber, err := strconv.ParseUint(MagicNumberOverride, 0, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid archive magic number override %q: %v", MagicNumberOverride, err)
+		}
+		return uint32(magicNumber), nil
+	}
+	return MagicNumber, nil
+}
+
+// TopLevelKind classifies the collections an archive stores in the empty ("") database.
+// These are the collections that mongodump writes to the top level of a dump directory,
+// rather than to the directory of a database.
+type TopLevelKind int
+
+const (
+	// NotTopLevel is the kind of everything that belongs to a database.
+	NotTopLevel TopLevelKind = iota
+	// TopLevelOplog is the oplog captured by mongodump --oplog, to be replayed by --oplogReplay.
+	TopLevelOplog
+	// TopLevelCollection is any other top level collection.
+	TopLevelCollection
+)
+
+// DefaultClassifyTopLevel classifies the "oplog" collection as the oplog,
+// and every other top level collection as a TopLevelCollection.
+func DefaultClassifyTopLevel(collection string) TopLevelKind {
+	if collection == "oplog" {
+		return TopLevelOplog
+	}
+	return TopLevelCollection
+}
+
+// classifyTopLevel classifies a collection of the empty database with the prelude's predicate.
+func (prelude *Prelude) classifyTopLevel(collection string) TopLevelKind {
+	if prelude.ClassifyTopLevel != nil {
+		return prelude.ClassifyTopLevel(collection)
+	}
+	return DefaultClassifyTopLevel(collection)
 }
 
 // Read consumes and checks the magic number at the beginning of the archive,
 // then it runs the parser with a Prelude as its consumer.
 func (prelude *Prelude) Read(in io.Reader) error {
+	return prelude.ReadWithCallback(in, nil)
+}
+
+// ReadWithCallback is like Read, but also calls cb with each CollectionMetadata
+// as soon as it is read from the archive, if cb is non-nil.
+func (prelude *Prelude) ReadWithCallback(in io.Reader, cb func(*CollectionMetadata)) error {
 	readMagicNumberBuf := make([]byte, 4)
 	_, err := io.ReadAtLeast(in, readMagicNumberBuf, 4)
 	if err != nil {
@@ -58,7 +123,11 @@ func (prelude *Prelude) Read(in io.Reader) error {
 			(uint32(readMagicNumberBuf[3]) << 24),
 	)
 
-	if readMagicNumber != MagicNumber {
+	magicNumber, err := prelude.magicNumber()
+	if err != nil {
+		return err
+	}
+	if readMagicNumber != magicNumber {
 		return fmt.Errorf("stream or file does not apear to be a mongodump archive")
 	}
 
@@ -66,17 +135,42 @@ func (prelude *Prelude) Read(in io.Reader) error {
 		prelude.NamespaceMetadatasByDB = make(map[string][]*CollectionMetadata, 0)
 	}
 
-	parser := Parser{In: in}
-	parserConsumer := &preludeParserConsumer{prelude: prelude}
+	parser := Parser{In: in, Progress: prelude.Progress}
+	parserConsumer := &preludeParserConsumer{prelude: prelude, onMetadata: cb}
 	return parser.ReadBlock(parserConsumer)
 }
 
+// ResumeRead continues a Read of the prelude from a seekable input that failed part
+// way through, keeping the metadata already read. The offset is the last number of
+// bytes read that was reported to the prelude's Progress, which is always at the end
+// of the header or of a CollectionMetadata. If the prelude has no header yet, because
+// the read failed before it or the prelude is not the one that was being read, the
+// prelude is read again from the start.
+func (prelude *Prelude) ResumeRead(in io.ReadSeeker, offset int64) error {
+	if offset <= 0 || prelude.Header == nil {
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("error seeking to the beginning of archive: %v", err)
+		}
+		return prelude.Read(in)
+	}
+	// the offsets reported by the parser don't include the magic number
+	if _, err := in.Seek(offset+4, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking to offset %v of archive prelude: %v", offset, err)
+	}
+	parser := Parser{In: in, Progress: prelude.Progress, bytesRead: offset}
+	return parser.ResumeBlock(&preludeParserConsumer{prelude: prelude})
+}
+
 // NewPrelude generates a Prelude using the contents of an intent.Manager.
-func NewPrelude(manager *intents.Manager, maxProcs int) (*Prelude, error) {
+// The serverVersion, from the buildInfo of the server being dumped, may be
+// empty if it isn't known.
+func NewPrelude(manager *intents.Manager, maxProcs int, serverVersion string) (*Prelude, error) {
 	prelude := Prelude{
 		Header: &Header{
 			FormatVersion:         archiveFormatVersion,
 			ConcurrentCollections: int32(maxProcs),
+			DumpTimestamp:         time.Now(),
+			SourceServerVersion:   serverVersion,
 		},
 		NamespaceMetadatasByDB: make(map[string][]*CollectionMetadata, 0),
 	}
@@ -102,6 +196,25 @@ func NewPrelude(manager *intents.Manager, maxProcs int) (*Prelude, error) {
 	return &prelude, nil
 }
 
+// DumpTime returns the time at which the archive was produced. The bool is false
+// if the archive header doesn't record it, as is the case with older archives.
+func (prelude *Prelude) DumpTime() (time.Time, bool) {
+	if prelude.Header == nil || prelude.Header.DumpTimestamp.IsZero() {
+		return time.Time{}, false
+	}
+	return prelude.Header.DumpTimestamp, true
+}
+
+// SourceServerVersion returns the version of the server the archive was dumped
+// from. The bool is false if the archive header doesn't record it, as is the case
+// with older archives.
+func (prelude *Prelude) SourceServerVersion() (string, bool) {
+	if prelude.Header == nil || prelude.Header.SourceServerVersion == "" {
+		return "", false
+	}
+	return prelude.Header.SourceServerVersion, true
+}
+
 // AddMetadata adds a metadata data structure to a prelude and does the required bookkeeping.
 func (prelude *Prelude) AddMetadata(cm *CollectionMetadata) {
 	prelude.NamespaceMetadatas = append(prelude.NamespaceMetadatas, cm)
@@ -118,11 +231,15 @@ func (prelude *Prelude) AddMetadata(cm *CollectionMetadata) {
 
 // Write writes the archive header.
 func (prelude *Prelude) Write(out io.Writer) error {
+	magicNumber, err := prelude.magicNumber()
+	if err != nil {
+		return err
+	}
 	magicNumberBytes := make([]byte, 4)
 	for i := range magicNumberBytes {
-		magicNumberBytes[i] = byte(uint32(MagicNumber) >> uint(i*8))
+		magicNumberBytes[i] = byte(magicNumber >> uint(i*8))
 	}
-	_, err := out.Write(magicNumberBytes)
+	_, err = out.Write(magicNumberBytes)
 	if err != nil {
 		return err
 	}
@@ -153,7 +270,8 @@ func (prelude *Prelude) Write(out io.Writer) error {
 
 // preludeParserConsumer wraps a Prelude, and implements ParserConsumer.
 type preludeParserConsumer struct {
-	prelude *Prelude
+	prelude    *Prelude
+	onMetadata func(*CollectionMetadata)
 }
 
 // HeaderBSON is part of the ParserConsumer interface, it unmarshals archive Headers.
@@ -174,6 +292,9 @@ func (hpc *preludeParserConsumer) BodyBSON(data []byte) error {
 		return err
 	}
 	hpc.prelude.AddMetadata(cm)
+	if hpc.onMetadata != nil {
+		hpc.onMetadata(cm)
+	}
 	return nil
 }
 
@@ -235,6 +356,15 @@ func (pe *PreludeExplorer) Size() int64 {
 	return 0
 }
 
+// TopLevelKind returns how the collection at the pe's "location" should be restored.
+// It returns NotTopLevel for collections that belong to a database and for directories.
+func (pe *PreludeExplorer) TopLevelKind() TopLevelKind {
+	if pe.database != "" || pe.collection == "" {
+		return NotTopLevel
+	}
+	return pe.prelude.classifyTopLevel(pe.collection)
+}
+
 // IsDir is part of the DirLike interface. All pes that are not collections are Dirs.
 func (pe *PreludeExplorer) IsDir() bool {
 	return pe.collection == ""
@@ -261,26 +391,27 @@ func (pe *PreludeExplorer) ReadDir() ([]DirLike, error) {
 	pes := []DirLike{}
 	if pe.database == "" {
 		// when reading the top level of the archive, we need return all of the
-		// collections that are not bound to a database, aka, the oplog, and then all of
-		// the databases the prelude stores all top-level collections as collections in
-		// the "" database
-		topLevelNamespaceMetadatas, ok := pe.prelude.NamespaceMetadatasByDB[""]
-		if ok {
-			for _, topLevelNamespaceMetadata := range topLevelNamespaceMetadatas {
+		// collections that are not bound to a database, and then all of the databases.
+		// The prelude stores all top-level collections as collections in the "" database,
+		// which is not a database directory of its own. Whether a top level collection is
+		// the oplog to replay or some other collection is up to prelude.classifyTopLevel.
+		for _, topLevelNamespaceMetadata := range pe.prelude.NamespaceMetadatasByDB[""] {
+			pes = append(pes, &PreludeExplorer{
+				prelude:    pe.prelude,
+				collection: topLevelNamespaceMetadata.Collection,
+			})
+			if topLevelNamespaceMetadata.Metadata != "" {
 				pes = append(pes, &PreludeExplorer{
 					prelude:    pe.prelude,
 					collection: topLevelNamespaceMetadata.Collection,
+					isMetadata: true,
 				})
-				if topLevelNamespaceMetadata.Metadata != "" {
-					pes = append(pes, &PreludeExplorer{
-						prelude:    pe.prelude,
-						collection: topLevelNamespaceMetadata.Collection,
-						isMetadata: true,
-					})
-				}
 			}
 		}
 		for _, db := range pe.prelude.DBS {
+			if db == "" {
+				continue
+			}
 			pes = append(pes, &PreludeExplorer{
 				prelude:  pe.prelude,
 				database: db,
@@ -2,9 +2,13 @@ package archive
 
 import (
 	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
 	. "github.com/smartystreets/goconvey/convey"
 	//	"gopkg.in/mgo.v2/bson"
+	"io"
 	"testing"
+	"time"
 )
 
 func TestPrelude(t *testing.T) {
@@ -53,4 +57,325 @@ func TestPrelude(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(archivePrelude2, ShouldResemble, archivePrelude)
 	})
+
+	Convey("WritePrelude/ReadPrelude roundtrip of the dump timestamp", t, func() {
+		dumpTime := time.Date(2015, time.July, 4, 10, 30, 0, 123*int(time.Millisecond), time.UTC)
+		archivePrelude := &Prelude{
+			Header: &Header{
+				FormatVersion: "version-foo",
+				DumpTimestamp: dumpTime,
+			},
+		}
+		buf := &bytes.Buffer{}
+		err = archivePrelude.Write(buf)
+		So(err, ShouldBeNil)
+		archivePrelude2 := &Prelude{}
+		err = archivePrelude2.Read(buf)
+		So(err, ShouldBeNil)
+		readTime, ok := archivePrelude2.DumpTime()
+		So(ok, ShouldBeTrue)
+		So(readTime.Equal(dumpTime), ShouldBeTrue)
+
+		Convey("and a header without a dump timestamp reports none", func() {
+			archivePrelude.Header.DumpTimestamp = time.Time{}
+			buf := &bytes.Buffer{}
+			So(archivePrelude.Write(buf), ShouldBeNil)
+			archivePrelude3 := &Prelude{}
+			So(archivePrelude3.Read(buf), ShouldBeNil)
+			_, ok := archivePrelude3.DumpTime()
+			So(ok, ShouldBeFalse)
+			So(archivePrelude3.Header.FormatVersion, ShouldEqual, "version-foo")
+		})
+	})
+
+	Convey("WritePrelude/ReadPrelude roundtrip of the source server version", t, func() {
+		archivePrelude, err := NewPrelude(intents.NewIntentManager(), 1, "3.2.1")
+		So(err, ShouldBeNil)
+		buf := &bytes.Buffer{}
+		So(archivePrelude.Write(buf), ShouldBeNil)
+		archivePrelude2 := &Prelude{}
+		So(archivePrelude2.Read(buf), ShouldBeNil)
+		version, ok := archivePrelude2.SourceServerVersion()
+		So(ok, ShouldBeTrue)
+		So(version, ShouldEqual, "3.2.1")
+
+		Convey("and a header without a version reports none", func() {
+			archivePrelude.Header.SourceServerVersion = ""
+			buf := &bytes.Buffer{}
+			So(archivePrelude.Write(buf), ShouldBeNil)
+			archivePrelude3 := &Prelude{}
+			So(archivePrelude3.Read(buf), ShouldBeNil)
+			_, ok := archivePrelude3.SourceServerVersion()
+			So(ok, ShouldBeFalse)
+			So(archivePrelude3.Header.FormatVersion, ShouldEqual, archiveFormatVersion)
+		})
+	})
+
+	Convey("ReadWithCallback calls back once per collection, in order", t, func() {
+		archivePrelude := &Prelude{Header: &Header{FormatVersion: "version-foo"}}
+		archivePrelude.AddMetadata(&CollectionMetadata{Database: "db1", Collection: "c1"})
+		archivePrelude.AddMetadata(&CollectionMetadata{Database: "db2", Collection: "c2"})
+		archivePrelude.AddMetadata(&CollectionMetadata{Database: "db1", Collection: "c3"})
+		buf := &bytes.Buffer{}
+		So(archivePrelude.Write(buf), ShouldBeNil)
+
+		seen := []string{}
+		archivePrelude2 := &Prelude{}
+		err := archivePrelude2.ReadWithCallback(buf, func(cm *CollectionMetadata) {
+			seen = append(seen, cm.Database+"."+cm.Collection)
+		})
+		So(err, ShouldBeNil)
+		So(seen, ShouldResemble, []string{"db1.c1", "db2.c2", "db1.c3"})
+		So(len(archivePrelude2.NamespaceMetadatas), ShouldEqual, 3)
+	})
+
+	Convey("Reading a large prelude reports progress as it goes", t, func() {
+		archivePrelude := &Prelude{Header: &Header{FormatVersion: "version-foo"}}
+		for i := 0; i < 10000; i++ {
+			archivePrelude.AddMetadata(&CollectionMetadata{
+				Database:   fmt.Sprintf("db%v", i%10),
+				Collection: fmt.Sprintf("c%v", i),
+				Metadata:   `{"options":{},"indexes":[{"v":1,"key":{"_id":1},"name":"_id_"}]}`,
+			})
+		}
+		buf := &bytes.Buffer{}
+		So(archivePrelude.Write(buf), ShouldBeNil)
+		preludeSize := int64(buf.Len())
+
+		reporter := &recordingReporter{}
+		archivePrelude2 := &Prelude{Progress: reporter}
+		So(archivePrelude2.Read(buf), ShouldBeNil)
+		So(len(archivePrelude2.NamespaceMetadatas), ShouldEqual, 10000)
+
+		// once for the header, each collection, and the terminator
+		So(len(reporter.bytesRead), ShouldEqual, 10002)
+		for i := 1; i < len(reporter.bytesRead); i++ {
+			So(reporter.bytesRead[i], ShouldBeGreaterThan, reporter.bytesRead[i-1])
+		}
+		// everything but the magic number
+		So(reporter.bytesRead[10001], ShouldEqual, preludeSize-4)
+		So(reporter.blocksRead[10000], ShouldEqual, 0)
+		So(reporter.blocksRead[10001], ShouldEqual, 1)
+	})
+
+	Convey("Reading a prelude without a reporter is silent", t, func() {
+		archivePrelude := &Prelude{Header: &Header{FormatVersion: "version-foo"}}
+		archivePrelude.AddMetadata(&CollectionMetadata{Database: "db1", Collection: "c1"})
+		buf := &bytes.Buffer{}
+		So(archivePrelude.Write(buf), ShouldBeNil)
+		So((&Prelude{}).Read(buf), ShouldBeNil)
+	})
+}
+
+// recordingReporter records each report of a parser's progress.
+type recordingReporter struct {
+	bytesRead  []int64
+	blocksRead []int
+}
+
+func (reporter *recordingReporter) ParserProgress(bytesRead int64, blocksRead int) {
+	reporter.bytesRead = append(reporter.bytesRead, bytesRead)
+	reporter.blocksRead = append(reporter.blocksRead, blocksRead)
+}
+
+// topLevelEntries describes the entries at the top level of a prelude
+// as "name:kind" for files and "name/" for directories.
+func topLevelEntries(prelude *Prelude) []string {
+	explorer, err := prelude.NewPreludeExplorer()
+	So(err, ShouldBeNil)
+	entries, err := explorer.ReadDir()
+	So(err, ShouldBeNil)
+	described := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			described = append(described, entry.Name()+"/")
+			continue
+		}
+		kind := entry.(*PreludeExplorer).TopLevelKind()
+		described = append(described, fmt.Sprintf("%v:%v", entry.Name(), kind))
+	}
+	return described
+}
+
+func TestPreludeExplorerTopLevel(t *testing.T) {
+
+	Convey("With a prelude whose only top level collection is the oplog", t, func() {
+		prelude := &Prelude{}
+		prelude.AddMetadata(&CollectionMetadata{Database: "", Collection: "oplog"})
+
+		Convey("the oplog should be the only entry at the top level", func() {
+			So(topLevelEntries(prelude), ShouldResemble, []string{
+				fmt.Sprintf("oplog.bson:%v", TopLevelOplog),
+			})
+		})
+	})
+
+	Convey("With a prelude mixing the oplog, other top level collections and databases", t, func() {
+		prelude := &Prelude{}
+		prelude.AddMetadata(&CollectionMetadata{Database: "db1", Collection: "c1", Metadata: "m1"})
+		prelude.AddMetadata(&CollectionMetadata{Database: "", Collection: "oplog"})
+		prelude.AddMetadata(&CollectionMetadata{Database: "", Collection: "other", Metadata: "m2"})
+		prelude.AddMetadata(&CollectionMetadata{Database: "db2", Collection: "c2"})
+
+		Convey("top level collections should be classified, and \"\" not listed as a database", func() {
+			So(topLevelEntries(prelude), ShouldResemble, []string{
+				fmt.Sprintf("oplog.bson:%v", TopLevelOplog),
+				fmt.Sprintf("other.bson:%v", TopLevelCollection),
+				fmt.Sprintf("other.metadata.json:%v", TopLevelCollection),
+				"db1/",
+				"db2/",
+			})
+		})
+
+		Convey("collections in databases should not be top level", func() {
+			explorer, err := prelude.NewPreludeExplorer()
+			So(err, ShouldBeNil)
+			entries, err := explorer.ReadDir()
+			So(err, ShouldBeNil)
+			db1, err := entries[3].ReadDir()
+			So(err, ShouldBeNil)
+			So(len(db1), ShouldEqual, 2)
+			So(db1[0].(*PreludeExplorer).TopLevelKind(), ShouldEqual, NotTopLevel)
+		})
+
+		Convey("a custom ClassifyTopLevel should decide which collection is the oplog", func() {
+			prelude.ClassifyTopLevel = func(collection string) TopLevelKind {
+				if collection == "other" {
+					return TopLevelOplog
+				}
+				return TopLevelCollection
+			}
+			entries := topLevelEntries(prelude)
+			So(entries[0], ShouldEqual, fmt.Sprintf("oplog.bson:%v", TopLevelCollection))
+			So(entries[1], ShouldEqual, fmt.Sprintf("other.bson:%v", TopLevelOplog))
+		})
+	})
+}
+
+// failingReader reads from in until it has read limit bytes, and then fails.
+type failingReader struct {
+	in    io.Reader
+	limit int
+}
+
+func (reader *failingReader) Read(p []byte) (int, error) {
+	if reader.limit <= 0 {
+		return 0, fmt.Errorf("connection reset")
+	}
+	if len(p) > reader.limit {
+		p = p[:reader.limit]
+	}
+	n, err := reader.in.Read(p)
+	reader.limit -= n
+	return n, err
+}
+
+func TestPreludeResumeRead(t *testing.T) {
+
+	Convey("With a prelude whose read fails part way through", t, func() {
+		archivePrelude := &Prelude{Header: &Header{FormatVersion: "version-foo"}}
+		for i := 0; i < 100; i++ {
+			archivePrelude.AddMetadata(&CollectionMetadata{
+				Database:   fmt.Sprintf("db%v", i%3),
+				Collection: fmt.Sprintf("c%v", i),
+				Metadata:   `{"options":{},"indexes":[]}`,
+			})
+		}
+		buf := &bytes.Buffer{}
+		So(archivePrelude.Write(buf), ShouldBeNil)
+		raw := buf.Bytes()
+
+		reporter := &recordingReporter{}
+		archivePrelude2 := &Prelude{Progress: reporter}
+		err := archivePrelude2.Read(&failingReader{in: bytes.NewReader(raw), limit: len(raw) / 2})
+		So(err, ShouldNotBeNil)
+		readBefore := len(archivePrelude2.NamespaceMetadatas)
+		So(readBefore, ShouldBeGreaterThan, 0)
+		So(readBefore, ShouldBeLessThan, 100)
+		offset := reporter.bytesRead[len(reporter.bytesRead)-1]
+
+		Convey("resuming from the last offset reported should read the rest", func() {
+			in := bytes.NewReader(raw)
+			So(archivePrelude2.ResumeRead(in, offset), ShouldBeNil)
+			So(len(archivePrelude2.NamespaceMetadatas), ShouldEqual, 100)
+			So(archivePrelude2.NamespaceMetadatas, ShouldResemble, archivePrelude.NamespaceMetadatas)
+			So(archivePrelude2.DBS, ShouldResemble, archivePrelude.DBS)
+
+			// only the rest of the prelude was read
+			So(in.Len(), ShouldEqual, 0)
+			So(reporter.bytesRead[len(reporter.bytesRead)-1], ShouldEqual, int64(len(raw)-4))
+		})
+
+		Convey("resuming a prelude without a header should start over", func() {
+			archivePrelude3 := &Prelude{}
+			So(archivePrelude3.ResumeRead(bytes.NewReader(raw), offset), ShouldBeNil)
+			So(archivePrelude3.NamespaceMetadatas, ShouldResemble, archivePrelude.NamespaceMetadatas)
+		})
+
+		Convey("resuming from an offset that isn't a document boundary should be an error", func() {
+			So(archivePrelude2.ResumeRead(bytes.NewReader(raw), offset+1), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPreludeMagicNumber(t *testing.T) {
+
+	Convey("With a prelude written with a custom magic number", t, func() {
+		const forkMagicNumber uint32 = 0x12345678
+		archivePrelude := &Prelude{
+			Header:      &Header{FormatVersion: "version-foo"},
+			MagicNumber: forkMagicNumber,
+		}
+		archivePrelude.AddMetadata(&CollectionMetadata{Database: "db1", Collection: "c1"})
+		buf := &bytes.Buffer{}
+		So(archivePrelude.Write(buf), ShouldBeNil)
+		raw := buf.Bytes()
+		So(raw[:4], ShouldResemble, []byte{0x78, 0x56, 0x34, 0x12})
+
+		Convey("it should be read back with the same magic number", func() {
+			archivePrelude2 := &Prelude{MagicNumber: forkMagicNumber}
+			So(archivePrelude2.Read(bytes.NewReader(raw)), ShouldBeNil)
+			So(archivePrelude2.NamespaceMetadatas, ShouldResemble, archivePrelude.NamespaceMetadatas)
+		})
+
+		Convey("it should not be read with the default magic number", func() {
+			err := (&Prelude{}).Read(bytes.NewReader(raw))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "does not apear to be a mongodump archive")
+		})
+
+		Convey("an upstream archive should not be read with the custom magic number", func() {
+			archivePrelude.MagicNumber = 0
+			buf := &bytes.Buffer{}
+			So(archivePrelude.Write(buf), ShouldBeNil)
+			err := (&Prelude{MagicNumber: forkMagicNumber}).Read(buf)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("with the override the tools are built with set to it", func() {
+			MagicNumberOverride = "0x12345678"
+			Reset(func() {
+				MagicNumberOverride = ""
+			})
+
+			Convey("preludes that don't set their own should read and write it", func() {
+				archivePrelude2 := &Prelude{}
+				So(archivePrelude2.Read(bytes.NewReader(raw)), ShouldBeNil)
+				So(archivePrelude2.NamespaceMetadatas, ShouldResemble, archivePrelude.NamespaceMetadatas)
+
+				archivePrelude2.MagicNumber = 0
+				buf := &bytes.Buffer{}
+				So(archivePrelude2.Write(buf), ShouldBeNil)
+				So(buf.Bytes()[:4], ShouldResemble, []byte{0x78, 0x56, 0x34, 0x12})
+			})
+
+			Convey("an override that isn't a number should be an error", func() {
+				MagicNumberOverride = "fork"
+				err := (&Prelude{}).Read(bytes.NewReader(raw))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "invalid archive magic number override")
+				So((&Prelude{Header: &Header{}}).Write(&bytes.Buffer{}), ShouldNotBeNil)
+			})
+		})
+	})
 }
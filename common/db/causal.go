@@ -0,0 +1,154 @@
+package db
+
+import (
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"gopkg.in/mgo.v2/bson"
+	"sync"
+)
+
+// causalReadCommands are the commands that read in a causally consistent
+// session, waiting for the session's operation time with afterClusterTime.
+var causalReadCommands = map[string]bool{
+	"aggregate": true,
+	"count":     true,
+	"distinct":  true,
+	"find":      true,
+}
+
+// CausalSession is a causally consistent logical session shared by many commands.
+// Each command run in it is sent with the session id, unless it has its own, and
+// with the latest cluster time seen, and the session advances its operation time
+// and cluster time from each reply. Reads wait for the session's operation time,
+// so that they see every write made in the session before them. Causally
+// consistent sessions need a replica set or mongos running MongoDB 3.6 or later.
+//
+// A CausalSession may be used by many goroutines at once.
+type CausalSession struct {
+	lsid          bson.D
+	mutex         sync.Mutex
+	operationTime bson.MongoTimestamp
+	clusterTime   bson.MongoTimestamp
+	gossip        bson.Raw
+}
+
+// NewCausalSession returns a new CausalSession, which has no operation time
+// until a command run in it has replied.
+func NewCausalSession() (*CausalSession, error) {
+	lsid, err := newLogicalSessionID()
+	if err != nil {
+		return nil, err
+	}
+	return &CausalSession{lsid: lsid}, nil
+}
+
+// OperationTime returns the time of the latest operation run in the session.
+func (cs *CausalSession) OperationTime() bson.MongoTimestamp {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.operationTime
+}
+
+// ClusterTime returns the latest cluster time seen in the replies of the session.
+func (cs *CausalSession) ClusterTime() bson.MongoTimestamp {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.clusterTime
+}
+
+// causalReply is the part of a command's reply that advances a CausalSession.
+type causalReply struct {
+	OperationTime bson.MongoTimestamp `bson:"operationTime"`
+	ClusterTime   bson.Raw            `bson:"$clusterTime"`
+}
+
+// Run runs the command in the session through run, unmarshalling its reply in to out.
+func (cs *CausalSession) Run(run func(command interface{}, out interface{}) error,
+	command interface{}, out interface{}) error {
+	reply := bson.Raw{}
+	err := run(cs.attach(command), &reply)
+	if err != nil {
+		return err
+	}
+	if err = cs.advance(reply); err != nil {
+		return err
+	}
+	return reply.Unmarshal(out)
+}
+
+// attach returns the command with the session's id and latest cluster time, and
+// with a readConcern of afterClusterTime if the command reads. Commands that
+// can't be turned in to documents are returned as they are.
+func (cs *CausalSession) attach(command interface{}) interface{} {
+	var cmd bson.D
+	switch c := command.(type) {
+	case string:
+		cmd = bson.D{{c, 1}}
+	case bson.D:
+		cmd = c[:len(c):len(c)]
+	case bsonutil.MarshalD:
+		cmd = bson.D(c[:len(c):len(c)])
+	default:
+		raw, err := bson.Marshal(command)
+		if err != nil || bson.Unmarshal(raw, &cmd) != nil {
+			return command
+		}
+	}
+
+	cs.mutex.Lock()
+	operationTime, gossip := cs.operationTime, cs.gossip
+	cs.mutex.Unlock()
+
+	hasSession, readConcernIndex := false, -1
+	for i, elem := range cmd {
+		switch elem.Name {
+		case "lsid":
+			hasSession = true
+		case "readConcern":
+			readConcernIndex = i
+		}
+	}
+	if !hasSession {
+		cmd = append(cmd, bson.DocElem{"lsid", cs.lsid})
+	}
+	if gossip.Kind == 0x03 {
+		cmd = append(cmd, bson.DocElem{"$clusterTime", gossip})
+	}
+	if len(cmd) > 0 && causalReadCommands[cmd[0].Name] && operationTime != 0 {
+		afterClusterTime := bson.DocElem{"afterClusterTime", operationTime}
+		if readConcernIndex < 0 {
+			cmd = append(cmd, bson.DocElem{"readConcern", bson.D{afterClusterTime}})
+		} else if readConcern, ok := cmd[readConcernIndex].Value.(bson.D); ok {
+			readConcern = append(readConcern[:len(readConcern):len(readConcern)], afterClusterTime)
+			cmd[readConcernIndex] = bson.DocElem{"readConcern", readConcern}
+		}
+	}
+	return cmd
+}
+
+// advance moves the session's operation time and cluster time forward to those
+// of the reply, if they are later.
+func (cs *CausalSession) advance(raw bson.Raw) error {
+	reply := causalReply{}
+	if err := raw.Unmarshal(&reply); err != nil {
+		return err
+	}
+	clusterTime := struct {
+		ClusterTime bson.MongoTimestamp `bson:"clusterTime"`
+	}{}
+	if reply.ClusterTime.Kind == 0x03 {
+		if err := reply.ClusterTime.Unmarshal(&clusterTime); err != nil {
+			return err
+		}
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if reply.OperationTime > cs.operationTime {
+		cs.operationTime = reply.OperationTime
+	}
+	if clusterTime.ClusterTime > cs.clusterTime {
+		cs.clusterTime = clusterTime.ClusterTime
+		cs.gossip = reply.ClusterTime
+	}
+	return nil
+}
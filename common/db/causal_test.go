@@ -0,0 +1,90 @@
+package db
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestCausalSession(t *testing.T) {
+
+	Convey("With a CausalSession on a stubbed server whose time advances with each command", t, func() {
+		session, err := NewCausalSession()
+		So(err, ShouldBeNil)
+		commands := []bson.D{}
+		var now bson.MongoTimestamp = 100 << 32
+		run := func(cmd interface{}, out interface{}) error {
+			commands = append(commands, cmd.(bson.D))
+			now++
+			raw, err := bson.Marshal(bson.D{
+				{"ok", 1},
+				{"n", 3},
+				{"operationTime", now},
+				{"$clusterTime", bson.D{{"clusterTime", now}, {"signature", bson.D{{"keyId", 0}}}}},
+			})
+			if err != nil {
+				return err
+			}
+			return bson.Unmarshal(raw, out)
+		}
+
+		Convey("the first command should be sent with the session id but no cluster time", func() {
+			So(session.Run(run, "ping", &bson.M{}), ShouldBeNil)
+			So(commands[0][0], ShouldResemble, bson.DocElem{"ping", 1})
+			So(commandField(commands[0], "lsid"), ShouldResemble, session.lsid)
+			So(commandField(commands[0], "$clusterTime"), ShouldBeNil)
+			So(session.OperationTime(), ShouldEqual, now)
+			So(session.ClusterTime(), ShouldEqual, now)
+		})
+
+		Convey("the cluster time should advance with each reply, and be sent with the next command", func() {
+			for i := 0; i < 3; i++ {
+				So(session.Run(run, bson.D{{"insert", "c1"}}, &bson.M{}), ShouldBeNil)
+			}
+			So(session.ClusterTime(), ShouldEqual, bson.MongoTimestamp(100<<32+3))
+			gossip := commandField(commands[2], "$clusterTime").(bson.Raw)
+			clusterTime := bson.M{}
+			So(gossip.Unmarshal(&clusterTime), ShouldBeNil)
+			So(clusterTime["clusterTime"], ShouldEqual, bson.MongoTimestamp(100<<32+2))
+		})
+
+		Convey("reads should wait for the operation time of the writes before them, but writes shouldn't", func() {
+			So(session.Run(run, bson.D{{"insert", "c1"}}, &bson.M{}), ShouldBeNil)
+			So(session.Run(run, bson.D{{"insert", "c1"}}, &bson.M{}), ShouldBeNil)
+			result := struct {
+				N int `bson:"n"`
+			}{}
+			So(session.Run(run, bson.D{{"count", "c1"}}, &result), ShouldBeNil)
+			So(result.N, ShouldEqual, 3)
+			So(commandField(commands[0], "readConcern"), ShouldBeNil)
+			So(commandField(commands[1], "readConcern"), ShouldBeNil)
+			So(commandField(commands[2], "readConcern"), ShouldResemble,
+				bson.D{{"afterClusterTime", bson.MongoTimestamp(100<<32 + 2)}})
+		})
+
+		Convey("a read's own readConcern should be kept", func() {
+			So(session.Run(run, bson.D{{"insert", "c1"}}, &bson.M{}), ShouldBeNil)
+			So(session.Run(run, bson.D{{"find", "c1"}, {"readConcern", bson.D{{"level", "majority"}}}}, &bson.M{}), ShouldBeNil)
+			So(commandField(commands[1], "readConcern"), ShouldResemble,
+				bson.D{{"level", "majority"}, {"afterClusterTime", bson.MongoTimestamp(100<<32 + 1)}})
+		})
+
+		Convey("the session should not move back to an earlier time", func() {
+			So(session.Run(run, "ping", &bson.M{}), ShouldBeNil)
+			now = 50 << 32
+			So(session.Run(run, "ping", &bson.M{}), ShouldBeNil)
+			So(session.OperationTime(), ShouldEqual, bson.MongoTimestamp(100<<32+1))
+		})
+
+		Convey("inserts of a RetryableInserter in the session should keep its own session id", func() {
+			lsid, err := newLogicalSessionID()
+			So(err, ShouldBeNil)
+			inserter := &RetryableInserter{run: run, collection: "c1", lsid: lsid, docLimit: 10}
+			inserter.SetCausalSession(session)
+			So(inserter.Insert(bson.D{{"_id", 1}}), ShouldBeNil)
+			So(inserter.Flush(), ShouldBeNil)
+			So(commandField(commands[0], "lsid"), ShouldResemble, lsid)
+			So(session.OperationTime(), ShouldEqual, now)
+		})
+	})
+}
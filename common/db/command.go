@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"strings"
@@ -32,6 +33,25 @@ type CommandRunner interface {
 	CollectionNames(db string) ([]string, error)
 }
 
+// CommandWithComment returns the command with a comment field added, so that it
+// can be picked out in the server's logs. Commands given as a name, like "ping",
+// are turned in to documents. Commands of other types, and all commands when the
+// comment is empty, are returned as they are.
+func CommandWithComment(command interface{}, comment string) interface{} {
+	if comment == "" {
+		return command
+	}
+	switch cmd := command.(type) {
+	case string:
+		return bson.D{{cmd, 1}, {"comment", comment}}
+	case bson.D:
+		return append(cmd[:len(cmd):len(cmd)], bson.DocElem{"comment", comment})
+	case bsonutil.MarshalD:
+		return append(cmd[:len(cmd):len(cmd)], bson.DocElem{"comment", comment})
+	}
+	return command
+}
+
 // Remove removes all documents matched by query q in the db database and c collection.
 func (sp *SessionProvider) Remove(db, c string, q interface{}) error {
 	session, err := sp.GetSession()
@@ -159,6 +179,23 @@ func (sp *SessionProvider) SupportsRepairCursor(db, collection string) (bool, er
 	return true, nil
 }
 
+// ServerVersion returns the version of the connected server, from buildInfo.
+func (sp *SessionProvider) ServerVersion() (string, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	buildInfo := struct {
+		Version string `bson:"version"`
+	}{}
+	err = session.Run("buildInfo", &buildInfo)
+	if err != nil {
+		return "", err
+	}
+	return buildInfo.Version, nil
+}
+
 // SupportsWriteCommands returns true if the connected server supports write
 // commands, returns false otherwise.
 func (sp *SessionProvider) SupportsWriteCommands() (bool, error) {
@@ -0,0 +1,358 @@
+package db
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opcodes of the wire protocol messages read and written by compressingConn.
+const (
+	opReply      = 1
+	opQuery      = 2004
+	opCompressed = 2012
+)
+
+// compressorIds are the ids OP_COMPRESSED messages name their compressor by.
+var compressorIds = map[string]byte{"snappy": 1, "zlib": 2, "zstd": 3}
+
+// supportedCompressors are the compressors messages can be compressed and
+// decompressed with; the others are recognized so that asking for them is only
+// a warning.
+var supportedCompressors = map[string]bool{"zlib": true}
+
+// uncompressedCommands are the commands that are never compressed, as the wire
+// protocol requires, since they negotiate compression or carry credentials.
+var uncompressedCommands = map[string]bool{
+	"hello": true, "ismaster": true, "saslstart": true, "saslcontinue": true, "getnonce": true,
+	"authenticate": true, "createuser": true, "updateuser": true,
+	"copydbsaslstart": true, "copydbgetnonce": true, "copydb": true,
+}
+
+// ParseCompressors parses the --compressors argument, a comma-separated list of
+// compressors in order of preference, into their names. It's an error to name
+// an unknown compressor. Known compressors that aren't supported are left out
+// with a warning, so that the connection negotiates one of the others, or is
+// left uncompressed. There are none if the tool doesn't register the
+// compression options.
+func ParseCompressors(opts *options.Compression) ([]string, error) {
+	compressors := []string{}
+	if opts == nil || opts.Compressors == "" {
+		return compressors, nil
+	}
+	for _, name := range strings.Split(opts.Compressors, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := compressorIds[name]; !ok {
+			return nil, fmt.Errorf("unknown compressor '%v' in --compressors; must be snappy, zlib or zstd", name)
+		}
+		if !supportedCompressors[name] {
+			log.Logf(log.Always, "warning: compressor '%v' in --compressors isn't supported, so it won't be used; only zlib is", name)
+			continue
+		}
+		compressors = append(compressors, name)
+	}
+	return compressors, nil
+}
+
+// handshakeDialer wraps the given dial function so that each connection it opens
+// starts with a handshake that names the application, if appName is set, and
+// negotiates the first of the compressors that the server also supports, then
+// compresses its messages with it. Connections to servers that support none of
+// the compressors are left uncompressed. It returns dial as it is if there is
+// neither an application name nor any compressors.
+func handshakeDialer(appName string, compressors []string, timeout time.Duration,
+	dial func(addr string) (net.Conn, error)) func(addr string) (net.Conn, error) {
+	if appName == "" && len(compressors) == 0 {
+		return dial
+	}
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		conn.SetDeadline(time.Now().Add(timeout))
+		compressor, err := handshake(conn, appName, compressors)
+		conn.SetDeadline(time.Time{})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error in handshake with %v: %v", addr, err)
+		}
+		if len(compressors) == 0 {
+			return conn, nil
+		}
+		if compressor == "" {
+			log.Logf(log.Info, "%v supports none of the compressors %v; not compressing messages to it",
+				addr, strings.Join(compressors, ","))
+			return conn, nil
+		}
+		log.Logf(log.DebugLow, "compressing messages to %v with %v", addr, compressor)
+		return &compressingConn{Conn: conn, compressorId: compressorIds[compressor]}, nil
+	}
+}
+
+// handshake sends the server an isMaster naming the application and listing the
+// compressors, which must be the first message on the connection for the server
+// to take either, and returns the first of the compressors the server replies
+// that it supports, or "" if it supports none.
+func handshake(conn net.Conn, appName string, compressors []string) (string, error) {
+	command := bson.D{{"isMaster", 1}}
+	if appName != "" {
+		// the server refuses client metadata without the driver and os
+		command = append(command, bson.DocElem{"client", bson.D{
+			{"application", bson.D{{"name", appName}}},
+			{"driver", bson.D{{"name", "mongo-tools"}, {"version", options.VersionStr}}},
+			{"os", bson.D{{"type", runtime.GOOS}, {"architecture", runtime.GOARCH}}},
+		}})
+	}
+	if len(compressors) > 0 {
+		command = append(command, bson.DocElem{"compression", compressors})
+	}
+	query, err := bson.Marshal(command)
+	if err != nil {
+		return "", err
+	}
+	msg := appendHeader(nil, 0, 0, opQuery)
+	msg = appendInt32(msg, 0) // flags
+	msg = append(append(msg, "admin.$cmd"...), 0)
+	msg = appendInt32(msg, 0)  // numberToSkip
+	msg = appendInt32(msg, -1) // numberToReturn
+	msg = append(msg, query...)
+	setLength(msg)
+	if _, err = conn.Write(msg); err != nil {
+		return "", err
+	}
+
+	reply, err := readMessage(conn)
+	if err != nil {
+		return "", err
+	}
+	// responseFlags, cursorID, startingFrom and numberReturned precede the document
+	const replyDocumentOffset = 16 + 4 + 8 + 4 + 4
+	if opcode(reply) != opReply || len(reply) < replyDocumentOffset {
+		return "", fmt.Errorf("unexpected reply to isMaster of opcode %v", opcode(reply))
+	}
+	result := struct {
+		Compression []string `bson:"compression"`
+	}{}
+	if err = bson.Unmarshal(reply[replyDocumentOffset:], &result); err != nil {
+		return "", fmt.Errorf("error reading reply to isMaster: %v", err)
+	}
+	for _, name := range compressors {
+		for _, supported := range result.Compression {
+			if name == supported {
+				return name, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// compressingConn is a connection to a server that has agreed to a compressor,
+// which writes each message as an OP_COMPRESSED message and reads compressed
+// replies back as the messages they hold, so the driver sees neither.
+type compressingConn struct {
+	net.Conn
+	compressorId byte
+
+	writeMutex sync.Mutex
+	// the start of a message written in part
+	pending []byte
+	// the rest of the last message read
+	unread []byte
+}
+
+// Write buffers p until it holds whole messages, and writes each of them, compressed
+// unless its command mustn't be.
+func (conn *compressingConn) Write(p []byte) (int, error) {
+	conn.writeMutex.Lock()
+	defer conn.writeMutex.Unlock()
+	conn.pending = append(conn.pending, p...)
+	for len(conn.pending) >= 4 {
+		length := int(int32(binary.LittleEndian.Uint32(conn.pending)))
+		if length < 16 {
+			return 0, fmt.Errorf("invalid message length %v", length)
+		}
+		if len(conn.pending) < length {
+			break
+		}
+		msg := conn.pending[:length]
+		if !mustNotCompress(msg) {
+			compressed, err := conn.compress(msg)
+			if err != nil {
+				return 0, err
+			}
+			msg = compressed
+		}
+		if _, err := conn.Conn.Write(msg); err != nil {
+			return 0, err
+		}
+		conn.pending = conn.pending[length:]
+	}
+	if len(conn.pending) == 0 {
+		conn.pending = nil
+	}
+	return len(p), nil
+}
+
+// Read reads messages from the server, decompressing those that are compressed.
+func (conn *compressingConn) Read(p []byte) (int, error) {
+	if len(conn.unread) == 0 {
+		msg, err := readMessage(conn.Conn)
+		if err != nil {
+			return 0, err
+		}
+		if opcode(msg) == opCompressed {
+			if msg, err = decompress(msg); err != nil {
+				return 0, err
+			}
+		}
+		conn.unread = msg
+	}
+	n := copy(p, conn.unread)
+	conn.unread = conn.unread[n:]
+	return n, nil
+}
+
+// compress returns the message as an OP_COMPRESSED message with the same ids.
+func (conn *compressingConn) compress(msg []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := zlib.NewWriter(buf)
+	if _, err := writer.Write(msg[16:]); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	compressed := appendHeader(nil, requestId(msg), responseTo(msg), opCompressed)
+	compressed = appendInt32(compressed, opcode(msg))
+	compressed = appendInt32(compressed, int32(len(msg)-16))
+	compressed = append(compressed, conn.compressorId)
+	compressed = append(compressed, buf.Bytes()...)
+	setLength(compressed)
+	return compressed, nil
+}
+
+// decompress returns the message held by an OP_COMPRESSED message.
+func decompress(msg []byte) ([]byte, error) {
+	// originalOpcode, uncompressedSize and compressorId precede the compressed message
+	const compressedOffset = 16 + 4 + 4 + 1
+	if len(msg) < compressedOffset {
+		return nil, fmt.Errorf("compressed message too short")
+	}
+	original := int32(binary.LittleEndian.Uint32(msg[16:]))
+	size := int32(binary.LittleEndian.Uint32(msg[20:]))
+	if id := msg[24]; id != compressorIds["zlib"] {
+		return nil, fmt.Errorf("message compressed with unsupported compressor %v", id)
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(msg[compressedOffset:]))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing message: %v", err)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing message: %v", err)
+	}
+	if int32(len(body)) != size {
+		return nil, fmt.Errorf("decompressed message is %v bytes, not %v", len(body), size)
+	}
+	decompressed := appendHeader(nil, requestId(msg), responseTo(msg), original)
+	decompressed = append(decompressed, body...)
+	setLength(decompressed)
+	return decompressed, nil
+}
+
+// mustNotCompress returns whether the message is a command that is never
+// compressed, or is already compressed.
+func mustNotCompress(msg []byte) bool {
+	switch opcode(msg) {
+	case opCompressed:
+		return true
+	case opQuery:
+		if len(msg) < 20 {
+			return false
+		}
+	default:
+		return false
+	}
+	// flags precede the namespace, and numberToSkip and numberToReturn the query
+	rest := msg[20:]
+	end := bytes.IndexByte(rest, 0)
+	if end < 0 || !strings.HasSuffix(string(rest[:end]), ".$cmd") || len(rest) < end+1+8 {
+		return false
+	}
+	name, doc := firstElement(rest[end+1+8:])
+	if name == "$query" || name == "query" {
+		// a command wrapped with its read preference
+		name, _ = firstElement(doc)
+	}
+	return uncompressedCommands[strings.ToLower(name)]
+}
+
+// firstElement returns the name of the first element of the BSON document, and
+// what follows the name, which starts with the value if it is a document.
+func firstElement(doc []byte) (string, []byte) {
+	if len(doc) < 5 {
+		return "", nil
+	}
+	end := bytes.IndexByte(doc[5:], 0)
+	if end < 0 {
+		return "", nil
+	}
+	return string(doc[5 : 5+end]), doc[5+end+1:]
+}
+
+// readMessage reads a whole message of the wire protocol from r.
+func readMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(int32(binary.LittleEndian.Uint32(header)))
+	if length < 16 {
+		return nil, fmt.Errorf("invalid message length %v", length)
+	}
+	msg := make([]byte, length)
+	copy(msg, header)
+	if _, err := io.ReadFull(r, msg[16:]); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func appendHeader(b []byte, requestId, responseTo, opcode int32) []byte {
+	b = appendInt32(b, 0) // messageLength, set by setLength
+	b = appendInt32(b, requestId)
+	b = appendInt32(b, responseTo)
+	return appendInt32(b, opcode)
+}
+
+func appendInt32(b []byte, i int32) []byte {
+	return append(b, byte(i), byte(i>>8), byte(i>>16), byte(i>>24))
+}
+
+func setLength(msg []byte) {
+	binary.LittleEndian.PutUint32(msg, uint32(len(msg)))
+}
+
+func requestId(msg []byte) int32 {
+	return int32(binary.LittleEndian.Uint32(msg[4:]))
+}
+
+func responseTo(msg []byte) int32 {
+	return int32(binary.LittleEndian.Uint32(msg[8:]))
+}
+
+func opcode(msg []byte) int32 {
+	return int32(binary.LittleEndian.Uint32(msg[12:]))
+}
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"bytes"
+	"compress/zlib"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// queryMessage builds an OP_QUERY message of the command on the admin database.
+func queryMessage(requestId int32, command bson.D) []byte {
+	query, _ := bson.Marshal(command)
+	msg := appendHeader(nil, requestId, 0, opQuery)
+	msg = appendInt32(msg, 0)
+	msg = append(append(msg, "admin.$cmd"...), 0)
+	msg = appendInt32(msg, 0)
+	msg = appendInt32(msg, -1)
+	msg = append(msg, query...)
+	setLength(msg)
+	return msg
+}
+
+// replyMessage builds an OP_REPLY message holding the document.
+func replyMessage(responseTo int32, reply bson.M) []byte {
+	doc, _ := bson.Marshal(reply)
+	msg := appendHeader(nil, 0, responseTo, opReply)
+	msg = appendInt32(msg, 0)
+	msg = append(msg, make([]byte, 8)...)
+	msg = appendInt32(msg, 0)
+	msg = appendInt32(msg, 1)
+	msg = append(msg, doc...)
+	setLength(msg)
+	return msg
+}
+
+// handshakeQuery is the isMaster a client starts its connection with.
+type handshakeQuery struct {
+	Client struct {
+		Application struct {
+			Name string `bson:"name"`
+		} `bson:"application"`
+		Driver bson.M `bson:"driver"`
+		OS     bson.M `bson:"os"`
+	} `bson:"client"`
+	Compression []string `bson:"compression"`
+}
+
+// stubHandshakeServer answers the handshake on conn, saying that it supports
+// the given compressors, and returns what the client asked for.
+func stubHandshakeServer(conn net.Conn, supported []string) *handshakeQuery {
+	msg, err := readMessage(conn)
+	if err != nil || opcode(msg) != opQuery {
+		return nil
+	}
+	query := &handshakeQuery{}
+	if bson.Unmarshal(msg[20+len("admin.$cmd")+1+8:], query) != nil {
+		return nil
+	}
+	reply := bson.M{"ok": 1, "ismaster": true}
+	if supported != nil {
+		reply["compression"] = supported
+	}
+	conn.Write(replyMessage(requestId(msg), reply))
+	return query
+}
+
+func TestCompressors(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Parsing --compressors", t, func() {
+		compressors, err := ParseCompressors(&options.Compression{Compressors: "zlib"})
+		So(err, ShouldBeNil)
+		So(compressors, ShouldResemble, []string{"zlib"})
+
+		compressors, err = ParseCompressors(&options.Compression{})
+		So(err, ShouldBeNil)
+		So(compressors, ShouldBeEmpty)
+		compressors, err = ParseCompressors(nil)
+		So(err, ShouldBeNil)
+		So(compressors, ShouldBeEmpty)
+
+		_, err = ParseCompressors(&options.Compression{Compressors: "zlib,lz4"})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "unknown compressor 'lz4'")
+
+		Convey("unsupported compressors should be skipped with a warning", func() {
+			logged := &bytes.Buffer{}
+			log.SetWriter(logged)
+			Reset(func() {
+				log.SetWriter(os.Stderr)
+			})
+			compressors, err = ParseCompressors(&options.Compression{Compressors: "snappy,zstd,zlib"})
+			So(err, ShouldBeNil)
+			So(compressors, ShouldResemble, []string{"zlib"})
+			So(logged.String(), ShouldContainSubstring, "compressor 'snappy' in --compressors isn't supported")
+			So(logged.String(), ShouldContainSubstring, "compressor 'zstd' in --compressors isn't supported")
+
+			compressors, err = ParseCompressors(&options.Compression{Compressors: "snappy,zstd"})
+			So(err, ShouldBeNil)
+			So(compressors, ShouldBeEmpty)
+			// so connections are left uncompressed without negotiating
+			client, server := net.Pipe()
+			defer server.Close()
+			conn, err := handshakeDialer("", compressors, time.Second, func(string) (net.Conn, error) {
+				return client, nil
+			})("stub:27017")
+			So(err, ShouldBeNil)
+			So(conn, ShouldEqual, client)
+		})
+	})
+
+	Convey("With a stub server on the other end of the connection", t, func() {
+		client, server := net.Pipe()
+		Reset(func() {
+			client.Close()
+			server.Close()
+		})
+		asked := make(chan *handshakeQuery, 1)
+		appName := ""
+		compressors := []string{"zlib"}
+		dial := func(supported []string) (net.Conn, error) {
+			go func() {
+				asked <- stubHandshakeServer(server, supported)
+			}()
+			dialer := handshakeDialer(appName, compressors, time.Second, func(string) (net.Conn, error) {
+				return client, nil
+			})
+			return dialer("stub:27017")
+		}
+
+		Convey("that supports zlib, the connection should negotiate and compress with it", func() {
+			conn, err := dial([]string{"snappy", "zlib"})
+			So(err, ShouldBeNil)
+			So((<-asked).Compression, ShouldResemble, []string{"zlib"})
+			So(conn, ShouldHaveSameTypeAs, &compressingConn{})
+
+			sent := queryMessage(7, bson.D{{"insert", "c1"}, {"documents", []bson.D{{{"_id", 1}}}}})
+			go conn.Write(sent)
+			received, err := readMessage(server)
+			So(err, ShouldBeNil)
+			So(opcode(received), ShouldEqual, opCompressed)
+			So(requestId(received), ShouldEqual, 7)
+			So(received[24], ShouldEqual, compressorIds["zlib"])
+			decompressed, err := decompress(received)
+			So(err, ShouldBeNil)
+			So(decompressed, ShouldResemble, sent)
+
+			Convey("and read compressed replies as the messages they hold", func() {
+				reply := replyMessage(7, bson.M{"ok": 1, "n": 1})
+				body := &bytes.Buffer{}
+				writer := zlib.NewWriter(body)
+				writer.Write(reply[16:])
+				writer.Close()
+				compressed := appendHeader(nil, 0, 7, opCompressed)
+				compressed = appendInt32(compressed, opReply)
+				compressed = appendInt32(compressed, int32(len(reply)-16))
+				compressed = append(compressed, compressorIds["zlib"])
+				compressed = append(compressed, body.Bytes()...)
+				setLength(compressed)
+				go server.Write(compressed)
+
+				read, err := ioutil.ReadAll(&limitedReader{conn, len(reply)})
+				So(err, ShouldBeNil)
+				So(read, ShouldResemble, reply)
+			})
+
+			Convey("but not compress commands that carry credentials", func() {
+				sent := queryMessage(8, bson.D{{"saslStart", 1}, {"mechanism", "SCRAM-SHA-1"}})
+				go conn.Write(sent)
+				received, err := readMessage(server)
+				So(err, ShouldBeNil)
+				So(received, ShouldResemble, sent)
+			})
+		})
+
+		Convey("that supports none of them, the connection should fall back to uncompressed", func() {
+			conn, err := dial(nil)
+			So(err, ShouldBeNil)
+			So((<-asked).Compression, ShouldResemble, []string{"zlib"})
+			So(conn, ShouldEqual, client)
+		})
+
+		Convey("and an application name, the handshake should name it", func() {
+			appName = "nightly-restore"
+			conn, err := dial([]string{"zlib"})
+			So(err, ShouldBeNil)
+			query := <-asked
+			So(query.Client.Application.Name, ShouldEqual, "nightly-restore")
+			So(query.Client.Driver["name"], ShouldEqual, "mongo-tools")
+			So(query.Client.OS["type"], ShouldNotBeEmpty)
+			So(query.Compression, ShouldResemble, []string{"zlib"})
+			So(conn, ShouldHaveSameTypeAs, &compressingConn{})
+		})
+
+		Convey("and an application name but no compressors, the handshake should still name it", func() {
+			appName = "nightly-restore"
+			compressors = nil
+			conn, err := dial(nil)
+			So(err, ShouldBeNil)
+			query := <-asked
+			So(query.Client.Application.Name, ShouldEqual, "nightly-restore")
+			So(query.Compression, ShouldBeEmpty)
+			So(conn, ShouldEqual, client)
+		})
+	})
+}
+
+// limitedReader reads exactly n bytes from r, in the small reads the driver makes.
+type limitedReader struct {
+	r net.Conn
+	n int
+}
+
+func (reader *limitedReader) Read(p []byte) (int, error) {
+	if reader.n == 0 {
+		return 0, io.EOF
+	}
+	if len(p) > 10 {
+		p = p[:10]
+	}
+	if len(p) > reader.n {
+		p = p[:reader.n]
+	}
+	n, err := reader.r.Read(p)
+	reader.n -= n
+	return n, err
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
+	"net"
 )
 
 // Interface type for connecting to the database.
@@ -22,8 +23,14 @@ type VanillaDBConnector struct {
 
 // Configure sets up the db connector using the options in opts. It parses the
 // connection string and then sets up the dial information using the default
-// dial timeout.
+// dial timeout, dialing each server with a handshake naming the application and
+// negotiating any --compressors.
 func (self *VanillaDBConnector) Configure(opts options.ToolOptions) error {
+	compressors, err := ParseCompressors(opts.Compression)
+	if err != nil {
+		return err
+	}
+
 	// create the addresses to be used to connect
 	connectionAddrs := util.CreateConnectionAddrs(opts.Host, opts.Port)
 
@@ -38,6 +45,14 @@ func (self *VanillaDBConnector) Configure(opts options.ToolOptions) error {
 		Source:         opts.GetAuthenticationDatabase(),
 		Mechanism:      opts.Auth.Mechanism,
 	}
+	if opts.ConnectionAppName != "" || len(compressors) > 0 {
+		dial := handshakeDialer(opts.ConnectionAppName, compressors, DefaultDialTimeout, func(addr string) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, DefaultDialTimeout)
+		})
+		self.dialInfo.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return dial(addr.String())
+		}
+	}
 	return nil
 }
 
@@ -146,6 +146,14 @@ func NewSessionProvider(opts options.ToolOptions) (*SessionProvider, error) {
 
 	// create the connector for dialing the database
 	provider.connector = getConnector(opts)
+	if opts.Compression != nil && opts.Compression.Compressors != "" {
+		// only the connectors that dial with net.Conn compress their messages
+		switch provider.connector.(type) {
+		case *VanillaDBConnector, *TLSDBConnector:
+		default:
+			return nil, fmt.Errorf("cannot use --compressors with --ssl or kerberos")
+		}
+	}
 
 	// configure the connector
 	err := provider.connector.Configure(opts)
@@ -178,5 +186,8 @@ func getConnector(opts options.ToolOptions) DBConnector {
 			return connector
 		}
 	}
+	if opts.TLS.Enabled() {
+		return &TLSDBConnector{}
+	}
 	return &VanillaDBConnector{}
 }
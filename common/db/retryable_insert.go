@@ -0,0 +1,335 @@
+package db
+
+import (
+	"crypto/rand"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"strings"
+)
+
+// maxCommandBatchSize is the most bytes of documents sent in one command. The
+// body of a command is limited to MaxBSONSize, and the rest of the command, such
+// as its write concern, session and comment, must fit in what is left.
+const maxCommandBatchSize = MaxBSONSize - 16*1024
+
+// RetryableInserter is a BufferedBulkInserter alternative that sends each batch
+// of documents as an insert command in a logical session, numbered with its own
+// transaction number. When a batch fails with a transient error, such as a primary
+// stepping down, it is retried once with the same session id and transaction number,
+// so a server that already applied the batch won't insert its documents twice.
+// Retryable writes need a replica set or mongos running MongoDB 3.6 or later.
+//
+// One made by NewCommandInserter sends plain insert commands instead, outside of
+// any logical session, and never retries them.
+//
+// After ReplaceById, each batch is sent as an update command that replaces the
+// documents with the same _ids, or inserts them where there are none.
+type RetryableInserter struct {
+	run             func(cmd interface{}, result interface{}) error
+	refresh         func()
+	collection      string
+	continueOnError bool
+	writeConcern    bson.D
+	lsid            bson.D
+	txnNumber       int64
+	comment         string
+	replace         bool
+	docLimit        int
+	byteCount       int
+	docs            []bson.Raw
+}
+
+// NewRetryableInserter returns an initialized RetryableInserter for writing to the
+// collection in a new logical session. Like the mgo session of the collection, it
+// must only be used by one goroutine at a time.
+func NewRetryableInserter(collection *mgo.Collection, docLimit int,
+	continueOnError bool, safety *mgo.Safe) (*RetryableInserter, error) {
+	lsid, err := newLogicalSessionID()
+	if err != nil {
+		return nil, err
+	}
+	return &RetryableInserter{
+		run:             collection.Database.Run,
+		refresh:         collection.Database.Session.Refresh,
+		collection:      collection.Name,
+		continueOnError: continueOnError,
+		writeConcern:    WriteConcernDocument(safety),
+		lsid:            lsid,
+		docLimit:        docLimit,
+	}, nil
+}
+
+// NewCommandInserter returns an initialized RetryableInserter for writing to the
+// collection with plain insert commands, which unlike the bulk inserts of a
+// BufferedBulkInserter can carry a comment.
+func NewCommandInserter(collection *mgo.Collection, docLimit int,
+	continueOnError bool, safety *mgo.Safe) *RetryableInserter {
+	return &RetryableInserter{
+		run:             collection.Database.Run,
+		refresh:         collection.Database.Session.Refresh,
+		collection:      collection.Name,
+		continueOnError: continueOnError,
+		writeConcern:    WriteConcernDocument(safety),
+		docLimit:        docLimit,
+	}
+}
+
+// SetComment sets the comment to attach to each insert command, so that the
+// inserts can be picked out in the server's logs.
+func (ri *RetryableInserter) SetComment(comment string) {
+	ri.comment = comment
+}
+
+// SetCausalSession runs the insert commands in the causally consistent session,
+// so that later reads in it see the inserted documents. Inserters with their own
+// logical session keep sending its id, and only share the session's cluster time.
+func (ri *RetryableInserter) SetCausalSession(session *CausalSession) {
+	run := ri.run
+	ri.run = func(cmd interface{}, result interface{}) error {
+		return session.Run(run, cmd, result)
+	}
+}
+
+// ReplaceById makes the inserter replace the document of the collection with the
+// same _id as each document it's given, inserting the document if there is none,
+// rather than fail to insert it. Documents without an _id are given a new ObjectId.
+func (ri *RetryableInserter) ReplaceById() {
+	ri.replace = true
+}
+
+// newLogicalSessionID generates the {id: <UUID>} document identifying a logical session.
+func newLogicalSessionID() (bson.D, error) {
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		return nil, fmt.Errorf("error generating session id: %v", err)
+	}
+	// mark it as a random (version 4) UUID
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return bson.D{{"id", bson.Binary{Kind: 0x04, Data: uuid}}}, nil
+}
+
+// Insert adds a document to the buffer for insertion. If the buffer is
+// full, the batch is inserted, returning any error that occurs.
+func (ri *RetryableInserter) Insert(doc interface{}) error {
+	rawBytes, err := bson.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("bson encoding error: %v", err)
+	}
+	if ri.replace {
+		rawBytes, err = withObjectId(rawBytes)
+		if err != nil {
+			return fmt.Errorf("bson encoding error: %v", err)
+		}
+	}
+	// flush if we are full
+	size := ri.batchedSize(rawBytes)
+	if len(ri.docs) >= ri.docLimit || ri.byteCount+size > maxCommandBatchSize {
+		err = ri.Flush()
+		// the document's index in the new batch may be shorter
+		size = ri.batchedSize(rawBytes)
+	}
+	// buffer the document
+	ri.docs = append(ri.docs, bson.Raw{Kind: 0x03, Data: rawBytes})
+	ri.byteCount += size
+	return err
+}
+
+// batchedSize returns the bytes the document adds to the command of the batch:
+// the document, its index in the array of documents, and with ReplaceById, the
+// rest of the update statement, which repeats the _id.
+func (ri *RetryableInserter) batchedSize(rawBytes []byte) int {
+	// the element's type, its index as a string and the index's terminating null
+	size := len(rawBytes) + 1 + len(strconv.Itoa(len(ri.docs))) + 1
+	if ri.replace {
+		id := struct {
+			ID bson.Raw `bson:"_id"`
+		}{}
+		bson.Unmarshal(rawBytes, &id)
+		// {q: {_id: id}, u: doc, upsert: true} around the document and _id
+		size += len(id.ID.Data) + 32
+	}
+	return size
+}
+
+// Flush writes all buffered documents in one insert command then resets the buffer.
+func (ri *RetryableInserter) Flush() error {
+	if len(ri.docs) == 0 {
+		return nil
+	}
+	defer func() {
+		ri.docs = nil
+		ri.byteCount = 0
+	}()
+
+	cmd := bson.D{
+		{"insert", ri.collection},
+		{"documents", ri.docs},
+	}
+	if ri.replace {
+		cmd = bson.D{
+			{"update", ri.collection},
+			{"updates", replacementsById(ri.docs)},
+		}
+	}
+	cmd = append(cmd, bson.DocElem{"ordered", !ri.continueOnError}, bson.DocElem{"writeConcern", ri.writeConcern})
+	if ri.lsid != nil {
+		ri.txnNumber++
+		cmd = append(cmd, bson.DocElem{"lsid", ri.lsid}, bson.DocElem{"txnNumber", ri.txnNumber})
+	}
+	if ri.comment != "" {
+		cmd = append(cmd, bson.DocElem{"comment", ri.comment})
+	}
+	err := ri.runInsert(cmd)
+	if err != nil && ri.lsid != nil && isRetryableWriteError(err) {
+		// the batch may or may not have been applied; the server will know which
+		ri.refresh()
+		err = ri.runInsert(cmd)
+	}
+	return err
+}
+
+// withObjectId returns the document with a new ObjectId as its _id if it has none.
+func withObjectId(rawBytes []byte) ([]byte, error) {
+	doc := bson.D{}
+	if err := bson.Unmarshal(rawBytes, &doc); err != nil {
+		return nil, err
+	}
+	for _, elem := range doc {
+		if elem.Name == "_id" {
+			return rawBytes, nil
+		}
+	}
+	return bson.Marshal(append(bson.D{{"_id", bson.NewObjectId()}}, doc...))
+}
+
+// replacementsById returns the update statements of an update command that
+// replace the documents with the _ids of docs with docs, upserting them.
+func replacementsById(docs []bson.Raw) []bson.D {
+	updates := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		id := struct {
+			ID bson.Raw `bson:"_id"`
+		}{}
+		doc.Unmarshal(&id)
+		updates = append(updates, bson.D{{"q", bson.D{{"_id", id.ID}}}, {"u", doc}, {"upsert", true}})
+	}
+	return updates
+}
+
+// insertResult is the reply to an insert or update command.
+type insertResult struct {
+	N           int `bson:"n"`
+	WriteErrors []struct {
+		Index  int    `bson:"index"`
+		Code   int    `bson:"code"`
+		ErrMsg string `bson:"errmsg"`
+	} `bson:"writeErrors"`
+	WriteConcernError *struct {
+		Code   int    `bson:"code"`
+		ErrMsg string `bson:"errmsg"`
+	} `bson:"writeConcernError"`
+}
+
+// WriteFailure is a document of a batch that the server refused to insert.
+type WriteFailure struct {
+	// Index is the position of the document in its batch.
+	Index  int
+	ID     interface{}
+	Code   int
+	ErrMsg string
+}
+
+// WriteFailures is the error a RetryableInserter returns when the server refuses
+// to insert some of the documents of a batch, listing each of them. The rest of
+// the batch is inserted unless the inserts are ordered.
+type WriteFailures struct {
+	Failures []WriteFailure
+}
+
+// Error returns the message of the last failure, as mgo's bulk inserts would,
+// noting how many documents failed if there was more than one.
+func (failures *WriteFailures) Error() string {
+	last := failures.Failures[len(failures.Failures)-1]
+	if len(failures.Failures) == 1 {
+		return last.ErrMsg
+	}
+	return fmt.Sprintf("%v documents were not inserted, the last because: %v", len(failures.Failures), last.ErrMsg)
+}
+
+// runInsert runs an insert command, turning any write errors it reports in to an error.
+func (ri *RetryableInserter) runInsert(cmd bson.D) error {
+	result := insertResult{}
+	err := ri.run(cmd, &result)
+	if err != nil {
+		return err
+	}
+	if len(result.WriteErrors) > 0 {
+		failures := &WriteFailures{}
+		for _, writeErr := range result.WriteErrors {
+			failure := WriteFailure{Index: writeErr.Index, Code: writeErr.Code, ErrMsg: writeErr.ErrMsg}
+			if writeErr.Index >= 0 && writeErr.Index < len(ri.docs) {
+				doc := struct {
+					ID interface{} `bson:"_id"`
+				}{}
+				if ri.docs[writeErr.Index].Unmarshal(&doc) == nil {
+					failure.ID = doc.ID
+				}
+			}
+			failures.Failures = append(failures.Failures, failure)
+		}
+		return failures
+	}
+	if result.WriteConcernError != nil {
+		return fmt.Errorf("write concern error: %v", result.WriteConcernError.ErrMsg)
+	}
+	return nil
+}
+
+// isRetryableWriteError returns true for the network errors and primary
+// changes after which a retryable write may be sent again.
+func isRetryableWriteError(err error) bool {
+	if IsConnectionError(err) || err == ErrLostConnection {
+		return true
+	}
+	if queryErr, ok := err.(*mgo.QueryError); ok {
+		switch queryErr.Code {
+		// HostUnreachable, HostNotFound, NetworkTimeout, ShutdownInProgress,
+		// PrimarySteppedDown, NotMaster, NotMasterNoSlaveOk, NotMasterOrSecondary
+		case 6, 7, 89, 91, 189, 10107, 13435, 13436:
+			return true
+		}
+	}
+	return strings.Contains(err.Error(), "not master") ||
+		strings.Contains(err.Error(), "connection reset") ||
+		strings.Contains(err.Error(), "closed explicitly")
+}
+
+// SupportsRetryableWrites returns true if the connected server is a replica
+// set member or mongos that supports logical sessions, from MongoDB 3.6 on.
+func (sp *SessionProvider) SupportsRetryableWrites() (bool, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return false, err
+	}
+	session.SetSocketTimeout(0)
+	defer session.Close()
+	masterDoc := struct {
+		SetName        interface{} `bson:"setName"`
+		Msg            string      `bson:"msg"`
+		MaxWire        int         `bson:"maxWireVersion"`
+		SessionTimeout *int        `bson:"logicalSessionTimeoutMinutes"`
+	}{}
+	err = session.Run("isMaster", &masterDoc)
+	if err != nil {
+		return false, err
+	}
+	if masterDoc.SetName == nil && masterDoc.Msg != "isdbgrid" {
+		// standalones don't support retryable writes
+		return false, nil
+	}
+	// wire version 6 is MongoDB 3.6
+	return masterDoc.MaxWire >= 6 && masterDoc.SessionTimeout != nil, nil
+}
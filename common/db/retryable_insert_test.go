@@ -0,0 +1,212 @@
+package db
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+// commandField returns the value of the named field of a command.
+func commandField(cmd bson.D, name string) interface{} {
+	for _, elem := range cmd {
+		if elem.Name == name {
+			return elem.Value
+		}
+	}
+	return nil
+}
+
+func TestRetryableInserter(t *testing.T) {
+
+	Convey("With a RetryableInserter on a stubbed session, and a doc limit of 2", t, func() {
+		commands := []bson.D{}
+		failures := 0
+		refreshes := 0
+		lsid, err := newLogicalSessionID()
+		So(err, ShouldBeNil)
+		inserter := &RetryableInserter{
+			run: func(cmd interface{}, result interface{}) error {
+				commands = append(commands, cmd.(bson.D))
+				if failures > 0 {
+					failures--
+					return ErrLostConnection
+				}
+				return nil
+			},
+			refresh:      func() { refreshes++ },
+			collection:   "c1",
+			writeConcern: WriteConcernDocument(&mgo.Safe{WMode: "majority"}),
+			lsid:         lsid,
+			docLimit:     2,
+		}
+
+		Convey("each batch should be sent with the session id and its own txnNumber", func() {
+			for i := 0; i < 5; i++ {
+				So(inserter.Insert(bson.D{{"_id", i}}), ShouldBeNil)
+			}
+			So(inserter.Flush(), ShouldBeNil)
+			So(len(commands), ShouldEqual, 3)
+			for i, cmd := range commands {
+				So(cmd[0].Name, ShouldEqual, "insert")
+				So(cmd[0].Value, ShouldEqual, "c1")
+				So(commandField(cmd, "lsid"), ShouldResemble, lsid)
+				So(commandField(cmd, "txnNumber"), ShouldEqual, int64(i+1))
+				So(commandField(cmd, "writeConcern"), ShouldResemble, bson.D{{"w", "majority"}})
+			}
+			So(len(commandField(commands[2], "documents").([]bson.Raw)), ShouldEqual, 1)
+		})
+
+		Convey("a batch that fails transiently should be retried once with the same txnNumber", func() {
+			failures = 1
+			So(inserter.Insert(bson.D{{"_id", 1}}), ShouldBeNil)
+			So(inserter.Flush(), ShouldBeNil)
+			So(len(commands), ShouldEqual, 2)
+			So(refreshes, ShouldEqual, 1)
+			So(commands[1], ShouldResemble, commands[0])
+
+			Convey("and the next batch should use the next txnNumber", func() {
+				So(inserter.Insert(bson.D{{"_id", 2}}), ShouldBeNil)
+				So(inserter.Flush(), ShouldBeNil)
+				So(commandField(commands[2], "txnNumber"), ShouldEqual, int64(2))
+			})
+		})
+
+		Convey("a batch that keeps failing should return the error", func() {
+			failures = 2
+			So(inserter.Insert(bson.D{{"_id", 1}}), ShouldBeNil)
+			So(inserter.Flush(), ShouldEqual, ErrLostConnection)
+			So(len(commands), ShouldEqual, 2)
+		})
+
+		Convey("the comment should be attached to each batch", func() {
+			inserter.SetComment("nightly-restore")
+			So(inserter.Insert(bson.D{{"_id", 1}}), ShouldBeNil)
+			So(inserter.Flush(), ShouldBeNil)
+			So(commandField(commands[0], "comment"), ShouldEqual, "nightly-restore")
+		})
+
+		Convey("batches larger than a command can hold should be split", func() {
+			inserter.docLimit = 1000
+			padding := string(make([]byte, 1024*1024))
+			for i := 0; i < 20; i++ {
+				So(inserter.Insert(bson.D{{"_id", i}, {"padding", padding}}), ShouldBeNil)
+			}
+			So(inserter.Flush(), ShouldBeNil)
+			So(len(commands), ShouldEqual, 2)
+			sent := 0
+			for _, cmd := range commands {
+				raw, err := bson.Marshal(cmd)
+				So(err, ShouldBeNil)
+				So(len(raw), ShouldBeLessThanOrEqualTo, MaxBSONSize)
+				sent += len(commandField(cmd, "documents").([]bson.Raw))
+			}
+			So(sent, ShouldEqual, 20)
+		})
+
+		Convey("without a session, batches should be sent once, without a txnNumber", func() {
+			inserter.lsid = nil
+			failures = 1
+			So(inserter.Insert(bson.D{{"_id", 1}}), ShouldBeNil)
+			So(inserter.Flush(), ShouldEqual, ErrLostConnection)
+			So(len(commands), ShouldEqual, 1)
+			So(commandField(commands[0], "txnNumber"), ShouldBeNil)
+		})
+	})
+
+	Convey("With an unordered command inserter whose 3rd and 7th documents are refused", t, func() {
+		inserter := &RetryableInserter{
+			run: func(cmd interface{}, result interface{}) error {
+				raw, err := bson.Marshal(bson.M{
+					"ok": 1,
+					"n":  8,
+					"writeErrors": []bson.M{
+						{"index": 2, "code": 11000, "errmsg": "E11000 duplicate key error"},
+						{"index": 6, "code": 121, "errmsg": "Document failed validation"},
+					},
+				})
+				if err != nil {
+					return err
+				}
+				return bson.Unmarshal(raw, result)
+			},
+			collection:      "c1",
+			continueOnError: true,
+			docLimit:        10,
+		}
+
+		Convey("the error should list each refused document with its _id", func() {
+			for i := 0; i < 10; i++ {
+				So(inserter.Insert(bson.D{{"_id", fmt.Sprintf("doc%v", i)}}), ShouldBeNil)
+			}
+			err := inserter.Flush()
+			failures, ok := err.(*WriteFailures)
+			So(ok, ShouldBeTrue)
+			So(failures.Failures, ShouldResemble, []WriteFailure{
+				{Index: 2, ID: "doc2", Code: 11000, ErrMsg: "E11000 duplicate key error"},
+				{Index: 6, ID: "doc6", Code: 121, ErrMsg: "Document failed validation"},
+			})
+			So(err.Error(), ShouldContainSubstring, "2 documents were not inserted")
+		})
+	})
+
+	Convey("Session ids should be random version 4 UUIDs", t, func() {
+		lsid1, err := newLogicalSessionID()
+		So(err, ShouldBeNil)
+		lsid2, err := newLogicalSessionID()
+		So(err, ShouldBeNil)
+		uuid := lsid1[0].Value.(bson.Binary)
+		So(uuid.Kind, ShouldEqual, 0x04)
+		So(len(uuid.Data), ShouldEqual, 16)
+		So(uuid.Data[6]>>4, ShouldEqual, 4)
+		So(lsid1, ShouldNotResemble, lsid2)
+	})
+}
+
+func TestRetryableInserterReplaceById(t *testing.T) {
+
+	Convey("With a command inserter that replaces documents by _id", t, func() {
+		commands := []bson.D{}
+		inserter := &RetryableInserter{
+			run: func(cmd interface{}, result interface{}) error {
+				commands = append(commands, cmd.(bson.D))
+				return nil
+			},
+			collection:   "c1",
+			writeConcern: WriteConcernDocument(&mgo.Safe{}),
+			docLimit:     10,
+		}
+		inserter.ReplaceById()
+
+		Convey("each batch should be sent as an update command upserting by _id", func() {
+			So(inserter.Insert(bson.D{{"_id", "a"}, {"x", 1}}), ShouldBeNil)
+			So(inserter.Insert(bson.D{{"x", 2}}), ShouldBeNil)
+			So(inserter.Flush(), ShouldBeNil)
+			So(len(commands), ShouldEqual, 1)
+			So(commands[0][0], ShouldResemble, bson.DocElem{"update", "c1"})
+			So(commandField(commands[0], "documents"), ShouldBeNil)
+			So(commandField(commands[0], "ordered"), ShouldEqual, true)
+
+			updates := commandField(commands[0], "updates").([]bson.D)
+			So(len(updates), ShouldEqual, 2)
+			first := bson.M{}
+			So(bson.Unmarshal(updates[0][1].Value.(bson.Raw).Data, &first), ShouldBeNil)
+			So(first, ShouldResemble, bson.M{"_id": "a", "x": 1})
+			var id interface{}
+			So(commandField(updates[0], "q").(bson.D)[0].Value.(bson.Raw).Unmarshal(&id), ShouldBeNil)
+			So(id, ShouldEqual, "a")
+			So(commandField(updates[0], "upsert"), ShouldEqual, true)
+
+			Convey("giving a document without an _id a new one", func() {
+				second := bson.D{}
+				So(bson.Unmarshal(updates[1][1].Value.(bson.Raw).Data, &second), ShouldBeNil)
+				So(second[0].Name, ShouldEqual, "_id")
+				So(second[1], ShouldResemble, bson.DocElem{"x", 2})
+				var secondId interface{}
+				So(commandField(updates[1], "q").(bson.D)[0].Value.(bson.Raw).Unmarshal(&secondId), ShouldBeNil)
+				So(secondId, ShouldEqual, second[0].Value)
+			})
+		})
+	})
+}
@@ -0,0 +1,235 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// TLSDBConnector dials the database over TLS, using Go's crypto/tls rather
+// than openssl, so it is available without the ssl build tag. It is used
+// when any of the --tlsCAFile, --tlsCertKeyFile or --tlsCRLFile options are set.
+// It honors the ssl options that the openssl connector does where they apply:
+// --sslAllowInvalidCertificates, --sslAllowInvalidHostnames and
+// --sslPEMKeyPassword.
+type TLSDBConnector struct {
+	dialInfo *mgo.DialInfo
+	config   *tls.Config
+
+	// dial opens the TLS connection to a server; it is tls.DialWithDialer
+	// unless replaced in tests
+	dial func(network, addr string, config *tls.Config) (net.Conn, error)
+}
+
+// Configure sets up the db connector using the options in opts. It loads the
+// certificate material named by the tls options and then sets up the dial
+// information the same way as the VanillaDBConnector, with a DialServer
+// function that connects over TLS, with a handshake naming the application and
+// compressing messages with any --compressors.
+func (self *TLSDBConnector) Configure(opts options.ToolOptions) error {
+	if err := opts.TLS.Validate(); err != nil {
+		return err
+	}
+	config, err := buildTLSConfig(opts.TLS, opts.SSL)
+	if err != nil {
+		return err
+	}
+	compressors, err := ParseCompressors(opts.Compression)
+	if err != nil {
+		return err
+	}
+	dial := handshakeDialer(opts.ConnectionAppName, compressors, DefaultDialTimeout, self.dialServer)
+	self.config = config
+	if self.dial == nil {
+		self.dial = func(network, addr string, config *tls.Config) (net.Conn, error) {
+			return tls.DialWithDialer(&net.Dialer{Timeout: DefaultDialTimeout}, network, addr, config)
+		}
+	}
+
+	// create the addresses to be used to connect
+	connectionAddrs := util.CreateConnectionAddrs(opts.Host, opts.Port)
+
+	// set up the dial info
+	self.dialInfo = &mgo.DialInfo{
+		Addrs:          connectionAddrs,
+		Timeout:        DefaultDialTimeout,
+		Direct:         opts.Direct,
+		ReplicaSetName: opts.ReplicaSetName,
+		Username:       opts.Auth.Username,
+		Password:       opts.Auth.Password,
+		Source:         opts.GetAuthenticationDatabase(),
+		Mechanism:      opts.Auth.Mechanism,
+		DialServer: func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return dial(addr.String())
+		},
+	}
+	return nil
+}
+
+// GetNewSession connects to the server and returns the established session and any
+// error encountered.
+func (self *TLSDBConnector) GetNewSession() (*mgo.Session, error) {
+	return mgo.DialWithInfo(self.dialInfo)
+}
+
+// dialServer opens a TLS connection to addr, verifying the server's certificate
+// against the host name it was addressed by.
+func (self *TLSDBConnector) dialServer(addr string) (net.Conn, error) {
+	config := self.config.Clone()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		config.ServerName = host
+	} else {
+		config.ServerName = addr
+	}
+	return self.dial("tcp", addr, config)
+}
+
+// buildTLSConfig creates the tls.Config for the given options: the CA file
+// replaces the system roots, the certificate and key file is presented to the
+// server, decrypted with the --sslPEMKeyPassword if it's set, and the server's
+// certificate chain is checked against the CRL file. As with the openssl
+// connector, the server's certificate isn't checked at all with
+// --sslAllowInvalidCertificates, and with --sslAllowInvalidHostnames its chain
+// is checked but not its host name.
+func buildTLSConfig(opts *options.TLS, ssl *options.SSL) (*tls.Config, error) {
+	if ssl == nil {
+		ssl = &options.SSL{}
+	}
+	if ssl.SSLFipsMode {
+		return nil, fmt.Errorf("cannot use --sslFIPSMode with the tls options, which don't use openssl")
+	}
+	config := &tls.Config{}
+	if opts.CAFile != "" {
+		pemCerts, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading --tlsCAFile: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pemCerts) {
+			return nil, fmt.Errorf("no certificates found in --tlsCAFile %v", opts.CAFile)
+		}
+	}
+	if opts.CertKeyFile != "" {
+		cert, err := loadCertKeyFile(opts.CertKeyFile, ssl.SSLPEMKeyPassword)
+		if err != nil {
+			return nil, fmt.Errorf("error loading --tlsCertKeyFile: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	var crl *x509.RevocationList
+	if opts.CRLFile != "" {
+		var err error
+		crl, err = loadCRL(opts.CRLFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading --tlsCRLFile: %v", err)
+		}
+	}
+	switch {
+	case ssl.SSLAllowInvalidCert:
+		config.InsecureSkipVerify = true
+	case ssl.SSLAllowInvalidHost:
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyChain(config.RootCAs, crl)
+	case crl != nil:
+		config.VerifyPeerCertificate = checkRevoked(crl)
+	}
+	return config, nil
+}
+
+// loadCertKeyFile loads a certificate and its key from the same file, decrypting
+// the key with the password if it is encrypted.
+func loadCertKeyFile(path, password string) (tls.Certificate, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	var certPEM, keyPEM []byte
+	for block, rest := pem.Decode(raw); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			certPEM = append(certPEM, pem.EncodeToMemory(block)...)
+			continue
+		}
+		if x509.IsEncryptedPEMBlock(block) {
+			if password == "" {
+				return tls.Certificate{}, fmt.Errorf("the key is encrypted; use --sslPEMKeyPassword to decrypt it")
+			}
+			der, err := x509.DecryptPEMBlock(block, []byte(password))
+			if err != nil {
+				return tls.Certificate{}, fmt.Errorf("error decrypting the key: %v", err)
+			}
+			block = &pem.Block{Type: block.Type, Bytes: der}
+		}
+		keyPEM = append(keyPEM, pem.EncodeToMemory(block)...)
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// verifyChain returns a function for tls.Config.VerifyPeerCertificate that
+// checks the server's certificate chain against the roots, but not its host
+// name, and then against the crl if there is one.
+func verifyChain(roots *x509.CertPool, crl *x509.RevocationList) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("the server presented no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		chains, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		if err != nil {
+			return err
+		}
+		if crl == nil {
+			return nil
+		}
+		return checkRevoked(crl)(rawCerts, chains)
+	}
+}
+
+// loadCRL reads a certificate revocation list in either PEM or DER form.
+func loadCRL(path string) (*x509.RevocationList, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(raw); block != nil {
+		raw = block.Bytes
+	}
+	return x509.ParseRevocationList(raw)
+}
+
+// checkRevoked returns a function for tls.Config.VerifyPeerCertificate that
+// rejects any verified chain containing a certificate revoked by the crl.
+func checkRevoked(crl *x509.RevocationList) func([][]byte, [][]*x509.Certificate) error {
+	return func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if time.Now().After(crl.NextUpdate) && !crl.NextUpdate.IsZero() {
+			return fmt.Errorf("the certificate revocation list expired at %v", crl.NextUpdate)
+		}
+		for _, chain := range verifiedChains {
+			for _, cert := range chain {
+				for _, revoked := range crl.RevokedCertificateEntries {
+					if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+						return fmt.Errorf("certificate %v has been revoked", cert.Subject.CommonName)
+					}
+				}
+			}
+		}
+		return nil
+	}
+}
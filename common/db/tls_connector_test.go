@@ -0,0 +1,190 @@
+package db
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertMaterial writes a self-signed certificate and its key to
+// certkey.pem, the certificate alone to ca.pem, and an empty revocation
+// list signed by it to crl.pem, all in dir.
+func writeTestCertMaterial(dir string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return err
+	}
+	crlDER, err := x509.CreateRevocationList(rand.Reader,
+		&x509.RevocationList{Number: big.NewInt(1), ThisUpdate: time.Now(), NextUpdate: time.Now().Add(time.Hour)},
+		cert, key)
+	if err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	crlPEM := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crlDER})
+	if err = ioutil.WriteFile(filepath.Join(dir, "ca.pem"), certPEM, 0600); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "certkey.pem"), append(certPEM, keyPEM...), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "crl.pem"), crlPEM, 0600)
+}
+
+func TestTLSDBConnector(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With certificate material written to a temporary directory", t, func() {
+		dir, err := ioutil.TempDir("", "tls_connector_test")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		So(writeTestCertMaterial(dir), ShouldBeNil)
+
+		opts := options.ToolOptions{
+			Connection: &options.Connection{
+				Host: "host1",
+				Port: "20000",
+			},
+			Auth: &options.Auth{},
+			TLS: &options.TLS{
+				CAFile:      filepath.Join(dir, "ca.pem"),
+				CertKeyFile: filepath.Join(dir, "certkey.pem"),
+				CRLFile:     filepath.Join(dir, "crl.pem"),
+			},
+		}
+
+		Convey("getConnector should choose the tls connector", func() {
+			_, ok := getConnector(opts).(*TLSDBConnector)
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("the dialer should be given the configured cert material", func() {
+			var dialedAddr string
+			var dialedConfig *tls.Config
+			connector := &TLSDBConnector{
+				dial: func(network, addr string, config *tls.Config) (net.Conn, error) {
+					dialedAddr, dialedConfig = addr, config
+					return nil, errors.New("stub dialer")
+				},
+			}
+			So(connector.Configure(opts), ShouldBeNil)
+			So(connector.dialInfo.Addrs, ShouldResemble, []string{"host1:20000"})
+			So(connector.dialInfo.DialServer, ShouldNotBeNil)
+
+			_, err := connector.dialServer("host1:20000")
+			So(err, ShouldNotBeNil)
+			So(dialedAddr, ShouldEqual, "host1:20000")
+			So(dialedConfig, ShouldNotBeNil)
+			So(dialedConfig.ServerName, ShouldEqual, "host1")
+			So(dialedConfig.RootCAs, ShouldNotBeNil)
+			So(len(dialedConfig.Certificates), ShouldEqual, 1)
+			So(dialedConfig.VerifyPeerCertificate, ShouldNotBeNil)
+		})
+
+		Convey("a missing file should be reported by Configure", func() {
+			opts.TLS.CRLFile = filepath.Join(dir, "missing.pem")
+			err := (&TLSDBConnector{}).Configure(opts)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--tlsCRLFile")
+		})
+
+		Convey("--sslAllowInvalidCertificates should skip checking the server's certificate", func() {
+			config, err := buildTLSConfig(opts.TLS, &options.SSL{SSLAllowInvalidCert: true})
+			So(err, ShouldBeNil)
+			So(config.InsecureSkipVerify, ShouldBeTrue)
+			So(config.VerifyPeerCertificate, ShouldBeNil)
+		})
+
+		Convey("--sslAllowInvalidHostnames should check the chain but not the host name", func() {
+			config, err := buildTLSConfig(opts.TLS, &options.SSL{SSLAllowInvalidHost: true})
+			So(err, ShouldBeNil)
+			So(config.InsecureSkipVerify, ShouldBeTrue)
+			certPEM, err := ioutil.ReadFile(opts.TLS.CAFile)
+			So(err, ShouldBeNil)
+			block, _ := pem.Decode(certPEM)
+			So(config.VerifyPeerCertificate([][]byte{block.Bytes}, nil), ShouldBeNil)
+
+			Convey("rejecting a certificate the CA didn't sign", func() {
+				key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				So(err, ShouldBeNil)
+				template := &x509.Certificate{SerialNumber: big.NewInt(2), NotBefore: time.Now(),
+					NotAfter: time.Now().Add(time.Hour)}
+				other, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+				So(err, ShouldBeNil)
+				So(config.VerifyPeerCertificate([][]byte{other}, nil), ShouldNotBeNil)
+			})
+		})
+
+		Convey("an encrypted key should be decrypted with --sslPEMKeyPassword", func() {
+			raw, err := ioutil.ReadFile(opts.TLS.CertKeyFile)
+			So(err, ShouldBeNil)
+			certBlock, rest := pem.Decode(raw)
+			keyBlock, _ := pem.Decode(rest)
+			encrypted, err := x509.EncryptPEMBlock(rand.Reader, keyBlock.Type, keyBlock.Bytes,
+				[]byte("secret"), x509.PEMCipherAES256)
+			So(err, ShouldBeNil)
+			path := filepath.Join(dir, "encrypted.pem")
+			So(ioutil.WriteFile(path, append(pem.EncodeToMemory(certBlock), pem.EncodeToMemory(encrypted)...), 0600),
+				ShouldBeNil)
+			opts.TLS.CertKeyFile = path
+
+			config, err := buildTLSConfig(opts.TLS, &options.SSL{SSLPEMKeyPassword: "secret"})
+			So(err, ShouldBeNil)
+			So(len(config.Certificates), ShouldEqual, 1)
+			_, err = buildTLSConfig(opts.TLS, &options.SSL{})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--sslPEMKeyPassword")
+		})
+
+		Convey("--sslFIPSMode should be rejected", func() {
+			_, err := buildTLSConfig(opts.TLS, &options.SSL{SSLFipsMode: true})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a file without certificates should be rejected", func() {
+			opts.TLS.CAFile = filepath.Join(dir, "crl.pem")
+			So((&TLSDBConnector{}).Configure(opts), ShouldNotBeNil)
+		})
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 	"strconv"
 )
 
@@ -121,3 +122,27 @@ func BuildWriteConcern(writeConcern string, nodeType NodeType) (*mgo.Safe, error
 	)
 	return sessionSafety, nil
 }
+
+// WriteConcernDocument converts the write concern of an mgo session to the
+// document form used in the writeConcern field of commands.
+func WriteConcernDocument(safety *mgo.Safe) bson.D {
+	if safety == nil {
+		return bson.D{{w, 0}}
+	}
+	wc := bson.D{}
+	if safety.WMode != "" {
+		wc = append(wc, bson.DocElem{w, safety.WMode})
+	} else if safety.W > 0 {
+		wc = append(wc, bson.DocElem{w, safety.W})
+	}
+	if safety.J {
+		wc = append(wc, bson.DocElem{j, true})
+	}
+	if safety.FSync {
+		wc = append(wc, bson.DocElem{fSync, true})
+	}
+	if safety.WTimeout > 0 {
+		wc = append(wc, bson.DocElem{wTimeout, safety.WTimeout})
+	}
+	return wc
+}
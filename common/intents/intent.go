@@ -5,6 +5,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"gopkg.in/mgo.v2/bson"
 	"io"
+	"strings"
 	"sync"
 )
 
@@ -33,6 +34,10 @@ type Intent struct {
 	// Collection options
 	Options *bson.D
 
+	// Set for an oplog to replay whose collection isn't named "oplog", such as
+	// one an archive's prelude classifies as the oplog
+	Oplog bool
+
 	// File/collection size, for some prioritizer implementations.
 	// Units don't matter as long as they are consistent for a given use case.
 	Size int64
@@ -43,7 +48,7 @@ func (it *Intent) Namespace() string {
 }
 
 func (it *Intent) IsOplog() bool {
-	return it.DB == "" && it.C == "oplog"
+	return it.DB == "" && (it.C == "oplog" || it.Oplog)
 }
 
 func (it *Intent) IsUsers() bool {
@@ -80,6 +85,25 @@ func (it *Intent) IsSystemIndexes() bool {
 	return it.C == "system.indexes" && it.BSONPath != ""
 }
 
+// timeseriesBucketsPrefix is the prefix of the collections that hold the
+// buckets of time-series collections.
+const timeseriesBucketsPrefix = "system.buckets."
+
+// IsTimeseriesBuckets returns true if the intent is for the collection holding the
+// buckets of a time-series collection, rather than for a collection of its own.
+func (it *Intent) IsTimeseriesBuckets() bool {
+	return strings.HasPrefix(it.C, timeseriesBucketsPrefix) && len(it.C) > len(timeseriesBucketsPrefix)
+}
+
+// TimeseriesCollection returns the name of the time-series collection whose
+// buckets the intent is for, or "" if it isn't for buckets.
+func (it *Intent) TimeseriesCollection() string {
+	if !it.IsTimeseriesBuckets() {
+		return ""
+	}
+	return strings.TrimPrefix(it.C, timeseriesBucketsPrefix)
+}
+
 func (intent *Intent) IsSpecialCollection() bool {
 	return intent.IsSystemIndexes() || intent.IsUsers() || intent.IsRoles() || intent.IsAuthVersion()
 }
@@ -326,6 +350,37 @@ func (manager *Manager) Finalize(pType PriorityType) {
 	manager.intentsByDiscoveryOrder = nil
 }
 
+// FinalizeInOrder is like Finalize, except that the intents of the given
+// namespaces are returned first, in the order they're given, before the other
+// intents are returned as the prioritizer of the given type would. It returns
+// the given namespaces that the manager has no intents for.
+func (manager *Manager) FinalizeInOrder(pType PriorityType, order []string) []string {
+	queue := []*Intent{}
+	listed := map[*Intent]bool{}
+	missing := []string{}
+	for _, ns := range order {
+		intent := manager.intents[ns]
+		if intent == nil {
+			missing = append(missing, ns)
+			continue
+		}
+		if !listed[intent] {
+			listed[intent] = true
+			queue = append(queue, intent)
+		}
+	}
+	rest := []*Intent{}
+	for _, intent := range manager.intentsByDiscoveryOrder {
+		if !listed[intent] {
+			rest = append(rest, intent)
+		}
+	}
+	manager.intentsByDiscoveryOrder = rest
+	manager.Finalize(pType)
+	manager.prioritizer = &orderedPrioritizer{queue: queue, listed: listed, rest: manager.prioritizer}
+	return missing
+}
+
 func (manager *Manager) UsePrioritizer(prioritizer IntentPrioritizer) {
 	manager.prioritizer = prioritizer
 }
@@ -52,6 +52,31 @@ func (legacy *legacyPrioritizer) Finish(*Intent) {
 	return
 }
 
+//===== Ordered =====
+
+// orderedPrioritizer returns a list of intents in the order they're listed,
+// and then the rest of the intents as another prioritizer returns them.
+type orderedPrioritizer struct {
+	queue  []*Intent
+	listed map[*Intent]bool
+	rest   IntentPrioritizer
+}
+
+func (ordered *orderedPrioritizer) Get() *Intent {
+	if len(ordered.queue) == 0 {
+		return ordered.rest.Get()
+	}
+	var intent *Intent
+	intent, ordered.queue = ordered.queue[0], ordered.queue[1:]
+	return intent
+}
+
+func (ordered *orderedPrioritizer) Finish(intent *Intent) {
+	if !ordered.listed[intent] {
+		ordered.rest.Finish(intent)
+	}
+}
+
 //===== Longest Task First =====
 
 // longestTaskFirstPrioritizer returns intents in the order of largest -> smallest,
@@ -32,6 +32,37 @@ func TestLegacyPrioritizer(t *testing.T) {
 	})
 }
 
+func TestOrderedPrioritizer(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a manager finalized with an explicit order for some namespaces", t, func() {
+		manager := NewIntentManager()
+		for _, intent := range []*Intent{
+			&Intent{DB: "db1", C: "a", Size: 10},
+			&Intent{DB: "db1", C: "b", Size: 20},
+			&Intent{DB: "db2", C: "c", Size: 30},
+			&Intent{DB: "db2", C: "d", Size: 40},
+		} {
+			manager.Put(intent)
+		}
+		missing := manager.FinalizeInOrder(Legacy, []string{"db2.d", "db1.a", "db3.e", "db2.d"})
+
+		Convey("the listed namespaces should be processed in the given order, then the rest", func() {
+			namespaces := []string{}
+			for intent := manager.Pop(); intent != nil; intent = manager.Pop() {
+				namespaces = append(namespaces, intent.Namespace())
+				manager.Finish(intent)
+			}
+			So(namespaces, ShouldResemble, []string{"db2.d", "db1.a", "db1.b", "db2.c"})
+		})
+
+		Convey("the listed namespaces without intents should be returned", func() {
+			So(missing, ShouldResemble, []string{"db3.e"})
+		})
+	})
+}
+
 func TestBasicDBHeapBehavior(t *testing.T) {
 	var dbheap heap.Interface
 
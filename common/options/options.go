@@ -40,6 +40,14 @@ type ToolOptions struct {
 	*Namespace
 	*HiddenOptions
 
+	// TLS options for connecting with Go's own TLS implementation. These are
+	// only registered by tools that support them, with AddOptions.
+	TLS *TLS
+
+	// Compression options for the messages sent to and from the server. These
+	// are only registered by tools that support them, with AddOptions.
+	Compression *Compression
+
 	// Force direct connection to the server and disable the
 	// drivers automatic repl set discovery logic.
 	Direct bool
@@ -50,6 +58,11 @@ type ToolOptions struct {
 	// specified or discovered via the servers contacted.
 	ReplicaSetName string
 
+	// ConnectionAppName, if specified, is sent to the server as the application
+	// name of each connection, so that they can be picked out in its logs. It is
+	// only sent by the connectors that don't use --ssl or kerberos.
+	ConnectionAppName string
+
 	// for caching the parser
 	parser *flags.Parser
 }
@@ -112,6 +125,53 @@ type SSL struct {
 	SSLFipsMode         bool   `long:"sslFIPSMode" description:"use FIPS mode of the installed openssl library"`
 }
 
+// Struct holding the options for connecting over TLS without openssl
+type TLS struct {
+	CAFile      string `long:"tlsCAFile" description:"the .pem file containing the root certificate chain used to validate the server's certificate"`
+	CertKeyFile string `long:"tlsCertKeyFile" description:"the .pem file containing the client certificate and key to present to the server"`
+	CRLFile     string `long:"tlsCRLFile" description:"the .pem file containing the certificate revocation list used to validate the server's certificate"`
+}
+
+func (*TLS) Name() string {
+	return "tls"
+}
+
+// Enabled returns true if any of the tls options are set.
+func (tls *TLS) Enabled() bool {
+	return tls != nil && (tls.CAFile != "" || tls.CertKeyFile != "" || tls.CRLFile != "")
+}
+
+// Validate returns an error if any of the files given to the tls options
+// cannot be found.
+func (tls *TLS) Validate() error {
+	if tls == nil {
+		return nil
+	}
+	files := []struct{ flag, path string }{
+		{"tlsCAFile", tls.CAFile},
+		{"tlsCertKeyFile", tls.CertKeyFile},
+		{"tlsCRLFile", tls.CRLFile},
+	}
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			return fmt.Errorf("cannot use --%v: %v", file.flag, err)
+		}
+	}
+	return nil
+}
+
+// Struct holding the options for compressing messages to and from the server
+type Compression struct {
+	Compressors string `long:"compressors" description:"comma-separated list of compressors to compress messages to and from the server with, in order of preference; the first the server also supports is used, and messages are left uncompressed if it supports none. Only zlib is supported, and snappy and zstd are skipped with a warning; it can be used with the tls options, but not with --ssl or kerberos"`
+}
+
+func (*Compression) Name() string {
+	return "compression"
+}
+
 // Struct holding auth-related options
 type Auth struct {
 	Username  string `short:"u" long:"username" description:"username for authentication"`
@@ -150,6 +210,8 @@ func New(appName, usageStr string, enabled EnabledOptions) *ToolOptions {
 		Verbosity:     &Verbosity{},
 		Connection:    &Connection{},
 		SSL:           &SSL{},
+		TLS:           &TLS{},
+		Compression:   &Compression{},
 		Auth:          &Auth{},
 		Namespace:     &Namespace{},
 		HiddenOptions: hiddenOpts,
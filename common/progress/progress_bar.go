@@ -82,6 +82,10 @@ type Bar struct {
 	// values necessary for calculation
 	Watching Progressor
 
+	// Started, if set, is when the task started, and the bar also shows the
+	// estimated time remaining at the average rate since then
+	Started time.Time
+
 	// Writer is where the Bar is written out to
 	Writer io.Writer
 	// WaitTime is the time to wait between writing the bar
@@ -142,6 +146,32 @@ func (pb *Bar) formatCounts() (string, string) {
 	return fmt.Sprintf("%v", maxCount), fmt.Sprintf("%v", currentCount)
 }
 
+// EstimateRemaining returns the time left until current reaches max at the
+// average rate current reached its value in elapsed, or false if it can't be
+// estimated yet.
+func EstimateRemaining(max, current int64, elapsed time.Duration) (time.Duration, bool) {
+	if current <= 0 || max <= 0 || elapsed <= 0 {
+		return 0, false
+	}
+	if current >= max {
+		return 0, true
+	}
+	return time.Duration(float64(elapsed) * float64(max-current) / float64(current)), true
+}
+
+// formatETA returns the estimated time remaining shown after the bar, or "" if
+// the bar has no start time.
+func (pb *Bar) formatETA(maxCount, currentCount int64) string {
+	if pb.Started.IsZero() {
+		return ""
+	}
+	remaining, ok := EstimateRemaining(maxCount, currentCount, time.Since(pb.Started))
+	if !ok {
+		return "ETA unknown"
+	}
+	return fmt.Sprintf("ETA %v", remaining.Round(time.Second))
+}
+
 // computes all necessary values renders to the bar's Writer
 func (pb *Bar) renderToWriter() {
 	pb.hasRendered = true
@@ -161,6 +191,9 @@ func (pb *Bar) renderToWriter() {
 		maxStr,
 		percent*100,
 	)
+	if eta := pb.formatETA(maxCount, currentCount); eta != "" {
+		fmt.Fprintf(pb.Writer, " %v", eta)
+	}
 }
 
 func (pb *Bar) renderToGridRow(grid *text.GridWriter) {
@@ -178,6 +211,9 @@ func (pb *Bar) renderToGridRow(grid *text.GridWriter) {
 			fmt.Sprintf("%s/%s", currentStr, maxStr),
 			fmt.Sprintf("(%2.1f%%)", percent*100),
 		)
+		if eta := pb.formatETA(maxCount, currentCount); eta != "" {
+			grid.WriteCell(eta)
+		}
 	}
 	grid.EndRow()
 }
@@ -182,3 +182,44 @@ func TestBarUnits(t *testing.T) {
 		})
 	})
 }
+
+func TestBarETA(t *testing.T) {
+	writeBuffer := &bytes.Buffer{}
+
+	Convey("With a ProgressBar a quarter of the way done after 10 seconds", t, func() {
+		watching := NewCounter(1000)
+		watching.Inc(250)
+		pbar := &Bar{
+			Name:      "TEST",
+			Watching:  watching,
+			Writer:    writeBuffer,
+			BarLength: 10,
+			Started:   time.Now().Add(-10 * time.Second),
+		}
+
+		Convey("the remaining time should be estimated from the rate so far", func() {
+			remaining, ok := EstimateRemaining(1000, 250, 10*time.Second)
+			So(ok, ShouldBeTrue)
+			So(remaining, ShouldEqual, 30*time.Second)
+		})
+
+		Convey("the written output should contain the percentage and the ETA", func() {
+			pbar.renderToWriter()
+			So(writeBuffer.String(), ShouldContainSubstring, "250/1000 (25.0%) ETA 30s")
+		})
+
+		Convey("the ETA should be unknown until there's progress", func() {
+			watching.Set(0)
+			pbar.renderToWriter()
+			So(writeBuffer.String(), ShouldContainSubstring, "0/1000 (0.0%) ETA unknown")
+			_, ok := EstimateRemaining(1000, 0, 10*time.Second)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("a finished bar should have nothing remaining", func() {
+			remaining, ok := EstimateRemaining(1000, 1000, 10*time.Second)
+			So(ok, ShouldBeTrue)
+			So(remaining, ShouldEqual, 0)
+		})
+	})
+}
@@ -8,13 +8,16 @@ import (
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
-// Metadata holds information about a collection's options and indexes.
+// Metadata holds information about a collection's options and indexes, and its
+// shard key when it is dumped from a sharded cluster.
 type Metadata struct {
-	Options interface{}   `json:"options,omitempty"`
-	Indexes []interface{} `json:"indexes"`
+	Options  interface{}   `json:"options,omitempty"`
+	Indexes  []interface{} `json:"indexes"`
+	ShardKey interface{}   `json:"shardKey,omitempty"`
 }
 
 // IndexDocumentFromDB is used internally to preserve key ordering.
@@ -85,6 +88,25 @@ func (dump *MongoDump) dumpMetadata(intent *intents.Intent) error {
 		return fmt.Errorf("error getting indexes for collection `%v`: %v", nsID, err)
 	}
 
+	// When dumping through a mongos, we also record the collection's shard key,
+	// if it has one, so that mongorestore --autoShard can shard it the same way.
+	if dump.isMongos {
+		// decode into a bson.D so the order of the key's fields is kept
+		collInfo := struct {
+			Key bson.D `bson:"key"`
+		}{}
+		err = session.DB("config").C("collections").Find(
+			bson.M{"_id": nsID, "dropped": bson.M{"$ne": true}}).One(&collInfo)
+		if err != nil && err != mgo.ErrNotFound {
+			return fmt.Errorf("error getting shard key for collection `%v`: %v", nsID, err)
+		}
+		if len(collInfo.Key) > 0 {
+			if meta.ShardKey, err = bsonutil.ConvertBSONValueToJSON(collInfo.Key); err != nil {
+				return fmt.Errorf("error converting shard key to JSON: %v", err)
+			}
+		}
+	}
+
 	// Finally, we send the results to the writer as JSON bytes
 	jsonBytes, err := json.Marshal(meta)
 	if err != nil {
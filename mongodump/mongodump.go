@@ -248,7 +248,11 @@ func (dump *MongoDump) Dump() (err error) {
 	}
 
 	if dump.OutputOptions.Archive != "" {
-		dump.archive.Prelude, err = archive.NewPrelude(dump.manager, dump.ToolOptions.HiddenOptions.MaxProcs)
+		serverVersion, err := dump.sessionProvider.ServerVersion()
+		if err != nil {
+			log.Logf(log.Info, "not recording the server version in the archive: %v", err)
+		}
+		dump.archive.Prelude, err = archive.NewPrelude(dump.manager, dump.ToolOptions.HiddenOptions.MaxProcs, serverVersion)
 		if err != nil {
 			return fmt.Errorf("creating archive prelude: %v", err)
 		}
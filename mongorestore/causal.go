@@ -0,0 +1,31 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+// causalRunner is a commandRunner that runs each command in a causally
+// consistent session.
+type causalRunner struct {
+	commandRunner
+	session *db.CausalSession
+}
+
+func (runner *causalRunner) Run(command interface{}, out interface{}, database string) error {
+	return runner.session.Run(func(command interface{}, out interface{}) error {
+		return runner.commandRunner.Run(command, out, database)
+	}, command, out)
+}
+
+// logCausalTime logs the operation time of the --causalConsistency session once
+// the restore is done, after which reads in a session that has seen the time see
+// all of the restored data.
+func (restore *MongoRestore) logCausalTime() {
+	if restore.causalSession == nil {
+		return
+	}
+	operationTime := restore.causalSession.OperationTime()
+	log.Logf(log.Always, "restored data is visible to causally consistent reads after cluster time {t: %v, i: %v}",
+		operationTime>>32, uint32(operationTime))
+}
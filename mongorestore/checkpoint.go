@@ -0,0 +1,73 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/log"
+	"sync/atomic"
+)
+
+// docCheckpoints counts the documents inserted in to a namespace across its
+// insertion workers, and logs a line each time another --logEveryDocs of them
+// have been, so that tools parsing the log can follow a restore by count rather
+// than by time.
+type docCheckpoints struct {
+	ns       string
+	interval int64
+	count    int64
+}
+
+// newDocCheckpoints returns the checkpoints of the namespace, or nil if
+// --logEveryDocs isn't set.
+func (restore *MongoRestore) newDocCheckpoints(ns string) *docCheckpoints {
+	if restore.OutputOptions == nil || restore.OutputOptions.LogEveryDocs <= 0 {
+		return nil
+	}
+	return &docCheckpoints{ns: ns, interval: int64(restore.OutputOptions.LogEveryDocs)}
+}
+
+// add counts n more inserted documents, logging each checkpoint they pass. It
+// does nothing on a nil *docCheckpoints, and is safe to call from more than one
+// goroutine.
+func (checkpoints *docCheckpoints) add(n int64) {
+	if checkpoints == nil {
+		return
+	}
+	count := atomic.AddInt64(&checkpoints.count, n)
+	for passed := (count-n)/checkpoints.interval + 1; passed <= count/checkpoints.interval; passed++ {
+		log.Logf(log.Always, "checkpoint: %v documents inserted in to %v", passed*checkpoints.interval,
+			checkpoints.ns)
+	}
+}
+
+// checkpointInserter counts the documents it inserts towards the namespace's
+// checkpoints once a flush has inserted them. It flushes whenever a batch is
+// full, as the inserter it wraps would, so that the checkpoints keep up with the
+// inserts. When an insert fails, the documents buffered before it aren't counted,
+// since the failed flush may not have inserted them.
+type checkpointInserter struct {
+	documentInserter
+	checkpoints *docCheckpoints
+	batchSize   int
+	pending     int64
+}
+
+func (bulk *checkpointInserter) Insert(doc interface{}) error {
+	if err := bulk.documentInserter.Insert(doc); err != nil {
+		// the document is buffered after the failed flush of those before it
+		bulk.pending = 1
+		return err
+	}
+	bulk.pending++
+	if bulk.pending >= int64(bulk.batchSize) {
+		return bulk.Flush()
+	}
+	return nil
+}
+
+func (bulk *checkpointInserter) Flush() error {
+	err := bulk.documentInserter.Flush()
+	if err == nil {
+		bulk.checkpoints.add(bulk.pending)
+	}
+	bulk.pending = 0
+	return err
+}
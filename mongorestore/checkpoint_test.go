@@ -0,0 +1,130 @@
+package mongorestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// flakyInserter stands in for a bulk inserter whose flushes fail while failing is set.
+type flakyInserter struct {
+	failing bool
+}
+
+func (*flakyInserter) Insert(doc interface{}) error {
+	return nil
+}
+
+func (bulk *flakyInserter) Flush() error {
+	if bulk.failing {
+		return fmt.Errorf("E11000 duplicate key error")
+	}
+	return nil
+}
+
+func TestLogEveryDocs(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	checkpointLine := regexp.MustCompile(`checkpoint: (\d+) documents inserted in to (\S+)`)
+	checkpointsLogged := func(logged *bytes.Buffer) []string {
+		lines := []string{}
+		for _, match := range checkpointLine.FindAllStringSubmatch(logged.String(), -1) {
+			lines = append(lines, match[2]+" "+match[1])
+		}
+		return lines
+	}
+
+	Convey("With --logEveryDocs=10", t, func() {
+		logged := &bytes.Buffer{}
+		log.SetWriter(logged)
+		dir, err := ioutil.TempDir("", "mongorestore_log_every_docs")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			log.SetWriter(os.Stderr)
+			os.RemoveAll(dir)
+		})
+
+		restore := &MongoRestore{
+			ToolOptions:      &commonOpts.ToolOptions{},
+			InputOptions:     &InputOptions{},
+			OutputOptions:    &OutputOptions{LogEveryDocs: 10},
+			DocumentSink:     &bytes.Buffer{},
+			knownCollections: map[string][]string{"db1": {}},
+		}
+
+		Convey("a line should be logged after every 10 documents restored", func() {
+			path := filepath.Join(dir, "c1.bson")
+			data := []byte{}
+			for i := 0; i < 25; i++ {
+				raw, err := bson.Marshal(bson.D{{"_id", i}})
+				So(err, ShouldBeNil)
+				data = append(data, raw...)
+			}
+			So(ioutil.WriteFile(path, data, 0644), ShouldBeNil)
+			intent := &intents.Intent{DB: "db1", C: "c1", BSONPath: path, Location: path}
+			intent.BSONFile = &realBSONFile{intent: intent}
+
+			So(restore.RestoreIntent(intent), ShouldBeNil)
+			So(checkpointsLogged(logged), ShouldResemble, []string{"db1.c1 10", "db1.c1 20"})
+		})
+
+		Convey("documents counted by several workers should log each checkpoint once", func() {
+			checkpoints := restore.newDocCheckpoints("db1.c2")
+			wait := sync.WaitGroup{}
+			for worker := 0; worker < 4; worker++ {
+				wait.Add(1)
+				go func() {
+					defer wait.Done()
+					for i := 0; i < 10; i++ {
+						checkpoints.add(1)
+					}
+				}()
+			}
+			wait.Wait()
+			// the workers may log their checkpoints out of order
+			lines := checkpointsLogged(logged)
+			sort.Strings(lines)
+			So(lines, ShouldResemble,
+				[]string{"db1.c2 10", "db1.c2 20", "db1.c2 30", "db1.c2 40"})
+		})
+
+		Convey("only the documents of the flushes that succeed should be counted", func() {
+			inner := &flakyInserter{}
+			checkpoints := restore.newDocCheckpoints("db1.c3")
+			bulk := &checkpointInserter{documentInserter: inner, checkpoints: checkpoints, batchSize: 5}
+			insert := func(n int) {
+				for i := 0; i < n; i++ {
+					bulk.Insert(bson.Raw{})
+				}
+			}
+			insert(10)
+			inner.failing = true
+			insert(5)
+			inner.failing = false
+			insert(7)
+			So(bulk.Flush(), ShouldBeNil)
+			So(checkpoints.count, ShouldEqual, 17)
+			So(checkpointsLogged(logged), ShouldResemble, []string{"db1.c3 10"})
+		})
+	})
+
+	Convey("Without --logEveryDocs, nothing should be counted", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		checkpoints := restore.newDocCheckpoints("db1.c1")
+		So(checkpoints, ShouldBeNil)
+		checkpoints.add(1)
+	})
+}
@@ -0,0 +1,92 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"sort"
+	"strings"
+)
+
+// Severities of --caseCollisions.
+const (
+	caseCollisionsError  = "error"
+	caseCollisionsWarn   = "warn"
+	caseCollisionsIgnore = "ignore"
+)
+
+// findCaseCollisions returns the groups of names that differ only by case, each
+// sorted, in order of their first name. Names that are the same are not collisions.
+func findCaseCollisions(names []string) [][]string {
+	byFolded := map[string][]string{}
+	for _, name := range names {
+		folded := strings.ToLower(name)
+		if !util.StringSliceContains(byFolded[folded], name) {
+			byFolded[folded] = append(byFolded[folded], name)
+		}
+	}
+	collisions := [][]string{}
+	for _, group := range byFolded {
+		if len(group) > 1 {
+			sort.Strings(group)
+			collisions = append(collisions, group)
+		}
+	}
+	sort.Sort(byFirstName(collisions))
+	return collisions
+}
+
+// byFirstName sorts groups of names by the first name of each.
+type byFirstName [][]string
+
+func (groups byFirstName) Len() int           { return len(groups) }
+func (groups byFirstName) Swap(i, j int)      { groups[i], groups[j] = groups[j], groups[i] }
+func (groups byFirstName) Less(i, j int) bool { return groups[i][0] < groups[j][0] }
+
+// restoredNamespaceCollisions returns the databases to restore whose names differ
+// only by case, and then the collections of each database that do. The server never
+// allows databases like that, and collections like that collide on targets that
+// fold case.
+func (restore *MongoRestore) restoredNamespaceCollisions() [][]string {
+	dbNames := []string{}
+	namespacesByDB := map[string][]string{}
+	for _, intent := range restore.manager.Intents() {
+		if intent.DB == "" {
+			continue
+		}
+		if _, ok := namespacesByDB[intent.DB]; !ok {
+			dbNames = append(dbNames, intent.DB)
+		}
+		namespacesByDB[intent.DB] = append(namespacesByDB[intent.DB], intent.Namespace())
+	}
+	collisions := findCaseCollisions(dbNames)
+	sort.Strings(dbNames)
+	for _, dbName := range dbNames {
+		collisions = append(collisions, findCaseCollisions(namespacesByDB[dbName])...)
+	}
+	return collisions
+}
+
+// checkCaseCollisions looks for names to restore that differ only by case before
+// anything is inserted, returning an error for them or logging them, as set by
+// --caseCollisions.
+func (restore *MongoRestore) checkCaseCollisions() error {
+	if restore.OutputOptions.CaseCollisions == caseCollisionsIgnore {
+		return nil
+	}
+	collisions := restore.restoredNamespaceCollisions()
+	if len(collisions) == 0 {
+		return nil
+	}
+	descriptions := []string{}
+	for _, group := range collisions {
+		descriptions = append(descriptions, strings.Join(group, ", "))
+	}
+	if restore.OutputOptions.CaseCollisions == caseCollisionsError {
+		return fmt.Errorf("names to restore differ only by case: %v", strings.Join(descriptions, "; "))
+	}
+	for _, description := range descriptions {
+		log.Logf(log.Always, "warning: names to restore differ only by case: %v", description)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/intents"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestFindCaseCollisions(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Names differing only by case should be grouped together", t, func() {
+		So(findCaseCollisions([]string{"b", "MyColl", "B", "other", "mycoll", "MYCOLL", "b"}),
+			ShouldResemble, [][]string{{"B", "b"}, {"MYCOLL", "MyColl", "mycoll"}})
+		So(findCaseCollisions([]string{"a", "b", "a"}), ShouldBeEmpty)
+	})
+}
+
+func TestCheckCaseCollisions(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive of two collections whose names differ only by case", t, func() {
+		buf := &closingBuffer{}
+		So(writeTestArchive(buf, 1,
+			&intents.Intent{DB: "db1", C: "MyColl", BSONPath: "db1/MyColl.bson"},
+			&intents.Intent{DB: "db1", C: "mycoll", BSONPath: "db1/mycoll.bson"},
+			&intents.Intent{DB: "db1", C: "other", BSONPath: "db1/other.bson"},
+			&intents.Intent{DB: "db2", C: "mycoll", BSONPath: "db2/mycoll.bson"},
+		), ShouldBeNil)
+
+		restore := &MongoRestore{
+			manager:       intents.NewIntentManager(),
+			InputOptions:  &InputOptions{Archive: "dump.archive"},
+			OutputOptions: &OutputOptions{},
+			ToolOptions:   &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+			archive:       &archive.Reader{In: buf, Prelude: &archive.Prelude{}},
+		}
+		So(restore.archive.Prelude.Read(buf), ShouldBeNil)
+		restore.archive.Demux = &archive.Demultiplexer{In: buf, NamespaceBufferSize: archiveNamespaceBufferSize}
+		target, err := restore.archive.Prelude.NewPreludeExplorer()
+		So(err, ShouldBeNil)
+		So(restore.CreateAllIntents(target, "", ""), ShouldBeNil)
+
+		Convey("the preflight should flag only those two", func() {
+			So(restore.restoredNamespaceCollisions(), ShouldResemble,
+				[][]string{{"db1.MyColl", "db1.mycoll"}})
+		})
+
+		Convey("--caseCollisions=error should fail the restore", func() {
+			restore.OutputOptions.CaseCollisions = caseCollisionsError
+			So(restore.checkCaseCollisions(), ShouldNotBeNil)
+		})
+
+		Convey("--caseCollisions=warn and ignore should only let the restore go on", func() {
+			restore.OutputOptions.CaseCollisions = caseCollisionsWarn
+			So(restore.checkCaseCollisions(), ShouldBeNil)
+			restore.OutputOptions.CaseCollisions = caseCollisionsIgnore
+			So(restore.checkCaseCollisions(), ShouldBeNil)
+		})
+	})
+
+	Convey("Databases whose names differ only by case should be flagged", t, func() {
+		restore := &MongoRestore{manager: intents.NewIntentManager()}
+		restore.manager.Put(&intents.Intent{DB: "Sales", C: "c1", BSONPath: "Sales/c1.bson"})
+		restore.manager.Put(&intents.Intent{DB: "sales", C: "c1", BSONPath: "sales/c1.bson"})
+		So(restore.restoredNamespaceCollisions(), ShouldResemble, [][]string{{"Sales", "sales"}})
+	})
+}
@@ -0,0 +1,28 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+)
+
+// commandComment returns the comment to attach to the restore's commands and
+// inserts for --appName and --comment. The application name is also sent when
+// connecting, though not with --ssl or kerberos, so it starts the comment too.
+func commandComment(appName, comment string) string {
+	switch {
+	case appName == "":
+		return comment
+	case comment == "":
+		return appName
+	}
+	return appName + ": " + comment
+}
+
+// commentingRunner is a commandRunner that attaches a comment to each command.
+type commentingRunner struct {
+	commandRunner
+	comment string
+}
+
+func (runner *commentingRunner) Run(command interface{}, out interface{}, database string) error {
+	return runner.commandRunner.Run(db.CommandWithComment(command, runner.comment), out, database)
+}
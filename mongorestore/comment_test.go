@@ -0,0 +1,42 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestCommandComment(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("The comment should name the restore with --appName", t, func() {
+		So(commandComment("", ""), ShouldEqual, "")
+		So(commandComment("", "ticket 42"), ShouldEqual, "ticket 42")
+		So(commandComment("nightly-restore", ""), ShouldEqual, "nightly-restore")
+		So(commandComment("nightly-restore", "ticket 42"), ShouldEqual, "nightly-restore: ticket 42")
+	})
+
+	Convey("With --appName and --comment and a stubbed session", t, func() {
+		runner := &stubRunner{}
+		restore := &MongoRestore{runner: runner, isMongos: true, comment: commandComment("nightly-restore", "ticket 42")}
+		intent := &intents.Intent{DB: "db", C: "users"}
+
+		Convey("the comment should be attached to each command run", func() {
+			So(restore.autoShardCollection(intent, bson.D{{"_id", 1}}), ShouldBeNil)
+			So(runner.count(), ShouldEqual, 2)
+			So(runner.commands[0], ShouldResemble,
+				bson.D{{"enableSharding", "db"}, {"comment", "nightly-restore: ticket 42"}})
+			So(runner.commands[1], ShouldResemble, bson.D{{"shardCollection", "db.users"},
+				{"key", bson.D{{"_id", 1}}}, {"comment", "nightly-restore: ticket 42"}})
+		})
+
+		Convey("no comment should be attached without them", func() {
+			restore.comment = ""
+			So(restore.autoShardCollection(intent, bson.D{{"_id", 1}}), ShouldBeNil)
+			So(runner.commands[0], ShouldResemble, bson.D{{"enableSharding", "db"}})
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"strconv"
+)
+
+// commitQuorumWireVersion is the wire version of MongoDB 4.4, the first whose
+// createIndexes takes a commitQuorum.
+const commitQuorumWireVersion = 9
+
+// parseCommitQuorum parses the argument to --indexCommitQuorum: a number of
+// data-bearing members, or a name such as "majority", "votingMembers" or that of
+// a replica set tag.
+func parseCommitQuorum(arg string) (interface{}, error) {
+	if members, err := strconv.Atoi(arg); err == nil {
+		if members < 0 {
+			return nil, fmt.Errorf("cannot specify a negative number of members")
+		}
+		return members, nil
+	}
+	return arg, nil
+}
+
+// setIndexCommitQuorum sets the commitQuorum that createIndexes is run with, for
+// --indexCommitQuorum. Only the replica set members and mongos of MongoDB 4.4 and
+// later take one, so on other servers a warning is logged and the indexes are
+// built with the server's default.
+func (restore *MongoRestore) setIndexCommitQuorum() error {
+	arg := restore.OutputOptions.IndexCommitQuorum
+	if arg == "" {
+		return nil
+	}
+	quorum, err := parseCommitQuorum(arg)
+	if err != nil {
+		return fmt.Errorf("invalid --indexCommitQuorum argument '%v': %v", arg, err)
+	}
+	isMaster := struct {
+		MaxWire int    `bson:"maxWireVersion"`
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}{}
+	err = restore.getRunner().Run("isMaster", &isMaster, "admin")
+	if err != nil {
+		return fmt.Errorf("error checking for commitQuorum support: %v", err)
+	}
+	if isMaster.MaxWire < commitQuorumWireVersion || (isMaster.SetName == "" && isMaster.Msg != "isdbgrid") {
+		log.Logf(log.Always, "warning: the target doesn't support a commitQuorum for index builds, "+
+			"so --indexCommitQuorum is ignored")
+		return nil
+	}
+	restore.indexCommitQuorum = quorum
+	return nil
+}
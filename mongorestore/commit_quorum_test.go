@@ -0,0 +1,84 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"testing"
+)
+
+// isMasterRunner answers every command with its reply, as a server would isMaster.
+type isMasterRunner struct {
+	reply bson.M
+}
+
+func (runner *isMasterRunner) Run(command interface{}, out interface{}, database string) error {
+	raw, err := bson.Marshal(runner.reply)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, out)
+}
+
+func TestIndexCommitQuorum(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --indexCommitQuorum", t, func() {
+		logged := &bytes.Buffer{}
+		log.SetWriter(logged)
+		Reset(func() {
+			log.SetWriter(os.Stderr)
+		})
+		runner := &isMasterRunner{reply: bson.M{"ok": 1, "maxWireVersion": 9, "setName": "rs0"}}
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{IndexCommitQuorum: "majority"},
+			runner:        runner,
+		}
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+		indexes := []IndexDocument{{Key: bson.D{{"a", 1}}}}
+
+		Convey("a replica set of 4.4 or later should build indexes with the commitQuorum", func() {
+			So(restore.setIndexCommitQuorum(), ShouldBeNil)
+			So(restore.createIndexesCommand(intent, indexes), ShouldResemble, bson.D{
+				{"createIndexes", "c1"},
+				{"indexes", indexes},
+				{"commitQuorum", "majority"},
+			})
+		})
+
+		Convey("a number of members should be passed as a number", func() {
+			restore.OutputOptions.IndexCommitQuorum = "2"
+			So(restore.setIndexCommitQuorum(), ShouldBeNil)
+			So(restore.createIndexesCommand(intent, indexes)[2], ShouldResemble, bson.DocElem{"commitQuorum", 2})
+		})
+
+		Convey("a mongos of 4.4 or later should take it too", func() {
+			runner.reply = bson.M{"ok": 1, "maxWireVersion": 9, "msg": "isdbgrid"}
+			So(restore.setIndexCommitQuorum(), ShouldBeNil)
+			So(restore.indexCommitQuorum, ShouldEqual, "majority")
+		})
+
+		Convey("older servers and standalones should build indexes with their default", func() {
+			for _, reply := range []bson.M{
+				{"ok": 1, "maxWireVersion": 8, "setName": "rs0"},
+				{"ok": 1, "maxWireVersion": 13},
+			} {
+				runner.reply = reply
+				So(restore.setIndexCommitQuorum(), ShouldBeNil)
+				So(restore.createIndexesCommand(intent, indexes), ShouldResemble,
+					bson.D{{"createIndexes", "c1"}, {"indexes", indexes}})
+			}
+			So(logged.String(), ShouldContainSubstring, "--indexCommitQuorum is ignored")
+		})
+
+		Convey("a negative number of members should be an error", func() {
+			restore.OutputOptions.IndexCommitQuorum = "-1"
+			So(restore.setIndexCommitQuorum(), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,57 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"sort"
+)
+
+// databaseSentinel is the collection --databasesOnly creates, and then drops,
+// in each database to make the server create the database.
+const databaseSentinel = "mongorestore_databasesOnly_sentinel"
+
+// dumpedDatabases returns the names of the databases in the dump, in order:
+// the databases listed in the archive's prelude that --includeDB allows, which
+// include databases without any collections, or else the databases of the
+// restore's intents.
+func (restore *MongoRestore) dumpedDatabases() []string {
+	seen := map[string]bool{}
+	if restore.archive != nil {
+		for _, dbName := range restore.archive.Prelude.DBS {
+			seen[dbName] = restore.includesDB(dbName)
+		}
+	} else {
+		for _, intent := range restore.manager.Intents() {
+			seen[intent.DB] = true
+		}
+	}
+	// the empty database holds the top level collections, such as the oplog
+	delete(seen, "")
+
+	dbNames := []string{}
+	for dbName, included := range seen {
+		if included {
+			dbNames = append(dbNames, dbName)
+		}
+	}
+	sort.Strings(dbNames)
+	return dbNames
+}
+
+// createDatabases makes sure each of the databases exists, without leaving any
+// collections in them, by creating and then dropping a sentinel collection.
+func createDatabases(runner commandRunner, dbNames []string) error {
+	for _, dbName := range dbNames {
+		log.Logf(log.Always, "creating database %v", dbName)
+		err := runner.Run(bson.D{{"create", databaseSentinel}}, &struct{}{}, dbName)
+		if err != nil {
+			return fmt.Errorf("error creating database %v: %v", dbName, err)
+		}
+		err = runner.Run(bson.D{{"drop", databaseSentinel}}, &struct{}{}, dbName)
+		if err != nil {
+			return fmt.Errorf("error dropping sentinel collection %v.%v: %v", dbName, databaseSentinel, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestDatabasesOnly(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive whose prelude lists two databases", t, func() {
+		restore := &MongoRestore{
+			InputOptions: &InputOptions{},
+			archive: &archive.Reader{
+				Prelude: &archive.Prelude{DBS: []string{"db2", "", "db1"}},
+			},
+		}
+
+		Convey("the dumped databases should be those databases, in order", func() {
+			So(restore.dumpedDatabases(), ShouldResemble, []string{"db1", "db2"})
+		})
+
+		Convey("each database should be created without leaving any collections", func() {
+			runner := &stubRunner{}
+			So(createDatabases(runner, restore.dumpedDatabases()), ShouldBeNil)
+			So(runner.databases, ShouldResemble, []string{"db1", "db1", "db2", "db2"})
+			So(runner.commands, ShouldResemble, []interface{}{
+				bson.D{{"create", databaseSentinel}},
+				bson.D{{"drop", databaseSentinel}},
+				bson.D{{"create", databaseSentinel}},
+				bson.D{{"drop", databaseSentinel}},
+			})
+		})
+
+		Convey("a failed command should stop the restore", func() {
+			runner := &stubRunner{err: fmt.Errorf("not authorized")}
+			err := createDatabases(runner, restore.dumpedDatabases())
+			So(err, ShouldNotBeNil)
+			So(runner.count(), ShouldEqual, 1)
+		})
+	})
+}
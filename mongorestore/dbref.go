@@ -0,0 +1,142 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// Directions of --convertDBRef.
+const (
+	dbRefToManual   = "toManual"
+	dbRefFromManual = "fromManual"
+)
+
+// dbRefConversion is a parsed --convertDBRef argument: a top level field of a
+// namespace whose references are converted from DBRefs to the plain _ids they
+// refer to, or from plain _ids to DBRefs to the documents of refC.
+type dbRefConversion struct {
+	ns        string
+	field     string
+	direction string
+	refC      string
+}
+
+// parseDBRefConversion parses an argument to --convertDBRef, of the form
+// "db.coll:field=toManual" or "db.coll:field=fromManual:otherColl".
+func parseDBRefConversion(arg string) (*dbRefConversion, error) {
+	const form = "expected the form db.coll:field=toManual or db.coll:field=fromManual:otherColl"
+	equals := strings.Index(arg, "=")
+	if equals < 0 {
+		return nil, fmt.Errorf(form)
+	}
+	ns, field, err := parseSplitBy(arg[:equals])
+	if err != nil {
+		return nil, fmt.Errorf(form)
+	}
+	conversion := &dbRefConversion{ns: ns, field: field}
+	direction := arg[equals+1:]
+	switch {
+	case direction == dbRefToManual:
+		conversion.direction = dbRefToManual
+	case strings.HasPrefix(direction, dbRefFromManual+":"):
+		conversion.direction = dbRefFromManual
+		conversion.refC = strings.TrimPrefix(direction, dbRefFromManual+":")
+		if conversion.refC == "" {
+			return nil, fmt.Errorf(form)
+		}
+	default:
+		return nil, fmt.Errorf(form)
+	}
+	return conversion, nil
+}
+
+// getDBRefTransform returns the transform that applies the --convertDBRef
+// conversions of the intent's namespace, or nil if it has none.
+func (restore *MongoRestore) getDBRefTransform(intent *intents.Intent) documentTransform {
+	conversions, ok := restore.dbRefConversions[intent.Namespace()]
+	if !ok {
+		return nil
+	}
+	return convertDBRefs(conversions)
+}
+
+// convertDBRefs creates a documentTransform that converts the references in the
+// fields of the conversions, including each of the references in an array. With
+// toManual, a DBRef is replaced by its $id, and other values are left as they
+// are. With fromManual, a value is replaced by a DBRef with it as the $id, and
+// nulls and values that are already DBRefs are left as they are.
+func convertDBRefs(conversions []*dbRefConversion) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		converted := false
+		for i, elem := range doc {
+			for _, conversion := range conversions {
+				if elem.Name != conversion.field {
+					continue
+				}
+				value, ok := conversion.convertValue(elem.Value)
+				if ok {
+					doc[i].Value = value
+					converted = true
+				}
+			}
+		}
+		if !converted {
+			return raw, nil
+		}
+		return bson.Marshal(doc)
+	}
+}
+
+// convertValue returns the converted reference, or each of the converted
+// references in an array. It returns false if nothing was converted.
+func (conversion *dbRefConversion) convertValue(value interface{}) (interface{}, bool) {
+	if values, ok := value.([]interface{}); ok {
+		convertedValues := make([]interface{}, len(values))
+		converted := false
+		for i, value := range values {
+			convertedValue, ok := conversion.convertRef(value)
+			convertedValues[i] = convertedValue
+			converted = converted || ok
+		}
+		return convertedValues, converted
+	}
+	return conversion.convertRef(value)
+}
+
+// convertRef returns the converted reference, and false if the value isn't
+// one to convert.
+func (conversion *dbRefConversion) convertRef(value interface{}) (interface{}, bool) {
+	id, isDBRef := dbRefId(value)
+	if conversion.direction == dbRefToManual {
+		return id, isDBRef
+	}
+	if isDBRef || value == nil {
+		return value, false
+	}
+	return bson.D{{"$ref", conversion.refC}, {"$id", value}}, true
+}
+
+// dbRefId returns the $id of the value if it is a DBRef, a document whose first
+// fields are $ref and $id. It returns the value itself, and false, otherwise.
+func dbRefId(value interface{}) (interface{}, bool) {
+	switch doc := value.(type) {
+	case bson.D:
+		if len(doc) >= 2 && doc[0].Name == "$ref" && doc[1].Name == "$id" {
+			return doc[1].Value, true
+		}
+	case bson.M:
+		_, hasRef := doc["$ref"]
+		id, hasId := doc["$id"]
+		if hasRef && hasId {
+			return id, true
+		}
+	}
+	return value, false
+}
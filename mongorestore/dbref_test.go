@@ -0,0 +1,100 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestConvertDBRef(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Parsing --convertDBRef arguments", t, func() {
+		conversion, err := parseDBRefConversion("db1.orders:customer=toManual")
+		So(err, ShouldBeNil)
+		So(*conversion, ShouldResemble, dbRefConversion{ns: "db1.orders", field: "customer", direction: dbRefToManual})
+
+		conversion, err = parseDBRefConversion("db1.orders:customer=fromManual:customers")
+		So(err, ShouldBeNil)
+		So(*conversion, ShouldResemble, dbRefConversion{ns: "db1.orders", field: "customer",
+			direction: dbRefFromManual, refC: "customers"})
+
+		for _, arg := range []string{"db1.orders:customer", "db1.orders=toManual",
+			"db1.orders:customer=sideways", "db1.orders:customer=fromManual", "db1.orders:customer=fromManual:"} {
+			_, err = parseDBRefConversion(arg)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("With orders that reference their customer and items by DBRef", t, func() {
+		customerId, itemIds := bson.NewObjectId(), []bson.ObjectId{bson.NewObjectId(), bson.NewObjectId()}
+		dumped, err := bson.Marshal(bson.D{
+			{"_id", 1},
+			{"customer", mgo.DBRef{Collection: "customers", Id: customerId, Database: "db1"}},
+			{"items", []interface{}{
+				mgo.DBRef{Collection: "items", Id: itemIds[0]},
+				mgo.DBRef{Collection: "items", Id: itemIds[1]},
+			}},
+			{"note", "leave me"},
+		})
+		So(err, ShouldBeNil)
+
+		toManual := convertDBRefs([]*dbRefConversion{
+			{field: "customer", direction: dbRefToManual},
+			{field: "items", direction: dbRefToManual},
+		})
+		manual, err := toManual(dumped)
+		So(err, ShouldBeNil)
+
+		Convey("converting them to manual references should leave only their _ids", func() {
+			doc := bson.M{}
+			So(bson.Unmarshal(manual, &doc), ShouldBeNil)
+			So(doc["customer"], ShouldEqual, customerId)
+			So(doc["items"], ShouldResemble, []interface{}{itemIds[0], itemIds[1]})
+			So(doc["note"], ShouldEqual, "leave me")
+
+			Convey("and converting those back should make DBRefs to the given collection", func() {
+				fromManual := convertDBRefs([]*dbRefConversion{
+					{field: "customer", direction: dbRefFromManual, refC: "customers"},
+					{field: "items", direction: dbRefFromManual, refC: "items"},
+				})
+				restored, err := fromManual(manual)
+				So(err, ShouldBeNil)
+				doc := struct {
+					Customer mgo.DBRef   `bson:"customer"`
+					Items    []mgo.DBRef `bson:"items"`
+					Note     string      `bson:"note"`
+				}{}
+				So(bson.Unmarshal(restored, &doc), ShouldBeNil)
+				So(doc.Customer, ShouldResemble, mgo.DBRef{Collection: "customers", Id: customerId})
+				So(doc.Items, ShouldResemble, []mgo.DBRef{
+					{Collection: "items", Id: itemIds[0]},
+					{Collection: "items", Id: itemIds[1]},
+				})
+				So(doc.Note, ShouldEqual, "leave me")
+
+				Convey("which are left as they are if converted again", func() {
+					again, err := fromManual(restored)
+					So(err, ShouldBeNil)
+					So(again, ShouldResemble, restored)
+				})
+			})
+		})
+
+		Convey("documents without references should be left as they were", func() {
+			raw, err := bson.Marshal(bson.D{{"_id", 2}, {"customer", nil}, {"items", []interface{}{}}})
+			So(err, ShouldBeNil)
+			for _, direction := range []string{dbRefToManual, dbRefFromManual} {
+				out, err := convertDBRefs([]*dbRefConversion{
+					{field: "customer", direction: direction, refC: "customers"},
+					{field: "items", direction: direction, refC: "items"},
+				})(raw)
+				So(err, ShouldBeNil)
+				So(out, ShouldResemble, raw)
+			}
+		})
+	})
+}
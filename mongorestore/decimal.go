@@ -0,0 +1,156 @@
+package mongorestore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// decimal128Kind is the BSON element type of Decimal128 values. The driver has
+// no type for them, so they are written as raw elements of this kind.
+const decimal128Kind = 0x13
+
+// Limits of the coefficient and exponent of a Decimal128.
+const (
+	decimal128MaxDigits   = 34
+	decimal128MinExponent = -6176
+	decimal128MaxExponent = 6111
+)
+
+var decimalNumberRegex = regexp.MustCompile(`^([+-]?)(\d*)(?:\.(\d*))?(?:[eE]([+-]?\d+))?$`)
+
+// parseToDecimal128 parses an argument to --toDecimal128, of the form
+// "db.coll:fieldA,fieldB", returning the namespace and the fields.
+func parseToDecimal128(arg string) (string, []string, error) {
+	ns, fieldList, err := parseSplitBy(arg)
+	if err != nil {
+		return "", nil, fmt.Errorf("expected the form db.coll:field1,field2")
+	}
+	fields := strings.Split(fieldList, ",")
+	for _, field := range fields {
+		if field == "" {
+			return "", nil, fmt.Errorf("expected the form db.coll:field1,field2")
+		}
+		if err = validateTopLevelField(field); err != nil {
+			return "", nil, err
+		}
+	}
+	return ns, fields, nil
+}
+
+// decimal128FromString returns the Decimal128 value of a decimal number such as
+// "-12.50" or "1.5e-3", as its 16 bytes, keeping all of its digits, so that
+// "12.50" has two decimal places. It returns false for strings that aren't
+// decimal numbers and for numbers that a Decimal128 can't hold exactly.
+func decimal128FromString(s string) ([]byte, bool) {
+	match := decimalNumberRegex.FindStringSubmatch(s)
+	if match == nil || match[2]+match[3] == "" {
+		return nil, false
+	}
+	digits := strings.TrimLeft(match[2]+match[3], "0")
+	if digits == "" {
+		digits = "0"
+	}
+	exponent := -len(match[3])
+	if match[4] != "" {
+		e, err := strconv.Atoi(match[4])
+		if err != nil {
+			return nil, false
+		}
+		exponent += e
+	}
+	if len(digits) > decimal128MaxDigits ||
+		exponent < decimal128MinExponent || exponent > decimal128MaxExponent {
+		return nil, false
+	}
+	coefficient, _ := new(big.Int).SetString(digits, 10)
+	low := new(big.Int).And(coefficient, new(big.Int).SetUint64(^uint64(0))).Uint64()
+	high := new(big.Int).Rsh(coefficient, 64).Uint64()
+	high |= uint64(exponent-decimal128MinExponent) << 49
+	if match[1] == "-" {
+		high |= 1 << 63
+	}
+	value := make([]byte, 16)
+	binary.LittleEndian.PutUint64(value[:8], low)
+	binary.LittleEndian.PutUint64(value[8:], high)
+	return value, true
+}
+
+// decimal128FromValue returns the Decimal128 value of a double, as the decimal
+// number with the fewest digits that reads back as the double, so that 0.1 becomes
+// 0.1 rather than the binary fraction it approximates, or of a numeric string.
+func decimal128FromValue(value interface{}) ([]byte, bool) {
+	switch v := value.(type) {
+	case float64:
+		return decimal128FromString(strconv.FormatFloat(v, 'g', -1, 64))
+	case string:
+		return decimal128FromString(strings.TrimSpace(v))
+	}
+	return nil, false
+}
+
+// getDecimal128Transform returns the transform that converts the --toDecimal128
+// fields of the intent's documents, or nil if none are given for its namespace.
+func (restore *MongoRestore) getDecimal128Transform(intent *intents.Intent) documentTransform {
+	fields, ok := restore.decimalFields[intent.Namespace()]
+	if !ok {
+		return nil
+	}
+	return convertToDecimal128(intent.Namespace(), fields)
+}
+
+// convertToDecimal128 creates a documentTransform that converts the doubles and
+// numeric strings of the given top level fields to Decimal128. Values of the
+// fields that can't be converted, such as NaN or strings that aren't numbers,
+// are logged and left as they are, as are values of other types. Since the
+// driver can't read Decimal128 values, the documents this returns can't be
+// transformed any further.
+func convertToDecimal128(ns string, fields []string) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		converted := false
+		for i, elem := range doc {
+			if !util.StringSliceContains(fields, elem.Name) {
+				continue
+			}
+			switch elem.Value.(type) {
+			case float64, string:
+			default:
+				continue
+			}
+			value, ok := decimal128FromValue(elem.Value)
+			if !ok {
+				log.Logf(log.Always, "left field '%v' of document %v of %v as it was: can't convert %#v to decimal128",
+					elem.Name, idOf(doc), ns, elem.Value)
+				continue
+			}
+			doc[i].Value = bson.Raw{Kind: decimal128Kind, Data: value}
+			converted = true
+		}
+		if !converted {
+			return raw, nil
+		}
+		return bson.Marshal(doc)
+	}
+}
+
+// idOf returns the _id of the document, or nil if it has none.
+func idOf(doc bson.D) interface{} {
+	for _, elem := range doc {
+		if elem.Name == "_id" {
+			return elem.Value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package mongorestore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"testing"
+)
+
+// decimal128Field returns the Decimal128 value of the field of a document, as
+// hex with its high 64 bits first, or "" if the field isn't a Decimal128. The
+// driver can't read the documents, so the field is found in their bytes.
+func decimal128Field(raw []byte, field string) string {
+	at := bytes.Index(raw, append([]byte{decimal128Kind}, append([]byte(field), 0)...))
+	if at < 0 {
+		return ""
+	}
+	return decimal128Hex(raw[at+len(field)+2 : at+len(field)+18])
+}
+
+// decimal128Hex returns the 16 bytes of a Decimal128 as hex, high 64 bits first.
+func decimal128Hex(value []byte) string {
+	return fmt.Sprintf("%016x%016x", binary.LittleEndian.Uint64(value[8:]), binary.LittleEndian.Uint64(value[:8]))
+}
+
+func TestDecimal128FromString(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Decimal numbers should be encoded with all of their digits", t, func() {
+		for s, expected := range map[string]string{
+			"1":                                  "30400000000000000000000000000001",
+			"0.1":                                "303e0000000000000000000000000001",
+			"-12.50":                             "b03c00000000000000000000000004e2",
+			"0":                                  "30400000000000000000000000000000",
+			"1.5e-3":                             "3038000000000000000000000000000f",
+			"1E+3":                               "30460000000000000000000000000001",
+			".5":                                 "303e0000000000000000000000000005",
+			"00012.30":                           "303c00000000000000000000000004ce",
+			"9999999999999999999999999999999999": "3041ed09bead87c0378d8e63ffffffff",
+		} {
+			value, ok := decimal128FromString(s)
+			So(ok, ShouldBeTrue)
+			So(decimal128Hex(value), ShouldEqual, expected)
+		}
+	})
+
+	Convey("Strings that aren't decimal numbers, or that are too precise, shouldn't be", t, func() {
+		for _, s := range []string{"", ".", "-", "abc", "1.2.3", "1e", "NaN", "+Inf", "0x10",
+			"12345678901234567890123456789012345", "1e7000"} {
+			_, ok := decimal128FromString(s)
+			So(ok, ShouldBeFalse)
+		}
+	})
+}
+
+func TestToDecimal128(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --toDecimal128 on the price and qty fields", t, func() {
+		ns, fields, err := parseToDecimal128("db1.orders:price,qty")
+		So(err, ShouldBeNil)
+		So(ns, ShouldEqual, "db1.orders")
+		transform := convertToDecimal128(ns, fields)
+
+		Convey("a double field should become the Decimal128 of its shortest decimal form", func() {
+			raw, err := bson.Marshal(bson.D{{"_id", 1}, {"price", 19.99}, {"note", 0.1}})
+			So(err, ShouldBeNil)
+			converted, err := transform(raw)
+			So(err, ShouldBeNil)
+			// 1999 * 10^-2, rather than the binary fraction the double approximates
+			So(decimal128Field(converted, "price"), ShouldEqual, "303c00000000000000000000000007cf")
+			So(decimal128Field(converted, "note"), ShouldEqual, "")
+		})
+
+		Convey("a numeric string should keep its precision", func() {
+			raw, err := bson.Marshal(bson.D{{"_id", 1}, {"qty", "2.500"}})
+			So(err, ShouldBeNil)
+			converted, err := transform(raw)
+			So(err, ShouldBeNil)
+			So(decimal128Field(converted, "qty"), ShouldEqual, "303a00000000000000000000000009c4")
+		})
+
+		Convey("values that can't be converted should be logged and left as they are", func() {
+			logged := &bytes.Buffer{}
+			log.SetWriter(logged)
+			Reset(func() {
+				log.SetWriter(os.Stderr)
+			})
+			raw, err := bson.Marshal(bson.D{{"_id", 7}, {"price", "n/a"}, {"qty", 3}})
+			So(err, ShouldBeNil)
+			converted, err := transform(raw)
+			So(err, ShouldBeNil)
+			So(converted, ShouldResemble, raw)
+			So(logged.String(), ShouldContainSubstring, `left field 'price' of document 7 of db1.orders`)
+			So(logged.String(), ShouldNotContainSubstring, "'qty'")
+		})
+
+		Convey("malformed arguments should be rejected", func() {
+			for _, arg := range []string{"db1.orders", "db1.orders:", "db1.orders:a,,b", "db1:price", "db1.orders:a.b"} {
+				_, _, err := parseToDecimal128(arg)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
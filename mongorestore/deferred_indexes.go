@@ -0,0 +1,140 @@
+package mongorestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// deferredIndexes holds the unique indexes of a collection that --deferUniqueIndexes
+// kept from being built.
+type deferredIndexes struct {
+	DB      string
+	C       string
+	Indexes []IndexDocument
+}
+
+// isUniqueIndex returns true if the index has a true or non-zero unique option.
+func isUniqueIndex(index IndexDocument) bool {
+	switch unique := index.Options["unique"].(type) {
+	case bool:
+		return unique
+	case nil:
+		return false
+	default:
+		number, err := util.ToFloat64(unique)
+		return err == nil && number != 0
+	}
+}
+
+// deferUniqueIndexes adds the unique indexes among the intent's indexes to the
+// list of indexes left for the operator to build, and returns the rest.
+func (restore *MongoRestore) deferUniqueIndexes(intent *intents.Intent, indexes []IndexDocument) []IndexDocument {
+	build := []IndexDocument{}
+	deferred := deferredIndexes{DB: intent.DB, C: intent.C}
+	for _, index := range indexes {
+		if isUniqueIndex(index) {
+			log.Logf(log.Always, "deferring the build of unique index %v on %v",
+				index.Options["name"], intent.Namespace())
+			deferred.Indexes = append(deferred.Indexes, index)
+		} else {
+			build = append(build, index)
+		}
+	}
+	if len(deferred.Indexes) > 0 {
+		restore.deferredIndexesMutex.Lock()
+		restore.deferredIndexes = append(restore.deferredIndexes, deferred)
+		restore.deferredIndexesMutex.Unlock()
+	}
+	return build
+}
+
+// WriteDeferredIndexScript writes a mongo shell script to path that builds
+// the unique indexes deferred by --deferUniqueIndexes.
+func (restore *MongoRestore) WriteDeferredIndexScript(path string) error {
+	restore.deferredIndexesMutex.Lock()
+	deferred := restore.deferredIndexes
+	restore.deferredIndexesMutex.Unlock()
+
+	script := &bytes.Buffer{}
+	if err := writeDeferredIndexScript(script, deferred); err != nil {
+		return fmt.Errorf("error building the script for the deferred unique indexes: %v", err)
+	}
+	if err := ioutil.WriteFile(path, script.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing the script for the deferred unique indexes: %v", err)
+	}
+	count := 0
+	for _, collection := range deferred {
+		count += len(collection.Indexes)
+	}
+	log.Logf(log.Always, "deferred %v unique %v; run %v to build them once duplicates are removed",
+		count, util.Pluralize(count, "index", "indexes"), path)
+	return nil
+}
+
+// writeDeferredIndexScript writes a createIndexes command to out for each of
+// the collections, in namespace order. The index specs are written as extended
+// JSON, in the same form as in the dump's metadata files.
+func writeDeferredIndexScript(out io.Writer, deferred []deferredIndexes) error {
+	sorted := make([]deferredIndexes, len(deferred))
+	copy(sorted, deferred)
+	sort.Sort(byDeferredNamespace(sorted))
+
+	if _, err := fmt.Fprintln(out, "// unique indexes deferred by mongorestore --deferUniqueIndexes"); err != nil {
+		return err
+	}
+	for _, collection := range sorted {
+		// round trip the specs through BSON, for ordered documents of plain BSON values
+		indexes := []interface{}{}
+		for _, index := range collection.Indexes {
+			raw, err := bson.Marshal(index)
+			if err != nil {
+				return err
+			}
+			spec := bson.D{}
+			if err = bson.Unmarshal(raw, &spec); err != nil {
+				return err
+			}
+			indexes = append(indexes, spec)
+		}
+		command, err := bsonutil.ConvertBSONValueToJSON(bson.D{
+			{"createIndexes", collection.C},
+			{"indexes", indexes},
+		})
+		if err != nil {
+			return err
+		}
+		commandJSON, err := json.Marshal(command)
+		if err != nil {
+			return err
+		}
+		dbJSON, err := json.Marshal(collection.DB)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "printjson(db.getSiblingDB(%s).runCommand(%s));\n", dbJSON, commandJSON)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type byDeferredNamespace []deferredIndexes
+
+func (s byDeferredNamespace) Len() int      { return len(s) }
+func (s byDeferredNamespace) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDeferredNamespace) Less(i, j int) bool {
+	if s[i].DB != s[j].DB {
+		return s[i].DB < s[j].DB
+	}
+	return s[i].C < s[j].C
+}
@@ -0,0 +1,68 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"testing"
+)
+
+func TestDeferUniqueIndexes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a collection with unique and non-unique indexes", t, func() {
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{DeferUniqueIndexes: "deferred.js"},
+		}
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+		indexes := []IndexDocument{
+			{Key: bson.D{{"_id", 1}}, Options: bson.M{"name": "_id_", "ns": "db1.c1"}},
+			{Key: bson.D{{"email", 1}}, Options: bson.M{"name": "email_1", "ns": "db1.c1", "unique": true}},
+			{Key: bson.D{{"a", 1}, {"b", -1}}, Options: bson.M{"name": "a_1_b_-1", "ns": "db1.c1"}},
+			{Key: bson.D{{"sku", 1}}, Options: bson.M{"name": "sku_1", "ns": "db1.c1", "unique": 1.0}},
+			{Key: bson.D{{"c", 1}}, Options: bson.M{"name": "c_1", "ns": "db1.c1", "unique": false}},
+		}
+
+		Convey("the unique indexes should be deferred while the others are built", func() {
+			build := restore.deferUniqueIndexes(intent, indexes)
+			So(len(build), ShouldEqual, 3)
+			So(build[0].Options["name"], ShouldEqual, "_id_")
+			So(build[1].Options["name"], ShouldEqual, "a_1_b_-1")
+			So(build[1].Key, ShouldResemble, bson.D{{"a", 1}, {"b", -1}})
+			So(build[2].Options["name"], ShouldEqual, "c_1")
+
+			So(len(restore.deferredIndexes), ShouldEqual, 1)
+			deferred := restore.deferredIndexes[0]
+			So(deferred.DB, ShouldEqual, "db1")
+			So(deferred.C, ShouldEqual, "c1")
+			So(len(deferred.Indexes), ShouldEqual, 2)
+			So(deferred.Indexes[0].Options["name"], ShouldEqual, "email_1")
+			So(deferred.Indexes[1].Options["name"], ShouldEqual, "sku_1")
+
+			Convey("and written to a script that builds them", func() {
+				restore.deferUniqueIndexes(&intents.Intent{DB: "db0", C: "c2"}, indexes[1:2])
+				script := &bytes.Buffer{}
+				So(writeDeferredIndexScript(script, restore.deferredIndexes), ShouldBeNil)
+				lines := strings.Split(strings.TrimSpace(script.String()), "\n")
+				So(len(lines), ShouldEqual, 3)
+				So(lines[1], ShouldStartWith, `printjson(db.getSiblingDB("db0").runCommand({"createIndexes":"c2",`)
+				So(lines[2], ShouldStartWith, `printjson(db.getSiblingDB("db1").runCommand({"createIndexes":"c1",`)
+				So(lines[2], ShouldContainSubstring, `"key":{"email":1}`)
+				So(lines[2], ShouldContainSubstring, `"name":"email_1"`)
+				So(lines[2], ShouldContainSubstring, `"unique":true`)
+				So(lines[2], ShouldContainSubstring, `"name":"sku_1"`)
+				So(lines[2], ShouldNotContainSubstring, "a_1_b_-1")
+			})
+		})
+
+		Convey("a collection without unique indexes should have nothing deferred", func() {
+			build := restore.deferUniqueIndexes(intent, indexes[2:3])
+			So(len(build), ShouldEqual, 1)
+			So(restore.deferredIndexes, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,128 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// countDocuments returns the number of documents in the given collection.
+func (restore *MongoRestore) countDocuments(dbName, colName string) (int64, error) {
+	if restore.documentCounter != nil {
+		return restore.documentCounter(dbName, colName)
+	}
+	session, err := restore.metadataReadSession()
+	if err != nil {
+		return 0, fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+	n, err := session.DB(dbName).C(colName).Count()
+	return int64(n), err
+}
+
+// namespaceLister lists the databases and collections of the target. It is
+// implemented by db.SessionProvider.
+type namespaceLister interface {
+	DatabaseNames() ([]string, error)
+	CollectionNames(db string) ([]string, error)
+}
+
+// clusterUserCollections returns the collections of the target's databases, other
+// than admin, local and config, that aren't system collections.
+func (restore *MongoRestore) clusterUserCollections() ([]string, error) {
+	var lister namespaceLister = restore.SessionProvider
+	if restore.namespaceLister != nil {
+		lister = restore.namespaceLister
+	}
+	dbNames, err := lister.DatabaseNames()
+	if err != nil {
+		return nil, fmt.Errorf("error listing databases: %v", err)
+	}
+	namespaces := []string{}
+	for _, dbName := range dbNames {
+		if dbName == "admin" || dbName == "local" || dbName == "config" {
+			continue
+		}
+		colNames, err := lister.CollectionNames(dbName)
+		if err != nil {
+			return nil, fmt.Errorf("error listing collections of %v: %v", dbName, err)
+		}
+		for _, colName := range colNames {
+			if !strings.HasPrefix(colName, "system.") {
+				namespaces = append(namespaces, dbName+"."+colName)
+			}
+		}
+	}
+	return namespaces, nil
+}
+
+// checkEmptyCluster returns an error, before anything is restored, if
+// --requireEmptyCluster is set and the target already has user collections.
+func (restore *MongoRestore) checkEmptyCluster() error {
+	if !restore.OutputOptions.RequireEmptyCluster {
+		return nil
+	}
+	namespaces, err := restore.clusterUserCollections()
+	if err != nil {
+		return err
+	}
+	if len(namespaces) == 0 {
+		return nil
+	}
+	return fmt.Errorf("--requireEmptyCluster: the target already has %v user %v: %v",
+		len(namespaces), util.Pluralize(len(namespaces), "collection", "collections"), strings.Join(namespaces, ", "))
+}
+
+// skipNonEmpty returns true if --onlyIfEmpty is set and the intent's collection
+// already has documents, in which case nothing is restored in to it.
+func (restore *MongoRestore) skipNonEmpty(intent *intents.Intent, collectionExists bool) (bool, error) {
+	if !restore.OutputOptions.OnlyIfEmpty || !collectionExists {
+		return false, nil
+	}
+	count, err := restore.countDocuments(intent.DB, intent.C)
+	if err != nil {
+		return false, fmt.Errorf("error counting documents in %v: %v", intent.Namespace(), err)
+	}
+	if count == 0 {
+		return false, nil
+	}
+	log.Logf(log.Always, "skipping restore of %v, which already has %v %v",
+		intent.Namespace(), count, util.Pluralize(int(count), "document", "documents"))
+	if restore.InputOptions.Archive != "" && intent.BSONFile != nil {
+		// the archive still holds the collection's data, which must be read past
+		return true, discardIntentData(intent)
+	}
+	return true, nil
+}
+
+// skipMissingTarget returns true if --onlyExistingTargets is set and the intent's
+// collection doesn't already exist on the target, in which case it isn't restored.
+func (restore *MongoRestore) skipMissingTarget(intent *intents.Intent, collectionExists bool) (bool, error) {
+	if !restore.OutputOptions.OnlyExistingTargets || collectionExists {
+		return false, nil
+	}
+	log.Logf(log.Always, "skipping restore of %v, which the target doesn't have", intent.Namespace())
+	if restore.InputOptions.Archive != "" && intent.BSONFile != nil {
+		return true, discardIntentData(intent)
+	}
+	return true, nil
+}
+
+// discardIntentData reads all of the documents of the intent's BSON file without restoring them.
+func discardIntentData(intent *intents.Intent) error {
+	err := intent.BSONFile.Open()
+	if err != nil {
+		return err
+	}
+	defer intent.BSONFile.Close()
+	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(intent.BSONFile))
+	defer bsonSource.Close()
+	doc := bson.Raw{}
+	for bsonSource.Next(&doc) {
+	}
+	return bsonSource.Err()
+}
@@ -0,0 +1,152 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestOnlyIfEmpty(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With dumps of an empty target and a non-empty target", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_only_if_empty")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+
+		sink := &bytes.Buffer{}
+		restore := &MongoRestore{
+			ToolOptions:   &commonOpts.ToolOptions{},
+			InputOptions:  &InputOptions{},
+			OutputOptions: &OutputOptions{OnlyIfEmpty: true},
+			DocumentSink:  sink,
+			// both collections exist, but only "full" has documents
+			knownCollections: map[string][]string{"db1": {"empty", "full"}},
+			documentCounter: func(dbName, colName string) (int64, error) {
+				if colName == "full" {
+					return 3, nil
+				}
+				return 0, nil
+			},
+		}
+		intentFor := func(c string) *intents.Intent {
+			path := filepath.Join(dir, c+".bson")
+			raw, err := bson.Marshal(bson.D{{"_id", c}})
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(path, raw, 0644), ShouldBeNil)
+			intent := &intents.Intent{DB: "db1", C: c, BSONPath: path, Location: path}
+			intent.BSONFile = &realBSONFile{intent: intent}
+			return intent
+		}
+
+		Convey("only the empty target should be loaded", func() {
+			So(restore.RestoreIntent(intentFor("empty")), ShouldBeNil)
+			So(restore.RestoreIntent(intentFor("full")), ShouldBeNil)
+
+			So(sinkIds(sink), ShouldResemble, []interface{}{"empty"})
+		})
+
+		Convey("a target that doesn't exist should be loaded without counting it", func() {
+			restore.documentCounter = nil
+			So(restore.RestoreIntent(intentFor("new")), ShouldBeNil)
+			So(sink.Len(), ShouldBeGreaterThan, 0)
+		})
+	})
+}
+
+func TestOnlyExistingTargets(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With dumps of two collections, only one of which the target has", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_only_existing")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+
+		sink := &bytes.Buffer{}
+		restore := &MongoRestore{
+			ToolOptions:      &commonOpts.ToolOptions{},
+			InputOptions:     &InputOptions{},
+			OutputOptions:    &OutputOptions{OnlyExistingTargets: true},
+			DocumentSink:     sink,
+			knownCollections: map[string][]string{"db1": {"curated"}},
+		}
+		for _, c := range []string{"curated", "other"} {
+			path := filepath.Join(dir, c+".bson")
+			raw, err := bson.Marshal(bson.D{{"_id", c}})
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(path, raw, 0644), ShouldBeNil)
+			intent := &intents.Intent{DB: "db1", C: c, BSONPath: path, Location: path}
+			intent.BSONFile = &realBSONFile{intent: intent}
+			So(restore.RestoreIntent(intent), ShouldBeNil)
+		}
+
+		Convey("only the collection the target has should be restored", func() {
+			So(sinkIds(sink), ShouldResemble, []interface{}{"curated"})
+		})
+	})
+}
+
+// stubLister stands in for the target's namespaces.
+type stubLister map[string][]string
+
+func (lister stubLister) DatabaseNames() ([]string, error) {
+	dbNames := []string{}
+	for dbName := range lister {
+		dbNames = append(dbNames, dbName)
+	}
+	sort.Strings(dbNames)
+	return dbNames, nil
+}
+
+func (lister stubLister) CollectionNames(dbName string) ([]string, error) {
+	return lister[dbName], nil
+}
+
+func TestRequireEmptyCluster(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --requireEmptyCluster", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{RequireEmptyCluster: true}}
+
+		Convey("a target with only system databases and collections should be restored to", func() {
+			restore.namespaceLister = stubLister{
+				"admin":  {"system.users", "system.version"},
+				"local":  {"startup_log", "oplog.rs"},
+				"config": {"system.sessions", "transactions"},
+				"db1":    {"system.views"},
+			}
+			So(restore.checkEmptyCluster(), ShouldBeNil)
+		})
+
+		Convey("a target with a user collection should abort the restore", func() {
+			restore.namespaceLister = stubLister{
+				"admin": {"system.version"},
+				"db1":   {"system.views", "users"},
+			}
+			err := restore.checkEmptyCluster()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "already has 1 user collection: db1.users")
+		})
+
+		Convey("without it, a populated target should be restored to", func() {
+			restore.OutputOptions.RequireEmptyCluster = false
+			restore.namespaceLister = stubLister{"db1": {"users"}}
+			So(restore.checkEmptyCluster(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package mongorestore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// encryptedBinaryKind is the BSON binary subtype of the values encrypted by
+// --encryptFields, from the range of subtypes reserved for user defined data.
+const encryptedBinaryKind = 0x80
+
+// encryptedFields is a parsed --encryptFields argument of the form
+// "db.coll:fieldA,fieldB". The values of the top level Fields of DB.C are
+// encrypted before they are inserted.
+type encryptedFields struct {
+	DB     string
+	C      string
+	Fields []string
+}
+
+// parseEncryptedFields parses an argument to --encryptFields.
+func parseEncryptedFields(arg string) (*encryptedFields, error) {
+	colon := strings.Index(arg, ":")
+	if colon < 0 || colon == len(arg)-1 {
+		return nil, fmt.Errorf("expected the form db.coll:field1,field2")
+	}
+	ns, fieldList := arg[:colon], arg[colon+1:]
+	dot := strings.Index(ns, ".")
+	if dot <= 0 || dot == len(ns)-1 {
+		return nil, fmt.Errorf("'%v' is not a namespace of the form db.coll", ns)
+	}
+	fields := strings.Split(fieldList, ",")
+	for _, field := range fields {
+		if field == "" {
+			return nil, fmt.Errorf("expected the form db.coll:field1,field2")
+		}
+	}
+	return &encryptedFields{DB: ns[:dot], C: ns[dot+1:], Fields: fields}, nil
+}
+
+// loadEncryptionKey reads the base64 encoded AES key from the file at path,
+// and returns the AES-GCM cipher that encrypts with it. The key must be
+// 16, 24 or 32 bytes long, for AES-128, AES-192 or AES-256.
+func loadEncryptionKey(path string) (cipher.AEAD, error) {
+	encoded, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("the key is not base64 encoded: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// getEncryptTransforms returns a transform encrypting the intent's documents
+// for each --encryptFields argument for its namespace.
+func (restore *MongoRestore) getEncryptTransforms(intent *intents.Intent) []documentTransform {
+	transforms := []documentTransform{}
+	for _, encrypted := range restore.encryptedFields {
+		if encrypted.DB == intent.DB && encrypted.C == intent.C {
+			transforms = append(transforms, encryptFields(encrypted.Fields, restore.encryptionKey))
+		}
+	}
+	return transforms
+}
+
+// encryptFields creates a documentTransform that replaces the values of the
+// given top level fields with their encryption. Each value is encrypted as the
+// BSON document {v: value}, so that its type survives decryption, and stored as
+// binary data holding a random nonce followed by the sealed document.
+// Documents without any of the fields are left as is.
+func encryptFields(fields []string, aead cipher.AEAD) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		encrypted := false
+		for i, elem := range doc {
+			if !util.StringSliceContains(fields, elem.Name) {
+				continue
+			}
+			plaintext, err := bson.Marshal(bson.D{{"v", elem.Value}})
+			if err != nil {
+				return nil, err
+			}
+			nonce := make([]byte, aead.NonceSize())
+			if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+				return nil, fmt.Errorf("error generating a nonce: %v", err)
+			}
+			doc[i].Value = bson.Binary{
+				Kind: encryptedBinaryKind,
+				Data: aead.Seal(nonce, nonce, plaintext, nil),
+			}
+			encrypted = true
+		}
+		if !encrypted {
+			return raw, nil
+		}
+		return bson.Marshal(doc)
+	}
+}
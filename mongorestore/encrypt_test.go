@@ -0,0 +1,121 @@
+package mongorestore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// decryptValue reverses the encryption of a single value by encryptFields.
+func decryptValue(aead cipher.AEAD, value interface{}) interface{} {
+	binary, ok := value.(bson.Binary)
+	So(ok, ShouldBeTrue)
+	So(binary.Kind, ShouldEqual, encryptedBinaryKind)
+	nonce, sealed := binary.Data[:aead.NonceSize()], binary.Data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, nil)
+	So(err, ShouldBeNil)
+	doc := bson.D{}
+	So(bson.Unmarshal(plaintext, &doc), ShouldBeNil)
+	return doc[0].Value
+}
+
+func TestParseEncryptedFields(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --encryptFields arguments", t, func() {
+
+		Convey("a namespace and fields should be parsed", func() {
+			encrypted, err := parseEncryptedFields("db1.people:ssn,dob")
+			So(err, ShouldBeNil)
+			So(encrypted, ShouldResemble, &encryptedFields{DB: "db1", C: "people", Fields: []string{"ssn", "dob"}})
+		})
+
+		Convey("malformed arguments should be rejected", func() {
+			for _, arg := range []string{"db1.people", "people:ssn", "db1.people:", "db1.people:ssn,,dob"} {
+				_, err := parseEncryptedFields(arg)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestEncryptFields(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a key file and a restore encrypting two fields", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_encrypt")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		key := []byte("0123456789abcdef0123456789abcdef")
+		keyPath := filepath.Join(dir, "key")
+		So(ioutil.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600), ShouldBeNil)
+
+		aead, err := loadEncryptionKey(keyPath)
+		So(err, ShouldBeNil)
+		block, err := aes.NewCipher(key)
+		So(err, ShouldBeNil)
+		testAEAD, err := cipher.NewGCM(block)
+		So(err, ShouldBeNil)
+
+		restore := &MongoRestore{
+			OutputOptions:   &OutputOptions{},
+			encryptedFields: []*encryptedFields{{DB: "db1", C: "people", Fields: []string{"ssn", "dob"}}},
+			encryptionKey:   aead,
+		}
+		dob := time.Date(1980, time.March, 4, 0, 0, 0, 0, time.UTC)
+
+		Convey("matching fields should become binary that decrypts to the original values", func() {
+			transform, err := restore.getDocumentTransform(&intents.Intent{DB: "db1", C: "people"})
+			So(err, ShouldBeNil)
+			raw, err := bson.Marshal(bson.D{{"_id", 1}, {"name", "Ann"}, {"ssn", "123-45-6789"},
+				{"dob", dob}, {"age", 35}})
+			So(err, ShouldBeNil)
+			raw, err = transform(raw)
+			So(err, ShouldBeNil)
+
+			doc := bson.D{}
+			So(bson.Unmarshal(raw, &doc), ShouldBeNil)
+			So(len(doc), ShouldEqual, 5)
+			So(doc[0], ShouldResemble, bson.DocElem{"_id", 1})
+			So(doc[1], ShouldResemble, bson.DocElem{"name", "Ann"})
+			So(doc[2].Name, ShouldEqual, "ssn")
+			So(decryptValue(testAEAD, doc[2].Value), ShouldEqual, "123-45-6789")
+			So(doc[3].Name, ShouldEqual, "dob")
+			So(decryptValue(testAEAD, doc[3].Value).(time.Time).Equal(dob), ShouldBeTrue)
+			So(doc[4], ShouldResemble, bson.DocElem{"age", 35})
+		})
+
+		Convey("other collections and documents without the fields should be untouched", func() {
+			transform, err := restore.getDocumentTransform(&intents.Intent{DB: "db1", C: "other"})
+			So(err, ShouldBeNil)
+			So(transform, ShouldBeNil)
+
+			transform, err = restore.getDocumentTransform(&intents.Intent{DB: "db1", C: "people"})
+			So(err, ShouldBeNil)
+			raw, err := bson.Marshal(bson.D{{"_id", 2}, {"name", "Bob"}})
+			So(err, ShouldBeNil)
+			transformed, err := transform(raw)
+			So(err, ShouldBeNil)
+			So(transformed, ShouldResemble, raw)
+		})
+
+		Convey("a key of the wrong length should be rejected", func() {
+			So(ioutil.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key[:10])), 0600), ShouldBeNil)
+			_, err := loadEncryptionKey(keyPath)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,124 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// validateKeyEscapes checks that the replacements of --escapeKeysDot and
+// --escapeKeysDollar don't leave the field names they escape needing escaping.
+func validateKeyEscapes(dot, dollar string) error {
+	switch {
+	case dot == "" || strings.Contains(dot, "."):
+		return fmt.Errorf("--escapeKeysDot must be a replacement for '.' that doesn't contain one")
+	case dollar == "" || strings.HasPrefix(dollar, "$"):
+		return fmt.Errorf("--escapeKeysDollar must be a replacement for '$' that doesn't start with one")
+	case strings.Contains(dot+dollar, "\x00"):
+		return fmt.Errorf("the replacements of --escapeKeysDot and --escapeKeysDollar can't contain null bytes")
+	}
+	return nil
+}
+
+// escapeKeys creates a documentTransform that renames the fields of each
+// document that older servers refuse, at any depth, including in the documents
+// of arrays: each '.' in a field name is replaced with dot, and a leading '$'
+// with dollar. The $ref, $id and $db fields of DBRefs are left as they are. Each field renamed is logged the first time a field of its path
+// in the namespace is. It's an error for a renamed field to collide with another
+// field of the same document.
+func escapeKeys(ns, dot, dollar string) documentTransform {
+	logged := map[string]bool{}
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		escaper := &keyEscaper{dot: dot, dollar: dollar}
+		escaped, changed, err := escaper.escapeDocument(doc, "")
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			return raw, nil
+		}
+		for _, rename := range escaper.renamed {
+			if !logged[rename[0]] {
+				logged[rename[0]] = true
+				log.Logf(log.Always, "escaped field '%v' of the documents of %v to '%v'", rename[0], ns, rename[1])
+			}
+		}
+		return bson.Marshal(escaped)
+	}
+}
+
+// keyEscaper escapes the field names of a document, keeping the path of each
+// field it renames and the path it's renamed to.
+type keyEscaper struct {
+	dot, dollar string
+	renamed     [][2]string
+}
+
+func (escaper *keyEscaper) escapeName(name string) string {
+	if strings.HasPrefix(name, "$") {
+		name = escaper.dollar + name[1:]
+	}
+	return strings.Replace(name, ".", escaper.dot, -1)
+}
+
+// escapeDocument returns the document with its field names escaped, and whether
+// any were. Paths are those of the document's fields as they were dumped, joined
+// by '.' onto the given prefix.
+func (escaper *keyEscaper) escapeDocument(doc bson.D, prefix string) (bson.D, bool, error) {
+	names := map[string]bool{}
+	for _, elem := range doc {
+		names[elem.Name] = true
+	}
+	// the fields of a DBRef, in the order the server requires them
+	isDBRef := len(doc) >= 2 && doc[0].Name == "$ref" && doc[1].Name == "$id"
+	escaped := make(bson.D, 0, len(doc))
+	changed := false
+	for i, elem := range doc {
+		path := prefix + elem.Name
+		name := elem.Name
+		if !isDBRef || i > 2 || (i == 2 && elem.Name != "$db") {
+			name = escaper.escapeName(elem.Name)
+		}
+		if name != elem.Name {
+			if names[name] {
+				return nil, false, fmt.Errorf("escaping field '%v' would collide with field '%v'", path, prefix+name)
+			}
+			escaper.renamed = append(escaper.renamed, [2]string{path, prefix + name})
+			changed = true
+		}
+		value, valueChanged, err := escaper.escapeValue(elem.Value, path+".")
+		if err != nil {
+			return nil, false, err
+		}
+		changed = changed || valueChanged
+		escaped = append(escaped, bson.DocElem{Name: name, Value: value})
+	}
+	return escaped, changed, nil
+}
+
+func (escaper *keyEscaper) escapeValue(value interface{}, prefix string) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case bson.D:
+		return escaper.escapeDocument(v, prefix)
+	case []interface{}:
+		escaped := make([]interface{}, len(v))
+		changed := false
+		for i, elem := range v {
+			// the fields of every element share a path, so that each is logged once
+			escapedElem, elemChanged, err := escaper.escapeValue(elem, prefix)
+			if err != nil {
+				return nil, false, err
+			}
+			escaped[i] = escapedElem
+			changed = changed || elemChanged
+		}
+		return escaped, changed, nil
+	}
+	return value, false, nil
+}
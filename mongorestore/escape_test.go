@@ -0,0 +1,89 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEscapeKeys(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With documents with dotted and dollar-prefixed field names", t, func() {
+		logged := &bytes.Buffer{}
+		log.SetWriter(logged)
+		Reset(func() {
+			log.SetWriter(os.Stderr)
+		})
+		raw, err := bson.Marshal(bson.D{
+			{"_id", 1},
+			{"a.b", 1},
+			{"$price", 2},
+			{"cost$", 3},
+			{"sub", bson.D{{"x.y", bson.D{{"$ref", "z"}, {"$id", 1}, {"$db", "db2"}}}}},
+			{"notRef", bson.D{{"$ref", "z"}}},
+			{"list", []interface{}{bson.D{{"c.d", 1}}, bson.D{{"c.d", 2}}, "e.f"}},
+		})
+		So(err, ShouldBeNil)
+		escape := escapeKeys("db1.c", "．", "＄")
+
+		Convey("the field names should be escaped at every depth and the documents inserted", func() {
+			out, err := escape(raw)
+			So(err, ShouldBeNil)
+			inserter := &recordingInserter{}
+			So(inserter.Insert(bson.Raw{Kind: 3, Data: out}), ShouldBeNil)
+			So(inserter.Flush(), ShouldBeNil)
+			So(inserter.flushed, ShouldEqual, 1)
+			doc := bson.D{}
+			So(bson.Unmarshal(inserter.docs[0].Data, &doc), ShouldBeNil)
+			So(doc, ShouldResemble, bson.D{
+				{"_id", 1},
+				{"a．b", 1},
+				{"＄price", 2},
+				{"cost$", 3},
+				{"sub", bson.D{{"x．y", bson.D{{"$ref", "z"}, {"$id", 1}, {"$db", "db2"}}}}},
+				{"notRef", bson.D{{"＄ref", "z"}}},
+				{"list", []interface{}{bson.D{{"c．d", 1}}, bson.D{{"c．d", 2}}, "e.f"}},
+			})
+
+			Convey("logging each field renamed once", func() {
+				_, err := escape(raw)
+				So(err, ShouldBeNil)
+				So(strings.Count(logged.String(), "escaped field"), ShouldEqual, 5)
+				So(logged.String(), ShouldContainSubstring, "escaped field 'a.b' of the documents of db1.c to 'a．b'")
+				So(logged.String(), ShouldContainSubstring, "escaped field 'list.c.d'")
+				So(logged.String(), ShouldNotContainSubstring, "escaped field 'sub.x.y.$")
+			})
+		})
+
+		Convey("documents without such field names should be left as they are", func() {
+			plain, err := bson.Marshal(bson.D{{"_id", 1}, {"a", bson.D{{"b", 1}}}})
+			So(err, ShouldBeNil)
+			out, err := escape(plain)
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, plain)
+		})
+
+		Convey("a field escaped to the name of another field should be an error", func() {
+			colliding, err := bson.Marshal(bson.D{{"a.b", 1}, {"a．b", 2}})
+			So(err, ShouldBeNil)
+			_, err = escape(colliding)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "collide")
+		})
+	})
+
+	Convey("Replacements that would still need escaping should be rejected", t, func() {
+		So(validateKeyEscapes("．", "＄"), ShouldBeNil)
+		So(validateKeyEscapes("_", "_"), ShouldBeNil)
+		So(validateKeyEscapes("", "_"), ShouldNotBeNil)
+		So(validateKeyEscapes("a.b", "_"), ShouldNotBeNil)
+		So(validateKeyEscapes("_", "$$"), ShouldNotBeNil)
+	})
+}
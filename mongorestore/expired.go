@@ -0,0 +1,71 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseDropExpired parses the argument to --dropExpired, of the form
+// "field:ttlSeconds", returning the field and the TTL.
+func parseDropExpired(arg string) (string, time.Duration, error) {
+	colon := strings.LastIndex(arg, ":")
+	if colon <= 0 {
+		return "", 0, fmt.Errorf("expected the form field:ttlSeconds")
+	}
+	field, seconds := arg[:colon], arg[colon+1:]
+	ttl, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil || ttl < 0 {
+		return "", 0, fmt.Errorf("'%v' is not a number of seconds", seconds)
+	}
+	return field, time.Duration(ttl) * time.Second, nil
+}
+
+// getDropExpiredTransform returns the transform that skips the intent's documents
+// that have already expired, counting them, or nil without --dropExpired.
+func (restore *MongoRestore) getDropExpiredTransform(intent *intents.Intent) documentTransform {
+	if restore.dropExpiredField == "" {
+		return nil
+	}
+	ns := intent.Namespace()
+	return dropExpired(restore.dropExpiredField, restore.dropExpiredTTL, time.Now(), func() {
+		restore.expiredMutex.Lock()
+		defer restore.expiredMutex.Unlock()
+		if restore.expiredCounts == nil {
+			restore.expiredCounts = map[string]int64{}
+		}
+		restore.expiredCounts[ns]++
+	})
+}
+
+// expiredCount returns the number of documents of the namespace that were
+// skipped because they had expired.
+func (restore *MongoRestore) expiredCount(ns string) int64 {
+	restore.expiredMutex.Lock()
+	defer restore.expiredMutex.Unlock()
+	return restore.expiredCounts[ns]
+}
+
+// dropExpired creates a documentTransform that skips the documents whose possibly
+// dotted date field is ttl or more before now, as a TTL index on the field would
+// remove them, calling onExpired for each. Documents without a date in the field
+// never expire.
+func dropExpired(field string, ttl time.Duration, now time.Time, onExpired func()) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.M{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		value, _ := lookupField(doc, field)
+		date, ok := value.(time.Time)
+		if !ok || date.Add(ttl).After(now) {
+			return raw, nil
+		}
+		onExpired()
+		return nil, nil
+	}
+}
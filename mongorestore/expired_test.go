@@ -0,0 +1,69 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestParseDropExpired(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --dropExpired arguments", t, func() {
+
+		Convey("a field and TTL should be parsed", func() {
+			field, ttl, err := parseDropExpired("session.lastSeen:3600")
+			So(err, ShouldBeNil)
+			So(field, ShouldEqual, "session.lastSeen")
+			So(ttl, ShouldEqual, time.Hour)
+		})
+
+		Convey("malformed arguments should be rejected", func() {
+			for _, arg := range []string{"lastSeen", ":3600", "lastSeen:", "lastSeen:-1", "lastSeen:1h"} {
+				_, _, err := parseDropExpired(arg)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestDropExpired(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a restore of expired and live documents into a DocumentSink", t, func() {
+		sink := &bytes.Buffer{}
+		restore := &MongoRestore{
+			DocumentSink:     sink,
+			OutputOptions:    &OutputOptions{},
+			dropExpiredField: "lastSeen",
+			dropExpiredTTL:   time.Hour,
+		}
+		intent := &intents.Intent{DB: "db1", C: "sessions"}
+		now := time.Now()
+		docs := []bson.D{
+			{{"_id", "expired"}, {"lastSeen", now.Add(-2 * time.Hour)}},
+			{{"_id", "live"}, {"lastSeen", now.Add(-30 * time.Minute)}},
+			{{"_id", "alsoExpired"}, {"lastSeen", now.Add(-61 * time.Minute)}},
+			{{"_id", "noDate"}, {"lastSeen", "yesterday"}},
+			{{"_id", "missing"}},
+		}
+
+		Convey("only the live documents should be restored, and the rest counted", func() {
+			transform, err := restore.getDocumentTransform(intent)
+			So(err, ShouldBeNil)
+			count, err := restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSourceOf(docs...), 0, transform)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+			So(restore.expiredCount("db1.sessions"), ShouldEqual, 2)
+			So(restore.expiredCount("db1.other"), ShouldEqual, 0)
+
+			So(sinkIds(sink), ShouldResemble, []interface{}{"live", "noDate", "missing"})
+		})
+	})
+}
@@ -0,0 +1,83 @@
+package mongorestore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// failpointEnv names the environment variable that sets a failpoint, a failure
+// injected at a chosen point of the restore, for deterministically testing how
+// partial restores are handled. Without it, restores never hit a failpoint.
+const failpointEnv = "MONGORESTORE_FAILPOINT"
+
+// Phases of the restore that a failpoint can be set at.
+const (
+	// fail once the given number of documents have been read, across all collections
+	failpointAfterDocuments = "afterDocuments"
+	// fail before building the indexes of the given namespace
+	failpointBeforeIndexes = "beforeIndexes"
+	// fail once the given namespace has been restored
+	failpointAfterCollection = "afterCollection"
+)
+
+// failpoint is a parsed MONGORESTORE_FAILPOINT, of the form "phase:argument",
+// e.g. "afterCollection:db1.c1" or "afterDocuments:1000".
+type failpoint struct {
+	Phase     string
+	Namespace string
+	Documents int64
+
+	// documents read so far, for afterDocuments
+	seen int64
+}
+
+// parseFailpoint parses the value of MONGORESTORE_FAILPOINT. It returns nil
+// if spec is empty.
+func parseFailpoint(spec string) (*failpoint, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	colon := strings.Index(spec, ":")
+	if colon < 0 || colon == len(spec)-1 {
+		return nil, fmt.Errorf("expected the form phase:argument")
+	}
+	phase, arg := spec[:colon], spec[colon+1:]
+	switch phase {
+	case failpointAfterDocuments:
+		documents, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || documents < 0 {
+			return nil, fmt.Errorf("'%v' is not a number of documents", arg)
+		}
+		return &failpoint{Phase: phase, Documents: documents}, nil
+	case failpointBeforeIndexes, failpointAfterCollection:
+		return &failpoint{Phase: phase, Namespace: arg}, nil
+	}
+	return nil, fmt.Errorf("unknown phase '%v', expected %v, %v or %v", phase,
+		failpointAfterDocuments, failpointBeforeIndexes, failpointAfterCollection)
+}
+
+// check returns an error if the failpoint is set at the given phase of
+// restoring the namespace ns. It is safe to call on a nil failpoint.
+func (fp *failpoint) check(phase, ns string) error {
+	if fp == nil || fp.Phase != phase || fp.Namespace != ns {
+		return nil
+	}
+	return fmt.Errorf("hit failpoint %v:%v", phase, ns)
+}
+
+// documentTransform returns a documentTransform that fails once the failpoint's
+// number of documents have been read, or nil if the failpoint isn't set after
+// a number of documents. It is safe to call on a nil failpoint.
+func (fp *failpoint) documentTransform() documentTransform {
+	if fp == nil || fp.Phase != failpointAfterDocuments {
+		return nil
+	}
+	return func(raw []byte) ([]byte, error) {
+		if atomic.AddInt64(&fp.seen, 1) > fp.Documents {
+			return nil, fmt.Errorf("hit failpoint %v:%v", failpointAfterDocuments, fp.Documents)
+		}
+		return raw, nil
+	}
+}
@@ -0,0 +1,101 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestParseFailpoint(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With values of MONGORESTORE_FAILPOINT", t, func() {
+
+		Convey("an empty value should set no failpoint", func() {
+			fp, err := parseFailpoint("")
+			So(err, ShouldBeNil)
+			So(fp, ShouldBeNil)
+			So(fp.check(failpointAfterCollection, "db1.c1"), ShouldBeNil)
+			So(fp.documentTransform(), ShouldBeNil)
+		})
+
+		Convey("phases should be parsed with their arguments", func() {
+			fp, err := parseFailpoint("afterCollection:db1.c1")
+			So(err, ShouldBeNil)
+			So(fp.Phase, ShouldEqual, failpointAfterCollection)
+			So(fp.Namespace, ShouldEqual, "db1.c1")
+			So(fp.check(failpointAfterCollection, "db1.c1"), ShouldNotBeNil)
+			So(fp.check(failpointAfterCollection, "db1.c2"), ShouldBeNil)
+			So(fp.check(failpointBeforeIndexes, "db1.c1"), ShouldBeNil)
+
+			fp, err = parseFailpoint("afterDocuments:10")
+			So(err, ShouldBeNil)
+			So(fp.Phase, ShouldEqual, failpointAfterDocuments)
+			So(fp.Documents, ShouldEqual, 10)
+		})
+
+		Convey("malformed values should be rejected", func() {
+			for _, spec := range []string{"afterCollection", "afterCollection:", "afterDocuments:x", "sometime:db1.c1"} {
+				_, err := parseFailpoint(spec)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestFailpointPartialRestore(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a restore into a DocumentSink failing after 3 documents", t, func() {
+		fp, err := parseFailpoint("afterDocuments:3")
+		So(err, ShouldBeNil)
+		sink := &bytes.Buffer{}
+		restore := &MongoRestore{
+			DocumentSink:  sink,
+			OutputOptions: &OutputOptions{},
+			failpoint:     fp,
+		}
+		docs := []bson.D{}
+		for i := 0; i < 5; i++ {
+			docs = append(docs, bson.D{{"_id", i}})
+		}
+		restoreCollection := func(c string) (int64, error) {
+			intent := &intents.Intent{DB: "db1", C: c}
+			transform, err := restore.getDocumentTransform(intent)
+			So(err, ShouldBeNil)
+			return restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSourceOf(docs...), 0, transform)
+		}
+		writtenIds := func() []interface{} {
+			return sinkIds(bytes.NewReader(sink.Bytes()))
+		}
+
+		Convey("only the documents before the failpoint should be restored", func() {
+			count, err := restoreCollection("c1")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "failpoint afterDocuments:3")
+			So(count, ShouldEqual, 3)
+			So(writtenIds(), ShouldResemble, []interface{}{0, 1, 2})
+
+			Convey("and later collections should fail before restoring anything", func() {
+				count, err := restoreCollection("c2")
+				So(err, ShouldNotBeNil)
+				So(count, ShouldEqual, 0)
+				So(writtenIds(), ShouldResemble, []interface{}{0, 1, 2})
+			})
+
+			Convey("and restoring again without the failpoint should complete", func() {
+				restore.failpoint = nil
+				sink.Reset()
+				count, err := restoreCollection("c1")
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 5)
+				So(writtenIds(), ShouldResemble, []interface{}{0, 1, 2, 3, 4})
+			})
+		})
+	})
+}
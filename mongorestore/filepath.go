@@ -41,6 +41,12 @@ type realBSONFile struct {
 	errorWriter
 	intent *intents.Intent
 	gzip   bool
+	// if true, gzipped files are decompressed in parallel, or at least ahead of reading them
+	parallelGzip bool
+	// if non-zero, reading starts at the first valid document at or after this offset
+	startOffset int64
+	// if true, the documents are read from last to first
+	reverse bool
 }
 
 // Open is part of the intents.file interface. realBSONFiles need to be Opened before Read
@@ -55,7 +61,12 @@ func (f *realBSONFile) Open() (err error) {
 		return fmt.Errorf("error reading BSON file %v: %v", f.intent.BSONPath, err)
 	}
 	if f.gzip {
-		gzFile, err := gzip.NewReader(file)
+		var gzFile io.ReadCloser
+		if f.parallelGzip {
+			gzFile, err = newParallelGzipReader(file)
+		} else {
+			gzFile, err = gzip.NewReader(file)
+		}
 		if err != nil {
 			return fmt.Errorf("error decompressing compresed BSON file %v: %v", f.intent.BSONPath, err)
 		}
@@ -63,9 +74,61 @@ func (f *realBSONFile) Open() (err error) {
 	} else {
 		f.ReadCloser = file
 	}
+	if f.startOffset > 0 {
+		if err = seekToDocument(file, f.startOffset); err != nil {
+			file.Close()
+			return fmt.Errorf("error seeking in BSON file %v: %v", f.intent.BSONPath, err)
+		}
+	}
+	if f.reverse {
+		if err = f.openReversed(file); err != nil {
+			file.Close()
+			return fmt.Errorf("error reading BSON file %v in reverse: %v", f.intent.BSONPath, err)
+		}
+	}
 	return nil
 }
 
+// openReversed replaces the reader of the file with one that reads its
+// documents back to front, starting from the file's current position.
+func (f *realBSONFile) openReversed(file *os.File) error {
+	start, err := file.Seek(0, 1)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	reader, err := newReverseBSONReader(file, start, stat.Size())
+	if err != nil {
+		return err
+	}
+	f.ReadCloser = &wrappedReadCloser{ioutil.NopCloser(reader), file}
+	return nil
+}
+
+// seekToDocument seeks the file to the first valid BSON document at or after offset.
+func seekToDocument(file *os.File, offset int64) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if offset > stat.Size() {
+		return fmt.Errorf("offset %v is past the end of the file (%v bytes)", offset, stat.Size())
+	}
+	boundary, err := findDocumentBoundary(file, offset, stat.Size())
+	if err != nil {
+		return err
+	}
+	if boundary != offset {
+		log.Logf(log.Always, "skipped %v bytes after offset %v to the next valid document",
+			boundary-offset, offset)
+	}
+	_, err = file.Seek(boundary, 0)
+	return err
+}
+
 // realMetadataFile implements the intents.file interface. It lets intents read from real
 // metadata.json files ok disk via an embedded os.File
 // The Read, Write and Close methods of the intents.file interface is implemented here by the
@@ -89,7 +152,8 @@ func (f *realMetadataFile) Open() (err error) {
 	if err != nil {
 		return fmt.Errorf("error reading metadata %v: %v", f.intent.MetadataPath, err)
 	}
-	if f.gzip {
+	// metadata written by mongodump --gzip is compressed whether or not --gzip is given
+	if f.gzip || strings.HasSuffix(f.intent.MetadataPath, ".gz") {
 		gzFile, err := gzip.NewReader(file)
 		if err != nil {
 			return fmt.Errorf("error reading compressed metadata %v: %v", f.intent.MetadataPath, err)
@@ -128,14 +192,17 @@ func (restore *MongoRestore) getInfoFromFilename(filename string) (string, FileT
 		baseName := strings.TrimSuffix(baseFileName, ".bin")
 		return baseName, BSONFileType
 	}
+	// Compressed metadata files are recognized whether or not --gzip is given,
+	// so that the indexes in them aren't skipped.
+	if strings.HasSuffix(baseFileName, ".metadata.json.gz") && restore.InputOptions.Archive == "" {
+		baseName := strings.TrimSuffix(baseFileName, ".metadata.json.gz")
+		return baseName, MetadataFileType
+	}
 	// Gzip indicates that files in a dump directory should have a .gz suffix
 	// but it does not indicate that the "files" provided by the archive should,
 	// compressed or otherwise.
 	if restore.InputOptions.Gzip && restore.InputOptions.Archive == "" {
-		if strings.HasSuffix(baseFileName, ".metadata.json.gz") {
-			baseName := strings.TrimSuffix(baseFileName, ".metadata.json.gz")
-			return baseName, MetadataFileType
-		} else if strings.HasSuffix(baseFileName, ".bson.gz") {
+		if strings.HasSuffix(baseFileName, ".bson.gz") {
 			baseName := strings.TrimSuffix(baseFileName, ".bson.gz")
 			return baseName, BSONFileType
 		}
@@ -151,6 +218,22 @@ func (restore *MongoRestore) getInfoFromFilename(filename string) (string, FileT
 	return "", UnknownFileType
 }
 
+// isOplog returns true if the top level entry of a dump holds the oplog. Archives
+// classify their top level collections themselves; in dump directories the oplog
+// is always oplog.bson.
+func isOplog(entry archive.DirLike) bool {
+	if pe, ok := entry.(*archive.PreludeExplorer); ok {
+		return pe.TopLevelKind() == archive.TopLevelOplog && !isMetadataEntry(entry)
+	}
+	return entry.Name() == "oplog.bson"
+}
+
+// isMetadataEntry returns true if the top level entry of an archive is a
+// collection's metadata, rather than its data.
+func isMetadataEntry(entry archive.DirLike) bool {
+	return strings.HasSuffix(entry.Name(), ".metadata.json")
+}
+
 // CreateAllIntents drills down into a dump folder, creating intents for all of
 // the databases and collections it finds.
 func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike, filterDB string, filterCollection string) error {
@@ -165,7 +248,7 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike, filterDB stri
 			if err = util.ValidateDBName(entry.Name()); err != nil {
 				return fmt.Errorf("invalid database name '%v': %v", entry.Name(), err)
 			}
-			if filterDB == "" || entry.Name() == filterDB {
+			if (filterDB == "" || entry.Name() == filterDB) && restore.includesDB(entry.Name()) {
 				err = restore.CreateIntentsForDB(entry.Name(), filterCollection, entry, false)
 			} else {
 				err = restore.CreateIntentsForDB(entry.Name(), "", entry, true)
@@ -174,15 +257,18 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike, filterDB stri
 				return err
 			}
 		} else {
-			if entry.Name() == "oplog.bson" {
+			if isOplog(entry) {
 				if restore.InputOptions.OplogReplay {
-					log.Log(log.DebugLow, "found oplog.bson file to replay")
+					log.Logf(log.DebugLow, "found %v file to replay", entry.Name())
 				}
 				foundOplog = true
+				// archives may hold the oplog in a collection of another name,
+				// which their data is demultiplexed by
 				oplogIntent := &intents.Intent{
-					C:        "oplog",
+					C:        strings.TrimSuffix(entry.Name(), ".bson"),
 					BSONPath: entry.Path(),
 					Size:     entry.Size(),
+					Oplog:    true,
 				}
 				// filterDB is used to mimic CreateIntentsForDB, and since CreateIntentsForDB wouldn't
 				// apply the oplog, even when asked, we don't either.
@@ -215,11 +301,31 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike, filterDB stri
 							Demux:  restore.archive.Demux,
 						}
 				} else {
-					oplogIntent.BSONFile = &realBSONFile{intent: oplogIntent, gzip: restore.InputOptions.Gzip}
+					oplogIntent.BSONFile = &realBSONFile{
+						intent:        oplogIntent,
+						gzip:          restore.InputOptions.Gzip,
+						parallelGzip: restore.InputOptions.ParallelGzip,
+					}
 				}
 				restore.manager.Put(oplogIntent)
 			} else {
-				log.Logf(log.Always, `don't know what to do with file "%v", skipping...`, entry.Path())
+				if restore.InputOptions.Archive == "" || isMetadataEntry(entry) {
+					log.Logf(log.Always, `don't know what to do with file "%v", skipping...`, entry.Path())
+				} else {
+					skippedIntent := &intents.Intent{
+						C: strings.TrimSuffix(entry.Name(), ".bson"),
+					}
+					log.Logf(log.Always, "warning: ignoring top level collection %v of the archive, "+
+						"which isn't its oplog", skippedIntent.C)
+					// the archive still holds the collection's data, which must be consumed
+					restore.archive.Demux.Open(
+						skippedIntent.Namespace(),
+						&archive.MutedCollection{
+							Intent: skippedIntent,
+							Demux:  restore.archive.Demux,
+						},
+					)
+				}
 			}
 		}
 	}
@@ -229,6 +335,15 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike, filterDB stri
 	return nil
 }
 
+// includesDB returns whether the given database, as it is named in the dump,
+// is one of the databases given to --includeDB, or true if there are none.
+func (restore *MongoRestore) includesDB(dbName string) bool {
+	if len(restore.InputOptions.IncludeDBs) == 0 {
+		return true
+	}
+	return util.StringSliceContains(restore.InputOptions.IncludeDBs, dbName)
+}
+
 // CreateIntentsForDB drills down into the dir folder, creating intents
 // for all of the collection dump files it finds for the db database.
 func (restore *MongoRestore) CreateIntentsForDB(db string, filterCollection string, dir archive.DirLike, mute bool) (err error) {
@@ -281,6 +396,10 @@ func (restore *MongoRestore) CreateIntentsForDB(db string, filterCollection stri
 					Size:     entry.Size(),
 					BSONPath: entry.Path(),
 				}
+				archiveIntent, err := restore.stripIntentPrefix(intent, skip)
+				if err != nil {
+					return err
+				}
 				if restore.InputOptions.Archive != "" {
 					if restore.InputOptions.Archive == "-" {
 						intent.Location = "archive on stdin"
@@ -295,33 +414,46 @@ func (restore *MongoRestore) CreateIntentsForDB(db string, filterCollection stri
 					} else {
 						if intent.IsSpecialCollection() {
 							intent.BSONFile = &archive.SpecialCollectionCache{Intent: intent, Demux: restore.archive.Demux}
-							restore.archive.Demux.Open(intent.Namespace(), intent.BSONFile)
+							restore.archive.Demux.Open(archiveIntent.Namespace(), intent.BSONFile)
 						} else {
-							intent.BSONFile = &archive.RegularCollectionReceiver{Intent: intent, Demux: restore.archive.Demux}
+							intent.BSONFile = &archive.RegularCollectionReceiver{Intent: archiveIntent, Demux: restore.archive.Demux}
 						}
 					}
 				} else {
 					if skip {
 						continue
 					}
-					intent.BSONFile = &realBSONFile{intent: intent, gzip: restore.InputOptions.Gzip}
+					intent.BSONFile = &realBSONFile{
+						intent:        intent,
+						gzip:          restore.InputOptions.Gzip,
+						parallelGzip: restore.InputOptions.ParallelGzip,
+						reverse:       restore.InputOptions.ReverseOrder,
+					}
 				}
 				log.Logf(log.Info, "found collection %v bson to restore", intent.Namespace())
 				restore.manager.Put(intent)
 			case MetadataFileType:
 				usesMetadataFiles = true
+				if mute {
+					// creating the collection would restore part of a database that isn't being restored
+					continue
+				}
 				intent := &intents.Intent{
 					DB:           db,
 					C:            collection,
 					MetadataPath: entry.Path(),
 				}
+				archiveIntent, err := restore.stripIntentPrefix(intent, mute)
+				if err != nil {
+					return err
+				}
 				if restore.InputOptions.Archive != "" {
 					if restore.InputOptions.Archive == "-" {
 						intent.Location = "archive on stdin"
 					} else {
 						intent.Location = fmt.Sprintf("archive '%v'", restore.InputOptions.Archive)
 					}
-					intent.MetadataFile = &archive.MetadataPreludeFile{Intent: intent, Prelude: restore.archive.Prelude}
+					intent.MetadataFile = &archive.MetadataPreludeFile{Intent: archiveIntent, Prelude: restore.archive.Prelude}
 				} else {
 					intent.MetadataFile = &realMetadataFile{intent: intent, gzip: restore.InputOptions.Gzip}
 				}
@@ -381,7 +513,13 @@ func (restore *MongoRestore) CreateIntentForCollection(db string, collection str
 		BSONPath: dir.Path(),
 		Size:     dir.Size(),
 	}
-	intent.BSONFile = &realBSONFile{intent: intent, gzip: restore.InputOptions.Gzip}
+	intent.BSONFile = &realBSONFile{
+		intent:        intent,
+		gzip:          restore.InputOptions.Gzip,
+		parallelGzip: restore.InputOptions.ParallelGzip,
+		startOffset:   restore.InputOptions.StartOffset,
+		reverse:       restore.InputOptions.ReverseOrder,
+	}
 
 	// finally, check if it has a .metadata.json file in its folder
 	log.Logf(log.DebugLow, "scanning directory %v for metadata", dir.Name())
@@ -395,7 +533,7 @@ func (restore *MongoRestore) CreateIntentForCollection(db string, collection str
 	}
 	metadataName := baseName + ".metadata.json"
 	for _, entry := range entries {
-		if entry.Name() == metadataName {
+		if entry.Name() == metadataName || entry.Name() == metadataName+".gz" {
 			metadataPath := entry.Path()
 			log.Logf(log.Info, "found metadata for collection at %v", metadataPath)
 			intent.MetadataPath = metadataPath
@@ -416,7 +554,8 @@ func (restore *MongoRestore) CreateIntentForCollection(db string, collection str
 // helper for searching a list of FileInfo for metadata files
 func hasMetadataFiles(files []archive.DirLike) bool {
 	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".metadata.json") {
+		if strings.HasSuffix(file.Name(), ".metadata.json") ||
+			strings.HasSuffix(file.Name(), ".metadata.json.gz") {
 			return true
 		}
 	}
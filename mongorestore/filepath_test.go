@@ -2,6 +2,9 @@ package mongorestore
 
 import (
 	"bytes"
+	"compress/gzip"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
@@ -9,6 +12,10 @@ import (
 	"github.com/mongodb/mongo-tools/common/testutil"
 	"github.com/mongodb/mongo-tools/common/util"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -296,3 +303,196 @@ func TestCreateIntentsForCollection(t *testing.T) {
 
 	})
 }
+
+func TestGzippedMetadata(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a dump directory holding gzipped metadata", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_gzip_metadata")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		So(ioutil.WriteFile(filepath.Join(dir, "c1.bson"), []byte{}, 0644), ShouldBeNil)
+		metadata := &bytes.Buffer{}
+		gzWriter := gzip.NewWriter(metadata)
+		_, err = gzWriter.Write([]byte(`{"options":{},"indexes":[` +
+			`{"v":1,"key":{"_id":1},"name":"_id_","ns":"db1.c1"},` +
+			`{"v":1,"key":{"a":1},"name":"a_1","ns":"db1.c1"}]}`))
+		So(err, ShouldBeNil)
+		So(gzWriter.Close(), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "c1.metadata.json.gz"), metadata.Bytes(), 0644), ShouldBeNil)
+
+		mr := &MongoRestore{
+			manager:      intents.NewIntentManager(),
+			InputOptions: &InputOptions{},
+			ToolOptions:  &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+		}
+
+		// readIndexes reads the indexes from the metadata of the intent for db1.c1
+		readIndexes := func() []IndexDocument {
+			intent := mr.manager.IntentForNamespace("db1.c1")
+			So(intent, ShouldNotBeNil)
+			So(intent.MetadataFile, ShouldNotBeNil)
+			So(intent.MetadataFile.Open(), ShouldBeNil)
+			defer intent.MetadataFile.Close()
+			raw, err := ioutil.ReadAll(intent.MetadataFile)
+			So(err, ShouldBeNil)
+			_, indexes, err := mr.MetadataFromJSON(raw)
+			So(err, ShouldBeNil)
+			return indexes
+		}
+
+		Convey("its indexes should be read without --gzip", func() {
+			ddl, err := newActualPath(dir)
+			So(err, ShouldBeNil)
+			So(mr.CreateIntentsForDB("db1", "", ddl, false), ShouldBeNil)
+			indexes := readIndexes()
+			So(len(indexes), ShouldEqual, 2)
+			So(indexes[1].Options["name"], ShouldEqual, "a_1")
+		})
+
+		Convey("its indexes should be found when restoring the collection's bson file", func() {
+			bsonFile, err := newActualPath(filepath.Join(dir, "c1.bson"))
+			So(err, ShouldBeNil)
+			So(mr.CreateIntentForCollection("db1", "c1", bsonFile), ShouldBeNil)
+			So(len(readIndexes()), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestIncludeDB(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive of three databases, restoring two of them", t, func() {
+		buf := &closingBuffer{}
+		So(writeTestArchive(buf, 20,
+			&intents.Intent{DB: "db1", C: "c1", BSONPath: "db1/c1.bson"},
+			&intents.Intent{DB: "db2", C: "c1", BSONPath: "db2/c1.bson"},
+			&intents.Intent{DB: "db3", C: "c1", BSONPath: "db3/c1.bson"},
+		), ShouldBeNil)
+
+		sink := &bytes.Buffer{}
+		restore := &MongoRestore{
+			manager:       intents.NewIntentManager(),
+			InputOptions:  &InputOptions{Archive: "dump.archive", IncludeDBs: []string{"db1", "db3"}},
+			OutputOptions: &OutputOptions{},
+			ToolOptions:   &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+			DocumentSink:  sink,
+			knownCollections: map[string][]string{
+				"db1": {}, "db2": {}, "db3": {},
+			},
+			archive: &archive.Reader{In: buf, Prelude: &archive.Prelude{}},
+		}
+		So(restore.archive.Prelude.Read(buf), ShouldBeNil)
+		restore.archive.Demux = &archive.Demultiplexer{In: buf, NamespaceBufferSize: archiveNamespaceBufferSize}
+		target, err := restore.archive.Prelude.NewPreludeExplorer()
+		So(err, ShouldBeNil)
+		So(restore.CreateAllIntents(target, "", ""), ShouldBeNil)
+
+		Convey("only the included databases should be restored", func() {
+			So(restore.manager.IntentForNamespace("db2.c1"), ShouldBeNil)
+			toRestore := []*intents.Intent{
+				restore.manager.IntentForNamespace("db1.c1"),
+				restore.manager.IntentForNamespace("db3.c1"),
+			}
+			for _, intent := range toRestore {
+				So(intent, ShouldNotBeNil)
+				So(intent.BSONFile.Open(), ShouldBeNil)
+			}
+			demuxErr := make(chan error)
+			go func() {
+				demuxErr <- restore.archive.Demux.Run()
+			}()
+
+			// restore the collections in the order they were written to the archive
+			for _, intent := range toRestore {
+				So(restore.RestoreIntent(intent), ShouldBeNil)
+			}
+			So(<-demuxErr, ShouldBeNil)
+			So(restore.dumpedDatabases(), ShouldResemble, []string{"db1", "db3"})
+
+			// the documents of db2 were skipped, leaving it untouched
+			So(len(sinkDocuments(sink)), ShouldEqual, 40)
+		})
+
+		Convey("--db should narrow the included databases further", func() {
+			restore.manager = intents.NewIntentManager()
+			So(restore.CreateAllIntents(target, "db3", ""), ShouldBeNil)
+			restored := []string{}
+			for _, intent := range restore.manager.Intents() {
+				restored = append(restored, intent.Namespace())
+			}
+			So(restored, ShouldResemble, []string{"db3.c1"})
+		})
+	})
+}
+
+func TestCreateAllIntentsTopLevel(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive whose prelude classifies oplog.rs as its oplog", t, func() {
+		logged := &bytes.Buffer{}
+		log.SetWriter(logged)
+		Reset(func() {
+			log.SetWriter(os.Stderr)
+		})
+
+		buf := &closingBuffer{}
+		So(writeTestArchive(buf, 5,
+			&intents.Intent{C: "oplog.rs", BSONPath: "oplog.rs.bson"},
+			&intents.Intent{C: "stray", BSONPath: "stray.bson"},
+		), ShouldBeNil)
+		restore := &MongoRestore{
+			manager:       intents.NewIntentManager(),
+			InputOptions:  &InputOptions{Archive: "dump.archive", OplogReplay: true},
+			OutputOptions: &OutputOptions{},
+			ToolOptions:   &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+			archive:       &archive.Reader{In: buf, Prelude: &archive.Prelude{}},
+		}
+		So(restore.archive.Prelude.Read(buf), ShouldBeNil)
+		restore.archive.Prelude.ClassifyTopLevel = func(collection string) archive.TopLevelKind {
+			if collection == "oplog.rs" {
+				return archive.TopLevelOplog
+			}
+			return archive.TopLevelCollection
+		}
+		restore.archive.Demux = &archive.Demultiplexer{In: buf, NamespaceBufferSize: archiveNamespaceBufferSize}
+		target, err := restore.archive.Prelude.NewPreludeExplorer()
+		So(err, ShouldBeNil)
+		So(restore.CreateAllIntents(target, "", ""), ShouldBeNil)
+
+		Convey("the oplog should be named after its collection and still be the oplog", func() {
+			oplog := restore.manager.Oplog()
+			So(oplog, ShouldNotBeNil)
+			So(oplog.C, ShouldEqual, "oplog.rs")
+			So(oplog.IsOplog(), ShouldBeTrue)
+		})
+
+		Convey("the other top level collection should be ignored with a warning", func() {
+			So(restore.manager.IntentForNamespace(".stray"), ShouldBeNil)
+			So(logged.String(), ShouldContainSubstring,
+				"warning: ignoring top level collection stray of the archive, which isn't its oplog")
+		})
+
+		Convey("the data of both should be consumed from the archive", func() {
+			oplog := restore.manager.Oplog()
+			So(oplog.BSONFile.Open(), ShouldBeNil)
+			demuxErr := make(chan error)
+			go func() {
+				demuxErr <- restore.archive.Demux.Run()
+			}()
+			count := 0
+			bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(oplog.BSONFile))
+			for bsonSource.Next(&bson.D{}) {
+				count++
+			}
+			So(bsonSource.Err(), ShouldBeNil)
+			So(count, ShouldEqual, 5)
+			So(<-demuxErr, ShouldBeNil)
+		})
+	})
+}
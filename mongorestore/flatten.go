@@ -0,0 +1,89 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"strings"
+)
+
+// Modes of --flattenArrays.
+const (
+	flattenArraysKeep  = "keep"
+	flattenArraysIndex = "index"
+)
+
+// validateFlattenNamespace checks that an argument to --flatten is a namespace.
+func validateFlattenNamespace(ns string) error {
+	dot := strings.Index(ns, ".")
+	if dot <= 0 || dot == len(ns)-1 {
+		return fmt.Errorf("'%v' is not a namespace of the form db.coll", ns)
+	}
+	return nil
+}
+
+// getFlattenTransform returns the transform that flattens the documents of the
+// intent's collection, or nil if it isn't given to --flatten.
+func (restore *MongoRestore) getFlattenTransform(intent *intents.Intent) documentTransform {
+	if !restore.flattenNamespaces[intent.Namespace()] {
+		return nil
+	}
+	return flattenDocument(restore.OutputOptions.FlattenArrays == flattenArraysIndex)
+}
+
+// flattenDocument creates a documentTransform that replaces the subdocuments of
+// each document with top level fields named by their dotted paths, so that
+// {a: {b: {c: 1}}} becomes {"a.b.c": 1}. Arrays are left as they are, unless
+// indexArrays is set, in which case their elements are flattened too, named by
+// their index, so that {a: [{b: 1}]} becomes {"a.0.b": 1}. Empty subdocuments and
+// arrays are kept, since they would otherwise disappear. The _id is left as it
+// is, so that every document keeps one.
+//
+// Flattening can't always be undone: a field whose name already had a dot in it
+// can't be told apart from a flattened one, and indexed arrays can't be told
+// apart from subdocuments with numeric field names. Dotted field names need
+// MongoDB 3.6 or later.
+func flattenDocument(indexArrays bool) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		flattened := bson.D{}
+		for _, elem := range doc {
+			if elem.Name == "_id" {
+				flattened = append(flattened, elem)
+				continue
+			}
+			flattened = flattenValue(flattened, elem.Name, elem.Value, indexArrays)
+		}
+		return bson.Marshal(flattened)
+	}
+}
+
+// flattenValue appends the value to flattened as the field name, or, if it is a
+// subdocument or an array being indexed, appends each of its elements named with
+// name as a prefix.
+func flattenValue(flattened bson.D, name string, value interface{}, indexArrays bool) bson.D {
+	switch v := value.(type) {
+	case bson.D:
+		if len(v) == 0 {
+			break
+		}
+		for _, elem := range v {
+			flattened = flattenValue(flattened, name+"."+elem.Name, elem.Value, indexArrays)
+		}
+		return flattened
+	case []interface{}:
+		if !indexArrays || len(v) == 0 {
+			break
+		}
+		for i, elem := range v {
+			flattened = flattenValue(flattened, name+"."+strconv.Itoa(i), elem, indexArrays)
+		}
+		return flattened
+	}
+	return append(flattened, bson.DocElem{name, value})
+}
@@ -0,0 +1,78 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestFlatten(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a document nested two levels deep", t, func() {
+		raw, err := bson.Marshal(bson.D{
+			{"_id", 1},
+			{"user", bson.D{
+				{"name", "ann"},
+				{"address", bson.D{{"city", "Oslo"}, {"zip", "0150"}}},
+				{"prefs", bson.D{}},
+			}},
+			{"tags", []interface{}{"a", bson.D{{"b", 2}}}},
+		})
+		So(err, ShouldBeNil)
+
+		flatten := func(indexArrays bool) bson.D {
+			out, err := flattenDocument(indexArrays)(raw)
+			So(err, ShouldBeNil)
+			doc := bson.D{}
+			So(bson.Unmarshal(out, &doc), ShouldBeNil)
+			return doc
+		}
+
+		Convey("its subdocuments should be flattened to dotted keys, keeping arrays", func() {
+			So(flatten(false), ShouldResemble, bson.D{
+				{"_id", 1},
+				{"user.name", "ann"},
+				{"user.address.city", "Oslo"},
+				{"user.address.zip", "0150"},
+				{"user.prefs", bson.D{}},
+				{"tags", []interface{}{"a", bson.D{{"b", 2}}}},
+			})
+		})
+
+		Convey("with --flattenArrays=index, arrays should be flattened by index", func() {
+			So(flatten(true), ShouldResemble, bson.D{
+				{"_id", 1},
+				{"user.name", "ann"},
+				{"user.address.city", "Oslo"},
+				{"user.address.zip", "0150"},
+				{"user.prefs", bson.D{}},
+				{"tags.0", "a"},
+				{"tags.1.b", 2},
+			})
+		})
+	})
+
+	Convey("A subdocument _id should be left as it is", t, func() {
+		raw, err := bson.Marshal(bson.D{{"_id", bson.D{{"a", 1}, {"b", 2}}}, {"x", bson.D{{"y", 3}}}})
+		So(err, ShouldBeNil)
+		out, err := flattenDocument(true)(raw)
+		So(err, ShouldBeNil)
+		doc := bson.D{}
+		So(bson.Unmarshal(out, &doc), ShouldBeNil)
+		So(doc, ShouldResemble, bson.D{{"_id", bson.D{{"a", 1}, {"b", 2}}}, {"x.y", 3}})
+	})
+
+	Convey("Only the collections given to --flatten should be flattened", t, func() {
+		restore := &MongoRestore{
+			OutputOptions:     &OutputOptions{FlattenArrays: flattenArraysKeep},
+			flattenNamespaces: map[string]bool{"db1.events": true},
+		}
+		So(restore.getFlattenTransform(&intents.Intent{DB: "db1", C: "events"}), ShouldNotBeNil)
+		So(restore.getFlattenTransform(&intents.Intent{DB: "db1", C: "users"}), ShouldBeNil)
+		So(validateFlattenNamespace("events"), ShouldNotBeNil)
+	})
+}
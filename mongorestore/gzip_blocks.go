@@ -0,0 +1,219 @@
+package mongorestore
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// A gzip file may be made of several gzip members one after another, each of
+// which can be decompressed on its own. BGZF files, such as bgzip writes, are
+// made of members of at most 64KB that each record their compressed size in an
+// extra field of their header, so they can be split into members without
+// decompressing them, and the members decompressed on several cores at once.
+// --parallelGzip decompresses such files that way; any other gzip file has to be
+// decompressed in order, and is decompressed ahead of its reader instead.
+
+// bgzfHeaderSize is the size of the header of a BGZF member, up to the end of
+// its extra field, and bgzfMaxDataSize the most data a member can hold.
+const (
+	bgzfHeaderSize  = 18
+	bgzfMaxDataSize = 64 * 1024
+)
+
+// bgzfBlockSize returns the compressed size of the gzip member whose header
+// starts header, if the member is a BGZF block.
+func bgzfBlockSize(header []byte) (int, bool) {
+	if len(header) < bgzfHeaderSize ||
+		header[0] != 0x1f || header[1] != 0x8b || header[2] != 8 || header[3]&0x04 == 0 ||
+		binary.LittleEndian.Uint16(header[10:]) != 6 ||
+		header[12] != 'B' || header[13] != 'C' || binary.LittleEndian.Uint16(header[14:]) != 2 {
+		return 0, false
+	}
+	return int(binary.LittleEndian.Uint16(header[16:])) + 1, true
+}
+
+// newParallelGzipReader returns a reader of the decompressed contents of in. It
+// decompresses the BGZF blocks of in on several cores, or if in isn't made of
+// BGZF blocks, decompresses it in turn ahead of the reader.
+func newParallelGzipReader(in io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(in)
+	header, _ := buffered.Peek(bgzfHeaderSize)
+	if _, ok := bgzfBlockSize(header); ok {
+		return newGzipBlockReader(buffered, runtime.NumCPU()), nil
+	}
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedReadCloser{newReadAheadReader(gz), gz}, nil
+}
+
+// gzipBlock is a gzip member of a file, and its decompressed data once a worker
+// has decompressed it. A member that isn't a BGZF block can't be split from the
+// members after it, so it is decompressed along with them in turn, from rest.
+type gzipBlock struct {
+	compressed   []byte
+	data         []byte
+	rest         io.Reader
+	err          error
+	decompressed chan struct{}
+}
+
+// gzipBlockReader splits a BGZF file into its blocks in one goroutine, and
+// decompresses the blocks in several others, handing them over to its reader in
+// the order of the file.
+type gzipBlockReader struct {
+	blocks    chan *gzipBlock
+	current   *gzipBlock
+	unread    []byte
+	done      chan struct{}
+	finished  sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func newGzipBlockReader(in *bufio.Reader, workers int) *gzipBlockReader {
+	reader := &gzipBlockReader{
+		blocks: make(chan *gzipBlock, 2*workers),
+		done:   make(chan struct{}),
+	}
+	work := make(chan *gzipBlock, workers)
+	reader.finished.Add(workers + 1)
+	go reader.split(in, work)
+	for i := 0; i < workers; i++ {
+		go reader.decompress(work)
+	}
+	return reader
+}
+
+// split reads the blocks of in until it fails or the reader is closed, queueing
+// each block for the reader and for the workers.
+func (reader *gzipBlockReader) split(in *bufio.Reader, work chan<- *gzipBlock) {
+	defer reader.finished.Done()
+	defer close(work)
+	defer close(reader.blocks)
+	for {
+		block := &gzipBlock{decompressed: make(chan struct{})}
+		header, err := in.Peek(bgzfHeaderSize)
+		if len(header) == 0 && err == io.EOF {
+			return
+		}
+		size, ok := bgzfBlockSize(header)
+		if !ok {
+			// this also reports a header cut short, or the error that cut it short
+			block.rest, block.err = gzip.NewReader(in)
+			close(block.decompressed)
+			reader.queue(block)
+			return
+		}
+		block.compressed = make([]byte, size)
+		if _, err = io.ReadFull(in, block.compressed); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			block.err = err
+			close(block.decompressed)
+			reader.queue(block)
+			return
+		}
+		if !reader.queue(block) {
+			return
+		}
+		select {
+		case work <- block:
+		case <-reader.done:
+			return
+		}
+	}
+}
+
+// queue hands block over to the reader, returning false if the reader was closed
+// first.
+func (reader *gzipBlockReader) queue(block *gzipBlock) bool {
+	select {
+	case reader.blocks <- block:
+		return true
+	case <-reader.done:
+		return false
+	}
+}
+
+// decompress decompresses blocks until there are no more.
+func (reader *gzipBlockReader) decompress(work <-chan *gzipBlock) {
+	defer reader.finished.Done()
+	var gz *gzip.Reader
+	for block := range work {
+		source := bytes.NewReader(block.compressed)
+		if gz == nil {
+			gz, block.err = gzip.NewReader(source)
+		} else {
+			block.err = gz.Reset(source)
+		}
+		if block.err == nil {
+			block.data, block.err = readGzipBlock(gz, block.compressed)
+		}
+		close(block.decompressed)
+	}
+}
+
+// readGzipBlock decompresses a block of compressed from gz, which reads from
+// compressed.
+func readGzipBlock(gz *gzip.Reader, compressed []byte) ([]byte, error) {
+	// a gzip member ends with the size of its decompressed data, which for a
+	// BGZF block is at most 64KB
+	size := binary.LittleEndian.Uint32(compressed[len(compressed)-4:])
+	if size > bgzfMaxDataSize {
+		return nil, fmt.Errorf("BGZF block of %v bytes is larger than %v bytes", size, bgzfMaxDataSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(gz, data); err != nil {
+		return nil, err
+	}
+	// reading to the end of the block checks its checksum
+	n, err := gz.Read(make([]byte, 1))
+	if n > 0 || err == nil {
+		return nil, fmt.Errorf("BGZF block is larger than its recorded size of %v bytes", size)
+	}
+	if err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (reader *gzipBlockReader) Read(p []byte) (int, error) {
+	for len(reader.unread) == 0 {
+		if reader.current != nil {
+			if reader.current.err != nil {
+				return 0, reader.current.err
+			}
+			if reader.current.rest != nil {
+				return reader.current.rest.Read(p)
+			}
+		}
+		block, ok := <-reader.blocks
+		if !ok {
+			return 0, io.EOF
+		}
+		<-block.decompressed
+		reader.current, reader.unread = block, block.data
+	}
+	n := copy(p, reader.unread)
+	reader.unread = reader.unread[n:]
+	return n, nil
+}
+
+// Close stops splitting and decompressing blocks, waiting for the blocks being
+// decompressed to be finished, so that the reader read from can then be closed.
+// It doesn't close that reader.
+func (reader *gzipBlockReader) Close() error {
+	reader.closeOnce.Do(func() {
+		close(reader.done)
+	})
+	reader.finished.Wait()
+	return nil
+}
@@ -0,0 +1,112 @@
+package mongorestore
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+)
+
+// bgzfBlocks compresses data as bgzip would, in BGZF blocks of at most blockSize
+// bytes of data each, followed by BGZF's empty end-of-file block.
+func bgzfBlocks(data []byte, blockSize int) ([]byte, error) {
+	compressed := &bytes.Buffer{}
+	writeBlock := func(data []byte) error {
+		block := &bytes.Buffer{}
+		writer := gzip.NewWriter(block)
+		// the block size is filled in once the block has been compressed
+		writer.Header.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+		if _, err := writer.Write(data); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		raw := block.Bytes()
+		binary.LittleEndian.PutUint16(raw[16:], uint16(len(raw)-1))
+		_, err := compressed.Write(raw)
+		return err
+	}
+	for len(data) > 0 {
+		n := blockSize
+		if n > len(data) {
+			n = len(data)
+		}
+		if err := writeBlock(data[:n]); err != nil {
+			return nil, err
+		}
+		data = data[n:]
+	}
+	if err := writeBlock(nil); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func TestParallelGzipReader(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a gzipped .bson file and the same data in BGZF blocks", t, func() {
+		gzipped, err := gzippedTestDocuments(30000)
+		So(err, ShouldBeNil)
+		gz, err := gzip.NewReader(bytes.NewReader(gzipped))
+		So(err, ShouldBeNil)
+		data, err := ioutil.ReadAll(gz)
+		So(err, ShouldBeNil)
+		blocks, err := bgzfBlocks(data, 60000)
+		So(err, ShouldBeNil)
+		_, ok := bgzfBlockSize(blocks)
+		So(ok, ShouldBeTrue)
+
+		readAll := func(compressed []byte) ([]byte, error) {
+			reader, err := newParallelGzipReader(bytes.NewReader(compressed))
+			So(err, ShouldBeNil)
+			defer reader.Close()
+			return ioutil.ReadAll(reader)
+		}
+
+		Convey("decompressing the blocks in parallel should give the same data", func() {
+			decompressed, err := readAll(blocks)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(decompressed, data), ShouldBeTrue)
+		})
+
+		Convey("the gzipped file should be decompressed ahead of the reader instead", func() {
+			_, ok := bgzfBlockSize(gzipped)
+			So(ok, ShouldBeFalse)
+			decompressed, err := readAll(gzipped)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(decompressed, data), ShouldBeTrue)
+		})
+
+		Convey("a member after the blocks that isn't a BGZF block should be decompressed in turn", func() {
+			decompressed, err := readAll(append(append([]byte{}, blocks...), gzipped...))
+			So(err, ShouldBeNil)
+			So(bytes.Equal(decompressed, append(append([]byte{}, data...), data...)), ShouldBeTrue)
+		})
+
+		Convey("blocks cut short should be an error", func() {
+			_, err := readAll(blocks[:len(blocks)/2])
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a corrupt block should be an error", func() {
+			corrupt := append([]byte{}, blocks...)
+			corrupt[len(corrupt)/2] ^= 0xff
+			_, err := readAll(corrupt)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("closing the reader before the end should stop the workers", func() {
+			reader := newGzipBlockReader(bufio.NewReader(bytes.NewReader(blocks)), 4)
+			_, err := reader.Read(make([]byte, 100))
+			So(err, ShouldBeNil)
+			So(reader.Close(), ShouldBeNil)
+		})
+	})
+}
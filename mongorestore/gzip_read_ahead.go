@@ -0,0 +1,109 @@
+package mongorestore
+
+import (
+	"io"
+	"sync"
+)
+
+// The decompressed data of --parallelGzip is handed over in blocks of
+// readAheadBlockSize bytes, with up to readAheadBlocks blocks decompressed
+// ahead of the reader.
+const (
+	readAheadBlockSize = 1024 * 1024
+	readAheadBlocks    = 4
+)
+
+// readAheadBlock is a block of data read ahead, and the error that ended the
+// reading, if any.
+type readAheadBlock struct {
+	data []byte
+	err  error
+}
+
+// readAheadReader reads from another reader, such as a gzip decompressor, in a
+// goroutine of its own, in blocks, ahead of its own reader. A gzip stream can only
+// be decompressed in order, but this way decompressing a .bson file overlaps with
+// decoding and inserting its documents, rather than taking turns with them.
+type readAheadReader struct {
+	blocks    chan readAheadBlock
+	free      chan []byte
+	current   readAheadBlock
+	unread    []byte
+	done      chan struct{}
+	finished  chan struct{}
+	closeOnce sync.Once
+}
+
+func newReadAheadReader(in io.Reader) *readAheadReader {
+	reader := &readAheadReader{
+		blocks:   make(chan readAheadBlock, readAheadBlocks),
+		free:     make(chan []byte, readAheadBlocks+1),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go reader.fill(in)
+	return reader
+}
+
+// fill reads blocks from in until it fails or the reader is closed.
+func (reader *readAheadReader) fill(in io.Reader) {
+	defer close(reader.finished)
+	defer close(reader.blocks)
+	for {
+		var data []byte
+		select {
+		case data = <-reader.free:
+		default:
+			data = make([]byte, readAheadBlockSize)
+		}
+		// unlike io.ReadFull, this returns the reader's own error at its end
+		var n int
+		var err error
+		for n < len(data) && err == nil {
+			var read int
+			read, err = in.Read(data[n:])
+			n += read
+		}
+		select {
+		case reader.blocks <- readAheadBlock{data: data[:n], err: err}:
+		case <-reader.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (reader *readAheadReader) Read(p []byte) (int, error) {
+	for len(reader.unread) == 0 {
+		if reader.current.err != nil {
+			return 0, reader.current.err
+		}
+		if reader.current.data != nil {
+			// the block has been read, so it can be filled again
+			select {
+			case reader.free <- reader.current.data[:cap(reader.current.data)]:
+			default:
+			}
+		}
+		block, ok := <-reader.blocks
+		if !ok {
+			block.err = io.ErrClosedPipe
+		}
+		reader.current, reader.unread = block, block.data
+	}
+	n := copy(p, reader.unread)
+	reader.unread = reader.unread[n:]
+	return n, nil
+}
+
+// Close stops reading ahead, waiting for the block being read to be finished, so
+// that the reader read from can then be closed. It doesn't close that reader.
+func (reader *readAheadReader) Close() error {
+	reader.closeOnce.Do(func() {
+		close(reader.done)
+	})
+	<-reader.finished
+	return nil
+}
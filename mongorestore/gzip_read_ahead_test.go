@@ -0,0 +1,139 @@
+package mongorestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gzippedTestDocuments returns count documents of a few hundred bytes each, gzipped
+// as they would be in a .bson.gz file.
+func gzippedTestDocuments(count int) ([]byte, error) {
+	compressed := &bytes.Buffer{}
+	writer := gzip.NewWriter(compressed)
+	for i := 0; i < count; i++ {
+		raw, err := bson.Marshal(bson.D{{"_id", i}, {"text", strings.Repeat("restore ", i%64)}})
+		if err != nil {
+			return nil, err
+		}
+		if _, err = writer.Write(raw); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func TestParallelGzip(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a gzipped .bson file larger than the blocks read ahead", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_parallel_gzip")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		compressed, err := gzippedTestDocuments(30000)
+		So(err, ShouldBeNil)
+		path := filepath.Join(dir, "c.bson.gz")
+		So(ioutil.WriteFile(path, compressed, 0644), ShouldBeNil)
+
+		readAll := func(parallelGzip bool) []bson.D {
+			file := &realBSONFile{intent: &intents.Intent{BSONPath: path}, gzip: true, parallelGzip: parallelGzip}
+			So(file.Open(), ShouldBeNil)
+			source := db.NewDecodedBSONSource(db.NewBSONSource(file))
+			defer source.Close()
+			docs := []bson.D{}
+			doc := bson.D{}
+			for source.Next(&doc) {
+				docs = append(docs, doc)
+				doc = bson.D{}
+			}
+			So(source.Err(), ShouldBeNil)
+			return docs
+		}
+
+		Convey("reading ahead should decode the same documents as reading in turn", func() {
+			serial := readAll(false)
+			So(len(serial), ShouldEqual, 30000)
+			So(readAll(true), ShouldResemble, serial)
+		})
+
+		Convey("closing the file before the end should stop the reading ahead", func() {
+			file := &realBSONFile{intent: &intents.Intent{BSONPath: path}, gzip: true, parallelGzip: true}
+			So(file.Open(), ShouldBeNil)
+			_, err := file.Read(make([]byte, 100))
+			So(err, ShouldBeNil)
+			So(file.Close(), ShouldBeNil)
+		})
+	})
+
+	Convey("A read ahead reader should return the error that ended the reading", t, func() {
+		reader := newReadAheadReader(io.MultiReader(strings.NewReader("partial"), errorReader{io.ErrUnexpectedEOF}))
+		defer reader.Close()
+		data, err := ioutil.ReadAll(reader)
+		So(string(data), ShouldEqual, "partial")
+		So(err, ShouldEqual, io.ErrUnexpectedEOF)
+	})
+}
+
+type errorReader struct {
+	err error
+}
+
+func (reader errorReader) Read([]byte) (int, error) {
+	return 0, reader.err
+}
+
+func BenchmarkGzipDecompression(b *testing.B) {
+	compressed, err := gzippedTestDocuments(100000)
+	if err != nil {
+		b.Fatal(err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		b.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		b.Fatal(err)
+	}
+	blocks, err := bgzfBlocks(data, 65280)
+	if err != nil {
+		b.Fatal(err)
+	}
+	decompress := func(b *testing.B, compressed []byte, open func(io.Reader) (io.ReadCloser, error)) {
+		for i := 0; i < b.N; i++ {
+			reader, err := open(bytes.NewReader(compressed))
+			if err != nil {
+				b.Fatal(err)
+			}
+			n, err := io.Copy(ioutil.Discard, reader)
+			if err != nil {
+				b.Fatal(err)
+			}
+			reader.Close()
+			b.SetBytes(n)
+		}
+	}
+	serial := func(in io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(in)
+	}
+	b.Run("serial", func(b *testing.B) { decompress(b, compressed, serial) })
+	b.Run("readAhead", func(b *testing.B) { decompress(b, compressed, newParallelGzipReader) })
+	b.Run("serialBGZF", func(b *testing.B) { decompress(b, blocks, serial) })
+	b.Run("parallelBGZF", func(b *testing.B) { decompress(b, blocks, newParallelGzipReader) })
+}
@@ -0,0 +1,34 @@
+package mongorestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// hashDocuments creates a documentTransform that stores a SHA-256 hash of each
+// document in the field, as a hex string, so that documents can later be
+// compared by their hashes. The hash is of the document's BSON without the field,
+// so a document restored again with its hash gets the same one. Documents with
+// the same fields and values in the same order get the same hash.
+func hashDocuments(field string) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		hashed := bson.D{}
+		for _, elem := range doc {
+			if elem.Name != field {
+				hashed = append(hashed, elem)
+			}
+		}
+		content, err := bson.Marshal(hashed)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		return bson.Marshal(append(hashed, bson.DocElem{field, hex.EncodeToString(sum[:])}))
+	}
+}
@@ -0,0 +1,44 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestHashField(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --hashField set to contentHash", t, func() {
+		transform := hashDocuments("contentHash")
+		hashOf := func(doc bson.D) string {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			out, err := transform(raw)
+			So(err, ShouldBeNil)
+			hashed := bson.D{}
+			So(bson.Unmarshal(out, &hashed), ShouldBeNil)
+			last := hashed[len(hashed)-1]
+			So(last.Name, ShouldEqual, "contentHash")
+			return last.Value.(string)
+		}
+		doc := bson.D{{"_id", 1}, {"name", "ann"}, {"tags", []interface{}{"a", "b"}}}
+
+		Convey("identical documents should get the same hash", func() {
+			first := hashOf(doc)
+			So(len(first), ShouldEqual, 64)
+			So(hashOf(bson.D{{"_id", 1}, {"name", "ann"}, {"tags", []interface{}{"a", "b"}}}), ShouldEqual, first)
+		})
+
+		Convey("a modified document should get a different hash", func() {
+			So(hashOf(bson.D{{"_id", 1}, {"name", "ann"}, {"tags", []interface{}{"a", "c"}}}), ShouldNotEqual, hashOf(doc))
+		})
+
+		Convey("an existing hash field should be left out of the hash and replaced", func() {
+			withHash := append(doc[:len(doc):len(doc)], bson.DocElem{"contentHash", "stale"})
+			So(hashOf(withHash), ShouldEqual, hashOf(doc))
+		})
+	})
+}
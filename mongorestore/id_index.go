@@ -0,0 +1,110 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Modes of --idIndexOptions.
+const (
+	idIndexOptionsRestore = "restore"
+	idIndexOptionsIgnore  = "ignore"
+)
+
+// idIndexName is the name the server gives every _id index.
+const idIndexName = "_id_"
+
+// idIndexAllowedOptions are the options of an _id index spec, other than its key
+// and name, that the server accepts in the idIndex option of create.
+var idIndexAllowedOptions = map[string]bool{"v": true, "collation": true}
+
+// idIndexOptions takes the _id index out of the indexes to build for the intent,
+// since the server builds it when it creates the collection and it can't be
+// rebuilt without dropping the collection. With --idIndexOptions=restore, those
+// of its options the server allows on an _id index are added to the collection
+// options as the idIndex the collection is created with, and the others are
+// logged and ignored.
+func (restore *MongoRestore) idIndexOptions(intent *intents.Intent, options bson.D,
+	indexes []IndexDocument) (bson.D, []IndexDocument) {
+	var idIndex *IndexDocument
+	others := []IndexDocument{}
+	for i, index := range indexes {
+		if index.Options["name"] == idIndexName {
+			idIndex = &indexes[i]
+		} else {
+			others = append(others, index)
+		}
+	}
+	if idIndex == nil || intent.IsTimeseriesBuckets() {
+		return options, others
+	}
+	if restore.OutputOptions.IdIndexOptions == idIndexOptionsIgnore {
+		log.Logf(log.Info, "ignoring the options of the _id index of %v", intent.Namespace())
+		return options, others
+	}
+
+	ignored := []string{}
+	for name := range idIndex.Options {
+		if name != "name" && name != "ns" && !idIndexAllowedOptions[name] {
+			ignored = append(ignored, name)
+		}
+	}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		log.Logf(log.Always, "ignoring %v of the _id index of %v, which the server doesn't allow on _id indexes",
+			strings.Join(ignored, ", "), intent.Namespace())
+	}
+
+	spec := bson.D{}
+	if v, ok := idIndex.Options["v"]; ok && restore.OutputOptions.KeepIndexVersion {
+		spec = append(spec, bson.DocElem{"v", v})
+	}
+	if collation, ok := idIndex.Options["collation"]; ok {
+		// the server requires the _id index to have the collection's default collation
+		if sameValue(collation, optionValue(options, "collation")) {
+			spec = append(spec, bson.DocElem{"collation", collation})
+		} else {
+			log.Logf(log.Always, "ignoring the collation of the _id index of %v, "+
+				"which isn't the default collation of the collection", intent.Namespace())
+		}
+	}
+	if len(spec) == 0 {
+		return options, others
+	}
+	spec = append(spec, bson.DocElem{"key", idIndex.Key}, bson.DocElem{"name", idIndexName})
+	withIdIndex := append(bson.D{}, options...)
+	return append(withIdIndex, bson.DocElem{"idIndex", spec}), others
+}
+
+// optionValue returns the value of the named option, or nil if it isn't set.
+func optionValue(options bson.D, name string) interface{} {
+	for _, option := range options {
+		if option.Name == name {
+			return option.Value
+		}
+	}
+	return nil
+}
+
+// sameValue returns whether the values encode to the same BSON, regardless of
+// the order of the fields of documents.
+func sameValue(value1, value2 interface{}) bool {
+	if value1 == nil || value2 == nil {
+		return value1 == nil && value2 == nil
+	}
+	decoded := [2]bson.M{}
+	for i, value := range []interface{}{value1, value2} {
+		raw, err := bson.Marshal(bson.M{"value": value})
+		if err != nil {
+			return false
+		}
+		if err = bson.Unmarshal(raw, &decoded[i]); err != nil {
+			return false
+		}
+	}
+	return reflect.DeepEqual(decoded[0], decoded[1])
+}
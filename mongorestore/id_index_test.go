@@ -0,0 +1,93 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"testing"
+)
+
+func TestIdIndexOptions(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With metadata whose _id index has options", t, func() {
+		logged := &bytes.Buffer{}
+		log.SetWriter(logged)
+		Reset(func() {
+			log.SetWriter(os.Stderr)
+		})
+
+		restore := &MongoRestore{OutputOptions: &OutputOptions{IdIndexOptions: idIndexOptionsRestore}}
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+		metadata := func(collectionOptions string) (bson.D, []IndexDocument) {
+			options, indexes, err := restore.MetadataFromJSON([]byte(`{"options":` + collectionOptions + `,` +
+				`"indexes":[` +
+				`{"v":2,"key":{"_id":1},"name":"_id_","ns":"db1.c1","unique":true,"background":true,` +
+				`"collation":{"locale":"fr","strength":2}},` +
+				`{"v":2,"key":{"a":1},"name":"a_1","ns":"db1.c1"}]}`))
+			So(err, ShouldBeNil)
+			return options, indexes
+		}
+		idIndexSpec := func(options bson.D) bson.D {
+			spec, _ := optionValue(options, "idIndex").(bson.D)
+			return spec
+		}
+
+		Convey("the _id index should never be built with the other indexes", func() {
+			options, indexes := metadata(`{}`)
+			_, indexes = restore.idIndexOptions(intent, options, indexes)
+			So(len(indexes), ShouldEqual, 1)
+			So(indexes[0].Options["name"], ShouldEqual, "a_1")
+		})
+
+		Convey("a collation matching the collection's should be kept in the idIndex the collection is created with", func() {
+			options, indexes := metadata(`{"collation":{"strength":2,"locale":"fr"}}`)
+			options, _ = restore.idIndexOptions(intent, options, indexes)
+			spec := idIndexSpec(options)
+			So(spec, ShouldNotBeNil)
+			So(optionValue(spec, "name"), ShouldEqual, "_id_")
+			So(sameValue(optionValue(spec, "key"), bson.D{{"_id", 1}}), ShouldBeTrue)
+			So(optionValue(spec, "collation"), ShouldNotBeNil)
+			So(optionValue(spec, "unique"), ShouldBeNil)
+			So(optionValue(spec, "v"), ShouldBeNil)
+			So(logged.String(), ShouldContainSubstring,
+				"ignoring background, unique of the _id index of db1.c1, which the server doesn't allow on _id indexes")
+
+			Convey("with its version if --keepIndexVersion is set", func() {
+				restore.OutputOptions.KeepIndexVersion = true
+				options, indexes := metadata(`{"collation":{"locale":"fr","strength":2}}`)
+				options, _ = restore.idIndexOptions(intent, options, indexes)
+				So(sameValue(optionValue(idIndexSpec(options), "v"), 2), ShouldBeTrue)
+			})
+		})
+
+		Convey("a collation the collection doesn't have should be logged and ignored", func() {
+			options, indexes := metadata(`{"collation":{"locale":"de"}}`)
+			options, _ = restore.idIndexOptions(intent, options, indexes)
+			So(idIndexSpec(options), ShouldBeNil)
+			So(logged.String(), ShouldContainSubstring,
+				"ignoring the collation of the _id index of db1.c1, which isn't the default collation of the collection")
+		})
+
+		Convey("with --idIndexOptions=ignore, the collection options should be left as they are", func() {
+			restore.OutputOptions.IdIndexOptions = idIndexOptionsIgnore
+			options, indexes := metadata(`{"collation":{"locale":"fr","strength":2}}`)
+			withIdIndex, indexes := restore.idIndexOptions(intent, options, indexes)
+			So(withIdIndex, ShouldResemble, options)
+			So(len(indexes), ShouldEqual, 1)
+		})
+
+		Convey("the idIndex should be passed to create", func() {
+			options, indexes := metadata(`{"collation":{"locale":"fr","strength":2}}`)
+			options, _ = restore.idIndexOptions(intent, options, indexes)
+			command := restore.createCommand(intent, options)
+			So(command[0], ShouldResemble, bson.DocElem{"create", "c1"})
+			So(idIndexSpec(command), ShouldNotBeNil)
+		})
+	})
+}
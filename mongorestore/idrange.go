@@ -0,0 +1,159 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"strings"
+)
+
+// idRange is a parsed --idRange argument of the form "db.coll=min,max". Its bounds
+// are either both ObjectIds or both numbers; a nil bound leaves that end open.
+type idRange struct {
+	Min interface{}
+	Max interface{}
+}
+
+// parseIdRange parses an argument to --idRange, returning the namespace and range.
+// Each bound is an ObjectId in hex, a number, or empty for no bound.
+func parseIdRange(arg string) (string, *idRange, error) {
+	equals := strings.LastIndex(arg, "=")
+	if equals < 0 {
+		return "", nil, fmt.Errorf("expected the form db.coll=min,max")
+	}
+	ns, bounds := arg[:equals], arg[equals+1:]
+	dot := strings.Index(ns, ".")
+	if dot <= 0 || dot == len(ns)-1 {
+		return "", nil, fmt.Errorf("'%v' is not a namespace of the form db.coll", ns)
+	}
+	comma := strings.Index(bounds, ",")
+	if comma < 0 {
+		return "", nil, fmt.Errorf("expected a minimum and maximum _id separated by a comma")
+	}
+	min, err := parseIdBound(bounds[:comma])
+	if err != nil {
+		return "", nil, err
+	}
+	max, err := parseIdBound(bounds[comma+1:])
+	if err != nil {
+		return "", nil, err
+	}
+	if min == nil && max == nil {
+		return "", nil, fmt.Errorf("at least one of the minimum and maximum _id must be given")
+	}
+	if min != nil && max != nil {
+		cmp, ok := compareIds(min, max)
+		if !ok {
+			return "", nil, fmt.Errorf("the minimum and maximum _id must both be ObjectIds or both be numbers")
+		}
+		if cmp >= 0 {
+			return "", nil, fmt.Errorf("the minimum _id must be less than the maximum")
+		}
+	}
+	return ns, &idRange{Min: min, Max: max}, nil
+}
+
+// parseIdBound parses one bound of an --idRange, returning nil if it is empty.
+func parseIdBound(bound string) (interface{}, error) {
+	if bound == "" {
+		return nil, nil
+	}
+	if len(bound) == 24 && bson.IsObjectIdHex(bound) {
+		return bson.ObjectIdHex(bound), nil
+	}
+	number, err := strconv.ParseFloat(bound, 64)
+	if err != nil {
+		return nil, fmt.Errorf("'%v' is not an ObjectId or a number", bound)
+	}
+	return number, nil
+}
+
+// compareIds compares two _ids that are both ObjectIds or both numbers, returning
+// -1, 0 or 1. The second return value is false if they can't be compared.
+func compareIds(a, b interface{}) (int, bool) {
+	if aId, ok := a.(bson.ObjectId); ok {
+		bId, ok := b.(bson.ObjectId)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(string(aId), string(bId)), true
+	}
+	aNum, ok := idAsFloat(a)
+	if !ok {
+		return 0, false
+	}
+	bNum, ok := idAsFloat(b)
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case aNum < bNum:
+		return -1, true
+	case aNum > bNum:
+		return 1, true
+	}
+	return 0, true
+}
+
+// idAsFloat converts a numeric _id to a float64.
+func idAsFloat(id interface{}) (float64, bool) {
+	switch n := id.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// contains reports whether the id is in the range, which includes its minimum but
+// not its maximum so that adjacent ranges don't overlap. Ids of another type than
+// the range's bounds are never in it.
+func (r *idRange) contains(id interface{}) bool {
+	if r.Min != nil {
+		cmp, ok := compareIds(id, r.Min)
+		if !ok || cmp < 0 {
+			return false
+		}
+	}
+	if r.Max != nil {
+		cmp, ok := compareIds(id, r.Max)
+		if !ok || cmp >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// getIdRangeTransform returns the transform that skips documents outside the
+// intent's --idRange, or nil if it has none.
+func (restore *MongoRestore) getIdRangeTransform(intent *intents.Intent) documentTransform {
+	r, ok := restore.idRanges[intent.Namespace()]
+	if !ok {
+		return nil
+	}
+	return inIdRange(r)
+}
+
+// inIdRange creates a documentTransform that skips documents whose _id is outside
+// the range, decoding only their _id.
+func inIdRange(r *idRange) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := struct {
+			Id interface{} `bson:"_id"`
+		}{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		if !r.contains(doc.Id) {
+			return nil, nil
+		}
+		return raw, nil
+	}
+}
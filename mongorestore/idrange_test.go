@@ -0,0 +1,102 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestParseIdRange(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --idRange arguments", t, func() {
+
+		Convey("numeric bounds should be parsed", func() {
+			ns, r, err := parseIdRange("db1.c1=100,200.5")
+			So(err, ShouldBeNil)
+			So(ns, ShouldEqual, "db1.c1")
+			So(r.Min, ShouldEqual, 100.0)
+			So(r.Max, ShouldEqual, 200.5)
+		})
+
+		Convey("ObjectId bounds should be parsed, and either may be left open", func() {
+			_, r, err := parseIdRange("db1.c1=55d3c0e2a3b2ad9e5b000000,")
+			So(err, ShouldBeNil)
+			So(r.Min, ShouldEqual, bson.ObjectIdHex("55d3c0e2a3b2ad9e5b000000"))
+			So(r.Max, ShouldBeNil)
+		})
+
+		Convey("malformed arguments should be rejected", func() {
+			for _, arg := range []string{
+				"db1.c1", "c1=1,2", "db1.c1=1", "db1.c1=,", "db1.c1=2,1", "db1.c1=a,b",
+				"db1.c1=1,55d3c0e2a3b2ad9e5b000000",
+			} {
+				_, _, err := parseIdRange(arg)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestIdRange(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a restore into a DocumentSink of documents in three _id buckets", t, func() {
+		sink := &bytes.Buffer{}
+		restore := &MongoRestore{
+			DocumentSink:  sink,
+			OutputOptions: &OutputOptions{},
+		}
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+
+		restoreRange := func(docs []bson.D) (int64, []interface{}) {
+			transform, err := restore.getDocumentTransform(intent)
+			So(err, ShouldBeNil)
+			count, err := restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSourceOf(docs...), 0, transform)
+			So(err, ShouldBeNil)
+
+			return count, sinkIds(sink)
+		}
+
+		Convey("only the numeric ids in the assigned bucket should be restored", func() {
+			docs := []bson.D{}
+			for i := 0; i < 9; i++ {
+				docs = append(docs, bson.D{{"_id", i}})
+			}
+			docs = append(docs, bson.D{{"_id", 4.5}}, bson.D{{"_id", "4"}})
+			restore.idRanges = map[string]*idRange{"db1.c1": {Min: 3.0, Max: 6.0}}
+			count, ids := restoreRange(docs)
+			So(count, ShouldEqual, 4)
+			So(ids, ShouldResemble, []interface{}{3, 4, 5, 4.5})
+		})
+
+		Convey("only the ObjectIds in the assigned bucket should be restored", func() {
+			bucketIds := []bson.ObjectId{
+				bson.ObjectIdHex("100000000000000000000000"),
+				bson.ObjectIdHex("200000000000000000000000"),
+				bson.ObjectIdHex("300000000000000000000000"),
+			}
+			docs := []bson.D{}
+			for _, id := range bucketIds {
+				docs = append(docs, bson.D{{"_id", id}})
+			}
+			_, r, err := parseIdRange("db1.c1=200000000000000000000000,300000000000000000000000")
+			So(err, ShouldBeNil)
+			restore.idRanges = map[string]*idRange{"db1.c1": r}
+			count, ids := restoreRange(docs)
+			So(count, ShouldEqual, 1)
+			So(ids, ShouldResemble, []interface{}{bucketIds[1]})
+		})
+
+		Convey("other collections should be restored in full", func() {
+			restore.idRanges = map[string]*idRange{"db1.other": {Min: 3.0, Max: 6.0}}
+			count, _ := restoreRange([]bson.D{{{"_id", 1}}, {{"_id", 7}}})
+			So(count, ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,58 @@
+package mongorestore
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// newObjectIds returns the function that generates the new ObjectIds given to
+// the documents of the namespace ns. With --deterministicIds these depend only
+// on the seed, the namespace and how many ids have been generated before, so
+// restoring the same dump twice produces the same ids.
+func (restore *MongoRestore) newObjectIds(ns string) func() bson.ObjectId {
+	if restore.OutputOptions.DeterministicIds == "" {
+		return bson.NewObjectId
+	}
+	return deterministicObjectIds(restore.OutputOptions.DeterministicIds, ns)
+}
+
+// deterministicObjectIds returns a function generating a sequence of ObjectIds
+// derived from seed and ns. The first 4 bytes of each id, where an ObjectId
+// normally has its timestamp, are taken from a hash of the seed and namespace,
+// and the other 8 are a counter, so the ids never repeat within a namespace.
+// It is not safe to call the function from more than one goroutine.
+func deterministicObjectIds(seed, ns string) func() bson.ObjectId {
+	hash := sha1.Sum([]byte(seed + "\x00" + ns))
+	var counter uint64
+	return func() bson.ObjectId {
+		id := make([]byte, 12)
+		copy(id, hash[:4])
+		binary.BigEndian.PutUint64(id[4:], counter)
+		counter++
+		return bson.ObjectId(id)
+	}
+}
+
+// replaceObjectIds creates a documentTransform that gives each document with an
+// ObjectId _id a new one from next. Documents with other kinds of _id are left as is.
+func replaceObjectIds(next func() bson.ObjectId) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		for i, elem := range doc {
+			if elem.Name != "_id" {
+				continue
+			}
+			if _, ok := elem.Value.(bson.ObjectId); !ok {
+				return raw, nil
+			}
+			doc[i].Value = next()
+			return bson.Marshal(doc)
+		}
+		return raw, nil
+	}
+}
@@ -0,0 +1,69 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestDeterministicIds(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a collection of documents with ObjectId and other _ids", t, func() {
+		docs := []bson.D{
+			{{"_id", bson.NewObjectId()}, {"x", 1}},
+			{{"_id", bson.NewObjectId()}, {"x", 2}},
+			{{"_id", "custom"}, {"x", 3}},
+			{{"_id", bson.NewObjectId()}, {"x", 4}},
+		}
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+
+		// restoreIds restores the documents with the given seed and returns their _ids
+		restoreIds := func(seed string) []interface{} {
+			sink := &bytes.Buffer{}
+			restore := &MongoRestore{
+				DocumentSink:  sink,
+				OutputOptions: &OutputOptions{DeterministicIds: seed},
+			}
+			transform, err := restore.getDocumentTransform(intent)
+			So(err, ShouldBeNil)
+			_, err = restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSourceOf(docs...), 0, transform)
+			So(err, ShouldBeNil)
+
+			return sinkIds(sink)
+		}
+
+		Convey("two runs with the same seed should produce identical ids", func() {
+			first := restoreIds("fixtures")
+			second := restoreIds("fixtures")
+			So(len(first), ShouldEqual, 4)
+			So(second, ShouldResemble, first)
+
+			Convey("which are new and unique ObjectIds", func() {
+				seen := map[interface{}]bool{}
+				for i, id := range first {
+					if i == 2 {
+						So(id, ShouldEqual, "custom")
+						continue
+					}
+					So(id, ShouldNotEqual, docs[i][0].Value)
+					So(seen[id], ShouldBeFalse)
+					seen[id] = true
+				}
+			})
+		})
+
+		Convey("a different seed should produce different ids", func() {
+			So(restoreIds("other"), ShouldNotResemble, restoreIds("fixtures"))
+		})
+
+		Convey("without a seed the original ids should be kept", func() {
+			So(restoreIds(""), ShouldResemble,
+				[]interface{}{docs[0][0].Value, docs[1][0].Value, "custom", docs[3][0].Value})
+		})
+	})
+}
@@ -0,0 +1,37 @@
+package mongorestore
+
+import (
+	"sync"
+	"time"
+)
+
+// indexBuildPacer runs index builds one at a time for --indexBuildRateLimit,
+// waiting its delay between the end of each build and the start of the next,
+// so that the IO of the builds is spread out. Its methods run builds straight
+// away on a nil *indexBuildPacer.
+type indexBuildPacer struct {
+	delay time.Duration
+	mutex sync.Mutex
+	last  time.Time
+}
+
+func newIndexBuildPacer(delay time.Duration) *indexBuildPacer {
+	return &indexBuildPacer{delay: delay}
+}
+
+// run runs build once no other build is running and the delay has passed since
+// the last one ended.
+func (pacer *indexBuildPacer) run(build func() error) error {
+	if pacer == nil {
+		return build()
+	}
+	pacer.mutex.Lock()
+	defer pacer.mutex.Unlock()
+	if !pacer.last.IsZero() {
+		if wait := pacer.delay - time.Since(pacer.last); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	defer func() { pacer.last = time.Now() }()
+	return build()
+}
@@ -0,0 +1,57 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIndexBuildRateLimit(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With index builds for four collections restored in parallel", t, func() {
+		var mutex sync.Mutex
+		starts, ends := []time.Time{}, []time.Time{}
+		build := func() error {
+			mutex.Lock()
+			starts = append(starts, time.Now())
+			mutex.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mutex.Lock()
+			ends = append(ends, time.Now())
+			mutex.Unlock()
+			return nil
+		}
+		buildAll := func(restore *MongoRestore) {
+			errs := make(chan error, 4)
+			for i := 0; i < 4; i++ {
+				go func() {
+					errs <- restore.withIndexBuildSlot(func() error {
+						return restore.indexBuildPacer.run(build)
+					})
+				}()
+			}
+			for i := 0; i < 4; i++ {
+				So(<-errs, ShouldBeNil)
+			}
+		}
+
+		Convey("each build should start the delay after the one before it ended", func() {
+			delay := 30 * time.Millisecond
+			buildAll(&MongoRestore{indexBuildPacer: newIndexBuildPacer(delay)})
+			So(len(starts), ShouldEqual, 4)
+			for i := 1; i < 4; i++ {
+				So(starts[i].Sub(ends[i-1]), ShouldBeGreaterThanOrEqualTo, delay)
+			}
+		})
+
+		Convey("without a limit, the builds should overlap", func() {
+			buildAll(&MongoRestore{})
+			So(len(starts), ShouldEqual, 4)
+			So(starts[3].Before(ends[0]), ShouldBeTrue)
+		})
+	})
+}
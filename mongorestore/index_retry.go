@@ -0,0 +1,59 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"time"
+)
+
+// defaultIndexRetryBackoff is how long --retryIndexBuilds waits before the first
+// retry. The wait doubles with each retry after that.
+const defaultIndexRetryBackoff = time.Second
+
+// isTransientIndexBuildError returns true for the errors after which an index build
+// may succeed if it is run again, such as lost connections, interruptions and
+// resource pressure. Errors in the definition of the indexes, such as invalid keys
+// or conflicting options, and any unknown errors are not transient.
+func isTransientIndexBuildError(err error) bool {
+	if db.IsConnectionError(err) || err == db.ErrLostConnection {
+		return true
+	}
+	if queryErr, ok := err.(*mgo.QueryError); ok {
+		switch queryErr.Code {
+		// HostUnreachable, HostNotFound, ExceededTimeLimit, NetworkTimeout,
+		// ShutdownInProgress, WriteConflict, ConflictingOperationInProgress,
+		// ExceededMemoryLimit, PrimarySteppedDown, IndexBuildAborted, NotMaster,
+		// InterruptedAtShutdown, Interrupted, InterruptedDueToReplStateChange,
+		// BackgroundOperationInProgressForDatabase, BackgroundOperationInProgressForNamespace
+		case 6, 7, 50, 89, 91, 112, 117, 146, 189, 276, 10107, 11600, 11601, 11602, 12586, 12587:
+			return true
+		}
+	}
+	return false
+}
+
+// retryIndexBuild runs build, running it again up to --retryIndexBuilds times,
+// with a growing wait in between, for as long as it fails with a transient error.
+// refresh is called before each retry so that the build doesn't run again on the
+// socket that failed it.
+func (restore *MongoRestore) retryIndexBuild(intent *intents.Intent, refresh func(), build func() error) error {
+	backoff := restore.indexRetryBackoff
+	if backoff <= 0 {
+		backoff = defaultIndexRetryBackoff
+	}
+	err := build()
+	for retry := 1; err != nil && retry <= restore.OutputOptions.RetryIndexBuilds; retry++ {
+		if !isTransientIndexBuildError(err) {
+			return err
+		}
+		log.Logf(log.Always, "building indexes for %v failed: %v; retrying in %v (%v of %v)",
+			intent.Namespace(), err, backoff, retry, restore.OutputOptions.RetryIndexBuilds)
+		time.Sleep(backoff)
+		backoff *= 2
+		refresh()
+		err = build()
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"testing"
+	"time"
+)
+
+func TestRetryIndexBuild(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an index builder that fails transiently twice before succeeding", t, func() {
+		restore := &MongoRestore{
+			OutputOptions:     &OutputOptions{},
+			indexRetryBackoff: time.Millisecond,
+		}
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+		builds, refreshes := 0, 0
+		refresh := func() { refreshes++ }
+		build := func() error {
+			So(refreshes, ShouldEqual, builds)
+			builds++
+			if builds <= 2 {
+				return &mgo.QueryError{Code: 12587, Message: "cannot perform operation: a background operation is currently running"}
+			}
+			return nil
+		}
+
+		Convey("it should succeed on the third attempt with two retries", func() {
+			restore.OutputOptions.RetryIndexBuilds = 2
+			So(restore.retryIndexBuild(intent, refresh, build), ShouldBeNil)
+			So(builds, ShouldEqual, 3)
+			So(refreshes, ShouldEqual, 2)
+		})
+
+		Convey("it should fail with fewer retries", func() {
+			restore.OutputOptions.RetryIndexBuilds = 1
+			So(restore.retryIndexBuild(intent, refresh, build), ShouldNotBeNil)
+			So(builds, ShouldEqual, 2)
+			So(refreshes, ShouldEqual, 1)
+		})
+
+		Convey("it should fail at once without --retryIndexBuilds", func() {
+			So(restore.retryIndexBuild(intent, refresh, build), ShouldNotBeNil)
+			So(builds, ShouldEqual, 1)
+			So(refreshes, ShouldEqual, 0)
+		})
+	})
+
+	Convey("Errors in the definition of indexes should not be retried", t, func() {
+		restore := &MongoRestore{
+			OutputOptions:     &OutputOptions{RetryIndexBuilds: 3},
+			indexRetryBackoff: time.Millisecond,
+		}
+		for _, err := range []error{
+			&mgo.QueryError{Code: 67, Message: "bad index key pattern"},
+			&mgo.QueryError{Code: 85, Message: "Index with name: a_1 already exists with different options"},
+			fmt.Errorf("no such cmd: createIndexes"),
+		} {
+			builds := 0
+			buildErr := restore.retryIndexBuild(&intents.Intent{DB: "db1", C: "c1"}, func() {}, func() error {
+				builds++
+				return err
+			})
+			So(buildErr, ShouldEqual, err)
+			So(builds, ShouldEqual, 1)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package mongorestore
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"sync"
+)
+
+// byteBudget bounds the total bytes of the documents read from the dump that
+// haven't yet been inserted, across all collections and insertion workers, for
+// --maxInFlightBytes. Its methods do nothing on a nil *byteBudget.
+type byteBudget struct {
+	max  int64
+	used int64
+	peak int64
+	cond *sync.Cond
+}
+
+func newByteBudget(max int64) *byteBudget {
+	return &byteBudget{max: max, cond: sync.NewCond(&sync.Mutex{})}
+}
+
+// acquire blocks until n more bytes fit in the budget. A document larger than
+// the whole budget is let through once nothing else is in flight.
+func (budget *byteBudget) acquire(n int64) {
+	if budget == nil {
+		return
+	}
+	budget.cond.L.Lock()
+	defer budget.cond.L.Unlock()
+	for budget.used > 0 && budget.used+n > budget.max {
+		budget.cond.Wait()
+	}
+	budget.used += n
+	if budget.used > budget.peak {
+		budget.peak = budget.used
+	}
+}
+
+// release returns n bytes to the budget.
+func (budget *byteBudget) release(n int64) {
+	if budget == nil || n == 0 {
+		return
+	}
+	budget.cond.L.Lock()
+	budget.used -= n
+	budget.cond.L.Unlock()
+	budget.cond.Broadcast()
+}
+
+// budgetedInserter releases the bytes of the documents it buffers back to the
+// budget once they are flushed. It flushes whenever a batch is full, as the
+// inserter it wraps would, whenever no more documents are waiting, since the
+// reader may be blocked on the bytes it holds, and whenever an insert fails, so
+// that the bytes of the failed documents aren't held in the meantime.
+type budgetedInserter struct {
+	documentInserter
+	budget    *byteBudget
+	waiting   chan bson.Raw
+	batchSize int
+	docs      int
+	held      int64
+}
+
+func (bulk *budgetedInserter) Insert(doc interface{}) error {
+	err := bulk.documentInserter.Insert(doc)
+	bulk.docs++
+	bulk.held += int64(len(doc.(bson.Raw).Data))
+	if err != nil || bulk.docs >= bulk.batchSize || len(bulk.waiting) == 0 {
+		if flushErr := bulk.Flush(); err == nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+func (bulk *budgetedInserter) Flush() error {
+	err := bulk.documentInserter.Flush()
+	bulk.releaseHeld()
+	return err
+}
+
+// releaseHeld returns the bytes of the buffered documents to the budget, whether
+// or not they were inserted.
+func (bulk *budgetedInserter) releaseHeld() {
+	bulk.budget.release(bulk.held)
+	bulk.docs = 0
+	bulk.held = 0
+}
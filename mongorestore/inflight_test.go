@@ -0,0 +1,123 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowInserter stands in for a bulk inserter writing to a slow server, counting
+// the documents it inserts.
+type slowInserter struct {
+	mutex    *sync.Mutex
+	inserted *int
+	buffered int
+}
+
+func (bulk *slowInserter) Insert(doc interface{}) error {
+	bulk.buffered++
+	return nil
+}
+
+func (bulk *slowInserter) Flush() error {
+	time.Sleep(time.Millisecond)
+	bulk.mutex.Lock()
+	*bulk.inserted += bulk.buffered
+	bulk.mutex.Unlock()
+	bulk.buffered = 0
+	return nil
+}
+
+// failingInserter stands in for a bulk inserter whose batches all fail.
+type failingInserter struct{}
+
+func (*failingInserter) Insert(doc interface{}) error {
+	return fmt.Errorf("E11000 duplicate key error")
+}
+
+func (*failingInserter) Flush() error {
+	return nil
+}
+
+func TestMaxInFlightBytes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a budget of 1000 bytes and documents of about 100 bytes", t, func() {
+		budget := newByteBudget(1000)
+		raw, err := bson.Marshal(bson.M{"data": strings.Repeat("x", 80)})
+		So(err, ShouldBeNil)
+
+		Convey("documents inserted through slow workers should never exceed the budget", func() {
+			const documents, workers = 300, 3
+			docChan := make(chan bson.Raw, insertBufferFactor)
+			go func() {
+				for i := 0; i < documents; i++ {
+					budget.acquire(int64(len(raw)))
+					docChan <- bson.Raw{Data: raw}
+				}
+				close(docChan)
+			}()
+
+			mutex := &sync.Mutex{}
+			inserted := 0
+			wg := sync.WaitGroup{}
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					bulk := &budgetedInserter{
+						documentInserter: &slowInserter{mutex: mutex, inserted: &inserted},
+						budget:           budget,
+						waiting:          docChan,
+						batchSize:        50,
+					}
+					defer bulk.releaseHeld()
+					for rawDoc := range docChan {
+						bulk.Insert(rawDoc)
+					}
+					bulk.Flush()
+				}()
+			}
+			wg.Wait()
+
+			So(inserted, ShouldEqual, documents)
+			So(budget.peak, ShouldBeLessThanOrEqualTo, 1000)
+			So(budget.peak, ShouldBeGreaterThan, 0)
+			So(budget.used, ShouldEqual, 0)
+		})
+
+		Convey("the bytes of a document that fails to insert should be released", func() {
+			docChan := make(chan bson.Raw, insertBufferFactor)
+			// another document is waiting, so the failed one isn't flushed for that
+			docChan <- bson.Raw{Data: raw}
+			bulk := &budgetedInserter{
+				documentInserter: &failingInserter{},
+				budget:           budget,
+				waiting:          docChan,
+				batchSize:        50,
+			}
+			budget.acquire(int64(len(raw)))
+			So(bulk.Insert(bson.Raw{Data: raw}), ShouldNotBeNil)
+			So(budget.used, ShouldEqual, 0)
+		})
+
+		Convey("a document larger than the budget should still be let through alone", func() {
+			budget.acquire(1500)
+			So(budget.used, ShouldEqual, 1500)
+			budget.release(1500)
+			So(budget.used, ShouldEqual, 0)
+		})
+	})
+
+	Convey("A nil budget should not bound anything", t, func() {
+		var budget *byteBudget
+		budget.acquire(1 << 40)
+		budget.release(1 << 40)
+	})
+}
@@ -0,0 +1,93 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"time"
+)
+
+// commandRunner is the part of the SessionProvider used to send keepalive pings
+// and other commands, so that tests can stub it out.
+type commandRunner interface {
+	Run(command interface{}, out interface{}, database string) error
+}
+
+// getRunner returns what to run commands through: the SessionProvider,
+// unless the restore's runner was set, attaching any --comment to them and
+// running them in the --causalConsistency session.
+func (restore *MongoRestore) getRunner() commandRunner {
+	var runner commandRunner = restore.SessionProvider
+	if restore.runner != nil {
+		runner = restore.runner
+	}
+	return restore.wrapRunner(runner)
+}
+
+// sessionRunner returns a runner of commands on session, for operations that
+// need to keep to one connection, attaching any --comment to them and running
+// them in the --causalConsistency session.
+func (restore *MongoRestore) sessionRunner(session *mgo.Session) commandRunner {
+	return restore.wrapRunner(mgoSessionRunner{session})
+}
+
+func (restore *MongoRestore) wrapRunner(runner commandRunner) commandRunner {
+	if restore.comment != "" {
+		runner = &commentingRunner{commandRunner: runner, comment: restore.comment}
+	}
+	if restore.causalSession != nil {
+		runner = &causalRunner{commandRunner: runner, session: restore.causalSession}
+	}
+	return runner
+}
+
+// mgoSessionRunner is a commandRunner that runs commands on an mgo session.
+type mgoSessionRunner struct {
+	session *mgo.Session
+}
+
+func (runner mgoSessionRunner) Run(command interface{}, out interface{}, database string) error {
+	return runner.session.DB(database).Run(command, out)
+}
+
+// withKeepAlive runs build while pinging the server every --keepAliveInterval,
+// so that connections left idle during long index builds aren't dropped by
+// load balancers between the tool and the server.
+func (restore *MongoRestore) withKeepAlive(build func() error) error {
+	if restore.keepAliveInterval <= 0 {
+		return build()
+	}
+	runner := restore.keepAliveRunner
+	if runner == nil {
+		runner = restore.SessionProvider
+	}
+	stop := startKeepAlive(runner, restore.keepAliveInterval)
+	defer stop()
+	return build()
+}
+
+// startKeepAlive pings the server through runner every interval until
+// the returned function is called. Failed pings are logged and otherwise
+// ignored, since any real connection problem will surface in the build.
+func startKeepAlive(runner commandRunner, interval time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := runner.Run("ping", &struct{}{}, "admin"); err != nil {
+					log.Logf(log.DebugLow, "keepalive ping failed: %v", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,89 @@
+package mongorestore
+
+import (
+	"errors"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubRunner records the commands run through it.
+type stubRunner struct {
+	mutex     sync.Mutex
+	commands  []interface{}
+	databases []string
+	err       error
+}
+
+func (runner *stubRunner) Run(command interface{}, out interface{}, database string) error {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	runner.commands = append(runner.commands, command)
+	runner.databases = append(runner.databases, database)
+	// reply as the server would to a command that succeeded
+	if reply, ok := out.(*bson.M); ok && runner.err == nil {
+		if *reply == nil {
+			*reply = bson.M{}
+		}
+		(*reply)["ok"] = 1
+	}
+	return runner.err
+}
+
+func (runner *stubRunner) count() int {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	return len(runner.commands)
+}
+
+func TestKeepAlive(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a stubbed session to ping through", t, func() {
+		runner := &stubRunner{}
+		restore := &MongoRestore{
+			keepAliveInterval: 10 * time.Millisecond,
+			keepAliveRunner:   runner,
+		}
+
+		Convey("pings should be issued during a long index build", func() {
+			err := restore.withKeepAlive(func() error {
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(runner.count(), ShouldBeGreaterThanOrEqualTo, 3)
+			So(runner.commands[0], ShouldEqual, "ping")
+
+			Convey("and stop once the build is done", func() {
+				pings := runner.count()
+				time.Sleep(50 * time.Millisecond)
+				So(runner.count(), ShouldEqual, pings)
+			})
+		})
+
+		Convey("failed pings should not fail the build", func() {
+			runner.err = errors.New("connection reset")
+			buildErr := errors.New("build failed")
+			err := restore.withKeepAlive(func() error {
+				time.Sleep(50 * time.Millisecond)
+				return buildErr
+			})
+			So(err, ShouldEqual, buildErr)
+			So(runner.count(), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("no pings should be issued without an interval", func() {
+			restore.keepAliveInterval = 0
+			So(restore.withKeepAlive(func() error {
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			}), ShouldBeNil)
+			So(runner.count(), ShouldEqual, 0)
+		})
+	})
+}
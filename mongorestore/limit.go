@@ -0,0 +1,60 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"strconv"
+	"strings"
+)
+
+// parseDocumentLimit parses an argument to --limit of the form "db.coll=N",
+// returning the namespace and the number of documents to restore.
+func parseDocumentLimit(arg string) (string, int64, error) {
+	equals := strings.LastIndex(arg, "=")
+	if equals < 0 {
+		return "", 0, fmt.Errorf("expected the form db.coll=N")
+	}
+	ns, count := arg[:equals], arg[equals+1:]
+	dot := strings.Index(ns, ".")
+	if dot <= 0 || dot == len(ns)-1 {
+		return "", 0, fmt.Errorf("'%v' is not a namespace of the form db.coll", ns)
+	}
+	limit, err := strconv.ParseInt(count, 10, 64)
+	if err != nil || limit < 0 {
+		return "", 0, fmt.Errorf("'%v' is not a number of documents", count)
+	}
+	return ns, limit, nil
+}
+
+// getDocumentLimit returns the number of documents to restore into the intent's
+// collection: its --limit if it has one, or else --maxDocsPerCollection. The
+// second return value is false if the collection isn't limited.
+func (restore *MongoRestore) getDocumentLimit(intent *intents.Intent) (int64, bool) {
+	if limit, ok := restore.documentLimits[intent.Namespace()]; ok {
+		return limit, true
+	}
+	if restore.OutputOptions.MaxDocsPerCollection > 0 {
+		return restore.OutputOptions.MaxDocsPerCollection, true
+	}
+	return 0, false
+}
+
+// limitDocuments creates a documentTransform that passes on the first limit
+// documents and skips the rest, without decoding them. It is not safe to call
+// from more than one goroutine.
+func limitDocuments(limit int64, ns string) documentTransform {
+	var seen int64
+	return func(raw []byte) ([]byte, error) {
+		seen++
+		if seen <= limit {
+			return raw, nil
+		}
+		if seen == limit+1 {
+			log.Logf(log.Always, "reached the limit of %v %v for %v, skipping the rest",
+				limit, util.Pluralize(int(limit), "document", "documents"), ns)
+		}
+		return nil, nil
+	}
+}
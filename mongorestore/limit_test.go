@@ -0,0 +1,86 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestParseDocumentLimit(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --limit arguments", t, func() {
+
+		Convey("a namespace and count should be parsed", func() {
+			ns, limit, err := parseDocumentLimit("db1.c.sub=25")
+			So(err, ShouldBeNil)
+			So(ns, ShouldEqual, "db1.c.sub")
+			So(limit, ShouldEqual, 25)
+		})
+
+		Convey("malformed arguments should be rejected", func() {
+			for _, arg := range []string{"db1.c1", "c1=5", "db1.c1=", "db1.c1=-1", "db1.c1=many"} {
+				_, _, err := parseDocumentLimit(arg)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestDocumentLimits(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a restore of five documents into a DocumentSink", t, func() {
+		sink := &bytes.Buffer{}
+		restore := &MongoRestore{
+			DocumentSink:  sink,
+			OutputOptions: &OutputOptions{},
+		}
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+		docs := []bson.D{}
+		for i := 0; i < 5; i++ {
+			docs = append(docs, bson.D{{"_id", i}})
+		}
+		restoreLimited := func() (int64, []interface{}) {
+			transform, err := restore.getDocumentTransform(intent)
+			So(err, ShouldBeNil)
+			count, err := restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSourceOf(docs...), 0, transform)
+			So(err, ShouldBeNil)
+
+			return count, sinkIds(sink)
+		}
+
+		Convey("a --limit of 3 should restore exactly the first 3 documents", func() {
+			restore.documentLimits = map[string]int64{"db1.c1": 3}
+			count, ids := restoreLimited()
+			So(count, ShouldEqual, 3)
+			So(ids, ShouldResemble, []interface{}{0, 1, 2})
+		})
+
+		Convey("--maxDocsPerCollection should apply to collections without a --limit", func() {
+			restore.OutputOptions.MaxDocsPerCollection = 2
+			count, ids := restoreLimited()
+			So(count, ShouldEqual, 2)
+			So(ids, ShouldResemble, []interface{}{0, 1})
+
+			Convey("but a --limit should take precedence", func() {
+				restore.documentLimits = map[string]int64{"db1.c1": 4}
+				sink.Reset()
+				count, ids := restoreLimited()
+				So(count, ShouldEqual, 4)
+				So(ids, ShouldResemble, []interface{}{0, 1, 2, 3})
+			})
+		})
+
+		Convey("a limit larger than the collection should restore every document", func() {
+			restore.documentLimits = map[string]int64{"db1.c1": 10}
+			count, _ := restoreLimited()
+			So(count, ShouldEqual, 5)
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package mongorestore
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// Modes of --lowercaseKeysMode.
+const (
+	lowercaseKeysError    = "error"
+	lowercaseKeysLastWins = "lastWins"
+)
+
+// lowercaseKeys creates a documentTransform that lowercases the field names of
+// each document, at any depth, including in the documents of arrays. When two
+// fields of a document collapse to the same name, such as userName and username,
+// the document is an error, or, if lastWins is set, the value of the last of the
+// fields is kept, at the position of the first.
+func lowercaseKeys(ns string, lastWins bool) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		lowered, changed, err := lowercaseDocument(doc, lastWins, "")
+		if err != nil {
+			return nil, fmt.Errorf("can't lowercase the field names of a document of %v: %v", ns, err)
+		}
+		if !changed {
+			return raw, nil
+		}
+		return bson.Marshal(lowered)
+	}
+}
+
+// lowercaseDocument returns the document with its field names lowercased, and
+// whether any were changed. The prefix is the path of the document, for errors.
+func lowercaseDocument(doc bson.D, lastWins bool, prefix string) (bson.D, bool, error) {
+	lowered := make(bson.D, 0, len(doc))
+	positions := map[string]int{}
+	originals := map[string]string{}
+	changed := false
+	for _, elem := range doc {
+		name := strings.ToLower(elem.Name)
+		value, valueChanged, err := lowercaseValue(elem.Value, lastWins, prefix+name+".")
+		if err != nil {
+			return nil, false, err
+		}
+		changed = changed || valueChanged || name != elem.Name
+		if i, ok := positions[name]; ok {
+			if !lastWins {
+				return nil, false, fmt.Errorf("fields '%v%v' and '%v%v' both lowercase to '%v%v'",
+					prefix, originals[name], prefix, elem.Name, prefix, name)
+			}
+			lowered[i].Value = value
+			continue
+		}
+		positions[name] = len(lowered)
+		originals[name] = elem.Name
+		lowered = append(lowered, bson.DocElem{Name: name, Value: value})
+	}
+	return lowered, changed, nil
+}
+
+func lowercaseValue(value interface{}, lastWins bool, prefix string) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case bson.D:
+		return lowercaseDocument(v, lastWins, prefix)
+	case []interface{}:
+		lowered := make([]interface{}, len(v))
+		changed := false
+		for i, elem := range v {
+			loweredElem, elemChanged, err := lowercaseValue(elem, lastWins, fmt.Sprintf("%v%v.", prefix, i))
+			if err != nil {
+				return nil, false, err
+			}
+			lowered[i] = loweredElem
+			changed = changed || elemChanged
+		}
+		return lowered, changed, nil
+	}
+	return value, false, nil
+}
@@ -0,0 +1,63 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestLowercaseKeys(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --lowercaseKeys", t, func() {
+		lowercase := func(doc bson.D, lastWins bool) (bson.D, error) {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			out, err := lowercaseKeys("db1.users", lastWins)(raw)
+			if err != nil {
+				return nil, err
+			}
+			lowered := bson.D{}
+			So(bson.Unmarshal(out, &lowered), ShouldBeNil)
+			return lowered, nil
+		}
+
+		Convey("the field names should be lowercased at every depth", func() {
+			doc, err := lowercase(bson.D{
+				{"_id", 1},
+				{"FirstName", "Ann"},
+				{"Address", bson.D{{"ZipCode", "10001"}}},
+				{"Tags", []interface{}{bson.D{{"Name", "x"}}, "KeepValues"}},
+			}, false)
+			So(err, ShouldBeNil)
+			So(doc, ShouldResemble, bson.D{
+				{"_id", 1},
+				{"firstname", "Ann"},
+				{"address", bson.D{{"zipcode", "10001"}}},
+				{"tags", []interface{}{bson.D{{"name", "x"}}, "KeepValues"}},
+			})
+		})
+
+		collapsing := bson.D{{"_id", 1}, {"userName", "first"}, {"age", 3}, {"sub", bson.D{{"A", 1}}}, {"username", "last"}}
+
+		Convey("fields that collapse to the same name should be an error by default", func() {
+			_, err := lowercase(collapsing, false)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "fields 'userName' and 'username' both lowercase to 'username'")
+		})
+
+		Convey("with lastWins, the last value should be kept at the first position", func() {
+			doc, err := lowercase(collapsing, true)
+			So(err, ShouldBeNil)
+			So(doc, ShouldResemble, bson.D{{"_id", 1}, {"username", "last"}, {"age", 3}, {"sub", bson.D{{"a", 1}}}})
+		})
+
+		Convey("collisions in subdocuments should name their path", func() {
+			_, err := lowercase(bson.D{{"Sub", bson.D{{"A", 1}, {"a", 2}}}}, false)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "'sub.A' and 'sub.a'")
+		})
+	})
+}
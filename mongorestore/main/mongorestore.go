@@ -19,6 +19,8 @@ func main() {
 	opts.AddOptions(inputOpts)
 	outputOpts := &mongorestore.OutputOptions{}
 	opts.AddOptions(outputOpts)
+	opts.AddOptions(opts.TLS)
+	opts.AddOptions(opts.Compression)
 
 	extraArgs, err := opts.Parse()
 	if err != nil {
@@ -38,6 +40,12 @@ func main() {
 
 	log.SetVerbosity(opts.Verbosity)
 
+	if err = opts.TLS.Validate(); err != nil {
+		log.Logf(log.Always, "%v", err)
+		log.Logf(log.Always, "try 'mongorestore --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+
 	targetDir, err := getTargetDirFromArgs(extraArgs, inputOpts.Directory)
 	if err != nil {
 		log.Logf(log.Always, "%v", err)
@@ -50,6 +58,7 @@ func main() {
 	_, setName := util.ParseConnectionString(opts.Host)
 	opts.Direct = (setName == "")
 	opts.ReplicaSetName = setName
+	opts.ConnectionAppName = outputOpts.AppName
 
 	provider, err := db.NewSessionProvider(*opts)
 	if err != nil {
@@ -0,0 +1,131 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// restoreManifest is the document read from --manifest. It lists archives to
+// restore one after the other, such as a base archive followed by incrementals.
+type restoreManifest struct {
+	Archives []*manifestArchive `json:"archives"`
+}
+
+// manifestArchive is one of the archives of a restoreManifest, with the options
+// to restore it with. Archives are restored in ascending order.
+type manifestArchive struct {
+	Archive string `json:"archive"`
+	Order   int    `json:"order"`
+	Drop    bool   `json:"drop"`
+	Gzip    bool   `json:"gzip"`
+}
+
+// byManifestOrder sorts the archives of a manifest in the order they are restored.
+type byManifestOrder []*manifestArchive
+
+func (archives byManifestOrder) Len() int           { return len(archives) }
+func (archives byManifestOrder) Swap(i, j int)      { archives[i], archives[j] = archives[j], archives[i] }
+func (archives byManifestOrder) Less(i, j int) bool { return archives[i].Order < archives[j].Order }
+
+// loadManifest reads and validates the manifest at path, returning its archives
+// sorted in the order they are restored. Relative archive paths are resolved
+// against the directory holding the manifest.
+func loadManifest(path string) (*restoreManifest, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %v", err)
+	}
+	manifest := &restoreManifest{}
+	err = json.Unmarshal(contents, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest %v: %v", path, err)
+	}
+	if len(manifest.Archives) == 0 {
+		return nil, fmt.Errorf("manifest %v lists no archives", path)
+	}
+
+	orders := map[int]bool{}
+	for i, archive := range manifest.Archives {
+		if archive.Archive == "" || archive.Archive == "-" {
+			return nil, fmt.Errorf("archive %v of manifest %v has no file name", i, path)
+		}
+		if orders[archive.Order] {
+			return nil, fmt.Errorf("more than one archive of manifest %v has order %v", path, archive.Order)
+		}
+		orders[archive.Order] = true
+		if !filepath.IsAbs(archive.Archive) {
+			archive.Archive = filepath.Join(filepath.Dir(path), archive.Archive)
+		}
+		if _, err = os.Stat(archive.Archive); err != nil {
+			return nil, fmt.Errorf("archive %v of manifest %v: %v", i, path, err)
+		}
+	}
+	sort.Sort(byManifestOrder(manifest.Archives))
+	return manifest, nil
+}
+
+// manifestPass returns the MongoRestore that restores one archive of a manifest.
+// It shares the options and connection of the restore, other than the input and
+// the options set by the manifest.
+func (restore *MongoRestore) manifestPass(archive *manifestArchive) *MongoRestore {
+	inputOptions := *restore.InputOptions
+	inputOptions.Manifest = ""
+	inputOptions.Archive = archive.Archive
+	inputOptions.Gzip = archive.Gzip
+	outputOptions := *restore.OutputOptions
+	outputOptions.Drop = archive.Drop
+	return &MongoRestore{
+		ToolOptions:     restore.ToolOptions,
+		InputOptions:    &inputOptions,
+		OutputOptions:   &outputOptions,
+		SessionProvider: restore.SessionProvider,
+		DocumentSink:    restore.DocumentSink,
+		runner:          restore.runner,
+	}
+}
+
+// RestoreManifest restores each of the archives listed in the --manifest in turn,
+// stopping at the first that fails, and logs the documents restored from all of them.
+func (restore *MongoRestore) RestoreManifest() error {
+	if restore.InputOptions.Archive != "" || restore.TargetDirectory != "" {
+		return fmt.Errorf("cannot use --manifest with --archive or a directory to restore")
+	}
+	if restore.OutputOptions.VerifyReport != "" {
+		return fmt.Errorf("cannot use --verifyReport with --manifest")
+	}
+	if restore.InputOptions.TeeArchive != "" {
+		return fmt.Errorf("cannot use --teeArchive with --manifest")
+	}
+	manifest, err := loadManifest(restore.InputOptions.Manifest)
+	if err != nil {
+		return err
+	}
+
+	for i, archive := range manifest.Archives {
+		log.Logf(log.Always, "restoring archive %v of %v from manifest: %v",
+			i+1, len(manifest.Archives), archive.Archive)
+		pass := restore.manifestPass(archive)
+		err = pass.Restore()
+		for _, result := range pass.results {
+			restore.recordResult(result)
+		}
+		if err != nil {
+			return fmt.Errorf("error restoring archive %v: %v", archive.Archive, err)
+		}
+	}
+
+	documents := int64(0)
+	for _, result := range restore.results {
+		documents += result.Documents
+	}
+	log.Logf(log.Always, "restored %v %v from %v %v", documents,
+		util.Pluralize(int(documents), "document", "documents"),
+		len(manifest.Archives), util.Pluralize(len(manifest.Archives), "archive", "archives"))
+	return nil
+}
@@ -0,0 +1,74 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a directory holding a base archive and an incremental one", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_manifest")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		for _, name := range []string{"base.archive", "incr.archive"} {
+			So(ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0644), ShouldBeNil)
+		}
+		path := filepath.Join(dir, "restore.json")
+		writeManifest := func(manifest string) {
+			So(ioutil.WriteFile(path, []byte(manifest), 0644), ShouldBeNil)
+		}
+
+		Convey("the archives should be listed in their order, relative to the manifest", func() {
+			writeManifest(`{"archives": [
+				{"archive": "incr.archive", "order": 2, "gzip": true},
+				{"archive": "base.archive", "order": 1, "drop": true}
+			]}`)
+			manifest, err := loadManifest(path)
+			So(err, ShouldBeNil)
+			So(len(manifest.Archives), ShouldEqual, 2)
+			So(*manifest.Archives[0], ShouldResemble, manifestArchive{
+				Archive: filepath.Join(dir, "base.archive"), Order: 1, Drop: true,
+			})
+			So(*manifest.Archives[1], ShouldResemble, manifestArchive{
+				Archive: filepath.Join(dir, "incr.archive"), Order: 2, Gzip: true,
+			})
+
+			Convey("and each should be restored with its own options", func() {
+				restore := &MongoRestore{
+					InputOptions:  &InputOptions{Manifest: path},
+					OutputOptions: &OutputOptions{Drop: true, NumInsertionWorkers: 4},
+				}
+				pass := restore.manifestPass(manifest.Archives[1])
+				So(pass.InputOptions.Manifest, ShouldEqual, "")
+				So(pass.InputOptions.Archive, ShouldEqual, filepath.Join(dir, "incr.archive"))
+				So(pass.InputOptions.Gzip, ShouldBeTrue)
+				So(pass.OutputOptions.Drop, ShouldBeFalse)
+				So(pass.OutputOptions.NumInsertionWorkers, ShouldEqual, 4)
+				So(restore.OutputOptions.Drop, ShouldBeTrue)
+			})
+		})
+
+		Convey("invalid manifests should be rejected before restoring anything", func() {
+			for _, manifest := range []string{
+				`{"archives": []}`,
+				`{"archives": [{"order": 1}]}`,
+				`{"archives": [{"archive": "base.archive"}, {"archive": "incr.archive"}]}`,
+				`{"archives": [{"archive": "base.archive"}, {"archive": "missing.archive", "order": 1}]}`,
+				`{"archives": [`,
+			} {
+				writeManifest(manifest)
+				_, err := loadManifest(path)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
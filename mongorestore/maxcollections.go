@@ -0,0 +1,39 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/intents"
+)
+
+// checkMaxCollections returns an error if the archive holds more collections than
+// --maxCollections allows, so that a restore of the wrong archive stops before
+// anything is restored.
+func (restore *MongoRestore) checkMaxCollections(prelude *archive.Prelude) error {
+	return restore.checkCollectionCount(len(prelude.NamespaceMetadatas), "the archive")
+}
+
+// checkMaxIntents returns an error if the intents created from a dump directory
+// are for more collections than --maxCollections allows. The oplog and the
+// special collections of users, roles and indexes aren't counted.
+func (restore *MongoRestore) checkMaxIntents(manager *intents.Manager) error {
+	count := 0
+	for _, intent := range manager.Intents() {
+		if !intent.IsOplog() && !intent.IsSpecialCollection() {
+			count++
+		}
+	}
+	return restore.checkCollectionCount(count, "the dump directory")
+}
+
+func (restore *MongoRestore) checkCollectionCount(count int, source string) error {
+	max := restore.OutputOptions.MaxCollections
+	if max <= 0 {
+		return nil
+	}
+	if count > max {
+		return fmt.Errorf("%v holds %v collections, more than the %v allowed by --maxCollections; "+
+			"raise --maxCollections to restore it", source, count, max)
+	}
+	return nil
+}
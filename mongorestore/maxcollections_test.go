@@ -0,0 +1,53 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestMaxCollections(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive of three collections", t, func() {
+		prelude := &archive.Prelude{}
+		prelude.AddMetadata(&archive.CollectionMetadata{Database: "db1", Collection: "c1"})
+		prelude.AddMetadata(&archive.CollectionMetadata{Database: "db1", Collection: "c2"})
+		prelude.AddMetadata(&archive.CollectionMetadata{Database: "db2", Collection: "c1"})
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+
+		Convey("the restore should stop with a --maxCollections below that", func() {
+			restore.OutputOptions.MaxCollections = 2
+			So(restore.checkMaxCollections(prelude), ShouldNotBeNil)
+		})
+
+		Convey("the restore should go on with a --maxCollections of at least that, or none", func() {
+			restore.OutputOptions.MaxCollections = 3
+			So(restore.checkMaxCollections(prelude), ShouldBeNil)
+			restore.OutputOptions.MaxCollections = 0
+			So(restore.checkMaxCollections(prelude), ShouldBeNil)
+		})
+	})
+
+	Convey("With the intents of a dump directory of three collections and an oplog", t, func() {
+		manager := intents.NewIntentManager()
+		manager.Put(&intents.Intent{DB: "db1", C: "c1", BSONPath: "db1/c1.bson"})
+		manager.Put(&intents.Intent{DB: "db1", C: "c2", BSONPath: "db1/c2.bson"})
+		manager.Put(&intents.Intent{DB: "db2", C: "c1", BSONPath: "db2/c1.bson"})
+		manager.Put(&intents.Intent{C: "oplog", BSONPath: "oplog.bson"})
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+
+		Convey("the restore should stop with a --maxCollections below that", func() {
+			restore.OutputOptions.MaxCollections = 2
+			So(restore.checkMaxIntents(manager), ShouldNotBeNil)
+		})
+
+		Convey("the restore should go on with a --maxCollections of at least that", func() {
+			restore.OutputOptions.MaxCollections = 3
+			So(restore.checkMaxIntents(manager), ShouldBeNil)
+		})
+	})
+}
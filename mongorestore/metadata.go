@@ -10,6 +10,8 @@ import (
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"path"
+	"reflect"
 	"strings"
 )
 
@@ -27,10 +29,12 @@ type authVersionPair struct {
 	Server int
 }
 
-// Metadata holds information about a collection's options and indexes.
+// Metadata holds information about a collection's options and indexes, and its
+// shard key if it was dumped from a sharded cluster.
 type Metadata struct {
-	Options bson.D          `json:"options,omitempty"`
-	Indexes []IndexDocument `json:"indexes"`
+	Options  bson.D          `json:"options,omitempty"`
+	Indexes  []IndexDocument `json:"indexes"`
+	ShardKey bson.D          `json:"shardKey,omitempty"`
 }
 
 // this struct is used to read in the options of a set of indexes
@@ -38,7 +42,9 @@ type metaDataMapIndex struct {
 	Indexes []bson.M `json:"indexes"`
 }
 
-// IndexDocument holds information about a collection's index.
+// IndexDocument holds information about a collection's index. Options holds
+// every field of the index spec other than its key, including any this tool
+// doesn't know about, so they are passed on to createIndexes as they were dumped.
 type IndexDocument struct {
 	Options bson.M `bson:",inline"`
 	Key     bson.D `bson:"key"`
@@ -94,6 +100,55 @@ func (restore *MongoRestore) MetadataFromJSON(jsonBytes []byte) (bson.D, []Index
 	return meta.Options, meta.Indexes, nil
 }
 
+// dedupeIndexes returns the indexes of a collection's metadata without those
+// listed more than once, keeping the first of each, and the duplicates dropped.
+// Indexes are the same if they have the same name, or the same key and the same
+// options other than their names.
+func dedupeIndexes(indexes []IndexDocument) ([]IndexDocument, []IndexDocument) {
+	unique := []IndexDocument{}
+	duplicates := []IndexDocument{}
+	for _, index := range indexes {
+		duplicate := false
+		for _, kept := range unique {
+			if index.Options["name"] == kept.Options["name"] || sameIndex(index, kept) {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			duplicates = append(duplicates, index)
+		} else {
+			unique = append(unique, index)
+		}
+	}
+	return unique, duplicates
+}
+
+// sameIndex returns true if the indexes have the same key and the same options,
+// ignoring their names.
+func sameIndex(index1, index2 IndexDocument) bool {
+	if !reflect.DeepEqual(index1.Key, index2.Key) || len(index1.Options) != len(index2.Options) {
+		return false
+	}
+	for name, value := range index1.Options {
+		if name != "name" && !reflect.DeepEqual(value, index2.Options[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// dedupeIntentIndexes drops the indexes listed more than once in the intent's
+// metadata with a warning, so that only one of each is built.
+func dedupeIntentIndexes(intent *intents.Intent, indexes []IndexDocument) []IndexDocument {
+	unique, duplicates := dedupeIndexes(indexes)
+	for _, index := range duplicates {
+		log.Logf(log.Always, "warning: the metadata for %v lists index %v more than once; building only the first",
+			intent.Namespace(), index.Options["name"])
+	}
+	return unique
+}
+
 // LoadIndexesFromBSON reads indexes from the index BSON files and
 // caches them in the MongoRestore object.
 func (restore *MongoRestore) LoadIndexesFromBSON() error {
@@ -134,6 +189,17 @@ func stripDBFromNS(ns string) string {
 	return ns
 }
 
+// IgnoresMetadata returns true if the intent's namespace matches one of the
+// --ignoreMetadataFor patterns, in which case its options and indexes are not restored.
+func (restore *MongoRestore) IgnoresMetadata(intent *intents.Intent) bool {
+	for _, pattern := range restore.OutputOptions.IgnoreMetadataFor {
+		if matched, _ := path.Match(pattern, intent.Namespace()); matched {
+			return true
+		}
+	}
+	return false
+}
+
 // CollectionExists returns true if the given intent's collection exists.
 func (restore *MongoRestore) CollectionExists(intent *intents.Intent) (bool, error) {
 	restore.knownCollectionsMutex.Lock()
@@ -148,7 +214,7 @@ func (restore *MongoRestore) CollectionExists(intent *intents.Intent) (bool, err
 	if restore.knownCollections[intent.DB] == nil {
 		// if the database name isn't in the cache, grab collection
 		// names from the server
-		session, err := restore.SessionProvider.GetSession()
+		session, err := restore.metadataReadSession()
 		if err != nil {
 			return false, fmt.Errorf("error establishing connection: %v", err)
 		}
@@ -190,6 +256,13 @@ func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []Ind
 		}
 	}
 
+	if restore.OutputOptions.DeferUniqueIndexes != "" {
+		indexes = restore.deferUniqueIndexes(intent, indexes)
+		if len(indexes) == 0 {
+			return nil
+		}
+	}
+
 	session, err := restore.SessionProvider.GetSession()
 	if err != nil {
 		return fmt.Errorf("error establishing connection: %v", err)
@@ -197,30 +270,62 @@ func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []Ind
 	session.SetSafe(&mgo.Safe{})
 	defer session.Close()
 
-	// then attempt the createIndexes command
-	rawCommand := bson.D{
-		{"createIndexes", intent.C},
-		{"indexes", indexes},
-	}
-	results := bson.M{}
-	err = session.DB(intent.DB).Run(rawCommand, &results)
-	if err == nil {
+	build := func() error {
+		// then attempt the createIndexes command
+		err = restore.retryIndexBuild(intent, session.Refresh, func() error {
+			results := bson.M{}
+			return restore.sessionRunner(session).Run(restore.createIndexesCommand(intent, indexes), &results, intent.DB)
+		})
+		if err == nil {
+			return nil
+		}
+		if err.Error() != "no such cmd: createIndexes" {
+			return fmt.Errorf("createIndex error: %v", err)
+		}
+
+		// if we're here, the connected server does not support the command, so we fall back
+		log.Log(log.Info, "\tcreateIndexes command not supported, attemping legacy index insertion")
+		for _, idx := range indexes {
+			log.Logf(log.Info, "\tmanually creating index %v", idx.Options["name"])
+			err = restore.LegacyInsertIndex(intent, idx)
+			if err != nil {
+				return fmt.Errorf("error creating index %v: %v", idx.Options["name"], err)
+			}
+		}
 		return nil
 	}
-	if err.Error() != "no such cmd: createIndexes" {
-		return fmt.Errorf("createIndex error: %v", err)
+	return restore.withIndexBuildSlot(func() error {
+		return restore.indexBuildPacer.run(func() error {
+			return restore.withKeepAlive(build)
+		})
+	})
+}
+
+// withIndexBuildSlot runs build once fewer than --maxConcurrentIndexBuilds
+// index builds are running, across all of the collections being restored.
+func (restore *MongoRestore) withIndexBuildSlot(build func() error) error {
+	if restore.indexBuildSlots == nil {
+		return build()
 	}
+	restore.indexBuildSlots <- struct{}{}
+	defer func() { <-restore.indexBuildSlots }()
+	return build()
+}
 
-	// if we're here, the connected server does not support the command, so we fall back
-	log.Log(log.Info, "\tcreateIndexes command not supported, attemping legacy index insertion")
-	for _, idx := range indexes {
-		log.Logf(log.Info, "\tmanually creating index %v", idx.Options["name"])
-		err = restore.LegacyInsertIndex(intent, idx)
-		if err != nil {
-			return fmt.Errorf("error creating index %v: %v", idx.Options["name"], err)
-		}
+// createIndexesCommand builds the command that creates the indexes on the intent's
+// collection, with the --indexCommitQuorum and --metaWriteConcern if there are any.
+func (restore *MongoRestore) createIndexesCommand(intent *intents.Intent, indexes []IndexDocument) bson.D {
+	command := bson.D{
+		{"createIndexes", intent.C},
+		{"indexes", indexes},
 	}
-	return nil
+	if restore.indexCommitQuorum != nil {
+		command = append(command, bson.DocElem{"commitQuorum", restore.indexCommitQuorum})
+	}
+	if restore.metaWriteConcern != nil {
+		command = append(command, bson.DocElem{"writeConcern", restore.metaWriteConcern})
+	}
+	return command
 }
 
 // LegacyInsertIndex takes in an intent and an index document and attempts to
@@ -246,21 +351,13 @@ func (restore *MongoRestore) LegacyInsertIndex(intent *intents.Intent, index Ind
 // CreateCollection creates the collection specified in the intent with the
 // given options.
 func (restore *MongoRestore) CreateCollection(intent *intents.Intent, options bson.D) error {
-	jsonCommand, err := bsonutil.ConvertBSONValueToJSON(
-		append(bson.D{{"create", intent.C}}, options...),
-	)
+	jsonCommand, err := bsonutil.ConvertBSONValueToJSON(restore.createCommand(intent, options))
 	if err != nil {
 		return err
 	}
 
-	session, err := restore.SessionProvider.GetSession()
-	if err != nil {
-		return fmt.Errorf("error establishing connection: %v", err)
-	}
-	defer session.Close()
-
 	res := bson.M{}
-	err = session.DB(intent.DB).Run(jsonCommand, &res)
+	err = restore.getRunner().Run(jsonCommand, &res, intent.DB)
 	if err != nil {
 		return fmt.Errorf("error running create command: %v", err)
 	}
@@ -270,6 +367,16 @@ func (restore *MongoRestore) CreateCollection(intent *intents.Intent, options bs
 	return nil
 }
 
+// createCommand builds the command that creates the intent's collection with
+// the given options, and with the --metaWriteConcern if there is one.
+func (restore *MongoRestore) createCommand(intent *intents.Intent, options bson.D) bson.D {
+	command := append(bson.D{{"create", intent.C}}, options...)
+	if restore.metaWriteConcern != nil {
+		command = append(command, bson.DocElem{"writeConcern", restore.metaWriteConcern})
+	}
+	return command
+}
+
 // RestoreUsersOrRoles accepts a collection type (Users or Roles) and restores the intent
 // in the appropriate collection.
 func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *intents.Intent) error {
@@ -314,7 +421,7 @@ func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *
 	}
 
 	log.Logf(log.DebugLow, "restoring %v to temporary collection", collectionType)
-	if _, err = restore.RestoreCollectionToDB("admin", tempCol, bsonSource, 0); err != nil {
+	if _, err = restore.RestoreCollectionToDB("admin", tempCol, bsonSource, 0, nil); err != nil {
 		return fmt.Errorf("error restoring %v: %v", collectionType, err)
 	}
 
@@ -364,15 +471,9 @@ func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *
 		{"db", userTargetDB},
 	}
 
-	session, err := restore.SessionProvider.GetSession()
-	if err != nil {
-		return fmt.Errorf("error establishing connection: %v", err)
-	}
-	defer session.Close()
-
 	log.Logf(log.DebugLow, "merging %v from temp collection '%v'", collectionType, tempCol)
 	res := bson.M{}
-	err = session.Run(command, &res)
+	err = restore.getRunner().Run(command, &res, "admin")
 	if err != nil {
 		return fmt.Errorf("error running merge command: %v", err)
 	}
@@ -495,12 +596,7 @@ func (restore *MongoRestore) ShouldRestoreUsersAndRoles() bool {
 
 // DropCollection drops the intent's collection.
 func (restore *MongoRestore) DropCollection(intent *intents.Intent) error {
-	session, err := restore.SessionProvider.GetSession()
-	if err != nil {
-		return fmt.Errorf("error establishing connection: %v", err)
-	}
-	defer session.Close()
-	err = session.DB(intent.DB).C(intent.C).DropCollection()
+	err := restore.getRunner().Run(bson.D{{"drop", intent.C}}, &bson.M{}, intent.DB)
 	if err != nil {
 		return fmt.Errorf("error dropping collection: %v", err)
 	}
@@ -1,13 +1,19 @@
 package mongorestore
 
 import (
+	"bytes"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
 	commonOpts "github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 const ExistsDB = "restore_collection_exists"
@@ -174,3 +180,136 @@ func TestGetDumpAuthVersion(t *testing.T) {
 	})
 
 }
+
+func TestIgnoresMetadata(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a test mongorestore ignoring metadata for some namespaces", t, func() {
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{
+				IgnoreMetadataFor: []string{"db1.*", "db2.stale"},
+			},
+		}
+		Convey("matching namespaces should be ignored", func() {
+			So(restore.IgnoresMetadata(&intents.Intent{DB: "db1", C: "c1"}), ShouldBeTrue)
+			So(restore.IgnoresMetadata(&intents.Intent{DB: "db1", C: "c.2"}), ShouldBeTrue)
+			So(restore.IgnoresMetadata(&intents.Intent{DB: "db2", C: "stale"}), ShouldBeTrue)
+		})
+		Convey("other namespaces should not be ignored", func() {
+			So(restore.IgnoresMetadata(&intents.Intent{DB: "db2", C: "fresh"}), ShouldBeFalse)
+			So(restore.IgnoresMetadata(&intents.Intent{DB: "db10", C: "c1"}), ShouldBeFalse)
+		})
+	})
+}
+
+func TestMaxConcurrentIndexBuilds(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With index builds for eight collections restored in parallel", t, func() {
+		var mutex sync.Mutex
+		running, maxRunning := 0, 0
+		build := func() error {
+			mutex.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mutex.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+			return nil
+		}
+		buildAll := func(restore *MongoRestore) {
+			errs := make(chan error, 8)
+			for i := 0; i < 8; i++ {
+				go func() {
+					errs <- restore.withIndexBuildSlot(build)
+				}()
+			}
+			for i := 0; i < 8; i++ {
+				So(<-errs, ShouldBeNil)
+			}
+		}
+
+		Convey("no more than --maxConcurrentIndexBuilds should run at once", func() {
+			buildAll(&MongoRestore{indexBuildSlots: make(chan struct{}, 2)})
+			So(maxRunning, ShouldBeGreaterThan, 0)
+			So(maxRunning, ShouldBeLessThanOrEqualTo, 2)
+		})
+
+		Convey("without a limit, they should all be able to run at once", func() {
+			buildAll(&MongoRestore{})
+			So(maxRunning, ShouldBeGreaterThan, 2)
+		})
+	})
+}
+
+func TestUnknownIndexOptions(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With metadata for an index with an option unknown to this tool", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+		metadata := []byte(`{"indexes":[{"v":1,"key":{"a":1,"b":-1},"name":"a_1_b_-1",` +
+			`"futureOption":{"mode":"experimental","level":{"$numberLong":"3"}}}]}`)
+
+		Convey("the option should be forwarded to createIndexes unchanged", func() {
+			_, indexes, err := restore.MetadataFromJSON(metadata)
+			So(err, ShouldBeNil)
+			So(len(indexes), ShouldEqual, 1)
+
+			raw, err := bson.Marshal(restore.createIndexesCommand(intent, indexes))
+			So(err, ShouldBeNil)
+			command := bson.M{}
+			So(bson.Unmarshal(raw, &command), ShouldBeNil)
+			sent := command["indexes"].([]interface{})[0].(bson.M)
+			So(sent["name"], ShouldEqual, "a_1_b_-1")
+			So(sent["futureOption"], ShouldResemble, bson.M{"mode": "experimental", "level": int64(3)})
+		})
+	})
+}
+
+func TestDuplicateIndexes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With metadata listing indexes more than once", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+		metadata := []byte(`{"indexes":[` +
+			`{"v":1,"key":{"a":1},"name":"a_1"},` +
+			`{"v":1,"key":{"b":1},"name":"a_1"},` +
+			`{"v":1,"key":{"a":1},"name":"a_1_again"},` +
+			`{"v":1,"key":{"a":1},"name":"a_1_unique","unique":true},` +
+			`{"v":1,"key":{"a":1},"name":"a_1"}]}`)
+		_, indexes, err := restore.MetadataFromJSON(metadata)
+		So(err, ShouldBeNil)
+		So(len(indexes), ShouldEqual, 5)
+
+		logged := &bytes.Buffer{}
+		log.SetWriter(logged)
+		Reset(func() {
+			log.SetWriter(os.Stderr)
+		})
+
+		Convey("only the first of each should be built, with a warning for the rest", func() {
+			indexes = dedupeIntentIndexes(intent, indexes)
+			raw, err := bson.Marshal(restore.createIndexesCommand(intent, indexes))
+			So(err, ShouldBeNil)
+			command := bson.M{}
+			So(bson.Unmarshal(raw, &command), ShouldBeNil)
+			names := []interface{}{}
+			for _, index := range command["indexes"].([]interface{}) {
+				names = append(names, index.(bson.M)["name"])
+			}
+			So(names, ShouldResemble, []interface{}{"a_1", "a_1_unique"})
+			So(strings.Count(logged.String(), "more than once"), ShouldEqual, 3)
+			So(logged.String(), ShouldContainSubstring, "lists index a_1_again more than once")
+		})
+	})
+}
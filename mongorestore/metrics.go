@@ -0,0 +1,158 @@
+package mongorestore
+
+import (
+	"encoding/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// restoreMetrics tracks the progress of a restore as a whole, from the same
+// counters that drive the progress bars, for --metricsSocket. Its methods are
+// safe to call on a nil *restoreMetrics, which tracks nothing.
+type restoreMetrics struct {
+	mutex      sync.Mutex
+	started    time.Time
+	totalBytes int64
+	// bytes of the collections that are done restoring
+	doneBytes int64
+	documents int64
+	// the progress of each collection being restored
+	active map[string]progress.Progressor
+}
+
+// metricsSample is what is written to each connection to the metrics socket.
+type metricsSample struct {
+	Namespaces  []string `json:"namespaces"`
+	Documents   int64    `json:"documents"`
+	Bytes       int64    `json:"bytes"`
+	TotalBytes  int64    `json:"totalBytes"`
+	DocsPerSec  float64  `json:"docsPerSec"`
+	BytesPerSec float64  `json:"bytesPerSec"`
+	// seconds until all of TotalBytes is restored at the current rate, or 0 if unknown
+	ETASeconds float64 `json:"etaSeconds"`
+}
+
+func newRestoreMetrics(totalBytes int64) *restoreMetrics {
+	return &restoreMetrics{
+		started:    time.Now(),
+		totalBytes: totalBytes,
+		active:     map[string]progress.Progressor{},
+	}
+}
+
+// attach starts reporting the progress of the given namespace.
+func (metrics *restoreMetrics) attach(ns string, progressor progress.Progressor) {
+	if metrics == nil {
+		return
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.active[ns] = progressor
+}
+
+// detach stops reporting the given namespace as in progress, and counts
+// the bytes it restored as done.
+func (metrics *restoreMetrics) detach(ns string) {
+	if metrics == nil {
+		return
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	if progressor, ok := metrics.active[ns]; ok {
+		_, current := progressor.Progress()
+		metrics.doneBytes += current
+		delete(metrics.active, ns)
+	}
+}
+
+// addDocuments counts n more documents as restored.
+func (metrics *restoreMetrics) addDocuments(n int64) {
+	if metrics == nil {
+		return
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.documents += n
+}
+
+// sample returns the current metrics of the restore.
+func (metrics *restoreMetrics) sample() metricsSample {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	sample := metricsSample{
+		Namespaces: []string{},
+		Documents:  metrics.documents,
+		Bytes:      metrics.doneBytes,
+		TotalBytes: metrics.totalBytes,
+	}
+	for ns, progressor := range metrics.active {
+		sample.Namespaces = append(sample.Namespaces, ns)
+		_, current := progressor.Progress()
+		sample.Bytes += current
+	}
+	sort.Strings(sample.Namespaces)
+
+	elapsed := time.Since(metrics.started)
+	if elapsed > 0 {
+		sample.DocsPerSec = float64(sample.Documents) / elapsed.Seconds()
+		sample.BytesPerSec = float64(sample.Bytes) / elapsed.Seconds()
+	}
+	if remaining, ok := progress.EstimateRemaining(sample.TotalBytes, sample.Bytes, elapsed); ok {
+		sample.ETASeconds = remaining.Seconds()
+	}
+	return sample
+}
+
+// Progress is part of the progress.Progressor interface, so that the restore
+// as a whole has a progress bar. It returns the bytes of all of the collections
+// to restore and the bytes restored so far.
+func (metrics *restoreMetrics) Progress() (int64, int64) {
+	sample := metrics.sample()
+	return sample.TotalBytes, sample.Bytes
+}
+
+// serveMetrics listens on a Unix domain socket at path, and writes a sample of
+// the metrics, as a line of JSON, to each connection before closing it. The
+// returned function stops serving and removes the socket.
+func serveMetrics(path string, metrics *restoreMetrics) (func(), error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				// the listener was closed
+				return
+			}
+			err = json.NewEncoder(conn).Encode(metrics.sample())
+			if err != nil {
+				log.Logf(log.DebugLow, "error writing metrics to %v: %v", path, err)
+			}
+			conn.Close()
+		}
+	}()
+	return func() {
+		listener.Close()
+		<-stopped
+	}, nil
+}
+
+// totalRestoreSize returns the bytes of all of the collections to restore: the
+// sizes recorded in the prelude of an archive, or the sizes of the files of a
+// dump directory, of the namespaces that weren't filtered out.
+func (restore *MongoRestore) totalRestoreSize() int64 {
+	total := int64(0)
+	for _, intent := range restore.manager.Intents() {
+		total += intent.Size
+	}
+	return total
+}
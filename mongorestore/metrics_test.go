@@ -0,0 +1,143 @@
+package mongorestore
+
+import (
+	"encoding/json"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// metricsSampler is a DocumentSink that, on its second write, connects to
+// the metrics socket and keeps the sample it reads.
+type metricsSampler struct {
+	socket string
+	writes int
+	sample *metricsSample
+	err    error
+}
+
+func (sampler *metricsSampler) Write(p []byte) (int, error) {
+	sampler.writes++
+	if sampler.writes == 2 {
+		sampler.sample, sampler.err = readMetricsSample(sampler.socket)
+	}
+	return len(p), nil
+}
+
+func readMetricsSample(socket string) (*metricsSample, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	sample := &metricsSample{}
+	return sample, json.NewDecoder(conn).Decode(sample)
+}
+
+func TestMetricsSocket(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With metrics served on a Unix domain socket", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_metrics")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		socket := filepath.Join(dir, "metrics.sock")
+
+		sampler := &metricsSampler{socket: socket}
+		restore := &MongoRestore{
+			DocumentSink: sampler,
+			metrics:      newRestoreMetrics(1000),
+		}
+		stop, err := serveMetrics(socket, restore.metrics)
+		So(err, ShouldBeNil)
+		Reset(stop)
+
+		Convey("a sample read mid-restore should show the collection in progress", func() {
+			bsonSource := bsonSourceOf(
+				bson.D{{"_id", 1}},
+				bson.D{{"_id", 2}},
+				bson.D{{"_id", 3}},
+			)
+			count, err := restore.RestoreCollectionToDB("db1", "c1", bsonSource, 1000, nil)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+
+			So(sampler.err, ShouldBeNil)
+			So(sampler.sample, ShouldNotBeNil)
+			So(sampler.sample.Namespaces, ShouldResemble, []string{"db1.c1"})
+			So(sampler.sample.Documents, ShouldEqual, 1)
+			So(sampler.sample.Bytes, ShouldBeGreaterThan, 0)
+			So(sampler.sample.TotalBytes, ShouldEqual, 1000)
+
+			Convey("and the collection should be counted as done afterwards", func() {
+				sample := restore.metrics.sample()
+				So(sample.Namespaces, ShouldBeEmpty)
+				So(sample.Documents, ShouldEqual, 3)
+				So(sample.Bytes, ShouldBeGreaterThan, sampler.sample.Bytes)
+			})
+		})
+
+		Convey("the estimated time remaining should follow from the rate so far", func() {
+			restore.metrics.started = time.Now().Add(-10 * time.Second)
+			restore.metrics.doneBytes = 250
+			sample := restore.metrics.sample()
+			So(sample.BytesPerSec, ShouldAlmostEqual, 25, 0.5)
+			So(sample.ETASeconds, ShouldAlmostEqual, 30, 0.5)
+		})
+
+		Convey("the restore as a whole should have the progress of the bytes restored", func() {
+			restore.metrics.doneBytes = 250
+			total, current := restore.metrics.Progress()
+			So(total, ShouldEqual, 1000)
+			So(current, ShouldEqual, 250)
+		})
+
+		Convey("stopping should remove the socket", func() {
+			stop()
+			_, err := os.Stat(socket)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
+
+func TestTotalRestoreSize(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("The total size of an archive restore should only count the namespaces restored", t, func() {
+		prelude := &archive.Prelude{
+			NamespaceMetadatas: []*archive.CollectionMetadata{
+				{Database: "db1", Collection: "c1", Size: 300},
+				{Database: "db1", Collection: "c2", Size: 700},
+				{Database: "db2", Collection: "excluded", Size: 5000},
+			},
+		}
+		restore := &MongoRestore{
+			archive: &archive.Reader{Prelude: prelude},
+			manager: intents.NewIntentManager(),
+		}
+		for _, ns := range prelude.NamespaceMetadatas[:2] {
+			restore.manager.Put(&intents.Intent{DB: ns.Database, C: ns.Collection,
+				BSONPath: "archive", Size: int64(ns.Size)})
+		}
+		So(restore.totalRestoreSize(), ShouldEqual, 1000)
+	})
+
+	Convey("The total size of a dump directory restore should be that of its files", t, func() {
+		restore := &MongoRestore{manager: intents.NewIntentManager()}
+		restore.manager.Put(&intents.Intent{DB: "db1", C: "c1", BSONPath: "db1/c1.bson", Size: 300})
+		restore.manager.Put(&intents.Intent{DB: "db1", C: "c2", BSONPath: "db1/c2.bson", Size: 400})
+		So(restore.totalRestoreSize(), ShouldEqual, 700)
+	})
+}
@@ -3,6 +3,7 @@ package mongorestore
 
 import (
 	"compress/gzip"
+	"crypto/cipher"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/archive"
 	"github.com/mongodb/mongo-tools/common/auth"
@@ -18,9 +19,13 @@ import (
 	"io/ioutil"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
 // MongoRestore is a container for the user-specified options and
@@ -34,13 +39,20 @@ type MongoRestore struct {
 
 	TargetDirectory string
 
+	// DocumentSink, if set, receives the BSON of each document to restore in to a
+	// collection, after any transforms, instead of the document being inserted.
+	// It lets embedders test transforms and filters without a server.
+	DocumentSink io.Writer
+
 	tempUsersCol string
 	tempRolesCol string
 
 	// other internal state
-	manager         *intents.Manager
-	safety          *mgo.Safe
-	progressManager *progress.Manager
+	manager *intents.Manager
+	safety  *mgo.Safe
+	// the writeConcern of commands creating collections and indexes, if not the server's default
+	metaWriteConcern bson.D
+	progressManager  *progress.Manager
 
 	objCheck         bool
 	oplogLimit       bson.MongoTimestamp
@@ -55,6 +67,173 @@ type MongoRestore struct {
 	// indexes belonging to dbs and collections
 	dbCollectionIndexes map[string]collectionIndexes
 
+	// parsed --rewriteRefs arguments, and the maps of old to new _ids they need
+	refRewrites []*refRewrite
+	idMaps      map[string]idMap
+
+	// parsed --checkRefs arguments, and what they read from the target;
+	// the SessionProvider unless set in tests
+	refChecks []*refCheck
+	refLookup refLookup
+
+	// parsed --reshardKey arguments
+	reshardKeys []*reshardKey
+
+	// limits the collections restored in to each shard, for --maxCollectionsPerShard
+	shardLimiter *shardLimiter
+
+	// holds a value for each index build in progress, when --maxConcurrentIndexBuilds is set
+	indexBuildSlots chan struct{}
+
+	// serializes and spaces out index builds for --indexBuildRateLimit
+	indexBuildPacer *indexBuildPacer
+
+	// how long --retryIndexBuilds first waits to retry, if not defaultIndexRetryBackoff
+	indexRetryBackoff time.Duration
+
+	// how often to ping the server during index builds, for --keepAliveInterval,
+	// and what to ping it through; the SessionProvider unless set in tests
+	keepAliveInterval time.Duration
+	keepAliveRunner   commandRunner
+
+	// parsed --postRestore arguments
+	postRestoreCommands []*postRestoreCommand
+
+	// what commands such as those of --postRestore, --stampRestoreInfo and --autoShard
+	// are run through; the SessionProvider unless set in tests
+	runner commandRunner
+
+	// write failures of the documents of each namespace, the number of documents
+	// of each that failed to insert, the number skipped by --idCollisions=skip,
+	// and a lock for them
+	writeFailures       map[string][]db.WriteFailure
+	insertErrorCounts   map[string]int64
+	duplicateIdsSkipped map[string]int64
+	writeFailuresMutex  sync.Mutex
+
+	// the number of documents that failed to insert, for --maxErrors, updated atomically
+	insertErrors int64
+
+	// the comment attached to commands and inserts, from --appName and --comment
+	comment string
+
+	// the session all commands and inserts are run in, for --causalConsistency
+	causalSession *db.CausalSession
+
+	// parsed --encryptFields arguments, and the cipher from --encryptionKeyFile
+	encryptedFields []*encryptedFields
+	encryptionKey   cipher.AEAD
+
+	// the number of documents to restore into each namespace given to --limit
+	documentLimits map[string]int64
+
+	// the range of _ids to restore into each namespace given to --idRange
+	idRanges map[string]*idRange
+
+	// the bytes of documents read but not yet inserted, for --maxInFlightBytes, or nil
+	inFlight *byteBudget
+
+	// the date field and TTL given to --dropExpired, and the number of documents of
+	// each namespace skipped because they had expired
+	dropExpiredField string
+	dropExpiredTTL   time.Duration
+	expiredCounts    map[string]int64
+	expiredMutex     sync.Mutex
+
+	// the namespaces given to --renumberIds, and the original _ids of the documents
+	// of each, in the order of their new _ids
+	renumberNamespaces map[string]bool
+	renumberedIds      map[string][]interface{}
+	renumberedMutex    sync.Mutex
+
+	// the kinds of empty values removed by --pruneEmpty, or nil without it
+	pruneKinds map[string]bool
+
+	// the commitQuorum of createIndexes, or nil for the server's default
+	indexCommitQuorum interface{}
+
+	// the filter of the _ids restored, for --seenIdsBloom
+	seenIds *seenIdsFilter
+
+	// the namespaces listed by --order, restored first in that order
+	order []string
+
+	// parsed --clientSchema arguments
+	clientSchemas []*clientSchema
+
+	// parsed --templateField arguments
+	templateFields []*templateField
+
+	// the field to split each namespace given to --splitBy by
+	splitFields map[string]string
+
+	// the array field of each namespace given to --spillArray
+	spillArrays map[string]*spillArray
+
+	// the parsed --ttlOverride argument of each namespace given one
+	ttlOverrides map[string]*ttlOverride
+
+	// the parsed --convertDBRef arguments of each namespace given any
+	dbRefConversions map[string][]*dbRefConversion
+
+	// the fields of each namespace given to --toDecimal128
+	decimalFields map[string][]string
+
+	// the namespaces given to --skipFirstDocOf
+	skipFirstDocNamespaces map[string]bool
+
+	// the namespaces given to --flatten
+	flattenNamespaces map[string]bool
+
+	// parsed --rewriteBinarySubtype argument, or nil
+	binarySubtypeRewrite *binarySubtypeRewrite
+
+	// the copy of the archive being written for --teeArchive, or nil
+	archiveTee *archiveTee
+
+	// the file the documents skipped by transforms are written to for --skippedTo, or nil
+	skipped *skippedFile
+
+	// failure to inject, from MONGORESTORE_FAILPOINT, or nil
+	failpoint *failpoint
+
+	// the dumped namespace of each namespace renamed by --stripPrefix
+	strippedFrom map[string]string
+
+	// parsed --since arguments
+	sinceFilters []*sinceFilter
+
+	// counts the documents of a collection for --onlyIfEmpty; through the
+	// SessionProvider unless set in tests
+	documentCounter func(dbName, colName string) (int64, error)
+
+	// lists the target's namespaces for --requireEmptyCluster; the
+	// SessionProvider unless set in tests
+	namespaceLister namespaceLister
+
+	// reads back a document by its _id for --verifySample; through the
+	// SessionProvider unless set in tests
+	documentFetcher func(dbName, colName string, id bson.Raw) ([]byte, error)
+
+	// where sessions are got from; the SessionProvider unless set in tests
+	sessions sessionGetter
+
+	// sets the sessions of the reads that check the target to the
+	// --metadataReadPreference, or nil to read from the primary
+	setMetadataReadMode func(*mgo.Session)
+
+	// unique indexes left unbuilt by --deferUniqueIndexes
+	deferredIndexes      []deferredIndexes
+	deferredIndexesMutex sync.Mutex
+
+	// progress of the whole restore, shown as the total progress bar and served
+	// by --metricsSocket, or nil
+	metrics *restoreMetrics
+
+	// document counts of the restored namespaces, for --verifyReport
+	results      []RestoreResult
+	resultsMutex sync.Mutex
+
 	archive *archive.Reader
 
 	// channel on which to notify if/when a termination signal is received
@@ -66,6 +245,37 @@ type MongoRestore struct {
 
 type collectionIndexes map[string][]IndexDocument
 
+// bracedWriteConcern wraps an argument to --dataWriteConcern or --metaWriteConcern
+// in braces if they were left off of a document, e.g. "w:1,j:true".
+func bracedWriteConcern(writeConcern string) string {
+	if strings.Contains(writeConcern, ":") && !strings.HasPrefix(strings.TrimSpace(writeConcern), "{") {
+		return "{" + writeConcern + "}"
+	}
+	return writeConcern
+}
+
+// buildWriteConcerns parses the write concerns of the document inserts, and of the
+// commands that create collections and indexes, for the given type of node.
+func (restore *MongoRestore) buildWriteConcerns(nodeType db.NodeType) error {
+	dataWriteConcern := restore.OutputOptions.WriteConcern
+	if restore.OutputOptions.DataWriteConcern != "" {
+		dataWriteConcern = bracedWriteConcern(restore.OutputOptions.DataWriteConcern)
+	}
+	var err error
+	restore.safety, err = db.BuildWriteConcern(dataWriteConcern, nodeType)
+	if err != nil {
+		return fmt.Errorf("error parsing write concern: %v", err)
+	}
+	if restore.OutputOptions.MetaWriteConcern != "" {
+		metaSafety, err := db.BuildWriteConcern(bracedWriteConcern(restore.OutputOptions.MetaWriteConcern), nodeType)
+		if err != nil {
+			return fmt.Errorf("error parsing --metaWriteConcern: %v", err)
+		}
+		restore.metaWriteConcern = db.WriteConcernDocument(metaSafety)
+	}
+	return nil
+}
+
 // ParseAndValidateOptions returns a non-nil error if user-supplied options are invalid.
 func (restore *MongoRestore) ParseAndValidateOptions() error {
 	// Can't use option pkg defaults for --objcheck because it's two separate flags,
@@ -108,6 +318,43 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 	if restore.isMongos {
 		log.Log(log.DebugLow, "restoring to a sharded system")
 	}
+	if err = restore.setIndexCommitQuorum(); err != nil {
+		return err
+	}
+
+	for _, arg := range restore.OutputOptions.ReshardKeys {
+		reshard, err := parseReshardKey(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --reshardKey argument '%v': %v", arg, err)
+		}
+		restore.reshardKeys = append(restore.reshardKeys, reshard)
+	}
+	if len(restore.reshardKeys) > 0 && !restore.isMongos {
+		return fmt.Errorf("cannot use --reshardKey unless connected to a mongos")
+	}
+	if restore.OutputOptions.AutoShard && !restore.isMongos {
+		log.Log(log.Always, "not connected to a mongos; --autoShard will not shard any collections")
+	}
+
+	for _, arg := range restore.OutputOptions.PostRestore {
+		post, err := parsePostRestoreCommand(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --postRestore argument '%v': %v", arg, err)
+		}
+		restore.postRestoreCommands = append(restore.postRestoreCommands, post)
+	}
+
+	if restore.OutputOptions.MaxCollectionsPerShard < 0 {
+		return fmt.Errorf("cannot specify a negative number of collections per shard")
+	}
+	if restore.OutputOptions.MaxCollectionsPerShard > 0 {
+		if !restore.isMongos {
+			return fmt.Errorf("cannot use --maxCollectionsPerShard unless connected to a mongos")
+		}
+		if restore.InputOptions.Archive != "" {
+			return fmt.Errorf("cannot use --maxCollectionsPerShard with --archive")
+		}
+	}
 
 	if restore.InputOptions.OplogLimit != "" {
 		if !restore.InputOptions.OplogReplay {
@@ -126,9 +373,39 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 	}
 
 	log.Logf(log.DebugLow, "connected to node type: %v", nodeType)
-	restore.safety, err = db.BuildWriteConcern(restore.OutputOptions.WriteConcern, nodeType)
+	err = restore.buildWriteConcerns(nodeType)
 	if err != nil {
-		return fmt.Errorf("error parsing write concern: %v", err)
+		return err
+	}
+
+	if restore.OutputOptions.RetryWrites {
+		if restore.safety == nil {
+			return fmt.Errorf("cannot use --retryWrites with an unacknowledged write concern")
+		}
+		supported, err := restore.SessionProvider.SupportsRetryableWrites()
+		if err != nil {
+			return fmt.Errorf("error checking for retryable writes support: %v", err)
+		}
+		if !supported {
+			return fmt.Errorf("--retryWrites requires a replica set or mongos running MongoDB 3.6 or later")
+		}
+	}
+
+	if restore.OutputOptions.CausalConsistency {
+		if restore.safety == nil {
+			return fmt.Errorf("cannot use --causalConsistency with an unacknowledged write concern")
+		}
+		supported, err := restore.SessionProvider.SupportsRetryableWrites()
+		if err != nil {
+			return fmt.Errorf("error checking for logical session support: %v", err)
+		}
+		if !supported {
+			return fmt.Errorf("--causalConsistency requires a replica set or mongos running MongoDB 3.6 or later")
+		}
+		restore.causalSession, err = db.NewCausalSession()
+		if err != nil {
+			return err
+		}
 	}
 
 	// handle the hidden auth collection flags
@@ -143,6 +420,417 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		restore.tempRolesCol = *restore.ToolOptions.HiddenOptions.TempRolesColl
 	}
 
+	for _, pattern := range restore.OutputOptions.IgnoreMetadataFor {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --ignoreMetadataFor pattern '%v': %v", pattern, err)
+		}
+	}
+
+	for _, arg := range restore.OutputOptions.RewriteRefs {
+		rewrite, err := parseRefRewrite(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --rewriteRefs argument '%v': %v", arg, err)
+		}
+		restore.refRewrites = append(restore.refRewrites, rewrite)
+	}
+	if len(restore.refRewrites) > 0 && restore.InputOptions.Archive != "" {
+		return fmt.Errorf("cannot use --rewriteRefs with --archive")
+	}
+	for _, arg := range restore.OutputOptions.CheckRefs {
+		check, err := parseRefCheck(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --checkRefs argument '%v': %v", arg, err)
+		}
+		restore.refChecks = append(restore.refChecks, check)
+	}
+
+	for _, arg := range restore.OutputOptions.Since {
+		filter, err := parseSinceFilter(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --since argument '%v': %v", arg, err)
+		}
+		restore.sinceFilters = append(restore.sinceFilters, filter)
+	}
+	if restore.OutputOptions.DropExpired != "" {
+		restore.dropExpiredField, restore.dropExpiredTTL, err = parseDropExpired(restore.OutputOptions.DropExpired)
+		if err != nil {
+			return fmt.Errorf("invalid --dropExpired argument '%v': %v", restore.OutputOptions.DropExpired, err)
+		}
+	}
+	if restore.OutputOptions.RewriteBinarySubtype != "" {
+		restore.binarySubtypeRewrite, err = parseBinarySubtypeRewrite(restore.OutputOptions.RewriteBinarySubtype)
+		if err != nil {
+			return fmt.Errorf("invalid --rewriteBinarySubtype argument '%v': %v",
+				restore.OutputOptions.RewriteBinarySubtype, err)
+		}
+	}
+	switch restore.OutputOptions.CaseCollisions {
+	case "", caseCollisionsError, caseCollisionsWarn, caseCollisionsIgnore:
+	default:
+		return fmt.Errorf("--caseCollisions must be '%v', '%v' or '%v'",
+			caseCollisionsError, caseCollisionsWarn, caseCollisionsIgnore)
+	}
+
+	if restore.OutputOptions.PruneEmpty {
+		restore.pruneKinds, err = parsePruneKinds(restore.OutputOptions.PruneEmptyKinds)
+		if err != nil {
+			return fmt.Errorf("invalid --pruneEmptyKinds argument: %v", err)
+		}
+	}
+	if restore.OutputOptions.Order != "" {
+		if restore.InputOptions.Archive != "" {
+			// the collections of an archive are restored in the order it holds them
+			return fmt.Errorf("cannot use --order with --archive")
+		}
+		restore.order, err = readOrderFile(restore.OutputOptions.Order)
+		if err != nil {
+			return err
+		}
+	}
+	for _, arg := range restore.OutputOptions.ClientSchemas {
+		schema, err := parseClientSchema(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --clientSchema argument '%v': %v", arg, err)
+		}
+		restore.clientSchemas = append(restore.clientSchemas, schema)
+	}
+	if restore.OutputOptions.MetadataReadPreference != "" {
+		restore.setMetadataReadMode, err = parseMetadataReadPreference(restore.OutputOptions.MetadataReadPreference)
+		if err != nil {
+			return err
+		}
+	}
+	if restore.OutputOptions.SeenIdsBloom != "" {
+		if restore.OutputOptions.Drop {
+			// the filter would skip every document of the dropped collections
+			return fmt.Errorf("cannot use --seenIdsBloom with --drop")
+		}
+		restore.seenIds, err = loadSeenIdsFilter(restore.OutputOptions.SeenIdsBloom,
+			restore.OutputOptions.SeenIdsBloomCapacity)
+		if err != nil {
+			return err
+		}
+	}
+	switch restore.OutputOptions.LowercaseKeysMode {
+	case "", lowercaseKeysError, lowercaseKeysLastWins:
+	default:
+		return fmt.Errorf("--lowercaseKeysMode must be '%v' or '%v'", lowercaseKeysError, lowercaseKeysLastWins)
+	}
+	if restore.OutputOptions.EscapeKeys {
+		err = validateKeyEscapes(restore.OutputOptions.EscapeKeysDot, restore.OutputOptions.EscapeKeysDollar)
+		if err != nil {
+			return err
+		}
+	}
+	if restore.OutputOptions.MoveIdTo != "" {
+		if err := validateTopLevelField(restore.OutputOptions.MoveIdTo); err != nil {
+			return fmt.Errorf("invalid --moveIdTo argument: %v", err)
+		}
+	}
+	if restore.OutputOptions.HashField != "" {
+		if err := validateTopLevelField(restore.OutputOptions.HashField); err != nil {
+			return fmt.Errorf("invalid --hashField argument: %v", err)
+		}
+	}
+	for _, ns := range restore.OutputOptions.RenumberIds {
+		if err := validateFlattenNamespace(ns); err != nil {
+			return fmt.Errorf("invalid --renumberIds argument: %v", err)
+		}
+		if restore.OutputOptions.MoveIdTo != "" {
+			return fmt.Errorf("cannot use --renumberIds with --moveIdTo")
+		}
+		for _, rewrite := range restore.refRewrites {
+			if rewrite.DB+"."+rewrite.RefC == ns {
+				return fmt.Errorf("cannot use --renumberIds on %v, whose _ids are rewritten by --rewriteRefs", ns)
+			}
+		}
+		if restore.renumberNamespaces == nil {
+			restore.renumberNamespaces = map[string]bool{}
+		}
+		restore.renumberNamespaces[ns] = true
+	}
+	switch restore.OutputOptions.RepairUTF8Mode {
+	case "", repairUTF8Replace, repairUTF8Strip:
+	default:
+		return fmt.Errorf("--repairUTF8Mode must be '%v' or '%v'", repairUTF8Replace, repairUTF8Strip)
+	}
+	switch restore.OutputOptions.ClientSchemaMode {
+	case "", clientSchemaSkip, clientSchemaAbort:
+	default:
+		return fmt.Errorf("--clientSchemaMode must be '%v' or '%v'", clientSchemaSkip, clientSchemaAbort)
+	}
+	for _, arg := range restore.OutputOptions.TemplateFields {
+		templated, err := parseTemplateField(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --templateField argument '%v': %v", arg, err)
+		}
+		restore.templateFields = append(restore.templateFields, templated)
+	}
+	for _, arg := range restore.OutputOptions.SplitBy {
+		ns, field, err := parseSplitBy(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --splitBy argument '%v': %v", arg, err)
+		}
+		if restore.splitFields == nil {
+			restore.splitFields = map[string]string{}
+		}
+		restore.splitFields[ns] = field
+	}
+	switch restore.OutputOptions.IdIndexOptions {
+	case "", idIndexOptionsRestore, idIndexOptionsIgnore:
+	default:
+		return fmt.Errorf("--idIndexOptions must be '%v' or '%v'", idIndexOptionsRestore, idIndexOptionsIgnore)
+	}
+	switch restore.OutputOptions.NormalizeIdType {
+	case "", idTypeString, idTypeObjectId:
+	default:
+		return fmt.Errorf("--normalizeIdType must be '%v' or '%v'", idTypeString, idTypeObjectId)
+	}
+	switch restore.OutputOptions.IdCollisions {
+	case "", idCollisionsError, idCollisionsSkip, idCollisionsReplace:
+	default:
+		return fmt.Errorf("--idCollisions must be '%v', '%v' or '%v'",
+			idCollisionsError, idCollisionsSkip, idCollisionsReplace)
+	}
+	if restore.OutputOptions.LogEveryDocs < 0 {
+		return fmt.Errorf("--logEveryDocs must not be negative")
+	}
+	if restore.OutputOptions.VerifySample < 0 {
+		return fmt.Errorf("--verifySample must not be negative")
+	}
+	if restore.splitFields != nil {
+		if restore.OutputOptions.SplitByMaxTargets < 1 {
+			return fmt.Errorf("--splitByMaxTargets must be greater than 0")
+		}
+		if restore.OutputOptions.VerifyReport != "" {
+			return fmt.Errorf("cannot use --verifyReport with --splitBy")
+		}
+		if restore.OutputOptions.VerifySample > 0 {
+			return fmt.Errorf("cannot use --verifySample with --splitBy")
+		}
+	}
+	for _, arg := range restore.OutputOptions.SpillArrays {
+		spill, err := parseSpillArray(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --spillArray argument '%v': %v", arg, err)
+		}
+		if _, ok := restore.splitFields[spill.ns]; ok {
+			return fmt.Errorf("cannot use --spillArray and --splitBy on the same collection %v", spill.ns)
+		}
+		if restore.OutputOptions.VerifySample > 0 {
+			// the documents are inserted without the array
+			return fmt.Errorf("cannot use --verifySample with --spillArray")
+		}
+		if restore.spillArrays == nil {
+			restore.spillArrays = map[string]*spillArray{}
+		}
+		restore.spillArrays[spill.ns] = spill
+	}
+	for _, arg := range restore.OutputOptions.ToDecimal128 {
+		ns, fields, err := parseToDecimal128(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --toDecimal128 argument '%v': %v", arg, err)
+		}
+		// the documents can't be read again once they have decimals
+		if restore.OutputOptions.HashField != "" {
+			return fmt.Errorf("cannot use --toDecimal128 with --hashField")
+		}
+		if _, ok := restore.splitFields[ns]; ok {
+			return fmt.Errorf("cannot use --toDecimal128 and --splitBy on the same collection %v", ns)
+		}
+		if _, ok := restore.spillArrays[ns]; ok {
+			return fmt.Errorf("cannot use --toDecimal128 and --spillArray on the same collection %v", ns)
+		}
+		if restore.decimalFields == nil {
+			restore.decimalFields = map[string][]string{}
+		}
+		restore.decimalFields[ns] = append(restore.decimalFields[ns], fields...)
+	}
+	for _, arg := range restore.OutputOptions.ConvertDBRefs {
+		conversion, err := parseDBRefConversion(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --convertDBRef argument '%v': %v", arg, err)
+		}
+		for _, other := range restore.dbRefConversions[conversion.ns] {
+			if other.field == conversion.field {
+				return fmt.Errorf("--convertDBRef is given more than once for field '%v' of %v",
+					conversion.field, conversion.ns)
+			}
+		}
+		if restore.dbRefConversions == nil {
+			restore.dbRefConversions = map[string][]*dbRefConversion{}
+		}
+		restore.dbRefConversions[conversion.ns] = append(restore.dbRefConversions[conversion.ns], conversion)
+	}
+	for _, arg := range restore.OutputOptions.TTLOverrides {
+		override, err := parseTTLOverride(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --ttlOverride argument '%v': %v", arg, err)
+		}
+		if _, ok := restore.ttlOverrides[override.ns]; ok {
+			return fmt.Errorf("--ttlOverride is given more than once for %v", override.ns)
+		}
+		if restore.ttlOverrides == nil {
+			restore.ttlOverrides = map[string]*ttlOverride{}
+		}
+		restore.ttlOverrides[override.ns] = override
+	}
+	for _, ns := range restore.OutputOptions.SkipFirstDocOf {
+		if err := validateFlattenNamespace(ns); err != nil {
+			return fmt.Errorf("invalid --skipFirstDocOf argument: %v", err)
+		}
+		if restore.skipFirstDocNamespaces == nil {
+			restore.skipFirstDocNamespaces = map[string]bool{}
+		}
+		restore.skipFirstDocNamespaces[ns] = true
+	}
+	for _, ns := range restore.OutputOptions.Flatten {
+		if err := validateFlattenNamespace(ns); err != nil {
+			return fmt.Errorf("invalid --flatten argument: %v", err)
+		}
+		if restore.flattenNamespaces == nil {
+			restore.flattenNamespaces = map[string]bool{}
+		}
+		restore.flattenNamespaces[ns] = true
+	}
+	switch restore.OutputOptions.FlattenArrays {
+	case "", flattenArraysKeep, flattenArraysIndex:
+	default:
+		return fmt.Errorf("--flattenArrays must be '%v' or '%v'", flattenArraysKeep, flattenArraysIndex)
+	}
+
+	for _, arg := range restore.OutputOptions.Limits {
+		ns, limit, err := parseDocumentLimit(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --limit argument '%v': %v", arg, err)
+		}
+		if restore.documentLimits == nil {
+			restore.documentLimits = map[string]int64{}
+		}
+		restore.documentLimits[ns] = limit
+	}
+	if restore.InputOptions.StripPrefixFromDBs && restore.InputOptions.StripPrefix == "" {
+		return fmt.Errorf("cannot use --stripPrefixFromDBs without --stripPrefix")
+	}
+
+	if restore.OutputOptions.MaxDocsPerCollection < 0 {
+		return fmt.Errorf("cannot specify a negative --maxDocsPerCollection")
+	}
+
+	switch restore.OutputOptions.SinceMissing {
+	case "", sinceMissingInclude, sinceMissingExclude:
+	default:
+		return fmt.Errorf("--sinceMissing must be '%v' or '%v'", sinceMissingInclude, sinceMissingExclude)
+	}
+
+	if restore.OutputOptions.MaxInFlightBytes < 0 {
+		return fmt.Errorf("cannot specify a negative --maxInFlightBytes")
+	}
+	if restore.OutputOptions.MaxErrors < 0 {
+		return fmt.Errorf("cannot specify a negative --maxErrors")
+	}
+	if restore.OutputOptions.MaxInFlightBytes > 0 && restore.OutputOptions.DeterministicBatching {
+		// batches are flushed whenever the insertion workers catch up with the reader
+		return fmt.Errorf("cannot use --deterministicBatching with --maxInFlightBytes")
+	}
+	if restore.OutputOptions.MaxInFlightBytes > 0 {
+		restore.inFlight = newByteBudget(restore.OutputOptions.MaxInFlightBytes)
+	}
+	for _, arg := range restore.OutputOptions.IdRanges {
+		ns, r, err := parseIdRange(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --idRange argument '%v': %v", arg, err)
+		}
+		if restore.idRanges == nil {
+			restore.idRanges = map[string]*idRange{}
+		}
+		restore.idRanges[ns] = r
+	}
+
+	restore.failpoint, err = parseFailpoint(os.Getenv(failpointEnv))
+	if err != nil {
+		return fmt.Errorf("invalid %v: %v", failpointEnv, err)
+	}
+
+	for _, arg := range restore.OutputOptions.EncryptFields {
+		encrypted, err := parseEncryptedFields(arg)
+		if err != nil {
+			return fmt.Errorf("invalid --encryptFields argument '%v': %v", arg, err)
+		}
+		restore.encryptedFields = append(restore.encryptedFields, encrypted)
+	}
+	if len(restore.encryptedFields) > 0 {
+		if restore.OutputOptions.EncryptionKeyFile == "" {
+			return fmt.Errorf("cannot use --encryptFields without --encryptionKeyFile")
+		}
+		restore.encryptionKey, err = loadEncryptionKey(restore.OutputOptions.EncryptionKeyFile)
+		if err != nil {
+			return fmt.Errorf("error loading --encryptionKeyFile: %v", err)
+		}
+	}
+
+	if restore.InputOptions.OplogApplyBatchSize < 0 {
+		return fmt.Errorf("cannot specify a negative --oplogApplyBatchSize")
+	}
+
+	if restore.OutputOptions.OnlyIfEmpty && restore.OutputOptions.Drop {
+		return fmt.Errorf("cannot use --onlyIfEmpty with --drop")
+	}
+
+	if len(restore.InputOptions.IncludeDBs) > 0 && restore.InputOptions.OplogReplay {
+		return fmt.Errorf("cannot use --includeDB with --oplogReplay, " +
+			"since the oplog can contain operations on other databases")
+	}
+
+	switch restore.OutputOptions.StampRestoreInfo {
+	case "", stampComment, stampMarker:
+	default:
+		return fmt.Errorf("unsupported --stampRestoreInfo '%v', expected '%v' or '%v'",
+			restore.OutputOptions.StampRestoreInfo, stampComment, stampMarker)
+	}
+
+	if restore.OutputOptions.EmitPlan != "" && restore.OutputOptions.EmitPlan != planFormatDOT {
+		return fmt.Errorf("unsupported --emitPlan format '%v', expected '%v'",
+			restore.OutputOptions.EmitPlan, planFormatDOT)
+	}
+
+	if restore.OutputOptions.DatabasesOnly && restore.OutputOptions.EmitPlan != "" {
+		return fmt.Errorf("cannot use --databasesOnly with --emitPlan")
+	}
+
+	if restore.OutputOptions.MaxConcurrentIndexBuilds < 0 {
+		return fmt.Errorf("cannot specify a negative number of concurrent index builds")
+	}
+	if restore.OutputOptions.MaxConcurrentIndexBuilds > 0 {
+		restore.indexBuildSlots = make(chan struct{}, restore.OutputOptions.MaxConcurrentIndexBuilds)
+	}
+	if restore.OutputOptions.IndexBuildRateLimit < 0 {
+		return fmt.Errorf("cannot specify a negative --indexBuildRateLimit")
+	}
+	if restore.OutputOptions.IndexBuildRateLimit > 0 {
+		restore.indexBuildPacer = newIndexBuildPacer(
+			time.Duration(restore.OutputOptions.IndexBuildRateLimit) * time.Millisecond)
+	}
+
+	if restore.OutputOptions.Shuffle && restore.OutputOptions.ShuffleBufferSize < 1 {
+		return fmt.Errorf("--shuffleBufferSize must be at least 1")
+	}
+
+	if restore.OutputOptions.MaxCollections < 0 {
+		return fmt.Errorf("cannot specify a negative --maxCollections")
+	}
+
+	if restore.OutputOptions.RetryIndexBuilds < 0 {
+		return fmt.Errorf("cannot specify a negative --retryIndexBuilds")
+	}
+
+	if restore.OutputOptions.KeepAliveInterval < 0 {
+		return fmt.Errorf("cannot specify a negative --keepAliveInterval")
+	}
+	restore.keepAliveInterval = time.Duration(restore.OutputOptions.KeepAliveInterval) * time.Second
+
+	restore.comment = commandComment(restore.OutputOptions.AppName, restore.OutputOptions.Comment)
+
 	if restore.OutputOptions.NumInsertionWorkers < 0 {
 		return fmt.Errorf(
 			"cannot specify a negative number of insertion workers per collection")
@@ -162,12 +850,57 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		restore.stdin = os.Stdin
 	}
 
+	if restore.InputOptions.TeeArchive != "" && restore.InputOptions.Archive == "" {
+		return fmt.Errorf("cannot use --teeArchive without --archive")
+	}
+	if restore.InputOptions.DumpPreludeCSV && restore.InputOptions.Archive == "" {
+		return fmt.Errorf("cannot use --dumpPreludeCSV without --archive")
+	}
+
+	if restore.InputOptions.ParallelGzip {
+		switch {
+		case !restore.InputOptions.Gzip:
+			return fmt.Errorf("cannot use --parallelGzip without --gzip")
+		case restore.InputOptions.Archive != "":
+			return fmt.Errorf("cannot use --parallelGzip with --archive")
+		}
+	}
+
+	if restore.InputOptions.ReverseOrder {
+		switch {
+		case restore.InputOptions.Archive != "":
+			// archives interleave collections and can only be read forwards
+			return fmt.Errorf("cannot use --reverseOrder with --archive")
+		case restore.TargetDirectory == "-":
+			return fmt.Errorf("cannot use --reverseOrder when restoring from stdin")
+		case restore.InputOptions.Gzip:
+			return fmt.Errorf("cannot use --reverseOrder with --gzip")
+		}
+	}
+
+	if restore.InputOptions.StartOffset != 0 {
+		switch {
+		case restore.InputOptions.StartOffset < 0:
+			return fmt.Errorf("cannot specify a negative --startOffset")
+		case restore.InputOptions.Archive != "" || restore.TargetDirectory == "-":
+			return fmt.Errorf("cannot use --startOffset unless restoring from a .bson file")
+		case restore.InputOptions.Gzip:
+			return fmt.Errorf("cannot use --startOffset with --gzip")
+		case restore.ToolOptions.Collection == "" && !strings.HasSuffix(restore.TargetDirectory, ".bson"):
+			return fmt.Errorf("cannot use --startOffset without restoring a single collection")
+		}
+	}
+
 	return nil
 }
 
 // Restore runs the mongorestore program.
 func (restore *MongoRestore) Restore() error {
 	var target archive.DirLike
+	if restore.InputOptions.Manifest != "" {
+		return restore.RestoreManifest()
+	}
+
 	err := restore.ParseAndValidateOptions()
 	if err != nil {
 		log.Logf(log.DebugLow, "got error from options parsing: %v", err)
@@ -182,14 +915,22 @@ func (restore *MongoRestore) Restore() error {
 		if err != nil {
 			return err
 		}
-		restore.archive = &archive.Reader{
-			In:      archiveReader,
-			Prelude: &archive.Prelude{},
-		}
-		err = restore.archive.Prelude.Read(restore.archive.In)
+		defer restore.archiveTee.abandon()
+		restore.archive = &archive.Reader{In: archiveReader}
+		err = restore.readArchivePrelude()
 		if err != nil {
 			return err
 		}
+		if version, ok := restore.archive.Prelude.SourceServerVersion(); ok {
+			log.Logf(log.Info, "archive was dumped from a server running version %v", version)
+		}
+		if restore.InputOptions.DumpPreludeCSV {
+			// the body isn't needed
+			return restore.WritePreludeCSV(restore.archive.Prelude, os.Stdout)
+		}
+		if err = restore.checkMaxCollections(restore.archive.Prelude); err != nil {
+			return err
+		}
 		target, err = restore.archive.Prelude.NewPreludeExplorer()
 		if err != nil {
 			return err
@@ -239,7 +980,10 @@ func (restore *MongoRestore) Restore() error {
 	// to register themselves with the demux directly
 	if restore.InputOptions.Archive != "" {
 		restore.archive.Demux = &archive.Demultiplexer{
-			In: restore.archive.In,
+			In:                  restore.archive.In,
+			StrictEnd:           restore.InputOptions.StrictEnd,
+			Prelude:             restore.archive.Prelude,
+			NamespaceBufferSize: archiveNamespaceBufferSize,
 		}
 	}
 
@@ -281,11 +1025,63 @@ func (restore *MongoRestore) Restore() error {
 		return fmt.Errorf("error scanning filesystem: %v", err)
 	}
 
+	// the collections of an archive were counted from its prelude
+	if restore.InputOptions.Archive == "" {
+		if err = restore.checkMaxIntents(restore.manager); err != nil {
+			return err
+		}
+	}
+
 	if restore.isMongos && restore.manager.HasConfigDBIntent() && restore.ToolOptions.DB == "" {
 		return fmt.Errorf("cannot do a full restore on a sharded system - " +
 			"remove the 'config' directory from the dump directory first")
 	}
 
+	if err = restore.checkCaseCollisions(); err != nil {
+		return err
+	}
+
+	if err = restore.checkEmptyCluster(); err != nil {
+		return err
+	}
+
+	if err = restore.checkNamespaceLengths(); err != nil {
+		return err
+	}
+
+	if restore.OutputOptions.PermissionCheck {
+		return restore.checkPermissions()
+	}
+
+	if restore.OutputOptions.DatabasesOnly {
+		return createDatabases(restore.SessionProvider, restore.dumpedDatabases())
+	}
+
+	if restore.OutputOptions.EmitPlan != "" {
+		plan, err := restore.buildRestorePlan()
+		if err != nil {
+			return fmt.Errorf("error building restore plan: %v", err)
+		}
+		return plan.WriteDOT(os.Stdout)
+	}
+
+	restore.metrics = newRestoreMetrics(restore.totalRestoreSize())
+	if restore.OutputOptions.MetricsSocket != "" {
+		stop, err := serveMetrics(restore.OutputOptions.MetricsSocket, restore.metrics)
+		if err != nil {
+			return fmt.Errorf("error creating metrics socket: %v", err)
+		}
+		defer stop()
+	}
+
+	if restore.OutputOptions.SkippedTo != "" {
+		restore.skipped, err = newSkippedFile(restore.OutputOptions.SkippedTo)
+		if err != nil {
+			return err
+		}
+		defer restore.skipped.close()
+	}
+
 	if restore.InputOptions.Archive != "" {
 		namespaceChan := make(chan string, 1)
 		namespaceErrorChan := make(chan error)
@@ -349,14 +1145,30 @@ func (restore *MongoRestore) Restore() error {
 		return fmt.Errorf("restore error: %v", err)
 	}
 
+	err = restore.LoadIDMaps()
+	if err != nil {
+		return fmt.Errorf("restore error: %v", err)
+	}
+
 	// Restore the regular collections
+	var shardOf map[string]string
+	if restore.OutputOptions.MaxCollectionsPerShard > 0 {
+		shardOf, err = restore.GetShardTopology()
+		if err != nil {
+			return err
+		}
+	}
+
 	if restore.InputOptions.Archive != "" {
 		restore.manager.UsePrioritizer(restore.archive.Demux.NewPrioritizer(restore.manager))
 	} else if restore.OutputOptions.NumParallelCollections > 1 {
-		restore.manager.Finalize(intents.MultiDatabaseLTF)
+		restore.finalizeIntents(intents.MultiDatabaseLTF)
 	} else {
 		// use legacy restoration order if we are single-threaded
-		restore.manager.Finalize(intents.Legacy)
+		restore.finalizeIntents(intents.Legacy)
+	}
+	if shardOf != nil {
+		restore.shardLimiter = newShardLimiter(restore.manager, shardOf, restore.OutputOptions.MaxCollectionsPerShard)
 	}
 
 	restore.termChan = make(chan struct{})
@@ -365,6 +1177,41 @@ func (restore *MongoRestore) Restore() error {
 	if err := restore.RestoreIntents(); err != nil {
 		return err
 	}
+	restore.logTimingSummary()
+
+	if restore.OutputOptions.VerifyReport != "" {
+		err = restore.WriteVerifyReport(restore.OutputOptions.VerifyReport)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(restore.refChecks) > 0 {
+		if _, err = restore.CheckRefs(); err != nil {
+			return err
+		}
+	}
+
+	if restore.OutputOptions.DeferUniqueIndexes != "" {
+		err = restore.WriteDeferredIndexScript(restore.OutputOptions.DeferUniqueIndexes)
+		if err != nil {
+			return err
+		}
+	}
+
+	if restore.renumberNamespaces != nil {
+		err = restore.WriteRenumberedIds(restore.OutputOptions.RenumberIdsMap)
+		if err != nil {
+			return err
+		}
+	}
+
+	if restore.seenIds != nil {
+		err = restore.saveSeenIds(restore.OutputOptions.SeenIdsBloom)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Restore users/roles
 	if restore.ShouldRestoreUsersAndRoles() {
@@ -390,6 +1237,15 @@ func (restore *MongoRestore) Restore() error {
 		}
 	}
 
+	if err = restore.archiveTee.finish(); err != nil {
+		return err
+	}
+
+	if err = restore.skipped.close(); err != nil {
+		return err
+	}
+
+	restore.logCausalTime()
 	log.Log(log.Always, "done")
 	return nil
 }
@@ -407,15 +1263,99 @@ func (wrc *wrappedReadCloser) Close() error {
 	return wrc.inner.Close()
 }
 
+// multiReadCloser reads from each of its volumes in turn, like io.MultiReader,
+// and closes all of the volumes when it is closed.
+type multiReadCloser struct {
+	io.Reader
+	volumes []io.ReadCloser
+}
+
+func (mrc *multiReadCloser) Close() error {
+	var firstErr error
+	for _, volume := range mrc.volumes {
+		if err := volume.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// byVolumeNumber sorts the paths of archive volumes by the number they end in,
+// so that dump.archive.2 comes before dump.archive.10, and otherwise lexically.
+type byVolumeNumber []string
+
+func (paths byVolumeNumber) Len() int      { return len(paths) }
+func (paths byVolumeNumber) Swap(i, j int) { paths[i], paths[j] = paths[j], paths[i] }
+func (paths byVolumeNumber) Less(i, j int) bool {
+	prefixI, numberI := splitVolumeNumber(paths[i])
+	prefixJ, numberJ := splitVolumeNumber(paths[j])
+	if prefixI != prefixJ || numberI == "" || numberJ == "" {
+		return paths[i] < paths[j]
+	}
+	// numbers of any length compare by their digits once their zero padding is
+	// trimmed
+	numberI, numberJ = strings.TrimLeft(numberI, "0"), strings.TrimLeft(numberJ, "0")
+	if len(numberI) != len(numberJ) {
+		return len(numberI) < len(numberJ)
+	}
+	if numberI != numberJ {
+		return numberI < numberJ
+	}
+	return paths[i] < paths[j]
+}
+
+// splitVolumeNumber splits path into the digits it ends in, if any, and the rest.
+func splitVolumeNumber(path string) (string, string) {
+	i := len(path)
+	for i > 0 && path[i-1] >= '0' && path[i-1] <= '9' {
+		i--
+	}
+	return path[:i], path[i:]
+}
+
+// openArchiveVolumes opens all of the files matching pattern, in the order of
+// their volume numbers, as one logical archive. This supports archives split in
+// to numbered volumes, such as dump.archive.001, dump.archive.002, etc., or
+// dump.archive.1 to dump.archive.10 without zero padding. BSON documents and
+// blocks may straddle volume boundaries.
+func openArchiveVolumes(pattern string) (io.ReadCloser, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no archive volumes match '%v'", pattern)
+	}
+	sort.Sort(byVolumeNumber(paths))
+	mrc := &multiReadCloser{}
+	readers := make([]io.Reader, 0, len(paths))
+	for _, path := range paths {
+		log.Logf(log.DebugLow, "reading archive volume %v", path)
+		volume, err := os.Open(path)
+		if err != nil {
+			mrc.Close()
+			return nil, err
+		}
+		mrc.volumes = append(mrc.volumes, volume)
+		readers = append(readers, volume)
+	}
+	mrc.Reader = io.MultiReader(readers...)
+	return mrc, nil
+}
+
 func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 	if restore.InputOptions.Archive == "-" {
 		rc = ioutil.NopCloser(restore.stdin)
 	} else {
 		targetStat, err := os.Stat(restore.InputOptions.Archive)
-		if err != nil {
+		if os.IsNotExist(err) && strings.ContainsAny(restore.InputOptions.Archive, "*?[") {
+			rc, err = openArchiveVolumes(restore.InputOptions.Archive)
+			if err != nil {
+				return nil, err
+			}
+		} else if err != nil {
 			return nil, err
-		}
-		if targetStat.IsDir() {
+		} else if targetStat.IsDir() {
 			defaultArchiveFilePath := filepath.Join(restore.InputOptions.Archive, "archive")
 			if restore.InputOptions.Gzip {
 				defaultArchiveFilePath = defaultArchiveFilePath + ".gz"
@@ -431,6 +1371,14 @@ func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 			}
 		}
 	}
+	if restore.InputOptions.TeeArchive != "" {
+		// copy the archive as it was given, before it is decompressed
+		restore.archiveTee, err = newArchiveTee(rc, restore.InputOptions.TeeArchive)
+		if err != nil {
+			return nil, err
+		}
+		rc = restore.archiveTee
+	}
 	if restore.InputOptions.Gzip {
 		gzrc, err := gzip.NewReader(rc)
 		if err != nil {
@@ -1,13 +1,22 @@
 package mongorestore
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/archive"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -84,5 +93,238 @@ func TestMongorestore(t *testing.T) {
 			So(count, ShouldEqual, 100)
 		})
 
+		Convey("and --ignoreMetadataFor restores the data without options or indexes", func() {
+			restore.TargetDirectory = "testdata/testdirs"
+			restore.OutputOptions.IgnoreMetadataFor = []string{"db1.c1"}
+			err = restore.Restore()
+			restore.OutputOptions.IgnoreMetadataFor = nil
+			So(err, ShouldBeNil)
+			count, err := c1.Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 100)
+			indexes, err := c1.Indexes()
+			So(err, ShouldBeNil)
+			So(len(indexes), ShouldEqual, 1)
+			So(indexes[0].Name, ShouldEqual, "_id_")
+		})
+
+		Convey("and a --manifest restores a base archive and then an incremental one", func() {
+			dir, err := ioutil.TempDir("", "mongorestore_manifest")
+			So(err, ShouldBeNil)
+			Reset(func() {
+				os.RemoveAll(dir)
+			})
+			// the incremental archive repeats the _ids of the base, and adds five more
+			for name, count := range map[string]int{"base.archive": 10, "incr.archive": 15} {
+				buf := &closingBuffer{}
+				So(writeTestArchive(buf, count,
+					&intents.Intent{DB: "db1", C: "c1", BSONPath: "db1/c1.bson"}), ShouldBeNil)
+				So(ioutil.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644), ShouldBeNil)
+			}
+			manifest := `{"archives": [` +
+				`{"archive": "incr.archive", "order": 1},` +
+				`{"archive": "base.archive", "order": 0, "drop": true}]}`
+			So(ioutil.WriteFile(filepath.Join(dir, "restore.json"), []byte(manifest), 0644), ShouldBeNil)
+
+			// only the base archive drops the collection, removing this document
+			So(c1.Insert(bson.M{"_id": "stale"}), ShouldBeNil)
+			restore.InputOptions = &InputOptions{Manifest: filepath.Join(dir, "restore.json")}
+			err = restore.Restore()
+			restore.InputOptions = inputOptions
+			So(err, ShouldBeNil)
+			count, err := c1.Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 15)
+			count, err = c1.FindId("stale").Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
+		Convey("and --deterministicBatching inserts in the order of the dump on every run", func() {
+			batchingOptions := *outputOptions
+			batchingOptions.NumInsertionWorkers = 4
+			batchingOptions.DeterministicBatching = true
+			restore.OutputOptions = &batchingOptions
+			restore.progressManager = progress.NewProgressBarManager(ioutil.Discard, progressBarWaitTime)
+			docs := []bson.D{}
+			for i := 0; i < 100; i++ {
+				docs = append(docs, bson.D{{"_id", i}})
+			}
+			for run := 0; run < 2; run++ {
+				c1.DropCollection()
+				count, err := restore.RestoreCollectionToDB("db1", "c1", bsonSourceOf(docs...), 0, nil)
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 100)
+				restored := []bson.D{}
+				So(c1.Find(nil).Sort("$natural").All(&restored), ShouldBeNil)
+				So(restored, ShouldResemble, docs)
+			}
+		})
+
+		Convey("and --logEveryDocs logs the checkpoints of the documents the workers inserted", func() {
+			logged := &bytes.Buffer{}
+			log.SetWriter(logged)
+			defer log.SetWriter(os.Stderr)
+			checkpointOptions := *outputOptions
+			checkpointOptions.NumInsertionWorkers = 4
+			checkpointOptions.LogEveryDocs = 10
+			restore.OutputOptions = &checkpointOptions
+			restore.progressManager = progress.NewProgressBarManager(ioutil.Discard, progressBarWaitTime)
+			docs := []bson.D{}
+			for i := 0; i < 25; i++ {
+				docs = append(docs, bson.D{{"_id", i}})
+			}
+			count, err := restore.RestoreCollectionToDB("db1", "c1", bsonSourceOf(docs...), 0, nil)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 25)
+			So(logged.String(), ShouldContainSubstring, "checkpoint: 10 documents inserted in to db1.c1")
+			So(logged.String(), ShouldContainSubstring, "checkpoint: 20 documents inserted in to db1.c1")
+			So(logged.String(), ShouldNotContainSubstring, "checkpoint: 30")
+		})
+
+		Convey("and --metadataReadPreference is used for the reads that check the target", func() {
+			recording := &recordingSessions{sessionGetter: provider}
+			restore.sessions = recording
+			restore.setMetadataReadMode, err = parseMetadataReadPreference("secondaryPreferred")
+			So(err, ShouldBeNil)
+			restore.knownCollections = map[string][]string{}
+			restore.progressManager = progress.NewProgressBarManager(ioutil.Discard, progressBarWaitTime)
+			path := "testdata/testdirs/db1/c1.bson"
+			intent := &intents.Intent{DB: "db1", C: "c1", BSONPath: path, Location: path}
+			intent.BSONFile = &realBSONFile{intent: intent}
+			So(restore.RestoreIntent(intent), ShouldBeNil)
+
+			So(len(recording.sessions), ShouldBeGreaterThan, 0)
+			for _, session := range recording.sessions {
+				So(session.Mode(), ShouldEqual, mgo.Monotonic)
+			}
+			// while the documents were still inserted on the primary
+			count, err := c1.Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 100)
+		})
+
+	})
+}
+
+type closingBuffer struct {
+	bytes.Buffer
+}
+
+func (*closingBuffer) Close() error {
+	return nil
+}
+
+// writeTestArchive writes an archive to buf with the given collections, one after
+// the other, each containing count documents
+func writeTestArchive(buf *closingBuffer, count int, collections ...*intents.Intent) error {
+	manager := intents.NewIntentManager()
+	for _, intent := range collections {
+		manager.Put(intent)
+	}
+	prelude, err := archive.NewPrelude(manager, 1, "")
+	if err != nil {
+		return err
+	}
+	if err = prelude.Write(buf); err != nil {
+		return err
+	}
+	mux := archive.NewMultiplexer(buf)
+	go mux.Run()
+	for _, intent := range collections {
+		muxIn := &archive.MuxIn{Intent: intent, Mux: mux}
+		if err = muxIn.Open(); err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			doc, err := bson.Marshal(bson.M{"_id": i})
+			if err != nil {
+				return err
+			}
+			if _, err = muxIn.Write(doc); err != nil {
+				return err
+			}
+		}
+		if err = muxIn.Close(); err != nil {
+			return err
+		}
+	}
+	close(mux.Control)
+	return <-mux.Completed
+}
+
+func TestArchiveVolumes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive split in to two volumes at an arbitrary byte", t, func() {
+		intent := &intents.Intent{DB: "db1", C: "c1", BSONPath: "db1/c1.bson"}
+		buf := &closingBuffer{}
+		So(writeTestArchive(buf, 100, intent), ShouldBeNil)
+		data := buf.Bytes()
+
+		dir, err := ioutil.TempDir("", "mongorestore_volumes")
+		So(err, ShouldBeNil)
+		split := len(data)/2 + 3
+		So(ioutil.WriteFile(filepath.Join(dir, "dump.archive.001"), data[:split], 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "dump.archive.002"), data[split:], 0644), ShouldBeNil)
+
+		restore := &MongoRestore{
+			InputOptions: &InputOptions{Archive: filepath.Join(dir, "dump.archive.*")},
+		}
+
+		readVolumes := func() int {
+			in, err := restore.getArchiveReader()
+			So(err, ShouldBeNil)
+			defer in.Close()
+
+			prelude := &archive.Prelude{}
+			So(prelude.Read(in), ShouldBeNil)
+			So(len(prelude.NamespaceMetadatas), ShouldEqual, 1)
+
+			demux := &archive.Demultiplexer{In: in}
+			receiver := &archive.RegularCollectionReceiver{Intent: intent, Demux: demux}
+			So(receiver.Open(), ShouldBeNil)
+			countChan := make(chan int)
+			go func() {
+				bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(receiver))
+				count := 0
+				for bsonSource.Next(&bson.D{}) {
+					count++
+				}
+				countChan <- count
+			}()
+			So(demux.Run(), ShouldBeNil)
+			return <-countChan
+		}
+
+		Convey("the volumes should be read back as a single archive", func() {
+			So(readVolumes(), ShouldEqual, 100)
+		})
+
+		Convey("volumes numbered without zero padding should be read back in numeric order", func() {
+			volumes := 12
+			size := len(data)/volumes + 1
+			for i := 0; i < volumes; i++ {
+				end := (i + 1) * size
+				if end > len(data) {
+					end = len(data)
+				}
+				path := filepath.Join(dir, fmt.Sprintf("unpadded.archive.%v", i+1))
+				So(ioutil.WriteFile(path, data[i*size:end], 0644), ShouldBeNil)
+			}
+			restore.InputOptions.Archive = filepath.Join(dir, "unpadded.archive.*")
+			So(readVolumes(), ShouldEqual, 100)
+		})
+
+		Convey("a pattern matching no volumes should be an error", func() {
+			restore.InputOptions.Archive = filepath.Join(dir, "other.archive.*")
+			_, err := restore.getArchiveReader()
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
 	})
 }
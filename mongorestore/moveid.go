@@ -0,0 +1,65 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// validateTopLevelField checks that the argument to --moveIdTo or --hashField is
+// a top level field other than the _id.
+func validateTopLevelField(field string) error {
+	if field == "_id" || strings.HasPrefix(field, "$") || strings.Contains(field, ".") {
+		return fmt.Errorf("'%v' is not a top level field other than _id", field)
+	}
+	return nil
+}
+
+// getMoveIdTransform returns the transform that moves the _ids of the intent's
+// documents to the --moveIdTo field, or nil without --moveIdTo. Collections whose
+// _ids are rewritten by --rewriteRefs keep their _ids for the rewrite to replace,
+// so that references to them still match.
+func (restore *MongoRestore) getMoveIdTransform(intent *intents.Intent) documentTransform {
+	if restore.OutputOptions.MoveIdTo == "" {
+		return nil
+	}
+	var next func() bson.ObjectId
+	if _, ok := restore.idMaps[intent.Namespace()]; !ok {
+		next = restore.newObjectIds(intent.Namespace())
+	}
+	return moveIdTo(restore.OutputOptions.MoveIdTo, next)
+}
+
+// moveIdTo creates a documentTransform that copies the _id of each document to
+// the field, giving it a new ObjectId _id from next in its place, or leaving the
+// _id as it is if next is nil. Documents that already have the field are an
+// error, rather than have its value lost.
+func moveIdTo(field string, next func() bson.ObjectId) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		idIndex := -1
+		for i, elem := range doc {
+			switch elem.Name {
+			case field:
+				return nil, fmt.Errorf("document with _id %v already has a field %v to move its _id to",
+					doc.Map()["_id"], field)
+			case "_id":
+				idIndex = i
+			}
+		}
+		if idIndex < 0 {
+			// the server will assign the document an _id anyway
+			return raw, nil
+		}
+		doc = append(doc, bson.DocElem{field, doc[idIndex].Value})
+		if next != nil {
+			doc[idIndex].Value = next()
+		}
+		return bson.Marshal(doc)
+	}
+}
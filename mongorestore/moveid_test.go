@@ -0,0 +1,78 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestMoveIdTo(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --moveIdTo set to legacyId", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{MoveIdTo: "legacyId"}}
+		intent := &intents.Intent{DB: "db1", C: "events"}
+		transform, err := restore.getDocumentTransform(intent)
+		So(err, ShouldBeNil)
+
+		moved := func(doc bson.D) bson.D {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			out, err := transform(raw)
+			So(err, ShouldBeNil)
+			result := bson.D{}
+			So(bson.Unmarshal(out, &result), ShouldBeNil)
+			return result
+		}
+
+		Convey("the original _id should land in the field and a new _id be assigned", func() {
+			original := bson.NewObjectId()
+			doc := moved(bson.D{{"_id", original}, {"type", "click"}})
+			So(len(doc), ShouldEqual, 3)
+			So(doc[0].Name, ShouldEqual, "_id")
+			So(doc[0].Value, ShouldHaveSameTypeAs, bson.ObjectId(""))
+			So(doc[0].Value, ShouldNotEqual, original)
+			So(doc[1], ShouldResemble, bson.DocElem{"type", "click"})
+			So(doc[2], ShouldResemble, bson.DocElem{"legacyId", original})
+		})
+
+		Convey("_ids that aren't ObjectIds should be moved too", func() {
+			first := moved(bson.D{{"_id", "evt-1"}})
+			second := moved(bson.D{{"_id", "evt-2"}})
+			So(first[1], ShouldResemble, bson.DocElem{"legacyId", "evt-1"})
+			So(second[1], ShouldResemble, bson.DocElem{"legacyId", "evt-2"})
+			So(first[0].Value, ShouldNotEqual, second[0].Value)
+		})
+
+		Convey("a document already holding the field should be an error", func() {
+			raw, err := bson.Marshal(bson.D{{"_id", 1}, {"legacyId", 7}})
+			So(err, ShouldBeNil)
+			_, err = transform(raw)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("With --moveIdTo and --deterministicIds, the new _ids should be deterministic", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{MoveIdTo: "legacyId", DeterministicIds: "seed"}}
+		transform, err := restore.getDocumentTransform(&intents.Intent{DB: "db1", C: "events"})
+		So(err, ShouldBeNil)
+		raw, err := bson.Marshal(bson.D{{"_id", 1}})
+		So(err, ShouldBeNil)
+		out, err := transform(raw)
+		So(err, ShouldBeNil)
+		doc := bson.D{}
+		So(bson.Unmarshal(out, &doc), ShouldBeNil)
+		So(doc[0].Value, ShouldEqual, deterministicObjectIds("seed", "db1.events")())
+		So(doc[1], ShouldResemble, bson.DocElem{"legacyId", 1})
+	})
+
+	Convey("--moveIdTo should only take a top level field other than _id", t, func() {
+		So(validateTopLevelField("legacyId"), ShouldBeNil)
+		So(validateTopLevelField("_id"), ShouldNotBeNil)
+		So(validateTopLevelField("a.b"), ShouldNotBeNil)
+		So(validateTopLevelField("$id"), ShouldNotBeNil)
+	})
+}
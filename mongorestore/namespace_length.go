@@ -0,0 +1,78 @@
+package mongorestore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Limits of the lengths of names, in bytes. MongoDB 4.4 raised the limit of the
+// full namespace of a collection from 120 bytes to 255, and database names are
+// limited to 63 bytes by all versions.
+const (
+	maxNamespaceLength       = 255
+	maxNamespaceLengthBefore = 120
+	maxDBNameLength          = 63
+	longNamespaceWireVersion = 9
+)
+
+// namespaceLengthLimit returns the longest full namespace of a collection that
+// the target allows.
+func (restore *MongoRestore) namespaceLengthLimit() (int, error) {
+	isMaster := struct {
+		MaxWire int `bson:"maxWireVersion"`
+	}{}
+	err := restore.getRunner().Run("isMaster", &isMaster, "admin")
+	if err != nil {
+		return 0, fmt.Errorf("error checking the target's namespace length limit: %v", err)
+	}
+	if isMaster.MaxWire < longNamespaceWireVersion {
+		return maxNamespaceLengthBefore, nil
+	}
+	return maxNamespaceLength, nil
+}
+
+// targetNamespaces returns the namespaces that the restore inserts in to, as they
+// are named after --stripPrefix and with the child collections of --spillArray.
+func (restore *MongoRestore) targetNamespaces() []string {
+	namespaces := []string{}
+	for _, intent := range restore.manager.Intents() {
+		if intent.DB == "" || intent.IsSpecialCollection() {
+			continue
+		}
+		namespaces = append(namespaces, intent.Namespace())
+		if spill, ok := restore.spillArrays[intent.Namespace()]; ok {
+			namespaces = append(namespaces, intent.DB+"."+spill.child)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// checkNamespaceLengths returns an error naming each namespace to restore whose
+// database name or full name is longer than the target allows, before anything
+// is restored, rather than having the server refuse them part way through.
+func (restore *MongoRestore) checkNamespaceLengths() error {
+	if restore.DocumentSink != nil {
+		return nil
+	}
+	limit, err := restore.namespaceLengthLimit()
+	if err != nil {
+		return err
+	}
+	tooLong := []string{}
+	for _, ns := range restore.targetNamespaces() {
+		dbName := ns[:strings.Index(ns, ".")]
+		switch {
+		case len(dbName) > maxDBNameLength:
+			tooLong = append(tooLong, fmt.Sprintf("%v (database name of %v bytes, max %v)",
+				ns, len(dbName), maxDBNameLength))
+		case len(ns) > limit:
+			tooLong = append(tooLong, fmt.Sprintf("%v (%v bytes, max %v)", ns, len(ns), limit))
+		}
+	}
+	if len(tooLong) > 0 {
+		return fmt.Errorf("namespaces too long for the target: %v", strings.Join(tooLong, "; "))
+	}
+	return nil
+}
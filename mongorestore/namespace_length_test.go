@@ -0,0 +1,54 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"testing"
+)
+
+func TestCheckNamespaceLengths(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With collections to restore to a server older than 4.4", t, func() {
+		runner := &isMasterRunner{reply: bson.M{"ok": 1, "maxWireVersion": 8}}
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{},
+			manager:       intents.NewIntentManager(),
+			runner:        runner,
+		}
+		restore.manager.Put(&intents.Intent{DB: "db1", C: "events", BSONPath: "db1/events.bson"})
+		restore.manager.Put(&intents.Intent{DB: "db1", C: "users", BSONPath: "db1/users.bson"})
+
+		Convey("names within the limit should pass", func() {
+			So(restore.checkNamespaceLengths(), ShouldBeNil)
+		})
+
+		Convey("a remap to an over-length namespace should fail before restoring", func() {
+			child := strings.Repeat("c", 120)
+			spill, err := parseSpillArray("db1.events:items->" + child)
+			So(err, ShouldBeNil)
+			restore.spillArrays = map[string]*spillArray{spill.ns: spill}
+			err = restore.checkNamespaceLengths()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "db1."+child+" (124 bytes, max 120)")
+			So(err.Error(), ShouldNotContainSubstring, "db1.events")
+
+			Convey("but fit on 4.4 and later", func() {
+				runner.reply["maxWireVersion"] = 9
+				So(restore.checkNamespaceLengths(), ShouldBeNil)
+			})
+		})
+
+		Convey("an over-length database name should fail", func() {
+			dbName := strings.Repeat("d", 64)
+			restore.manager.Put(&intents.Intent{DB: dbName, C: "c1", BSONPath: dbName + "/c1.bson"})
+			err := restore.checkNamespaceLengths()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, dbName+".c1 (database name of 64 bytes, max 63)")
+		})
+	})
+}
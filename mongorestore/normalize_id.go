@@ -0,0 +1,133 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// Types of --normalizeIdType.
+const (
+	idTypeString   = "string"
+	idTypeObjectId = "objectid"
+)
+
+// Resolutions of --idCollisions.
+const (
+	idCollisionsError   = "error"
+	idCollisionsSkip    = "skip"
+	idCollisionsReplace = "replace"
+)
+
+// duplicateKeyCode is the code of the write errors of documents whose key is
+// already in a unique index.
+const duplicateKeyCode = 11000
+
+// normalizeId returns the _id as the given type: an ObjectId as its hex string
+// for "string", and a string of 24 hex digits as the ObjectId it names for
+// "objectid". Hex strings are lowercased by both, so that they compare equal to
+// the hex of ObjectIds. It returns false if the _id can't be of the type.
+func normalizeId(id interface{}, idType string) (interface{}, bool) {
+	switch v := id.(type) {
+	case bson.ObjectId:
+		if idType == idTypeString {
+			return v.Hex(), true
+		}
+		return v, true
+	case string:
+		if !bson.IsObjectIdHex(v) {
+			return v, idType == idTypeString
+		}
+		if idType == idTypeString {
+			return strings.ToLower(v), true
+		}
+		return bson.ObjectIdHex(v), true
+	}
+	return id, false
+}
+
+// normalizeIdType creates a documentTransform that converts the _id of each
+// document between ObjectIds and their hex strings, as normalizeId does, so that
+// documents from dumps that key the same entities by different types get the
+// same _ids. The first _id of the namespace that can't be converted is logged,
+// and all of them are left as they are.
+func normalizeIdType(ns, idType string) documentTransform {
+	logged := false
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		for i, elem := range doc {
+			if elem.Name != "_id" {
+				continue
+			}
+			id, ok := normalizeId(elem.Value, idType)
+			if !ok {
+				if !logged {
+					logged = true
+					log.Logf(log.Always, "warning: leaving _ids of %v that can't be made a %v as they are, such as %#v",
+						ns, idType, elem.Value)
+				}
+				return raw, nil
+			}
+			if id == elem.Value {
+				return raw, nil
+			}
+			doc[i].Value = id
+			return bson.Marshal(doc)
+		}
+		return raw, nil
+	}
+}
+
+// skipDuplicateIds returns the error of inserting into the namespace without
+// the documents refused because their _id was already in the collection, with
+// --idCollisions=skip, counting them instead. It returns nil if those were all
+// of the documents refused.
+func (restore *MongoRestore) skipDuplicateIds(ns string, err error) error {
+	failures, ok := err.(*db.WriteFailures)
+	if !ok || restore.OutputOptions.IdCollisions != idCollisionsSkip {
+		return err
+	}
+	remaining := []db.WriteFailure{}
+	for _, failure := range failures.Failures {
+		if failure.Code != duplicateKeyCode || !isIdIndexDuplicate(failure.ErrMsg) {
+			remaining = append(remaining, failure)
+		}
+	}
+	if skipped := len(failures.Failures) - len(remaining); skipped > 0 {
+		restore.writeFailuresMutex.Lock()
+		if restore.duplicateIdsSkipped == nil {
+			restore.duplicateIdsSkipped = map[string]int64{}
+		}
+		restore.duplicateIdsSkipped[ns] += int64(skipped)
+		restore.writeFailuresMutex.Unlock()
+	}
+	if len(remaining) == 0 {
+		return nil
+	}
+	return &db.WriteFailures{Failures: remaining}
+}
+
+// isIdIndexDuplicate returns whether a duplicate key error's message names the
+// _id index, rather than another unique index whose name contains "_id_", such
+// as user_id_1.
+func isIdIndexDuplicate(errMsg string) bool {
+	return strings.Contains(errMsg, "index: _id_ ") || strings.HasSuffix(errMsg, "index: _id_")
+}
+
+// logDuplicateIdsSkipped logs how many documents of the namespace were skipped by
+// --idCollisions=skip.
+func (restore *MongoRestore) logDuplicateIdsSkipped(ns string) {
+	restore.writeFailuresMutex.Lock()
+	skipped := restore.duplicateIdsSkipped[ns]
+	restore.writeFailuresMutex.Unlock()
+	if skipped > 0 {
+		log.Logf(log.Always, "skipped %v %v of %v whose _ids were already in the collection",
+			skipped, util.Pluralize(int(skipped), "document", "documents"), ns)
+	}
+}
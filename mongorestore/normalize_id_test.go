@@ -0,0 +1,113 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestNormalizeIdType(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	// dump A keys entities by hex strings, some uppercase, and dump B by ObjectIds
+	oid1, oid2, oid3 := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	dumpA := []bson.D{
+		{{"_id", oid1.Hex()}, {"from", "a"}},
+		{{"_id", "5A0B2C3D4E5F6A7B8C9D0E1F"}, {"from", "a"}},
+		{{"_id", oid2.Hex()}, {"from", "a"}},
+	}
+	dumpB := []bson.D{
+		{{"_id", oid1}, {"from", "b"}},
+		{{"_id", bson.ObjectIdHex("5a0b2c3d4e5f6a7b8c9d0e1f")}, {"from", "b"}},
+		{{"_id", oid3}, {"from", "b"}},
+	}
+
+	mergedIds := func(idType string) map[interface{}]int {
+		transform := normalizeIdType("db1.c1", idType)
+		ids := map[interface{}]int{}
+		for _, doc := range append(append([]bson.D{}, dumpA...), dumpB...) {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			raw, err = transform(raw)
+			So(err, ShouldBeNil)
+			out := bson.M{}
+			So(bson.Unmarshal(raw, &out), ShouldBeNil)
+			ids[out["_id"]]++
+		}
+		return ids
+	}
+
+	Convey("With --normalizeIdType, the same entity gets the same _id in both dumps", t, func() {
+		Convey("as strings", func() {
+			ids := mergedIds(idTypeString)
+			So(len(ids), ShouldEqual, 4)
+			So(ids[oid1.Hex()], ShouldEqual, 2)
+			So(ids["5a0b2c3d4e5f6a7b8c9d0e1f"], ShouldEqual, 2)
+			So(ids[oid2.Hex()], ShouldEqual, 1)
+			So(ids[oid3.Hex()], ShouldEqual, 1)
+		})
+		Convey("as ObjectIds", func() {
+			ids := mergedIds(idTypeObjectId)
+			So(len(ids), ShouldEqual, 4)
+			So(ids[oid1], ShouldEqual, 2)
+			So(ids[bson.ObjectIdHex("5a0b2c3d4e5f6a7b8c9d0e1f")], ShouldEqual, 2)
+		})
+	})
+
+	Convey("_ids that can't be converted are left as they are", t, func() {
+		transform := normalizeIdType("db1.c1", idTypeObjectId)
+		for _, id := range []interface{}{"not hex", 7, bson.D{{"a", 1}}} {
+			raw, err := bson.Marshal(bson.D{{"_id", id}})
+			So(err, ShouldBeNil)
+			out, err := transform(raw)
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, raw)
+		}
+	})
+}
+
+func TestSkipDuplicateIds(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	failures := func() error {
+		return &db.WriteFailures{Failures: []db.WriteFailure{
+			{Index: 0, Code: duplicateKeyCode, ErrMsg: "E11000 duplicate key error collection: db1.c1 index: _id_ dup key: { : 1 }"},
+			{Index: 1, Code: duplicateKeyCode, ErrMsg: "E11000 duplicate key error collection: db1.c1 index: email_1 dup key: { : \"x\" }"},
+			{Index: 2, Code: duplicateKeyCode, ErrMsg: "E11000 duplicate key error collection: db1.c1 index: _id_ dup key: { : 3 }"},
+			{Index: 3, Code: duplicateKeyCode, ErrMsg: "E11000 duplicate key error collection: db1.c1 index: user_id_1 dup key: { : 4 }"},
+		}}
+	}
+
+	Convey("With --idCollisions=skip", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{IdCollisions: idCollisionsSkip}}
+
+		Convey("documents whose _ids were already there are dropped from the error and counted", func() {
+			err := restore.skipDuplicateIds("db1.c1", failures())
+			So(err, ShouldNotBeNil)
+			remaining := err.(*db.WriteFailures).Failures
+			So(len(remaining), ShouldEqual, 2)
+			So(remaining[0].Index, ShouldEqual, 1)
+			So(remaining[1].Index, ShouldEqual, 3)
+			So(restore.duplicateIdsSkipped["db1.c1"], ShouldEqual, 2)
+		})
+
+		Convey("the error is nil when they were all of the failures", func() {
+			err := restore.skipDuplicateIds("db1.c1", &db.WriteFailures{Failures: []db.WriteFailure{
+				{Code: duplicateKeyCode, ErrMsg: "E11000 duplicate key error index: _id_"},
+			}})
+			So(err, ShouldBeNil)
+			So(restore.duplicateIdsSkipped["db1.c1"], ShouldEqual, 1)
+		})
+	})
+
+	Convey("With --idCollisions=error, the failures are kept", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{IdCollisions: idCollisionsError}}
+		err := restore.skipDuplicateIds("db1.c1", failures())
+		So(len(err.(*db.WriteFailures).Failures), ShouldEqual, 4)
+		So(restore.duplicateIdsSkipped, ShouldBeNil)
+	})
+}
@@ -0,0 +1,109 @@
+package mongorestore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+)
+
+// the smallest possible BSON document, {}, is 5 bytes long
+const minBSONSize = 5
+
+// findDocumentBoundary returns the offset of the first valid BSON document in
+// the input at or after offset, for resuming a read of a partially corrupt file.
+// A candidate document must have a plausible length, be terminated by a null byte
+// and unmarshal without error, and must be followed either by the end of the input
+// or by the plausible length of another document. It returns size if there are no
+// valid documents left.
+func findDocumentBoundary(in io.ReaderAt, offset, size int64) (int64, error) {
+	header := make([]byte, 4)
+	for ; offset+minBSONSize <= size; offset++ {
+		docSize, err := readDocumentSize(in, offset, header)
+		if err != nil {
+			return 0, err
+		}
+		if docSize < minBSONSize || docSize > db.MaxBSONSize || offset+docSize > size {
+			continue
+		}
+		doc := make([]byte, docSize)
+		if _, err := in.ReadAt(doc, offset); err != nil {
+			return 0, err
+		}
+		if doc[docSize-1] != 0 || bson.Unmarshal(doc, &bson.D{}) != nil {
+			continue
+		}
+		next := offset + docSize
+		if next == size {
+			return offset, nil
+		}
+		if next+4 <= size {
+			nextSize, err := readDocumentSize(in, next, header)
+			if err != nil {
+				return 0, err
+			}
+			if nextSize >= minBSONSize && nextSize <= db.MaxBSONSize && next+nextSize <= size {
+				return offset, nil
+			}
+		}
+	}
+	return size, nil
+}
+
+// readDocumentSize reads the little endian length of the BSON document at offset.
+func readDocumentSize(in io.ReaderAt, offset int64, header []byte) (int64, error) {
+	if _, err := in.ReadAt(header, offset); err != nil {
+		return 0, fmt.Errorf("error reading at offset %v: %v", offset, err)
+	}
+	return int64(int32(binary.LittleEndian.Uint32(header))), nil
+}
+
+// reverseBSONReader reads the BSON documents of a file back to front, for --reverseOrder.
+type reverseBSONReader struct {
+	file    io.ReaderAt
+	offsets []int64
+	sizes   []int64
+	buf     []byte
+}
+
+// newReverseBSONReader scans the documents of the file between start and end,
+// recording where each one is, so that they can then be read in reverse.
+func newReverseBSONReader(file io.ReaderAt, start, end int64) (*reverseBSONReader, error) {
+	reader := &reverseBSONReader{file: file}
+	header := make([]byte, 4)
+	for offset := start; offset < end; {
+		if offset+4 > end {
+			return nil, fmt.Errorf("truncated document at offset %v", offset)
+		}
+		docSize, err := readDocumentSize(file, offset, header)
+		if err != nil {
+			return nil, err
+		}
+		if docSize < minBSONSize || docSize > db.MaxBSONSize || offset+docSize > end {
+			return nil, fmt.Errorf("invalid document size %v at offset %v", docSize, offset)
+		}
+		reader.offsets = append(reader.offsets, offset)
+		reader.sizes = append(reader.sizes, docSize)
+		offset += docSize
+	}
+	return reader, nil
+}
+
+// Read fills p with the documents of the file, starting from the last one.
+func (reader *reverseBSONReader) Read(p []byte) (int, error) {
+	if len(reader.buf) == 0 {
+		last := len(reader.offsets) - 1
+		if last < 0 {
+			return 0, io.EOF
+		}
+		reader.buf = make([]byte, reader.sizes[last])
+		if _, err := reader.file.ReadAt(reader.buf, reader.offsets[last]); err != nil {
+			return 0, err
+		}
+		reader.offsets, reader.sizes = reader.offsets[:last], reader.sizes[:last]
+	}
+	n := copy(p, reader.buf)
+	reader.buf = reader.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,121 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStartOffset(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a BSON file that has a corrupt prefix", t, func() {
+		garbage := []byte("this region of the file is corrupt")
+		file := &bytes.Buffer{}
+		file.Write(garbage)
+		docStarts := []int64{}
+		for i := 1; i <= 3; i++ {
+			raw, err := bson.Marshal(bson.D{{"_id", i}, {"s", "hello world"}})
+			So(err, ShouldBeNil)
+			docStarts = append(docStarts, int64(file.Len()))
+			file.Write(raw)
+		}
+		data := file.Bytes()
+		size := int64(len(data))
+
+		Convey("an offset in the corrupt region should resync to the first document", func() {
+			boundary, err := findDocumentBoundary(bytes.NewReader(data), 3, size)
+			So(err, ShouldBeNil)
+			So(boundary, ShouldEqual, docStarts[0])
+		})
+
+		Convey("an offset in the middle of a document should resync to the next one", func() {
+			for offset := docStarts[0] + 1; offset < docStarts[1]; offset++ {
+				boundary, err := findDocumentBoundary(bytes.NewReader(data), offset, size)
+				So(err, ShouldBeNil)
+				So(boundary, ShouldEqual, docStarts[1])
+			}
+		})
+
+		Convey("an offset at the start of a document should be kept", func() {
+			boundary, err := findDocumentBoundary(bytes.NewReader(data), docStarts[2], size)
+			So(err, ShouldBeNil)
+			So(boundary, ShouldEqual, docStarts[2])
+		})
+
+		Convey("an offset after the last document should find nothing", func() {
+			boundary, err := findDocumentBoundary(bytes.NewReader(data), docStarts[2]+1, size)
+			So(err, ShouldBeNil)
+			So(boundary, ShouldEqual, size)
+		})
+
+		Convey("restoring the file from an offset should read only the documents after it", func() {
+			dir, err := ioutil.TempDir("", "mongorestore_offset")
+			So(err, ShouldBeNil)
+			Reset(func() {
+				os.RemoveAll(dir)
+			})
+			path := filepath.Join(dir, "c1.bson")
+			So(ioutil.WriteFile(path, data, 0644), ShouldBeNil)
+
+			intent := &intents.Intent{DB: "db1", C: "c1", BSONPath: path}
+			bsonFile := &realBSONFile{intent: intent, startOffset: docStarts[0] + 7}
+			So(bsonFile.Open(), ShouldBeNil)
+			defer bsonFile.Close()
+			source := db.NewDecodedBSONSource(db.NewBSONSource(bsonFile))
+			ids := []int{}
+			doc := struct {
+				ID int `bson:"_id"`
+			}{}
+			for source.Next(&doc) {
+				ids = append(ids, doc.ID)
+			}
+			So(source.Err(), ShouldBeNil)
+			So(ids, ShouldResemble, []int{2, 3})
+		})
+
+		Convey("restoring the file in reverse should insert its documents last to first", func() {
+			dir, err := ioutil.TempDir("", "mongorestore_reverse")
+			So(err, ShouldBeNil)
+			Reset(func() {
+				os.RemoveAll(dir)
+			})
+			path := filepath.Join(dir, "c1.bson")
+			So(ioutil.WriteFile(path, data, 0644), ShouldBeNil)
+
+			// insertedIDs restores the file to a DocumentSink, returning the _ids in insertion order
+			insertedIDs := func(bsonFile *realBSONFile) []interface{} {
+				So(bsonFile.Open(), ShouldBeNil)
+				source := db.NewDecodedBSONSource(db.NewBSONSource(bsonFile))
+				defer source.Close()
+				sink := &bytes.Buffer{}
+				restore := &MongoRestore{DocumentSink: sink}
+				_, err := restore.RestoreCollectionToDB("db1", "c1", source, 0, nil)
+				So(err, ShouldBeNil)
+				return sinkIds(sink)
+			}
+
+			intent := &intents.Intent{DB: "db1", C: "c1", BSONPath: path}
+			So(insertedIDs(&realBSONFile{intent: intent, startOffset: 1, reverse: true}),
+				ShouldResemble, []interface{}{3, 2, 1})
+
+			Convey("after the start offset, if there is one", func() {
+				So(insertedIDs(&realBSONFile{intent: intent, startOffset: docStarts[1], reverse: true}),
+					ShouldResemble, []interface{}{3, 2})
+			})
+		})
+
+		Convey("reading a file with a corrupt document in reverse should fail", func() {
+			_, err := newReverseBSONReader(bytes.NewReader(data), 0, size)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -35,11 +35,10 @@ func (restore *MongoRestore) RestoreOplog() error {
 	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(intent.BSONFile))
 	defer bsonSource.Close()
 
-	entryArray := make([]interface{}, 0, 1024)
 	rawOplogEntry := &bson.Raw{}
 
 	var totalOps int64
-	var entrySize, bufferedBytes int
+	var entrySize int
 
 	oplogProgressor := progress.NewCounter(intent.BSONSize)
 	bar := progress.Bar{
@@ -59,19 +58,18 @@ func (restore *MongoRestore) RestoreOplog() error {
 	}
 	defer session.Close()
 
+	batcher := &oplogBatcher{
+		apply: func(entries []interface{}) error {
+			return restore.ApplyOps(session, entries)
+		},
+		maxOps: restore.InputOptions.OplogApplyBatchSize,
+	}
+
 	// To restore the oplog, we iterate over the oplog entries,
-	// filling up a buffer. Once the buffer reaches max document size,
-	// apply the current buffered ops and reset the buffer.
+	// filling up a batch. Once the batch is full, we apply its
+	// ops and start a new one.
 	for bsonSource.Next(rawOplogEntry) {
 		entrySize = len(rawOplogEntry.Data)
-		if bufferedBytes+entrySize > oplogMaxCommandSize {
-			err = restore.ApplyOps(session, entryArray)
-			if err != nil {
-				return fmt.Errorf("error applying oplog: %v", err)
-			}
-			entryArray = make([]interface{}, 0, 1024)
-			bufferedBytes = 0
-		}
 
 		entryAsOplog := db.Oplog{}
 		err = bson.Unmarshal(rawOplogEntry.Data, &entryAsOplog)
@@ -92,29 +90,76 @@ func (restore *MongoRestore) RestoreOplog() error {
 			break
 		}
 
+		restore.stripOplogEntryPrefix(&entryAsOplog)
+
 		totalOps++
-		bufferedBytes += entrySize
 		oplogProgressor.Inc(int64(entrySize))
-		entryArray = append(entryArray, entryAsOplog)
-	}
-	// finally, flush the remaining entries
-	if len(entryArray) > 0 {
-		err = restore.ApplyOps(session, entryArray)
+		err = batcher.Add(entryAsOplog, entrySize)
 		if err != nil {
 			return fmt.Errorf("error applying oplog: %v", err)
 		}
 	}
+	// finally, flush the remaining entries
+	err = batcher.Flush()
+	if err != nil {
+		return fmt.Errorf("error applying oplog: %v", err)
+	}
 
 	log.Logf(log.Info, "applied %v ops", totalOps)
 	return nil
 
 }
 
+// oplogBatcher groups oplog entries in to the batches applied by each applyOps
+// command. A batch holds at most oplogMaxCommandSize bytes of entries, and, if
+// maxOps is set, at most maxOps entries; with maxOps set, commands are also
+// applied in batches of their own, so that no ops are batched across DDL.
+type oplogBatcher struct {
+	apply  func(entries []interface{}) error
+	maxOps int
+
+	entries       []interface{}
+	bufferedBytes int
+}
+
+// Add adds an entry of the given size to the current batch, first applying
+// the batch if the entry doesn't fit in it.
+func (batcher *oplogBatcher) Add(entry db.Oplog, size int) error {
+	if batcher.maxOps > 0 && entry.Operation == "c" {
+		if err := batcher.Flush(); err != nil {
+			return err
+		}
+		return batcher.apply([]interface{}{entry})
+	}
+	if batcher.bufferedBytes+size > oplogMaxCommandSize {
+		if err := batcher.Flush(); err != nil {
+			return err
+		}
+	}
+	batcher.entries = append(batcher.entries, entry)
+	batcher.bufferedBytes += size
+	if batcher.maxOps > 0 && len(batcher.entries) >= batcher.maxOps {
+		return batcher.Flush()
+	}
+	return nil
+}
+
+// Flush applies the current batch, if it has any entries.
+func (batcher *oplogBatcher) Flush() error {
+	if len(batcher.entries) == 0 {
+		return nil
+	}
+	err := batcher.apply(batcher.entries)
+	batcher.entries = nil
+	batcher.bufferedBytes = 0
+	return err
+}
+
 // ApplyOps is a wrapper for the applyOps database command, we pass in
 // a session to avoid opening a new connection for a few inserts at a time.
 func (restore *MongoRestore) ApplyOps(session *mgo.Session, entries []interface{}) error {
 	res := bson.M{}
-	err := session.Run(bson.D{{"applyOps", entries}}, &res)
+	err := restore.sessionRunner(session).Run(bson.D{{"applyOps", entries}}, &res, "admin")
 	if err != nil {
 		return fmt.Errorf("applyOps: %v", err)
 	}
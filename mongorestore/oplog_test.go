@@ -1,6 +1,7 @@
 package mongorestore
 
 import (
+	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
@@ -113,3 +114,105 @@ func TestValidOplogLimitChecking(t *testing.T) {
 	})
 
 }
+
+func TestOplogBatching(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an oplog of inserts around a DDL command", t, func() {
+		entries := []db.Oplog{
+			{Operation: "i", Namespace: "db1.c1", Object: bson.M{"_id": 1}},
+			{Operation: "i", Namespace: "db1.c1", Object: bson.M{"_id": 2}},
+			{Operation: "i", Namespace: "db1.c1", Object: bson.M{"_id": 3}},
+			{Operation: "c", Namespace: "db1.$cmd", Object: bson.M{"drop": "c2"}},
+			{Operation: "i", Namespace: "db1.c1", Object: bson.M{"_id": 4}},
+			{Operation: "u", Namespace: "db1.c1", Object: bson.M{"$set": bson.M{"x": 1}}, Query: bson.M{"_id": 4}},
+		}
+		batches := [][]db.Oplog{}
+		batcher := &oplogBatcher{
+			apply: func(batch []interface{}) error {
+				ops := []db.Oplog{}
+				for _, entry := range batch {
+					ops = append(ops, entry.(db.Oplog))
+				}
+				batches = append(batches, ops)
+				return nil
+			},
+		}
+		applyAll := func() {
+			for _, entry := range entries {
+				So(batcher.Add(entry, 100), ShouldBeNil)
+			}
+			So(batcher.Flush(), ShouldBeNil)
+		}
+
+		Convey("with a batch size of 2, inserts should be batched in order and the command applied alone", func() {
+			batcher.maxOps = 2
+			applyAll()
+			So(batches, ShouldResemble, [][]db.Oplog{
+				entries[0:2],
+				entries[2:3],
+				entries[3:4],
+				entries[4:6],
+			})
+		})
+
+		Convey("without a batch size, every entry should be applied in one batch", func() {
+			applyAll()
+			So(batches, ShouldResemble, [][]db.Oplog{entries})
+		})
+
+		Convey("batches should never exceed the maximum command size", func() {
+			batcher.maxOps = 10
+			for _, entry := range entries[:3] {
+				So(batcher.Add(entry, oplogMaxCommandSize/2), ShouldBeNil)
+			}
+			So(batcher.Flush(), ShouldBeNil)
+			So(batches, ShouldResemble, [][]db.Oplog{entries[0:2], entries[2:3]})
+		})
+	})
+}
+
+func TestOplogStripPrefix(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --stripPrefix renaming the dumped collections", t, func() {
+		restore := &MongoRestore{InputOptions: &InputOptions{StripPrefix: "prod_"}}
+
+		Convey("an insert into a prefixed collection should be applied to the renamed collection", func() {
+			entry := db.Oplog{Operation: "i", Namespace: "prod_db1.prod_users", Object: bson.M{"_id": 1}}
+			restore.stripOplogEntryPrefix(&entry)
+			So(entry.Namespace, ShouldEqual, "prod_db1.users")
+			So(entry.Object, ShouldResemble, bson.M{"_id": 1})
+
+			Convey("and to the renamed database with --stripPrefixFromDBs", func() {
+				restore.InputOptions.StripPrefixFromDBs = true
+				entry := db.Oplog{Operation: "i", Namespace: "prod_db1.prod_users", Object: bson.M{"_id": 1}}
+				restore.stripOplogEntryPrefix(&entry)
+				So(entry.Namespace, ShouldEqual, "db1.users")
+			})
+		})
+
+		Convey("commands should act on the renamed collections", func() {
+			restore.InputOptions.StripPrefixFromDBs = true
+			drop := db.Oplog{Operation: "c", Namespace: "prod_db1.$cmd", Object: bson.M{"drop": "prod_users"}}
+			restore.stripOplogEntryPrefix(&drop)
+			So(drop.Namespace, ShouldEqual, "db1.$cmd")
+			So(drop.Object, ShouldResemble, bson.M{"drop": "users"})
+
+			rename := db.Oplog{Operation: "c", Namespace: "prod_db1.$cmd",
+				Object: bson.M{"renameCollection": "prod_db1.prod_a", "to": "prod_db1.prod_b"}}
+			restore.stripOplogEntryPrefix(&rename)
+			So(rename.Object, ShouldResemble, bson.M{"renameCollection": "db1.a", "to": "db1.b"})
+		})
+
+		Convey("system collections and indexes inserted into them should keep their names", func() {
+			entry := db.Oplog{Operation: "i", Namespace: "prod_db1.system.indexes",
+				Object: bson.M{"ns": "prod_db1.prod_users", "key": bson.M{"x": 1}, "name": "x_1"}}
+			restore.stripOplogEntryPrefix(&entry)
+			So(entry.Namespace, ShouldEqual, "prod_db1.system.indexes")
+			So(entry.Object["ns"], ShouldEqual, "prod_db1.users")
+		})
+	})
+}
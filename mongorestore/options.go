@@ -12,13 +12,24 @@ See http://docs.mongodb.org/manual/reference/program/mongorestore/ for more info
 
 // InputOptions defines the set of options to use in configuring the restore process.
 type InputOptions struct {
-	Objcheck               bool   `long:"objcheck" description:"validate all objects before inserting"`
-	OplogReplay            bool   `long:"oplogReplay" description:"replay oplog for point-in-time restore"`
-	OplogLimit             string `long:"oplogLimit" description:"only include oplog entries before the provided Timestamp (seconds[:ordinal])"`
-	Archive                string `long:"archive" optional:"true" optional-value:"-" description:"restore from a dump-archive stream or file"`
-	RestoreDBUsersAndRoles bool   `long:"restoreDbUsersAndRoles" description:"restore user and role definitions for the given database"`
-	Directory              string `long:"dir" description:"input directory, use '-' for stdin"`
-	Gzip                   bool   `long:"gzip" description:"decompress gzipped input"`
+	Objcheck               bool     `long:"objcheck" description:"validate all objects before inserting"`
+	OplogReplay            bool     `long:"oplogReplay" description:"replay oplog for point-in-time restore"`
+	OplogLimit             string   `long:"oplogLimit" description:"only include oplog entries before the provided Timestamp (seconds[:ordinal])"`
+	OplogApplyBatchSize    int      `long:"oplogApplyBatchSize" description:"apply at most the given number of oplog entries in each applyOps command, applying commands such as DDL on their own (no limit but the command size by default)"`
+	Archive                string   `long:"archive" optional:"true" optional-value:"-" description:"restore from a dump-archive stream or file, or from the volumes of a split archive matching a pattern such as dump.archive.*"`
+	Manifest               string   `long:"manifest" description:"restore each of the archives listed in the given JSON file in turn, e.g. a base archive and then incrementals, in the form {archives: [{archive: 'base.archive', order: 0, drop: true}, ...]}; each archive may also set gzip"`
+	RestoreDBUsersAndRoles bool     `long:"restoreDbUsersAndRoles" description:"restore user and role definitions for the given database"`
+	Directory              string   `long:"dir" description:"input directory, use '-' for stdin"`
+	Gzip                   bool     `long:"gzip" description:"decompress gzipped input"`
+	ParallelGzip           bool     `long:"parallelGzip" description:"with --gzip, decompress each .bson file of the dump directory on several cores where the file is made of independently compressed blocks, as files compressed with bgzip are, and otherwise ahead of inserting its documents, in one goroutine of its own, so that decompressing and inserting overlap"`
+	StartOffset            int64    `long:"startOffset" description:"for recovering a partially corrupt .bson file, start reading the collection at the first valid document at or after the given byte offset"`
+	ReverseOrder           bool     `long:"reverseOrder" description:"restore the documents of each .bson file from last to first, e.g. newest first for a collection dumped in insertion order; not supported with --archive, which has no index of where its documents are, or with --gzip"`
+	StripPrefix            string   `long:"stripPrefix" description:"remove the given prefix from the names of the dumped collections, e.g. --stripPrefix prod_ restores prod_users to users"`
+	StripPrefixFromDBs     bool     `long:"stripPrefixFromDBs" description:"also remove the --stripPrefix from the names of the dumped databases"`
+	IncludeDBs             []string `long:"includeDB" description:"only restore the given database from the dump (may be specified multiple times); with --db, only a database matching both is restored"`
+	DumpPreludeCSV         bool     `long:"dumpPreludeCSV" description:"instead of restoring, write a CSV row to stdout for each namespace in the prelude of the --archive, with its db, collection, sizeBytes, indexCount, hasValidator and capped, without reading the rest of the archive"`
+	TeeArchive             string   `long:"teeArchive" description:"while restoring from an archive, such as one streamed to standard input, write a copy of its raw bytes to the given file, so that it can be restored again without fetching it again; failing to write the copy doesn't fail the restore"`
+	StrictEnd              bool     `long:"strictEnd" description:"fail if the archive has trailing bytes after its final block, instead of warning"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -28,15 +39,100 @@ func (*InputOptions) Name() string {
 
 // OutputOptions defines the set of options for restoring dump data.
 type OutputOptions struct {
-	Drop                   bool   `long:"drop" description:"drop each collection before import"`
-	WriteConcern           string `long:"writeConcern" default:"majority" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}' (defaults to 'majority')"`
-	NoIndexRestore         bool   `long:"noIndexRestore" description:"don't restore indexes"`
-	NoOptionsRestore       bool   `long:"noOptionsRestore" description:"don't restore collection options"`
-	KeepIndexVersion       bool   `long:"keepIndexVersion" description:"don't update index version"`
-	MaintainInsertionOrder bool   `long:"maintainInsertionOrder" description:"preserve order of documents during restoration"`
-	NumParallelCollections int    `long:"numParallelCollections" short:"j" description:"number of collections to restore in parallel (4 by default)" default:"4" default-mask:"-"`
-	NumInsertionWorkers    int    `long:"numInsertionWorkersPerCollection" description:"number of insert operations to run concurrently per collection (1 by default)" default:"1" default-mask:"-"`
-	StopOnError            bool   `long:"stopOnError" description:"stop restoring if an error is encountered on insert (off by default)"`
+	Drop                     bool     `long:"drop" description:"drop each collection before import"`
+	WriteConcern             string   `long:"writeConcern" default:"majority" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}' (defaults to 'majority')"`
+	DataWriteConcern         string   `long:"dataWriteConcern" description:"write concern for inserting documents, e.g. --dataWriteConcern w:1 (defaults to --writeConcern)"`
+	MetaWriteConcern         string   `long:"metaWriteConcern" description:"write concern for creating collections and building indexes, e.g. --metaWriteConcern majority (defaults to the server's default)"`
+	OnlyExistingTargets      bool     `long:"onlyExistingTargets" description:"only restore the collections that already exist on the target, skipping the rest, to refresh a curated subset"`
+	MetadataReadPreference   string   `long:"metadataReadPreference" description:"read preference of the reads that check the target before restoring each collection, such as whether it exists for --drop or --onlyExistingTargets and whether it's empty for --onlyIfEmpty: 'primary', 'secondaryPreferred' or 'nearest'; inserts and other writes always go to the primary (primary by default)"`
+	PermissionCheck          bool     `long:"permissionCheck" description:"instead of restoring, check that the authenticated user may insert in to, build indexes on and, with --drop, drop each namespace that would be restored, and report those it may not"`
+	RequireEmptyCluster      bool     `long:"requireEmptyCluster" description:"abort before restoring anything if any database of the target other than admin, local and config already has collections, other than system collections"`
+	OnlyIfEmpty              bool     `long:"onlyIfEmpty" description:"only restore collections that don't exist or have no documents, skipping any that already have data"`
+	NoIndexRestore           bool     `long:"noIndexRestore" description:"don't restore indexes"`
+	NoOptionsRestore         bool     `long:"noOptionsRestore" description:"don't restore collection options"`
+	KeepIndexVersion         bool     `long:"keepIndexVersion" description:"don't update index version"`
+	MaintainInsertionOrder   bool     `long:"maintainInsertionOrder" description:"preserve order of documents during restoration"`
+	Shuffle                  bool     `long:"shuffle" description:"insert the documents of each collection in a random order, the same for each --shuffleSeed, by shuffling them within a window of --shuffleBufferSize documents; implies one insertion worker per collection"`
+	ShuffleSeed              int64    `long:"shuffleSeed" description:"seed of the random order of --shuffle (0 by default)"`
+	ShuffleBufferSize        int      `long:"shuffleBufferSize" description:"number of documents of a collection that --shuffle holds in memory to shuffle (1000 by default)" default:"1000" default-mask:"-"`
+	MaxInFlightBytes         int64    `long:"maxInFlightBytes" description:"bound the total bytes of the documents read from the dump but not yet inserted, across all collections and insertion workers, pausing reading while the server catches up (no bound by default)"`
+	NumParallelCollections   int      `long:"numParallelCollections" short:"j" description:"number of collections to restore in parallel (4 by default)" default:"4" default-mask:"-"`
+	Order                    string   `long:"order" description:"restore the namespaces listed in the given file, one db.collection per line, first and in that order, before the rest in the default order; with --numParallelCollections=1 each finishes before the next starts"`
+	IdIndexOptions           string   `long:"idIndexOptions" description:"what to do with the options of the _id index in the metadata, such as its collation: 'restore' creates each collection with an _id index with those of them the server allows on _id indexes and logs the others, and 'ignore' creates it with the server's defaults; the _id index of a collection that already exists is never rebuilt ('restore' by default)" default:"restore" default-mask:"-"`
+	NormalizeIdType          string   `long:"normalizeIdType" description:"make the _ids of the documents restored of one type, so that dumps that key the same entities by ObjectIds and by their hex strings can be merged: 'string' turns ObjectIds into hex strings, and 'objectid' turns hex strings into ObjectIds; other _ids are left as they are"`
+	IdCollisions             string   `long:"idCollisions" description:"what to do with a document whose _id is already in the collection, such as one merged from another dump: 'error' reports it as failing to insert, 'skip' leaves the document already there, and 'replace' replaces it ('error' by default)" default:"error" default-mask:"-"`
+	DeterministicBatching    bool     `long:"deterministicBatching" description:"insert each collection with one worker and flush its batches only when they are full, so documents are batched the same way on every run"`
+	NumInsertionWorkers      int      `long:"numInsertionWorkersPerCollection" description:"number of insert operations to run concurrently per collection (1 by default)" default:"1" default-mask:"-"`
+	DeferUniqueIndexes       string   `long:"deferUniqueIndexes" description:"don't build unique indexes, so that collections with duplicates still restore; instead, write a mongo shell script that builds them to the given file, to run once the duplicates are removed"`
+	MaxConcurrentIndexBuilds int      `long:"maxConcurrentIndexBuilds" description:"maximum number of collections building indexes at once, across all parallel collections (no limit by default)"`
+	IndexCommitQuorum        string   `long:"indexCommitQuorum" description:"the commitQuorum of each index build, such as 'majority', 'votingMembers' or a number of members; ignored by servers before 4.4 and standalones (the server's default by default)"`
+	IndexBuildRateLimit      int      `long:"indexBuildRateLimit" description:"build the indexes of one collection at a time, waiting the given number of milliseconds between the end of each build and the start of the next, to avoid spikes of IO on a shared cluster"`
+	RetryIndexBuilds         int      `long:"retryIndexBuilds" description:"retry a failed index build of a collection up to the given number of times, waiting longer each time, if it failed for a reason other than the definition of its indexes, such as a lost connection or resource pressure (no retries by default)"`
+	KeepAliveInterval        int      `long:"keepAliveInterval" description:"while building indexes, ping the server every given number of seconds so that idle connections aren't dropped by load balancers (off by default)"`
+	MaxCollectionsPerShard   int      `long:"maxCollectionsPerShard" description:"when restoring through a mongos, maximum number of collections to restore in parallel in to any one shard, judged by where their chunks or database are (no limit by default)"`
+	StopOnError              bool     `long:"stopOnError" description:"stop restoring if an error is encountered on insert (off by default)"`
+	MaxErrors                int64    `long:"maxErrors" description:"log and tolerate documents that fail to insert, across all collections, until more than the given number have failed, then abort the restore (no limit by default)"`
+	CausalConsistency        bool     `long:"causalConsistency" description:"run the restore's commands and inserts, other than the inserts of users and roles in to their temporary collections, in one causally consistent session, so that reads made after it in a session that has seen its final cluster time see all of the restored data (requires a replica set or mongos running MongoDB 3.6 or later)"`
+	RetryWrites              bool     `long:"retryWrites" description:"insert in retryable-write sessions, so batches interrupted by a failover can be retried without inserting documents twice (requires a replica set or mongos running MongoDB 3.6 or later)"`
+	IgnoreMetadataFor        []string `long:"ignoreMetadataFor" description:"don't restore collection options or indexes for namespaces matching the given pattern, e.g. 'db.*' (may be specified multiple times)"`
+	RewriteRefs              []string `long:"rewriteRefs" description:"give the documents of otherColl new _ids and rewrite the references to them in the given field of db.coll, in the form db.coll:field->otherColl; the _id mapping is held in memory (may be specified multiple times)"`
+	ReshardKeys              []string `long:"reshardKey" description:"shard the given collection on a new key before inserting into it, in the form db.coll={key:1}; documents missing the key are skipped (may be specified multiple times)"`
+	Preallocate              bool     `long:"preallocate" description:"create each collection that doesn't exist yet sized for the data to restore in to it, on storage engines that preallocate (WiredTiger doesn't)"`
+	AutoShard                bool     `long:"autoShard" description:"when restoring to a mongos, shard each collection that was sharded when it was dumped with the shard key it had, before inserting into it"`
+	MoveIdTo                 string   `long:"moveIdTo" description:"copy the _id of each document to the given field and give the document a new ObjectId _id, keeping the original ids while adopting new ones; with --deterministicIds the new ids are deterministic"`
+	RenumberIds              []string `long:"renumberIds" description:"give the documents of the given collection sequential integer _ids from 1, in the order they're restored, writing the original _ids to --renumberIdsMap (may be specified multiple times)"`
+	RenumberIdsMap           string   `long:"renumberIdsMap" description:"file to write the original and new _ids of the documents renumbered by --renumberIds to, one JSON line per document (defaults to 'renumbered_ids.json')" default:"renumbered_ids.json" default-mask:"-"`
+	DeterministicIds         string   `long:"deterministicIds" description:"give documents with ObjectId _ids new ones derived from the given seed, the same each time the dump is restored; references to them aren't rewritten, except with --rewriteRefs"`
+	EncryptFields            []string `long:"encryptFields" description:"encrypt the values of the given top level fields of a collection with AES-GCM before inserting them, storing them as binary data, in the form db.coll:field1,field2 (may be specified multiple times)"`
+	EncryptionKeyFile        string   `long:"encryptionKeyFile" description:"file holding the base64 encoded 16, 24 or 32 byte AES key used by --encryptFields"`
+	TTLRebase                string   `long:"ttlRebase" description:"shift the given date field of each document by the time since the dump was taken, preserving its remaining TTL"`
+	DropExpired              string   `long:"dropExpired" description:"skip the documents that a TTL index on the given date field would already have removed, in the form field:ttlSeconds, and log how many were skipped"`
+	RewriteBinarySubtype     string   `long:"rewriteBinarySubtype" description:"give the binary values of one subtype another, at any depth of each document, in the form from->to, e.g. 3->4; legacy UUIDs written by the Java or C# drivers are also put in the standard byte order with 3->4:java or 3->4:csharp"`
+	PruneEmpty               bool     `long:"pruneEmpty" description:"remove the fields of each document, at any depth, whose values are empty, as set by --pruneEmptyKinds; zeros and false are kept, as is the _id"`
+	PruneEmptyKinds          string   `long:"pruneEmptyKinds" description:"comma separated kinds of empty values for --pruneEmpty to remove, of 'null', 'string', 'array' and 'document' (defaults to all of them)" default:"null,string,array,document" default-mask:"-"`
+	RepairUTF8               bool     `long:"repairUTF8" description:"repair the invalid UTF-8 in the strings of each document, which the server would reject, as set by --repairUTF8Mode, logging the _ids of the documents repaired"`
+	RepairUTF8Mode           string   `long:"repairUTF8Mode" description:"whether --repairUTF8 should 'replace' invalid bytes with the Unicode replacement character or 'strip' them (defaults to 'replace')" default:"replace" default-mask:"-"`
+	ClientSchemas            []string `long:"clientSchema" description:"check each document of the given collection against a JSON Schema before inserting it, in the form db.coll:schema.json; the schema may be wrapped in {$jsonSchema: ...} like a validator (may be specified multiple times)"`
+	ClientSchemaMode         string   `long:"clientSchemaMode" description:"whether documents that don't match their --clientSchema are logged and skipped with 'skip', or stop the restore with 'abort' (defaults to 'skip')" default:"skip" default-mask:"-"`
+	TemplateFields           []string `long:"templateField" description:"set a field of each document of the given collection to the output of a Go text/template run with the document's fields, in the form db.coll:newField={{.existing}}-suffix; documents the template fails on are logged and skipped (may be specified multiple times)"`
+	SplitBy                  []string `long:"splitBy" description:"restore each document of the given collection in to a collection named for the value of its field, such as coll_<value>, created by its first insert without the options or indexes of the collection (may be specified multiple times)"`
+	SplitByMaxTargets        int      `long:"splitByMaxTargets" description:"the most collections that --splitBy may split a collection in to, stopping the restore if there would be more (100 by default)" default:"100" default-mask:"-"`
+	LowercaseKeys            bool     `long:"lowercaseKeys" description:"lowercase the field names of each document, at any depth; see --lowercaseKeysMode for fields that collapse to the same name"`
+	LowercaseKeysMode        string   `long:"lowercaseKeysMode" description:"whether a document with fields that --lowercaseKeys collapses to the same name, such as userName and username, is an 'error' that stops the restore, or keeps the value of the last of them with 'lastWins' (defaults to 'error')" default:"error" default-mask:"-"`
+	EscapeKeys               bool     `long:"escapeKeys" description:"rename the fields of each document that older servers refuse, at any depth, replacing each '.' in a field name with --escapeKeysDot and a leading '$' with --escapeKeysDollar, logging each field renamed"`
+	EscapeKeysDot            string   `long:"escapeKeysDot" description:"what --escapeKeys replaces each '.' in a field name with (defaults to the fullwidth full stop U+FF0E)" default:"．" default-mask:"-"`
+	EscapeKeysDollar         string   `long:"escapeKeysDollar" description:"what --escapeKeys replaces a leading '$' in a field name with (defaults to the fullwidth dollar sign U+FF04)" default:"＄" default-mask:"-"`
+	SeenIdsBloom             string   `long:"seenIdsBloom" description:"skip the documents whose _ids were probably restored by an earlier run with the same file, as recorded in a bloom filter that is loaded from and saved to the given file, accepting a small chance of skipping documents that weren't; the filter isn't saved if documents fail to insert"`
+	SeenIdsBloomCapacity     int64    `long:"seenIdsBloomCapacity" description:"the number of _ids a new --seenIdsBloom filter is sized to hold with a 1% chance of false positives (1000000 by default)" default:"1000000" default-mask:"-"`
+	SpillArrays              []string `long:"spillArray" description:"move the elements of an array field of each document of the given collection in to documents of their own in a child collection of the same database, {_id: ObjectId, parentId: <the document's _id>, index: <position>, value: <element>}, removing the field from the document, in the form db.coll:field->childColl; with --drop, the child collection is dropped too (may be specified multiple times)"`
+	ToDecimal128             []string `long:"toDecimal128" description:"convert the doubles and numeric strings of the given top level fields of a collection to decimal128, logging the values that can't be and leaving them as they are, in the form db.coll:field1,field2 (may be specified multiple times)"`
+	ConvertDBRefs            []string `long:"convertDBRef" description:"convert the references in a top level field of a collection, or in an array in it, from DBRefs to the plain _ids they refer to, in the form db.coll:field=toManual, or from plain _ids to DBRefs to the documents of otherColl, in the form db.coll:field=fromManual:otherColl (may be specified multiple times)"`
+	TTLOverrides             []string `long:"ttlOverride" description:"build the TTL index on a date field of the given collection with the given expireAfterSeconds instead of the one in the metadata, adding the index if the metadata has none, in the form db.coll:field=seconds (may be specified multiple times)"`
+	HashField                string   `long:"hashField" description:"store a SHA-256 hash of each document, without the field, in the given top level field as a hex string, so that documents can later be compared by their hashes"`
+	SkippedTo                string   `long:"skippedTo" description:"write every document that isn't restored because it was filtered out, such as by --idRange, --dropExpired or --limit, to the given BSON file, as it was dumped, in the 'doc' field of a document whose 'ns' field is its namespace, so that it can be inspected or restored later"`
+	SkipFirstDoc             bool     `long:"skipFirstDoc" description:"discard the first document of each collection's data instead of restoring it, for dumps made by custom exports that start each collection with a header or schema document"`
+	SkipFirstDocOf           []string `long:"skipFirstDocOf" description:"discard the first document of the given collection's data instead of restoring it, as --skipFirstDoc does for every collection (may be specified multiple times)"`
+	Flatten                  []string `long:"flatten" description:"replace the subdocuments of each document of the given collection with top level fields named by their dotted paths, e.g. {'a.b': 1} for {a: {b: 1}}; field names that already had dots in them make this impossible to undo (may be specified multiple times)"`
+	FlattenArrays            string   `long:"flattenArrays" description:"whether --flatten should 'keep' arrays as they are, or 'index' them, flattening their elements to fields named by their index, e.g. a.0 (defaults to 'keep')" default:"keep" default-mask:"-"`
+	Since                    []string `long:"since" description:"only restore the documents of a collection whose date field is after the given date, in the form db.coll:field=2015-01-01T00:00:00Z (may be specified multiple times)"`
+	SinceMissing             string   `long:"sinceMissing" description:"whether to 'include' or 'exclude' documents without a date in the --since field (defaults to 'include')" default:"include" default-mask:"-"`
+	Limits                   []string `long:"limit" description:"only restore the first N documents of a collection, skipping the rest, in the form db.coll=N (may be specified multiple times)"`
+	MaxDocsPerCollection     int64    `long:"maxDocsPerCollection" description:"only restore the first N documents of each collection without a --limit, skipping the rest (no limit by default)"`
+	IdRanges                 []string `long:"idRange" description:"only restore the documents of a collection whose _id is at least min and less than max, in the form db.coll=min,max; the bounds are both ObjectIds or both numbers, and either may be left empty (may be specified multiple times)"`
+	CaseCollisions           string   `long:"caseCollisions" description:"whether to 'error', 'warn' or 'ignore' when the databases, or the collections of a database, to restore have names that differ only by case, before restoring (defaults to 'warn')" default:"warn" default-mask:"-"`
+	DatabasesOnly            bool     `long:"databasesOnly" description:"instead of restoring, only create each of the dumped databases, without any collections, by creating and dropping a collection in it"`
+	EmitPlan                 string   `long:"emitPlan" description:"instead of restoring, write the namespaces to restore and the dependencies between them to stdout, in the given format; only 'dot' (Graphviz) is supported"`
+	PostRestore              []string `long:"postRestore" description:"run a command in the database of the given collection after restoring it, in the form db.coll:{command} (may be specified multiple times)"`
+	PostRestoreFatal         bool     `long:"postRestoreFatal" description:"stop the restore if a --postRestore command fails, instead of logging the error and continuing"`
+	StampRestoreInfo         string   `long:"stampRestoreInfo" description:"record when each restored collection was dumped and restored, either as the 'comment' of a collMod of the collection, or as a 'marker' document inserted into the mongorestore_restoreInfo collection of its database"`
+	MetricsSocket            string   `long:"metricsSocket" description:"while restoring, serve the current namespaces, document and byte counts, rates, and estimated time remaining as a line of JSON to each connection to a Unix domain socket created at the given path"`
+	Comment                  string   `long:"comment" description:"attach the given comment to the commands and inserts of the restore, so that they can be picked out in the server's logs (needs MongoDB 4.4 or later)"`
+	AppName                  string   `long:"appName" description:"name the restore as the application of its connections, except with --ssl or kerberos, and in the comment attached to its commands and inserts, as with --comment"`
+	CheckRefs                []string `long:"checkRefs" description:"after restoring, report how many values of the given field of db.coll, and which, are not the _id of a document of otherColl, in the form db.coll:field->otherColl; nothing is modified (may be specified multiple times)"`
+	MaxCollections           int      `long:"maxCollections" description:"stop before restoring anything if the archive or dump directory holds more than the given number of collections, as a guard against restoring the wrong archive (no limit by default)"`
+	LogEveryDocs             int      `long:"logEveryDocs" description:"log a line for each collection each time another given number of its documents have been inserted, for tools that parse the log, independently of the progress bars (off by default)"`
+	VerifySample             int      `long:"verifySample" description:"after restoring each collection, read back the given number of the documents inserted in to it, chosen at random, by their _ids, and report those that are missing or don't match what was inserted byte for byte"`
+	VerifyReport             string   `long:"verifyReport" description:"after restoring, compare the number of documents in each restored collection with the number inserted and write a JSON report of the results to the given path"`
 }
 
 // Name returns a human-readable group name for output options.
@@ -0,0 +1,47 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"io/ioutil"
+	"strings"
+)
+
+// readOrderFile reads the namespaces listed by the --order file, one "db.collection"
+// per line, skipping blank lines and lines starting with '#'.
+func readOrderFile(path string) ([]string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading order file: %v", err)
+	}
+	order := []string{}
+	for i, line := range strings.Split(string(contents), "\n") {
+		ns := strings.TrimSpace(line)
+		if ns == "" || strings.HasPrefix(ns, "#") {
+			continue
+		}
+		if !strings.Contains(ns, ".") {
+			return nil, fmt.Errorf("line %v of order file %v: '%v' is not of the form db.collection", i+1, path, ns)
+		}
+		if err := util.ValidateFullNamespace(ns); err != nil {
+			return nil, fmt.Errorf("line %v of order file %v: %v", i+1, path, err)
+		}
+		order = append(order, ns)
+	}
+	return order, nil
+}
+
+// finalizeIntents sets the order the collections are restored in: the namespaces
+// listed by --order first, in the order they're listed, and then the rest in the
+// default order for pType.
+func (restore *MongoRestore) finalizeIntents(pType intents.PriorityType) {
+	if restore.order == nil {
+		restore.manager.Finalize(pType)
+		return
+	}
+	for _, ns := range restore.manager.FinalizeInOrder(pType, restore.order) {
+		log.Logf(log.Always, "warning: %v is listed by --order but isn't being restored", ns)
+	}
+}
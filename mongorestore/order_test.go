@@ -0,0 +1,38 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOrderFile(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an --order file", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_order")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "order.txt")
+
+		Convey("the namespaces should be read in order, skipping blanks and comments", func() {
+			So(ioutil.WriteFile(path, []byte("# collections before their views\ndb1.users\n\n  db1.users_view  \ndb2.c\n"), 0644), ShouldBeNil)
+			order, err := readOrderFile(path)
+			So(err, ShouldBeNil)
+			So(order, ShouldResemble, []string{"db1.users", "db1.users_view", "db2.c"})
+		})
+
+		Convey("a line that isn't a namespace should be an error", func() {
+			So(ioutil.WriteFile(path, []byte("db1.users\ndb1\n"), 0644), ShouldBeNil)
+			_, err := readOrderFile(path)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "line 2")
+		})
+	})
+}
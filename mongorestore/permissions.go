@@ -0,0 +1,109 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// privilege is one of the privileges that connectionStatus reports the
+// authenticated users to have.
+type privilege struct {
+	Resource struct {
+		DB          *string `bson:"db"`
+		Collection  *string `bson:"collection"`
+		AnyResource bool    `bson:"anyResource"`
+	} `bson:"resource"`
+	Actions []string `bson:"actions"`
+}
+
+// covers returns whether the privilege's resource includes the collection. An
+// empty database or collection name in a resource matches any, except that an
+// empty collection name doesn't match system collections.
+func (priv privilege) covers(dbName, colName string) bool {
+	resource := priv.Resource
+	if resource.AnyResource {
+		return true
+	}
+	if resource.DB == nil || resource.Collection == nil {
+		// cluster resources
+		return false
+	}
+	if *resource.DB != "" && *resource.DB != dbName {
+		return false
+	}
+	if *resource.Collection == "" {
+		return !strings.HasPrefix(colName, "system.")
+	}
+	return *resource.Collection == colName
+}
+
+// requiredActions returns the actions the restore needs on each namespace.
+func (restore *MongoRestore) requiredActions() []string {
+	actions := []string{"insert", "createIndex"}
+	if restore.OutputOptions.Drop {
+		actions = append(actions, "dropCollection")
+	}
+	return actions
+}
+
+// missingActions returns the actions among the given ones that none of the
+// privileges grant on the namespace.
+func missingActions(privileges []privilege, ns string, actions []string) []string {
+	dot := strings.Index(ns, ".")
+	dbName, colName := ns[:dot], ns[dot+1:]
+	granted := map[string]bool{}
+	for _, priv := range privileges {
+		if !priv.covers(dbName, colName) {
+			continue
+		}
+		for _, action := range priv.Actions {
+			granted[action] = true
+		}
+	}
+	missing := []string{}
+	for _, action := range actions {
+		if !granted[action] {
+			missing = append(missing, action)
+		}
+	}
+	return missing
+}
+
+// checkPermissions asks the server for the privileges of the authenticated
+// users and returns an error naming each namespace to restore that they lack an
+// action needed to restore it on, for --permissionCheck. Nothing is written.
+func (restore *MongoRestore) checkPermissions() error {
+	status := struct {
+		AuthInfo struct {
+			Users      []bson.M    `bson:"authenticatedUsers"`
+			Privileges []privilege `bson:"authenticatedUserPrivileges"`
+		} `bson:"authInfo"`
+	}{}
+	err := restore.getRunner().Run(bson.D{{"connectionStatus", 1}, {"showPrivileges", true}}, &status, "admin")
+	if err != nil {
+		return fmt.Errorf("error checking permissions: %v", err)
+	}
+	if len(status.AuthInfo.Users) == 0 {
+		log.Log(log.Always, "warning: not authenticated as any user, so permissions can't be checked")
+		return nil
+	}
+
+	namespaces := restore.targetNamespaces()
+	denied := []string{}
+	for _, ns := range namespaces {
+		missing := missingActions(status.AuthInfo.Privileges, ns, restore.requiredActions())
+		if len(missing) > 0 {
+			denied = append(denied, fmt.Sprintf("%v (%v)", ns, strings.Join(missing, ", ")))
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("not permitted to restore %v %v: %v", len(denied),
+			util.Pluralize(len(denied), "namespace", "namespaces"), strings.Join(denied, "; "))
+	}
+	log.Logf(log.Always, "permitted to restore all %v %v", len(namespaces),
+		util.Pluralize(len(namespaces), "namespace", "namespaces"))
+	return nil
+}
@@ -0,0 +1,73 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestPermissionCheck(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a user who may write to db1 and only read db2.locked", t, func() {
+		runner := &isMasterRunner{reply: bson.M{"ok": 1, "authInfo": bson.M{
+			"authenticatedUsers": []bson.M{{"user": "restorer", "db": "admin"}},
+			"authenticatedUserPrivileges": []bson.M{
+				{"resource": bson.M{"cluster": true}, "actions": []string{"listDatabases"}},
+				{"resource": bson.M{"db": "db1", "collection": ""},
+					"actions": []string{"find", "insert", "createIndex", "dropCollection"}},
+				{"resource": bson.M{"db": "db2", "collection": "open"},
+					"actions": []string{"insert", "createIndex"}},
+				{"resource": bson.M{"db": "db2", "collection": "locked"},
+					"actions": []string{"find", "createIndex"}},
+			},
+		}}}
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{PermissionCheck: true},
+			manager:       intents.NewIntentManager(),
+			runner:        runner,
+		}
+		restore.manager.Put(&intents.Intent{DB: "db1", C: "users", BSONPath: "db1/users.bson"})
+		restore.manager.Put(&intents.Intent{DB: "db2", C: "open", BSONPath: "db2/open.bson"})
+
+		Convey("namespaces the user may write should pass", func() {
+			So(restore.checkPermissions(), ShouldBeNil)
+		})
+
+		Convey("a namespace the user may not insert in to should be reported", func() {
+			restore.manager.Put(&intents.Intent{DB: "db2", C: "locked", BSONPath: "db2/locked.bson"})
+			err := restore.checkPermissions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "not permitted to restore 1 namespace: db2.locked (insert)")
+			So(err.Error(), ShouldNotContainSubstring, "db1.users")
+		})
+
+		Convey("with --drop, the dropCollection action should be required too", func() {
+			restore.OutputOptions.Drop = true
+			err := restore.checkPermissions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "db2.open (dropCollection)")
+			So(err.Error(), ShouldNotContainSubstring, "db1.users")
+		})
+
+		Convey("a privilege on every collection of a database shouldn't cover its system collections", func() {
+			restore.manager.Put(&intents.Intent{DB: "db1", C: "system.js", BSONPath: "db1/system.js.bson"})
+			err := restore.checkPermissions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "db1.system.js (insert, createIndex)")
+		})
+	})
+
+	Convey("Without an authenticated user, nothing should be reported", t, func() {
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{PermissionCheck: true},
+			manager:       intents.NewIntentManager(),
+			runner:        &isMasterRunner{reply: bson.M{"ok": 1, "authInfo": bson.M{"authenticatedUsers": []bson.M{}}}},
+		}
+		restore.manager.Put(&intents.Intent{DB: "db1", C: "users", BSONPath: "db1/users.bson"})
+		So(restore.checkPermissions(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,147 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+)
+
+// formats supported by --emitPlan
+const planFormatDOT = "dot"
+
+// planEdge is a dependency of the From namespace on the To namespace.
+type planEdge struct {
+	From  string
+	To    string
+	Label string
+}
+
+// restorePlan holds the namespaces to restore and the dependencies between them.
+type restorePlan struct {
+	Namespaces []string
+	Edges      []planEdge
+}
+
+// buildRestorePlan reads the metadata of every collection to restore, finding
+// the collections that views are defined on, and combines them with the
+// dependencies between collections given by --rewriteRefs.
+func (restore *MongoRestore) buildRestorePlan() (*restorePlan, error) {
+	plan := &restorePlan{}
+	for _, intent := range restore.manager.Intents() {
+		if intent.IsOplog() || intent.IsUsers() || intent.IsRoles() ||
+			intent.IsAuthVersion() || intent.IsSystemIndexes() {
+			continue
+		}
+		plan.Namespaces = append(plan.Namespaces, intent.Namespace())
+		if intent.MetadataFile == nil {
+			continue
+		}
+		options, err := restore.readOptions(intent)
+		if err != nil {
+			return nil, err
+		}
+		plan.Edges = append(plan.Edges, viewDependencies(intent.DB, intent.Namespace(), options)...)
+	}
+	for _, rewrite := range restore.refRewrites {
+		plan.Edges = append(plan.Edges, planEdge{
+			From:  rewrite.DB + "." + rewrite.C,
+			To:    rewrite.DB + "." + rewrite.RefC,
+			Label: "rewriteRefs " + rewrite.Field,
+		})
+	}
+	sort.Strings(plan.Namespaces)
+	sort.Sort(byEdge(plan.Edges))
+	return plan, nil
+}
+
+// readOptions reads the collection options from an intent's metadata.
+func (restore *MongoRestore) readOptions(intent *intents.Intent) (bson.D, error) {
+	err := intent.MetadataFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer intent.MetadataFile.Close()
+	metadata, err := ioutil.ReadAll(intent.MetadataFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading metadata from %v: %v", intent.Location, err)
+	}
+	options, _, err := restore.MetadataFromJSON(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing metadata from %v: %v", intent.Location, err)
+	}
+	return options, nil
+}
+
+// viewDependencies returns the namespaces the view ns, in database dbName, is
+// defined on: its viewOn collection, and those its pipeline looks up.
+// It returns nothing if the collection options aren't those of a view.
+func viewDependencies(dbName, ns string, options bson.D) []planEdge {
+	edges := []planEdge{}
+	viewOn, ok := docValue(options, "viewOn").(string)
+	if !ok {
+		return edges
+	}
+	edges = append(edges, planEdge{From: ns, To: dbName + "." + viewOn, Label: "viewOn"})
+	pipeline, _ := docValue(options, "pipeline").([]interface{})
+	for _, stage := range pipeline {
+		for _, operator := range []string{"$lookup", "$graphLookup"} {
+			if from, ok := docValue(docValue(stage, operator), "from").(string); ok {
+				edges = append(edges, planEdge{From: ns, To: dbName + "." + from, Label: operator})
+			}
+		}
+	}
+	return edges
+}
+
+// docValue returns the value of a field in a document, or nil if doc isn't a document.
+func docValue(doc interface{}, field string) interface{} {
+	switch d := doc.(type) {
+	case bson.D:
+		return d.Map()[field]
+	case bson.M:
+		return d[field]
+	case map[string]interface{}:
+		return d[field]
+	}
+	return nil
+}
+
+// byEdge sorts planEdges by their namespaces.
+type byEdge []planEdge
+
+func (edges byEdge) Len() int      { return len(edges) }
+func (edges byEdge) Swap(i, j int) { edges[i], edges[j] = edges[j], edges[i] }
+func (edges byEdge) Less(i, j int) bool {
+	if edges[i].From != edges[j].From {
+		return edges[i].From < edges[j].From
+	}
+	return edges[i].To < edges[j].To
+}
+
+// WriteDOT writes the plan as a Graphviz DOT graph, with an edge from
+// each namespace to each of the namespaces it depends on.
+func (plan *restorePlan) WriteDOT(out io.Writer) error {
+	_, err := fmt.Fprintln(out, "digraph restore {")
+	if err != nil {
+		return err
+	}
+	for _, ns := range plan.Namespaces {
+		_, err = fmt.Fprintf(out, "\t%v;\n", strconv.Quote(ns))
+		if err != nil {
+			return err
+		}
+	}
+	for _, edge := range plan.Edges {
+		_, err = fmt.Fprintf(out, "\t%v -> %v [label=%v];\n",
+			strconv.Quote(edge.From), strconv.Quote(edge.To), strconv.Quote(edge.Label))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(out, "}")
+	return err
+}
@@ -0,0 +1,51 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestViewDependencies(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the metadata of a view on a collection", t, func() {
+		restore := &MongoRestore{}
+		options, _, err := restore.MetadataFromJSON([]byte(`{"options":{"viewOn":"orders",` +
+			`"pipeline":[{"$match":{"status":"A"}},` +
+			`{"$lookup":{"from":"customers","localField":"cid","foreignField":"_id","as":"c"}}]},` +
+			`"indexes":[]}`))
+		So(err, ShouldBeNil)
+
+		Convey("the view should depend on its source and looked up collections", func() {
+			edges := viewDependencies("shop", "shop.active", options)
+			So(edges, ShouldResemble, []planEdge{
+				{From: "shop.active", To: "shop.orders", Label: "viewOn"},
+				{From: "shop.active", To: "shop.customers", Label: "$lookup"},
+			})
+		})
+
+		Convey("the DOT graph should contain the dependency edge", func() {
+			plan := &restorePlan{
+				Namespaces: []string{"shop.active", "shop.orders"},
+				Edges:      viewDependencies("shop", "shop.active", options)[:1],
+			}
+			out := &bytes.Buffer{}
+			So(plan.WriteDOT(out), ShouldBeNil)
+			So(out.String(), ShouldEqual, "digraph restore {\n"+
+				"\t\"shop.active\";\n"+
+				"\t\"shop.orders\";\n"+
+				"\t\"shop.active\" -> \"shop.orders\" [label=\"viewOn\"];\n"+
+				"}\n")
+		})
+	})
+
+	Convey("Collections that aren't views should have no dependencies", t, func() {
+		restore := &MongoRestore{}
+		options, _, err := restore.MetadataFromJSON([]byte(`{"options":{"capped":true,"size":4096},"indexes":[]}`))
+		So(err, ShouldBeNil)
+		So(viewDependencies("shop", "shop.log", options), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,68 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// postRestoreCommand is a parsed --postRestore argument of the form "db.coll:{command}".
+type postRestoreCommand struct {
+	DB      string
+	C       string
+	Command bson.D
+}
+
+// parsePostRestoreCommand parses an argument to --postRestore.
+func parsePostRestoreCommand(arg string) (*postRestoreCommand, error) {
+	colon := strings.Index(arg, ":{")
+	if colon < 0 {
+		return nil, fmt.Errorf("expected the form db.coll:{command}")
+	}
+	ns, commandJSON := arg[:colon], arg[colon+1:]
+	dot := strings.Index(ns, ".")
+	if dot <= 0 || dot == len(ns)-1 {
+		return nil, fmt.Errorf("'%v' is not a namespace of the form db.coll", ns)
+	}
+	command := bson.D{}
+	err := json.Unmarshal([]byte(commandJSON), &command)
+	if err != nil {
+		return nil, fmt.Errorf("command '%v' is not valid JSON: %v", commandJSON, err)
+	}
+	if len(command) == 0 {
+		return nil, fmt.Errorf("command must have at least one field")
+	}
+	command, err = bsonutil.GetExtendedBsonD(command)
+	if err != nil {
+		return nil, fmt.Errorf("extended json in command '%v': %v", commandJSON, err)
+	}
+	return &postRestoreCommand{DB: ns[:dot], C: ns[dot+1:], Command: command}, nil
+}
+
+// runPostRestoreCommands runs the --postRestore commands of the intent's collection,
+// in the order they were given. A failed command is logged and the rest are still
+// run, unless --postRestoreFatal is set.
+func (restore *MongoRestore) runPostRestoreCommands(intent *intents.Intent) error {
+	runner := restore.getRunner()
+	for _, post := range restore.postRestoreCommands {
+		if post.DB != intent.DB || post.C != intent.C {
+			continue
+		}
+		log.Logf(log.Info, "running post-restore command %v on %v", post.Command[0].Name, intent.Namespace())
+		err := runner.Run(post.Command, &bson.M{}, intent.DB)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("error running post-restore command %v on %v: %v",
+			post.Command[0].Name, intent.Namespace(), err)
+		if restore.OutputOptions.PostRestoreFatal {
+			return err
+		}
+		log.Logf(log.Always, "%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestParsePostRestoreCommand(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --postRestore arguments", t, func() {
+
+		Convey("a command should be parsed with its namespace", func() {
+			post, err := parsePostRestoreCommand(`db1.c1:{"collMod": "c1", "usePowerOf2Sizes": true}`)
+			So(err, ShouldBeNil)
+			So(post.DB, ShouldEqual, "db1")
+			So(post.C, ShouldEqual, "c1")
+			So(post.Command, ShouldResemble, bson.D{{"collMod", "c1"}, {"usePowerOf2Sizes", true}})
+		})
+
+		Convey("malformed arguments should be errors", func() {
+			for _, arg := range []string{
+				`db1.c1`,
+				`db1:{"reIndex": "c1"}`,
+				`db1.c1:{"reIndex": `,
+				`db1.c1:{}`,
+			} {
+				_, err := parsePostRestoreCommand(arg)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestRunPostRestoreCommands(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a post-restore command for one collection", t, func() {
+		runner := &stubRunner{}
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{},
+			runner:        runner,
+			postRestoreCommands: []*postRestoreCommand{
+				{DB: "db1", C: "c1", Command: bson.D{{"reIndex", "c1"}}},
+			},
+			knownCollections: map[string][]string{"db1": {}},
+		}
+
+		Convey("the command should run once, after that collection is restored", func() {
+			for _, intent := range []*intents.Intent{
+				{DB: "db1", C: "c1"},
+				{DB: "db1", C: "c2"},
+			} {
+				So(restore.RestoreIntent(intent), ShouldBeNil)
+			}
+			So(runner.commands, ShouldResemble, []interface{}{bson.D{{"reIndex", "c1"}}})
+			So(runner.databases, ShouldResemble, []string{"db1"})
+		})
+
+		Convey("a failed command should be logged unless --postRestoreFatal is set", func() {
+			runner.err = fmt.Errorf("command failed")
+			intent := &intents.Intent{DB: "db1", C: "c1"}
+			So(restore.RestoreIntent(intent), ShouldBeNil)
+
+			restore.OutputOptions.PostRestoreFatal = true
+			So(restore.RestoreIntent(intent), ShouldNotBeNil)
+			So(runner.count(), ShouldEqual, 2)
+		})
+	})
+}
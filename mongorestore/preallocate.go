@@ -0,0 +1,24 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// preallocationOptions returns the options to create the intent's collection with
+// for --preallocate: the given options, with a size hint of the size of the data
+// to restore, from the .bson file or the archive's collection metadata. Storage
+// engines that don't preallocate, such as WiredTiger, ignore the hint. Options that
+// already have a size, like those of capped collections, are left as they are.
+func (restore *MongoRestore) preallocationOptions(intent *intents.Intent, options bson.D) bson.D {
+	if !restore.OutputOptions.Preallocate || intent.Size <= 0 {
+		return options
+	}
+	for _, option := range options {
+		if option.Name == "size" {
+			return options
+		}
+	}
+	preallocated := append(bson.D{}, options...)
+	return append(preallocated, bson.DocElem{"size", intent.Size})
+}
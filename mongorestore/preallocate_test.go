@@ -0,0 +1,59 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestPreallocate(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive whose collection metadata records their sizes", t, func() {
+		prelude := &archive.Prelude{}
+		prelude.AddMetadata(&archive.CollectionMetadata{Database: "db1", Collection: "sized",
+			Metadata: `{"options":{},"indexes":[]}`, Size: 4096})
+		prelude.AddMetadata(&archive.CollectionMetadata{Database: "db1", Collection: "capped",
+			Metadata: `{"options":{"capped":true,"size":1024},"indexes":[]}`, Size: 4096})
+
+		runner := &stubRunner{}
+		restore := &MongoRestore{
+			manager:       intents.NewIntentManager(),
+			InputOptions:  &InputOptions{Archive: "dump.archive"},
+			OutputOptions: &OutputOptions{Preallocate: true},
+			ToolOptions:   &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+			archive:       &archive.Reader{Prelude: prelude, Demux: &archive.Demultiplexer{}},
+			runner:        runner,
+		}
+		target, err := prelude.NewPreludeExplorer()
+		So(err, ShouldBeNil)
+		So(restore.CreateAllIntents(target, "", ""), ShouldBeNil)
+		sized := restore.manager.IntentForNamespace("db1.sized")
+		So(sized, ShouldNotBeNil)
+
+		Convey("the collection should be created with a size hint of the size from the metadata", func() {
+			So(restore.CreateCollection(sized, restore.preallocationOptions(sized, bson.D{})), ShouldBeNil)
+			So(runner.count(), ShouldEqual, 1)
+			So(runner.databases, ShouldResemble, []string{"db1"})
+			So(runner.commands[0], ShouldResemble, bsonutil.MarshalD{{"create", "sized"}, {"size", json.NumberLong(4096)}})
+		})
+
+		Convey("a size in the collection options should be kept", func() {
+			capped := restore.manager.IntentForNamespace("db1.capped")
+			options := bson.D{{"capped", true}, {"size", 1024}}
+			So(restore.preallocationOptions(capped, options), ShouldResemble, options)
+		})
+
+		Convey("no hint should be added without --preallocate", func() {
+			restore.OutputOptions.Preallocate = false
+			So(restore.preallocationOptions(sized, bson.D{}), ShouldResemble, bson.D{})
+		})
+	})
+}
@@ -0,0 +1,125 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"strings"
+)
+
+// stripPrefix returns the database and collection that the dumped collection db.c
+// is restored to with --stripPrefix: the collection without the prefix, and, with
+// --stripPrefixFromDBs, the database without it too. Names are only stripped when
+// something is left of them, and system collections are never renamed. It returns
+// an error if another dumped collection has already been stripped to the same name.
+func (restore *MongoRestore) stripPrefix(db, c string) (string, string, error) {
+	prefix := restore.InputOptions.StripPrefix
+	if prefix == "" {
+		return db, c, nil
+	}
+	targetDB, targetC := restore.strippedNamespace(db, c)
+
+	if restore.strippedFrom == nil {
+		restore.strippedFrom = map[string]string{}
+	}
+	source, target := db+"."+c, targetDB+"."+targetC
+	if existing, ok := restore.strippedFrom[target]; ok && existing != source {
+		return "", "", fmt.Errorf("both %v and %v would be restored to %v after stripping the prefix '%v'",
+			existing, source, target, prefix)
+	}
+	restore.strippedFrom[target] = source
+	return targetDB, targetC, nil
+}
+
+// strippedNamespace returns the database and collection that db.c is renamed to
+// with --stripPrefix, without checking for collisions.
+func (restore *MongoRestore) strippedNamespace(db, c string) (string, string) {
+	prefix := restore.InputOptions.StripPrefix
+	if prefix == "" {
+		return db, c
+	}
+	if restore.InputOptions.StripPrefixFromDBs {
+		db = stripNamePrefix(db, prefix)
+	}
+	if !strings.HasPrefix(c, "system.") && !strings.HasPrefix(c, "$") {
+		c = stripNamePrefix(c, prefix)
+	}
+	return db, c
+}
+
+// strippedFullName returns the namespace that the namespace "db.c" is renamed to
+// with --stripPrefix.
+func (restore *MongoRestore) strippedFullName(ns string) string {
+	parts := strings.SplitN(ns, ".", 2)
+	if len(parts) == 1 {
+		db, _ := restore.strippedNamespace(ns, "")
+		return db
+	}
+	db, c := restore.strippedNamespace(parts[0], parts[1])
+	return db + "." + c
+}
+
+// oplogCollectionCommands are the commands of oplog entries whose value is the
+// name of the collection they act on.
+var oplogCollectionCommands = []string{"create", "drop", "collMod", "createIndexes",
+	"dropIndexes", "deleteIndexes", "convertToCapped", "emptycapped"}
+
+// stripOplogEntryPrefix renames the namespaces an oplog entry acts on as
+// --stripPrefix renamed the dumped collections, so that replaying the oplog
+// changes the restored collections rather than the dumped names. This covers the
+// entry's namespace, the collection named by a command entry, the namespaces of a
+// renameCollection command and the namespace of an index inserted into
+// system.indexes. The query of an update only holds the document's _id, so it
+// is left alone.
+func (restore *MongoRestore) stripOplogEntryPrefix(entry *db.Oplog) {
+	if restore.InputOptions.StripPrefix == "" {
+		return
+	}
+	entry.Namespace = restore.strippedFullName(entry.Namespace)
+	switch {
+	case entry.Operation == "c" && entry.Object != nil:
+		if from, ok := entry.Object["renameCollection"].(string); ok {
+			entry.Object["renameCollection"] = restore.strippedFullName(from)
+			if to, ok := entry.Object["to"].(string); ok {
+				entry.Object["to"] = restore.strippedFullName(to)
+			}
+			return
+		}
+		for _, command := range oplogCollectionCommands {
+			if name, ok := entry.Object[command].(string); ok {
+				_, entry.Object[command] = restore.strippedNamespace("", name)
+			}
+		}
+	case entry.Operation == "i" && strings.HasSuffix(entry.Namespace, ".system.indexes") && entry.Object != nil:
+		if ns, ok := entry.Object["ns"].(string); ok {
+			entry.Object["ns"] = restore.strippedFullName(ns)
+		}
+	}
+}
+
+func stripNamePrefix(name, prefix string) string {
+	if len(name) > len(prefix) && strings.HasPrefix(name, prefix) {
+		return name[len(prefix):]
+	}
+	return name
+}
+
+// stripIntentPrefix renames the intent, created for a collection as it was dumped,
+// to the namespace it is restored to with --stripPrefix, unless it is skipped.
+// It returns an intent for the dumped namespace, which is the one an archive
+// knows the collection's data and metadata by.
+func (restore *MongoRestore) stripIntentPrefix(intent *intents.Intent, skip bool) (*intents.Intent, error) {
+	if skip {
+		return intent, nil
+	}
+	db, c, err := restore.stripPrefix(intent.DB, intent.C)
+	if err != nil {
+		return nil, err
+	}
+	if db == intent.DB && c == intent.C {
+		return intent, nil
+	}
+	dumped := &intents.Intent{DB: intent.DB, C: intent.C}
+	intent.DB, intent.C = db, c
+	return dumped, nil
+}
@@ -0,0 +1,79 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestStripPrefix(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a dump of collections with an environment prefix", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_strip_prefix")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		dbDir := filepath.Join(dir, "prod_db1")
+		So(os.Mkdir(dbDir, 0755), ShouldBeNil)
+		for _, file := range []string{"prod_users.bson", "prod_users.metadata.json", "prod_orders.bson",
+			"prod_.bson", "system.js.bson"} {
+			So(ioutil.WriteFile(filepath.Join(dbDir, file), []byte{}, 0644), ShouldBeNil)
+		}
+
+		mr := &MongoRestore{
+			manager:      intents.NewIntentManager(),
+			InputOptions: &InputOptions{StripPrefix: "prod_"},
+			ToolOptions:  &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+		}
+		namespaces := func() []string {
+			names := []string{}
+			for _, intent := range mr.manager.Intents() {
+				names = append(names, intent.Namespace())
+			}
+			sort.Strings(names)
+			return names
+		}
+
+		Convey("the collections should be restored without the prefix", func() {
+			ddl, err := newActualPath(dir)
+			So(err, ShouldBeNil)
+			So(mr.CreateAllIntents(ddl, "", ""), ShouldBeNil)
+			So(namespaces(), ShouldResemble,
+				[]string{"prod_db1.orders", "prod_db1.prod_", "prod_db1.system.js", "prod_db1.users"})
+
+			Convey("keeping the dumped files of each", func() {
+				users := mr.manager.IntentForNamespace("prod_db1.users")
+				So(users.BSONPath, ShouldEqual, filepath.Join(dbDir, "prod_users.bson"))
+				So(users.MetadataPath, ShouldEqual, filepath.Join(dbDir, "prod_users.metadata.json"))
+			})
+		})
+
+		Convey("with --stripPrefixFromDBs the database should be renamed too", func() {
+			mr.InputOptions.StripPrefixFromDBs = true
+			ddl, err := newActualPath(dir)
+			So(err, ShouldBeNil)
+			So(mr.CreateAllIntents(ddl, "", ""), ShouldBeNil)
+			So(namespaces(), ShouldResemble,
+				[]string{"db1.orders", "db1.prod_", "db1.system.js", "db1.users"})
+		})
+
+		Convey("a collection that would be stripped to an existing name should be an error", func() {
+			So(ioutil.WriteFile(filepath.Join(dbDir, "orders.bson"), []byte{}, 0644), ShouldBeNil)
+			ddl, err := newActualPath(dir)
+			So(err, ShouldBeNil)
+			err = mr.CreateAllIntents(ddl, "", "")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "prod_db1.orders")
+			So(err.Error(), ShouldContainSubstring, "prod_db1.prod_orders")
+		})
+	})
+}
@@ -0,0 +1,45 @@
+package mongorestore
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/util"
+	"io"
+	"strconv"
+)
+
+// preludeCSVHeader is the header row written by --dumpPreludeCSV.
+var preludeCSVHeader = []string{"db", "collection", "sizeBytes", "indexCount", "hasValidator", "capped"}
+
+// WritePreludeCSV writes a CSV row to out for each namespace in the archive's
+// prelude, in the order the prelude lists them, describing its size and the
+// metadata it was dumped with.
+func (restore *MongoRestore) WritePreludeCSV(prelude *archive.Prelude, out io.Writer) error {
+	writer := csv.NewWriter(out)
+	if err := writer.Write(preludeCSVHeader); err != nil {
+		return err
+	}
+	for _, cm := range prelude.NamespaceMetadatas {
+		options, indexes, err := restore.MetadataFromJSON([]byte(cm.Metadata))
+		if err != nil {
+			return fmt.Errorf("error parsing metadata of %v.%v: %v", cm.Database, cm.Collection, err)
+		}
+		validator, _ := bsonutil.FindValueByKey("validator", &options)
+		capped, _ := bsonutil.FindValueByKey("capped", &options)
+		err = writer.Write([]string{
+			cm.Database,
+			cm.Collection,
+			strconv.Itoa(cm.Size),
+			strconv.Itoa(len(indexes)),
+			strconv.FormatBool(validator != nil),
+			strconv.FormatBool(util.IsTruthy(capped)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
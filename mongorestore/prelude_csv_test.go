@@ -0,0 +1,45 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestWritePreludeCSV(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a prelude of a capped collection, a validated collection and one without metadata", t, func() {
+		prelude := &archive.Prelude{}
+		prelude.AddMetadata(&archive.CollectionMetadata{
+			Database:   "db1",
+			Collection: "log",
+			Size:       4096,
+			Metadata: `{"options":{"capped":true,"size":{"$numberLong":"1048576"}},` +
+				`"indexes":[{"v":2,"key":{"_id":1},"name":"_id_"}]}`,
+		})
+		prelude.AddMetadata(&archive.CollectionMetadata{
+			Database:   "db1",
+			Collection: "people",
+			Size:       123,
+			Metadata: `{"options":{"validator":{"age":{"$gte":0}}},` +
+				`"indexes":[{"v":2,"key":{"_id":1},"name":"_id_"},{"v":2,"key":{"name":1},"name":"name_1"}]}`,
+		})
+		prelude.AddMetadata(&archive.CollectionMetadata{Database: "db2", Collection: "bare"})
+
+		Convey("a header and a row for each namespace should be written", func() {
+			out := &bytes.Buffer{}
+			So((&MongoRestore{}).WritePreludeCSV(prelude, out), ShouldBeNil)
+			So(strings.Split(strings.TrimSpace(out.String()), "\n"), ShouldResemble, []string{
+				"db,collection,sizeBytes,indexCount,hasValidator,capped",
+				"db1,log,4096,1,false,true",
+				"db1,people,123,2,true,false",
+				"db2,bare,0,0,false,false",
+			})
+		})
+	})
+}
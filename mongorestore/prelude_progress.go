@@ -0,0 +1,33 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"time"
+)
+
+// preludeProgressLogger is an archive.ProgressReporter that logs how much of an
+// archive's prelude has been read, so that reading an enormous prelude shows
+// activity before any collection is restored. It logs at most once per interval,
+// so preludes read faster than that are read silently.
+type preludeProgressLogger struct {
+	interval   time.Duration
+	lastLogged time.Time
+	// the number of bytes read when the parser last reported, which a failed
+	// read of the prelude can be resumed from
+	bytesRead int64
+}
+
+func newPreludeProgressLogger(interval time.Duration) *preludeProgressLogger {
+	return &preludeProgressLogger{interval: interval, lastLogged: time.Now()}
+}
+
+// ParserProgress is part of the archive.ProgressReporter interface.
+func (logger *preludeProgressLogger) ParserProgress(bytesRead int64, blocksRead int) {
+	logger.bytesRead = bytesRead
+	if time.Since(logger.lastLogged) < logger.interval {
+		return
+	}
+	logger.lastLogged = time.Now()
+	log.Logf(log.Always, "reading archive prelude: %v read", text.FormatByteAmount(bytesRead))
+}
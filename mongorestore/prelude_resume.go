@@ -0,0 +1,29 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/log"
+	"io"
+)
+
+// preludeReadRetries is the number of times a read of an archive's prelude that
+// fails part way through is resumed before the restore gives up.
+const preludeReadRetries = 3
+
+// readArchivePrelude reads the prelude of the archive. When the archive can be
+// seeked in, as an --archive file that isn't decompressed or copied can, a read
+// that fails after the prelude's header, such as one from a flaky network
+// filesystem, is resumed from the end of the last metadata read rather than
+// failing the restore, up to preludeReadRetries times.
+func (restore *MongoRestore) readArchivePrelude() error {
+	progress := newPreludeProgressLogger(progressBarWaitTime)
+	restore.archive.Prelude = &archive.Prelude{Progress: progress}
+	err := restore.archive.Prelude.Read(restore.archive.In)
+	in, seekable := restore.archive.In.(io.ReadSeeker)
+	for retry := 0; err != nil && seekable && restore.archive.Prelude.Header != nil && retry < preludeReadRetries; retry++ {
+		log.Logf(log.Always, "error reading archive prelude: %v; resuming the read from byte %v",
+			err, progress.bytesRead)
+		err = restore.archive.Prelude.ResumeRead(in, progress.bytesRead)
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package mongorestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+)
+
+// flakyArchiveFile is an archive file whose read at failAt fails once, as a read
+// from a flaky network filesystem might.
+type flakyArchiveFile struct {
+	*bytes.Reader
+	failAt int64
+}
+
+func (file *flakyArchiveFile) Read(p []byte) (int, error) {
+	if file.failAt > 0 {
+		pos := file.Size() - int64(file.Len())
+		if pos >= file.failAt {
+			file.failAt = 0
+			return 0, fmt.Errorf("connection reset by peer")
+		}
+		if pos+int64(len(p)) > file.failAt {
+			p = p[:file.failAt-pos]
+		}
+	}
+	return file.Reader.Read(p)
+}
+
+func (*flakyArchiveFile) Close() error {
+	return nil
+}
+
+func TestReadArchivePrelude(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive file whose read fails in the middle of its prelude", t, func() {
+		collections := []*intents.Intent{}
+		for i := 0; i < 50; i++ {
+			collections = append(collections, &intents.Intent{DB: "db1", C: fmt.Sprintf("c%v", i)})
+		}
+		buf := &closingBuffer{}
+		So(writeTestArchive(buf, 1, collections...), ShouldBeNil)
+		raw := buf.Bytes()
+
+		manager := intents.NewIntentManager()
+		for _, intent := range collections {
+			manager.Put(intent)
+		}
+		prelude, err := archive.NewPrelude(manager, 1, "")
+		So(err, ShouldBeNil)
+		preludeBuf := &bytes.Buffer{}
+		So(prelude.Write(preludeBuf), ShouldBeNil)
+		preludeSize := preludeBuf.Len()
+
+		file := &flakyArchiveFile{Reader: bytes.NewReader(raw), failAt: int64(preludeSize / 2)}
+
+		Convey("the read should be resumed, leaving the archive at the end of the prelude", func() {
+			restore := &MongoRestore{archive: &archive.Reader{In: file}}
+			So(restore.readArchivePrelude(), ShouldBeNil)
+			So(len(restore.archive.Prelude.NamespaceMetadatas), ShouldEqual, 50)
+			So(file.Len(), ShouldEqual, len(raw)-preludeSize)
+		})
+
+		Convey("the read should fail if the archive can't be seeked in", func() {
+			restore := &MongoRestore{archive: &archive.Reader{In: ioutil.NopCloser(file)}}
+			So(restore.readArchivePrelude(), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,103 @@
+package mongorestore
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// Kinds of empty values that --pruneEmpty removes.
+const (
+	emptyNull     = "null"
+	emptyString   = "string"
+	emptyArray    = "array"
+	emptyDocument = "document"
+)
+
+// parsePruneKinds parses the argument to --pruneEmptyKinds, a comma separated
+// list of the kinds of empty values to remove, into a set of them.
+func parsePruneKinds(arg string) (map[string]bool, error) {
+	kinds := map[string]bool{}
+	for _, kind := range strings.Split(arg, ",") {
+		kind = strings.TrimSpace(kind)
+		switch kind {
+		case emptyNull, emptyString, emptyArray, emptyDocument:
+			kinds[kind] = true
+		default:
+			return nil, fmt.Errorf("'%v' is not one of '%v', '%v', '%v' or '%v'",
+				kind, emptyNull, emptyString, emptyArray, emptyDocument)
+		}
+	}
+	return kinds, nil
+}
+
+// pruneEmptyFields creates a documentTransform that removes the fields whose
+// values are of the given kinds of empty, at any depth of the document, including
+// in the documents of arrays. Subdocuments left empty by removing their fields are
+// removed too if empty documents are. The elements of arrays are never removed,
+// so that the positions of the rest don't change, and neither is the _id.
+func pruneEmptyFields(kinds map[string]bool) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		pruned, changed := pruneDocument(doc, kinds, true)
+		if !changed {
+			return raw, nil
+		}
+		return bson.Marshal(pruned)
+	}
+}
+
+// pruneDocument returns the document without its empty fields, and whether
+// any were removed.
+func pruneDocument(doc bson.D, kinds map[string]bool, topLevel bool) (bson.D, bool) {
+	pruned := bson.D{}
+	changed := false
+	for _, elem := range doc {
+		value, valueChanged := pruneValue(elem.Value, kinds)
+		changed = changed || valueChanged
+		if (!topLevel || elem.Name != "_id") && isEmptyValue(value, kinds) {
+			changed = true
+			continue
+		}
+		pruned = append(pruned, bson.DocElem{elem.Name, value})
+	}
+	return pruned, changed
+}
+
+// pruneValue prunes the fields of the value if it is a document, or of the
+// documents in it if it is an array.
+func pruneValue(value interface{}, kinds map[string]bool) (interface{}, bool) {
+	switch v := value.(type) {
+	case bson.D:
+		return pruneDocument(v, kinds, false)
+	case []interface{}:
+		changed := false
+		for i := range v {
+			var elemChanged bool
+			v[i], elemChanged = pruneValue(v[i], kinds)
+			changed = changed || elemChanged
+		}
+		return v, changed
+	}
+	return value, false
+}
+
+// isEmptyValue returns true if the value is one of the given kinds of empty.
+// Zeros and false are never empty.
+func isEmptyValue(value interface{}, kinds map[string]bool) bool {
+	switch v := value.(type) {
+	case nil:
+		return kinds[emptyNull]
+	case string:
+		return v == "" && kinds[emptyString]
+	case []interface{}:
+		return len(v) == 0 && kinds[emptyArray]
+	case bson.D:
+		return len(v) == 0 && kinds[emptyDocument]
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestPruneEmpty(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a document holding empty and non-empty values", t, func() {
+		raw, err := bson.Marshal(bson.D{
+			{"_id", nil},
+			{"zero", 0},
+			{"no", false},
+			{"null", nil},
+			{"blank", ""},
+			{"name", "ann"},
+			{"list", []interface{}{}},
+			{"sub", bson.D{}},
+			{"nested", bson.D{{"empty", bson.D{{"none", nil}}}, {"count", 0.0}}},
+			{"items", []interface{}{bson.D{{"a", ""}, {"b", 1}}, nil, ""}},
+		})
+		So(err, ShouldBeNil)
+
+		prune := func(arg string) bson.D {
+			kinds, err := parsePruneKinds(arg)
+			So(err, ShouldBeNil)
+			out, err := pruneEmptyFields(kinds)(raw)
+			So(err, ShouldBeNil)
+			doc := bson.D{}
+			So(bson.Unmarshal(out, &doc), ShouldBeNil)
+			return doc
+		}
+
+		Convey("every kind of empty field should be pruned, recursively, keeping zeros and false", func() {
+			So(prune("null,string,array,document"), ShouldResemble, bson.D{
+				{"_id", nil},
+				{"zero", 0},
+				{"no", false},
+				{"name", "ann"},
+				{"nested", bson.D{{"count", 0.0}}},
+				{"items", []interface{}{bson.D{{"b", 1}}, nil, ""}},
+			})
+		})
+
+		Convey("only the kinds given should be pruned", func() {
+			So(prune("null, array"), ShouldResemble, bson.D{
+				{"_id", nil},
+				{"zero", 0},
+				{"no", false},
+				{"blank", ""},
+				{"name", "ann"},
+				{"sub", bson.D{}},
+				{"nested", bson.D{{"empty", bson.D{}}, {"count", 0.0}}},
+				{"items", []interface{}{bson.D{{"a", ""}, {"b", 1}}, nil, ""}},
+			})
+		})
+	})
+
+	Convey("A document without empty fields should be passed through", t, func() {
+		raw, err := bson.Marshal(bson.D{{"_id", 1}, {"a", bson.D{{"b", 0}}}})
+		So(err, ShouldBeNil)
+		kinds, err := parsePruneKinds("null,string,array,document")
+		So(err, ShouldBeNil)
+		out, err := pruneEmptyFields(kinds)(raw)
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, raw)
+	})
+
+	Convey("Unknown kinds should be rejected", t, func() {
+		_, err := parsePruneKinds("null,zero")
+		So(err, ShouldNotBeNil)
+	})
+}
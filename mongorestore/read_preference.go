@@ -0,0 +1,51 @@
+package mongorestore
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2"
+)
+
+// sessionGetter gets sessions connected to the target. It is implemented by
+// db.SessionProvider.
+type sessionGetter interface {
+	GetSession() (*mgo.Session, error)
+}
+
+// metadataReadModes are the values of --metadataReadPreference, each setting a
+// session to the driver's mode closest to that read preference: "primary" reads
+// only from the primary, "secondaryPreferred" reads from a secondary while there
+// is one, and "nearest" reads from any member.
+var metadataReadModes = map[string]func(*mgo.Session){
+	"primary":            func(session *mgo.Session) { session.SetMode(mgo.Strong, true) },
+	"secondaryPreferred": func(session *mgo.Session) { session.SetMode(mgo.Monotonic, true) },
+	"nearest":            func(session *mgo.Session) { session.SetMode(mgo.Eventual, true) },
+}
+
+// parseMetadataReadPreference returns what sets a session to the read preference
+// of --metadataReadPreference.
+func parseMetadataReadPreference(arg string) (func(*mgo.Session), error) {
+	setMode, ok := metadataReadModes[arg]
+	if !ok {
+		return nil, fmt.Errorf("--metadataReadPreference must be 'primary', 'secondaryPreferred' or 'nearest'")
+	}
+	return setMode, nil
+}
+
+// metadataReadSession returns a session for the reads that check the target before
+// restoring a collection, such as whether the collection exists or is empty, with
+// the --metadataReadPreference. Everything else, and all writes, use sessions of
+// their own, which read from and write to the primary.
+func (restore *MongoRestore) metadataReadSession() (*mgo.Session, error) {
+	var sessions sessionGetter = restore.SessionProvider
+	if restore.sessions != nil {
+		sessions = restore.sessions
+	}
+	session, err := sessions.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	if restore.setMetadataReadMode != nil {
+		restore.setMetadataReadMode(session)
+	}
+	return session, nil
+}
@@ -0,0 +1,78 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"testing"
+)
+
+// stubSessions hands out unconnected sessions on the primary, as a provider
+// connected to a replica set would, keeping each.
+type stubSessions struct {
+	sessions []*mgo.Session
+}
+
+func (stub *stubSessions) GetSession() (*mgo.Session, error) {
+	session := &mgo.Session{}
+	session.SetMode(mgo.Strong, true)
+	stub.sessions = append(stub.sessions, session)
+	return session, nil
+}
+
+// recordingSessions hands out the sessions of a provider, keeping each.
+type recordingSessions struct {
+	sessionGetter
+	sessions []*mgo.Session
+}
+
+func (recording *recordingSessions) GetSession() (*mgo.Session, error) {
+	session, err := recording.sessionGetter.GetSession()
+	if err == nil {
+		recording.sessions = append(recording.sessions, session)
+	}
+	return session, err
+}
+
+func TestMetadataReadPreference(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --metadataReadPreference=secondaryPreferred", t, func() {
+		stub := &stubSessions{}
+		restore := &MongoRestore{sessions: stub}
+		var err error
+		restore.setMetadataReadMode, err = parseMetadataReadPreference("secondaryPreferred")
+		So(err, ShouldBeNil)
+
+		Convey("the reads that check the target should be allowed on a secondary", func() {
+			session, err := restore.metadataReadSession()
+			So(err, ShouldBeNil)
+			So(session.Mode(), ShouldEqual, mgo.Monotonic)
+
+			Convey("while the sessions of inserts stay on the primary", func() {
+				insertSession, err := restore.sessions.GetSession()
+				So(err, ShouldBeNil)
+				So(insertSession.Mode(), ShouldEqual, mgo.Strong)
+				So(len(stub.sessions), ShouldEqual, 2)
+				So(stub.sessions[0].Mode(), ShouldEqual, mgo.Monotonic)
+			})
+		})
+
+		Convey("without it, the reads should be on the primary", func() {
+			restore.setMetadataReadMode = nil
+			session, err := restore.metadataReadSession()
+			So(err, ShouldBeNil)
+			So(session.Mode(), ShouldEqual, mgo.Strong)
+		})
+	})
+
+	Convey("Read preferences the driver can't honor should be rejected", t, func() {
+		for _, arg := range []string{"primary", "secondaryPreferred", "nearest"} {
+			_, err := parseMetadataReadPreference(arg)
+			So(err, ShouldBeNil)
+		}
+		_, err := parseMetadataReadPreference("secondary")
+		So(err, ShouldNotBeNil)
+	})
+}
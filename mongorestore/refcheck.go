@@ -0,0 +1,184 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// refCheckBatchSize is how many references --checkRefs looks up at a time.
+const refCheckBatchSize = 1000
+
+// refCheckSampleSize is how many dangling references --checkRefs reports.
+const refCheckSampleSize = 10
+
+// refCheck is a parsed --checkRefs argument of the form "db.coll:field->otherColl".
+// Each value of the Field of DB.C should be the _id of a document of DB.RefC.
+type refCheck refRewrite
+
+// parseRefCheck parses an argument to --checkRefs.
+func parseRefCheck(arg string) (*refCheck, error) {
+	rewrite, err := parseRefRewrite(arg)
+	if err != nil {
+		return nil, err
+	}
+	return (*refCheck)(rewrite), nil
+}
+
+func (check *refCheck) String() string {
+	return fmt.Sprintf("%v.%v:%v->%v", check.DB, check.C, check.Field, check.RefC)
+}
+
+// refLookup is what --checkRefs reads from the target, so that tests can stub it out.
+type refLookup interface {
+	// forEachRef calls fn with the value of the possibly dotted field of each
+	// document of the collection that has it.
+	forEachRef(dbName, colName, field string, fn func(ref interface{}) error) error
+	// existingIds returns those of the given _ids that documents of the collection have.
+	existingIds(dbName, colName string, ids []interface{}) ([]interface{}, error)
+}
+
+// sessionRefLookup is the refLookup of a connection to the target.
+type sessionRefLookup struct {
+	session *mgo.Session
+}
+
+func (lookup *sessionRefLookup) forEachRef(dbName, colName, field string, fn func(ref interface{}) error) error {
+	iter := lookup.session.DB(dbName).C(colName).
+		Find(bson.M{field: bson.M{"$exists": true}}).Select(bson.M{"_id": 0, field: 1}).Iter()
+	doc := bson.M{}
+	for iter.Next(&doc) {
+		if ref, ok := lookupField(doc, field); ok {
+			if err := fn(ref); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+		doc = bson.M{}
+	}
+	return iter.Close()
+}
+
+func (lookup *sessionRefLookup) existingIds(dbName, colName string, ids []interface{}) ([]interface{}, error) {
+	docs := []struct {
+		ID interface{} `bson:"_id"`
+	}{}
+	err := lookup.session.DB(dbName).C(colName).
+		Find(bson.M{"_id": bson.M{"$in": ids}}).Select(bson.M{"_id": 1}).All(&docs)
+	if err != nil {
+		return nil, err
+	}
+	existing := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		existing = append(existing, doc.ID)
+	}
+	return existing, nil
+}
+
+// refCheckResult is what --checkRefs found for one of its arguments.
+type refCheckResult struct {
+	Check      *refCheck
+	References int64
+	Dangling   int64
+	// up to refCheckSampleSize of the dangling references, in the order found
+	Sample []interface{}
+}
+
+// checkRefs finds the references of the check that no document has as its _id.
+// A field holding an array is taken as a reference for each of its elements.
+func checkRefs(lookup refLookup, check *refCheck) (*refCheckResult, error) {
+	result := &refCheckResult{Check: check, Sample: []interface{}{}}
+	batch := []interface{}{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		existing, err := lookup.existingIds(check.DB, check.RefC, batch)
+		if err != nil {
+			return err
+		}
+		found := map[string]bool{}
+		for _, id := range existing {
+			key, err := idKey(id)
+			if err != nil {
+				return err
+			}
+			found[key] = true
+		}
+		for _, ref := range batch {
+			key, err := idKey(ref)
+			if err != nil {
+				return err
+			}
+			if found[key] {
+				continue
+			}
+			result.Dangling++
+			if len(result.Sample) < refCheckSampleSize {
+				result.Sample = append(result.Sample, ref)
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	add := func(ref interface{}) error {
+		result.References++
+		batch = append(batch, ref)
+		if len(batch) >= refCheckBatchSize {
+			return flush()
+		}
+		return nil
+	}
+	err := lookup.forEachRef(check.DB, check.C, check.Field, func(ref interface{}) error {
+		if refs, ok := ref.([]interface{}); ok {
+			for _, elem := range refs {
+				if err := add(elem); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return add(ref)
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error checking references of %v: %v", check, err)
+	}
+	return result, nil
+}
+
+// CheckRefs runs the checks of --checkRefs against the target once everything
+// is inserted, logging the number of dangling references each finds and a sample
+// of them. Nothing is modified, and dangling references don't fail the restore.
+func (restore *MongoRestore) CheckRefs() ([]*refCheckResult, error) {
+	lookup := restore.refLookup
+	if lookup == nil {
+		session, err := restore.SessionProvider.GetSession()
+		if err != nil {
+			return nil, fmt.Errorf("error establishing connection: %v", err)
+		}
+		defer session.Close()
+		lookup = &sessionRefLookup{session: session}
+	}
+	results := []*refCheckResult{}
+	for _, check := range restore.refChecks {
+		result, err := checkRefs(lookup, check)
+		if err != nil {
+			return nil, err
+		}
+		if result.Dangling > 0 {
+			log.Logf(log.Always, "%v of %v %v from %v are dangling, e.g. %v",
+				result.Dangling, result.References, util.Pluralize(int(result.References), "reference", "references"),
+				check, result.Sample)
+		} else {
+			log.Logf(log.Always, "all %v %v from %v resolve",
+				result.References, util.Pluralize(int(result.References), "reference", "references"), check)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
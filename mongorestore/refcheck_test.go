@@ -0,0 +1,95 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+// stubRefLookup is a refLookup over collections held in memory.
+type stubRefLookup struct {
+	collections map[string][]bson.M
+	lookups     int
+}
+
+func (lookup *stubRefLookup) forEachRef(dbName, colName, field string, fn func(ref interface{}) error) error {
+	for _, doc := range lookup.collections[dbName+"."+colName] {
+		if ref, ok := lookupField(doc, field); ok {
+			if err := fn(ref); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (lookup *stubRefLookup) existingIds(dbName, colName string, ids []interface{}) ([]interface{}, error) {
+	lookup.lookups++
+	existing := []interface{}{}
+	for _, doc := range lookup.collections[dbName+"."+colName] {
+		docKey, _ := idKey(doc["_id"])
+		for _, id := range ids {
+			// the server finds equal numbers of any type, and returns them as stored
+			if key, _ := idKey(id); key == docKey {
+				existing = append(existing, doc["_id"])
+				break
+			}
+		}
+	}
+	return existing, nil
+}
+
+func TestCheckRefs(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With restored orders referencing customers, one of them dangling", t, func() {
+		lookup := &stubRefLookup{collections: map[string][]bson.M{
+			"shop.customers": {{"_id": int64(1)}, {"_id": 2.0}},
+			"shop.orders": {
+				{"_id": "a", "customer": bson.M{"id": 1}},
+				{"_id": "b", "customer": bson.M{"id": int32(2)}},
+				{"_id": "c", "customer": bson.M{"id": 3}},
+				{"_id": "d"},
+			},
+			"shop.bundles": {{"_id": "x", "customers": []interface{}{1, 4, 5}}},
+		}}
+		check, err := parseRefCheck("shop.orders:customer.id->customers")
+		So(err, ShouldBeNil)
+
+		Convey("the dangling reference should be counted and sampled", func() {
+			result, err := checkRefs(lookup, check)
+			So(err, ShouldBeNil)
+			So(result.References, ShouldEqual, 3)
+			So(result.Dangling, ShouldEqual, 1)
+			So(result.Sample, ShouldResemble, []interface{}{3})
+		})
+
+		Convey("each element of an array should be checked", func() {
+			check, err := parseRefCheck("shop.bundles:customers->customers")
+			So(err, ShouldBeNil)
+			result, err := checkRefs(lookup, check)
+			So(err, ShouldBeNil)
+			So(result.References, ShouldEqual, 3)
+			So(result.Dangling, ShouldEqual, 2)
+			So(result.Sample, ShouldResemble, []interface{}{4, 5})
+		})
+
+		Convey("the checks of --checkRefs should be run through the lookup", func() {
+			restore := &MongoRestore{refLookup: lookup, refChecks: []*refCheck{check}}
+			results, err := restore.CheckRefs()
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Dangling, ShouldEqual, 1)
+			So(lookup.lookups, ShouldEqual, 1)
+		})
+	})
+
+	Convey("Malformed --checkRefs arguments should be rejected", t, func() {
+		for _, arg := range []string{"shop.orders", "orders:customer->customers", "shop.orders:->customers"} {
+			_, err := parseRefCheck(arg)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// refRewrite is a parsed --rewriteRefs argument of the form "db.coll:field->otherColl".
+// The documents of DB.RefC are given new _ids, and the references to them
+// in the Field of DB.C are rewritten to match.
+type refRewrite struct {
+	DB    string
+	C     string
+	Field string
+	RefC  string
+}
+
+// idMap maps the original _ids of a collection, keyed by their BSON encoding,
+// to the new ObjectIds they are restored with. The map is held in memory for the
+// whole restore, and costs on the order of 100 bytes per document in the
+// referenced collection when its _ids are ObjectIds.
+type idMap map[string]bson.ObjectId
+
+// parseRefRewrite parses an argument to --rewriteRefs.
+func parseRefRewrite(arg string) (*refRewrite, error) {
+	colon := strings.Index(arg, ":")
+	arrow := strings.Index(arg, "->")
+	if colon < 0 || arrow < colon {
+		return nil, fmt.Errorf("expected the form db.coll:field->otherColl")
+	}
+	ns, field, refC := arg[:colon], arg[colon+1:arrow], arg[arrow+2:]
+	dot := strings.Index(ns, ".")
+	if dot <= 0 || dot == len(ns)-1 {
+		return nil, fmt.Errorf("'%v' is not a namespace of the form db.coll", ns)
+	}
+	if field == "" || refC == "" {
+		return nil, fmt.Errorf("expected the form db.coll:field->otherColl")
+	}
+	return &refRewrite{DB: ns[:dot], C: ns[dot+1:], Field: field, RefC: refC}, nil
+}
+
+// idKey returns the key of an _id in an idMap, or of a reference to it. Numbers
+// are keyed by their value, as the server compares them, so that an int32, an
+// int64 and a double that are equal have the same key.
+func idKey(id interface{}) (string, error) {
+	raw, err := bson.Marshal(bson.D{{"_id", normalizeNumber(id)}})
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// normalizeNumber returns a number as a double if it can be held in one exactly,
+// and any other value as it is.
+func normalizeNumber(value interface{}) interface{} {
+	var n int64
+	switch v := value.(type) {
+	case int:
+		n = int64(v)
+	case int32:
+		n = int64(v)
+	case int64:
+		n = v
+	default:
+		return value
+	}
+	// integers beyond 2^53 can't all be held in a double
+	if n > 1<<53 || n < -(1<<53) {
+		return n
+	}
+	return float64(n)
+}
+
+// buildIDMap reads all of the documents from bsonSource and assigns each of their
+// _ids a new ObjectId, generated by calling next.
+func buildIDMap(bsonSource *db.DecodedBSONSource, next func() bson.ObjectId) (idMap, error) {
+	ids := idMap{}
+	doc := struct {
+		ID interface{} `bson:"_id"`
+	}{}
+	for bsonSource.Next(&doc) {
+		key, err := idKey(doc.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids[key] = next()
+	}
+	if err := bsonSource.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// LoadIDMaps makes a first pass over the collections referenced by --rewriteRefs,
+// building the map of their old _ids to new ones. This must be done before the
+// intent manager is finalized.
+func (restore *MongoRestore) LoadIDMaps() error {
+	restore.idMaps = map[string]idMap{}
+	for _, rewrite := range restore.refRewrites {
+		ns := rewrite.DB + "." + rewrite.RefC
+		if _, ok := restore.idMaps[ns]; ok {
+			continue
+		}
+		intent := restore.manager.IntentForNamespace(ns)
+		if intent == nil || intent.BSONFile == nil {
+			return fmt.Errorf("no collection %v to rewrite references to", ns)
+		}
+		log.Logf(log.Info, "assigning new _ids to the documents of %v", ns)
+		err := intent.BSONFile.Open()
+		if err != nil {
+			return err
+		}
+		bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(intent.BSONFile))
+		ids, err := buildIDMap(bsonSource, restore.newObjectIds(ns))
+		bsonSource.Close()
+		intent.BSONFile.Close()
+		if err != nil {
+			return fmt.Errorf("error reading _ids of %v: %v", ns, err)
+		}
+		restore.idMaps[ns] = ids
+	}
+	return nil
+}
+
+// getRefRewriteTransforms returns the transforms that apply --rewriteRefs to the intent's documents.
+func (restore *MongoRestore) getRefRewriteTransforms(intent *intents.Intent) []documentTransform {
+	transforms := []documentTransform{}
+	if ids, ok := restore.idMaps[intent.Namespace()]; ok {
+		transforms = append(transforms, rewriteField("_id", ids))
+	}
+	for _, rewrite := range restore.refRewrites {
+		if rewrite.DB == intent.DB && rewrite.C == intent.C {
+			ids := restore.idMaps[rewrite.DB+"."+rewrite.RefC]
+			transforms = append(transforms, rewriteField(rewrite.Field, ids))
+		}
+	}
+	return transforms
+}
+
+// rewriteField creates a documentTransform that replaces the value of the top level
+// field with its new _id from ids. Values that aren't in ids are left as is.
+func rewriteField(field string, ids idMap) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		for i, elem := range doc {
+			if elem.Name != field {
+				continue
+			}
+			key, err := idKey(elem.Value)
+			if err != nil {
+				return nil, err
+			}
+			newID, ok := ids[key]
+			if !ok {
+				return raw, nil
+			}
+			doc[i].Value = newID
+			return bson.Marshal(doc)
+		}
+		return raw, nil
+	}
+}
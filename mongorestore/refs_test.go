@@ -0,0 +1,100 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseRefRewrite(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --rewriteRefs arguments", t, func() {
+		Convey("a well formed argument should parse", func() {
+			rewrite, err := parseRefRewrite("shop.orders:customer->customers")
+			So(err, ShouldBeNil)
+			So(*rewrite, ShouldResemble, refRewrite{
+				DB: "shop", C: "orders", Field: "customer", RefC: "customers"})
+		})
+		Convey("malformed arguments should error", func() {
+			for _, arg := range []string{
+				"orders:customer->customers",
+				"shop.orders->customers",
+				"shop.orders:customer",
+				"shop.orders:->customers",
+				"shop.orders:customer->",
+			} {
+				_, err := parseRefRewrite(arg)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestRewriteRefs(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a parent collection and a child collection referencing it", t, func() {
+		parents := &bytes.Buffer{}
+		for _, id := range []int{1, 2, 3} {
+			raw, err := bson.Marshal(bson.D{{"_id", id}, {"name", "parent"}})
+			So(err, ShouldBeNil)
+			parents.Write(raw)
+		}
+		parentsSource := db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(parents)))
+		ids, err := buildIDMap(parentsSource, bson.NewObjectId)
+		So(err, ShouldBeNil)
+		So(len(ids), ShouldEqual, 3)
+
+		restore := &MongoRestore{
+			refRewrites: []*refRewrite{{DB: "db", C: "children", Field: "parent", RefC: "parents"}},
+			idMaps:      map[string]idMap{"db.parents": ids},
+		}
+
+		Convey("the child's reference should point at the parent's new _id", func() {
+			parentTransform := chainTransforms(
+				restore.getRefRewriteTransforms(&intents.Intent{DB: "db", C: "parents"}))
+			childTransform := chainTransforms(
+				restore.getRefRewriteTransforms(&intents.Intent{DB: "db", C: "children"}))
+			So(parentTransform, ShouldNotBeNil)
+			So(childTransform, ShouldNotBeNil)
+
+			raw, _ := bson.Marshal(bson.D{{"_id", 2}, {"name", "parent"}})
+			raw, err := parentTransform(raw)
+			So(err, ShouldBeNil)
+			parent := bson.D{}
+			So(bson.Unmarshal(raw, &parent), ShouldBeNil)
+			newID, ok := parent[0].Value.(bson.ObjectId)
+			So(ok, ShouldBeTrue)
+
+			raw, _ = bson.Marshal(bson.D{{"_id", 10}, {"parent", 2}})
+			raw, err = childTransform(raw)
+			So(err, ShouldBeNil)
+			child := bson.D{}
+			So(bson.Unmarshal(raw, &child), ShouldBeNil)
+			So(child[0].Value, ShouldEqual, 10)
+			So(child[1].Value, ShouldEqual, newID)
+		})
+
+		Convey("dangling references should be left as they are", func() {
+			childTransform := chainTransforms(
+				restore.getRefRewriteTransforms(&intents.Intent{DB: "db", C: "children"}))
+			raw, _ := bson.Marshal(bson.D{{"_id", 11}, {"parent", 4}})
+			rewritten, err := childTransform(raw)
+			So(err, ShouldBeNil)
+			So(rewritten, ShouldResemble, raw)
+		})
+
+		Convey("unrelated collections should not be transformed", func() {
+			transforms := restore.getRefRewriteTransforms(&intents.Intent{DB: "db", C: "other"})
+			So(chainTransforms(transforms), ShouldBeNil)
+		})
+	})
+}
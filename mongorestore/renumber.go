@@ -0,0 +1,106 @@
+package mongorestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// getRenumberTransform returns the transform that renumbers the _ids of the
+// intent's documents, or nil if its collection isn't given to --renumberIds.
+func (restore *MongoRestore) getRenumberTransform(intent *intents.Intent) documentTransform {
+	ns := intent.Namespace()
+	if !restore.renumberNamespaces[ns] {
+		return nil
+	}
+	return renumberIds(func(oldID interface{}) {
+		restore.renumberedMutex.Lock()
+		defer restore.renumberedMutex.Unlock()
+		if restore.renumberedIds == nil {
+			restore.renumberedIds = map[string][]interface{}{}
+		}
+		restore.renumberedIds[ns] = append(restore.renumberedIds[ns], oldID)
+	})
+}
+
+// renumberIds creates a documentTransform that gives the documents sequential
+// integer _ids from 1, in the order they're read, passing each original _id to
+// record. Documents without an _id are given one too, recorded as a null.
+func renumberIds(record func(oldID interface{})) documentTransform {
+	next := int64(1)
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		newID := next
+		next++
+		for i := range doc {
+			if doc[i].Name == "_id" {
+				record(doc[i].Value)
+				doc[i].Value = newID
+				return bson.Marshal(doc)
+			}
+		}
+		record(nil)
+		return bson.Marshal(append(bson.D{{"_id", newID}}, doc...))
+	}
+}
+
+// WriteRenumberedIds writes the mapping from the original _ids of the documents
+// renumbered by --renumberIds to their new _ids to path.
+func (restore *MongoRestore) WriteRenumberedIds(path string) error {
+	restore.renumberedMutex.Lock()
+	renumbered := restore.renumberedIds
+	restore.renumberedMutex.Unlock()
+
+	out := &bytes.Buffer{}
+	if err := writeRenumberedIds(out, renumbered); err != nil {
+		return fmt.Errorf("error building the map of renumbered ids: %v", err)
+	}
+	if err := ioutil.WriteFile(path, out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing the map of renumbered ids: %v", err)
+	}
+	log.Logf(log.Always, "wrote the map of renumbered ids to %v", path)
+	return nil
+}
+
+// writeRenumberedIds writes a line of JSON to out for each renumbered document,
+// in namespace order and then in order of their new _ids, of the form
+// {"ns": "db.coll", "old": <original _id>, "new": <new _id>}. The original
+// _ids are written as extended JSON, so that they can be read back as BSON.
+func writeRenumberedIds(out io.Writer, renumbered map[string][]interface{}) error {
+	namespaces := []string{}
+	for ns := range renumbered {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		for i, oldID := range renumbered[ns] {
+			line, err := bsonutil.ConvertBSONValueToJSON(bson.D{
+				{"ns", ns},
+				{"old", oldID},
+				{"new", int64(i + 1)},
+			})
+			if err != nil {
+				return err
+			}
+			encoded, err := json.Marshal(line)
+			if err != nil {
+				return err
+			}
+			if _, err = fmt.Fprintf(out, "%s\n", encoded); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
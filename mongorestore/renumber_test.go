@@ -0,0 +1,108 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenumberIds(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --renumberIds on a collection whose integer _ids have gaps", t, func() {
+		restore := &MongoRestore{
+			OutputOptions:      &OutputOptions{},
+			renumberNamespaces: map[string]bool{"db1.orders": true},
+		}
+		transform, err := restore.getDocumentTransform(&intents.Intent{DB: "db1", C: "orders"})
+		So(err, ShouldBeNil)
+
+		newIds := []interface{}{}
+		for _, doc := range []bson.D{
+			{{"_id", 3}, {"item", "a"}},
+			{{"_id", 7}, {"item", "b"}},
+			{{"_id", int64(40)}, {"item", "c"}},
+			{{"item", "d"}},
+		} {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			out, err := transform(raw)
+			So(err, ShouldBeNil)
+			renumbered := bson.D{}
+			So(bson.Unmarshal(out, &renumbered), ShouldBeNil)
+			So(renumbered[0].Name, ShouldEqual, "_id")
+			So(renumbered[1], ShouldResemble, doc[len(doc)-1])
+			newIds = append(newIds, renumbered[0].Value)
+		}
+
+		Convey("the _ids should be renumbered contiguously from 1", func() {
+			So(newIds, ShouldResemble, []interface{}{int64(1), int64(2), int64(3), int64(4)})
+		})
+
+		Convey("the mapping file should list each original _id with its new one", func() {
+			dir, err := ioutil.TempDir("", "mongorestore_renumber")
+			So(err, ShouldBeNil)
+			Reset(func() { os.RemoveAll(dir) })
+			path := filepath.Join(dir, "ids.json")
+
+			So(restore.WriteRenumberedIds(path), ShouldBeNil)
+			contents, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(strings.Split(strings.TrimSpace(string(contents)), "\n"), ShouldResemble, []string{
+				`{"ns":"db1.orders","old":3,"new":{"$numberLong":"1"}}`,
+				`{"ns":"db1.orders","old":7,"new":{"$numberLong":"2"}}`,
+				`{"ns":"db1.orders","old":{"$numberLong":"40"},"new":{"$numberLong":"3"}}`,
+				`{"ns":"db1.orders","old":null,"new":{"$numberLong":"4"}}`,
+			})
+		})
+	})
+
+	Convey("With --renumberIds on a collection some of whose documents are skipped", t, func() {
+		restore := &MongoRestore{
+			OutputOptions:      &OutputOptions{},
+			renumberNamespaces: map[string]bool{"db1.orders": true},
+			reshardKeys:        []*reshardKey{{DB: "db1", C: "orders", Key: bson.D{{"region", 1}}}},
+		}
+		transform, err := restore.getDocumentTransform(&intents.Intent{DB: "db1", C: "orders"})
+		So(err, ShouldBeNil)
+
+		Convey("the documents restored should be numbered without gaps", func() {
+			newIds := []interface{}{}
+			for _, doc := range []bson.D{
+				{{"_id", 3}, {"region", "eu"}},
+				{{"_id", 7}},
+				{{"_id", 9}, {"region", "us"}},
+			} {
+				raw, err := bson.Marshal(doc)
+				So(err, ShouldBeNil)
+				out, err := transform(raw)
+				So(err, ShouldBeNil)
+				if out == nil {
+					continue
+				}
+				renumbered := bson.D{}
+				So(bson.Unmarshal(out, &renumbered), ShouldBeNil)
+				newIds = append(newIds, renumbered[0].Value)
+			}
+			So(newIds, ShouldResemble, []interface{}{int64(1), int64(2)})
+			So(restore.renumberedIds["db1.orders"], ShouldResemble, []interface{}{3, 9})
+		})
+	})
+
+	Convey("Collections not given to --renumberIds should keep their _ids", t, func() {
+		restore := &MongoRestore{
+			OutputOptions:      &OutputOptions{},
+			renumberNamespaces: map[string]bool{"db1.orders": true},
+		}
+		transform, err := restore.getDocumentTransform(&intents.Intent{DB: "db1", C: "customers"})
+		So(err, ShouldBeNil)
+		So(transform, ShouldBeNil)
+	})
+}
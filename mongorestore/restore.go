@@ -7,6 +7,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"io/ioutil"
 	"strings"
@@ -17,17 +18,77 @@ const (
 	progressBarLength   = 24
 	progressBarWaitTime = time.Second * 3
 	insertBufferFactor  = 16
+	// number of documents the archive demultiplexer may queue up for each collection
+	archiveNamespaceBufferSize = 16
 )
 
+// documentInserter buffers documents and inserts them in batches.
+// It is implemented by db.BufferedBulkInserter and db.RetryableInserter.
+type documentInserter interface {
+	Insert(doc interface{}) error
+	Flush() error
+}
+
+// newDocumentInserter returns the inserter that a worker inserts in to the
+// collection with. Only the insert commands of a RetryableInserter, used for
+// --retryWrites, --comment, causal sessions and --idCollisions, report each
+// document the server refuses. The bulk inserts used otherwise fail with the
+// error of the last document refused, which logInsertError counts as one error.
+func (restore *MongoRestore) newDocumentInserter(coll *mgo.Collection) (documentInserter, error) {
+	var bulk documentInserter
+	if restore.OutputOptions.RetryWrites {
+		var err error
+		bulk, err = db.NewRetryableInserter(
+			coll, restore.ToolOptions.BulkBufferSize, !restore.OutputOptions.StopOnError, restore.safety)
+		if err != nil {
+			return nil, err
+		}
+	} else if restore.comment != "" || restore.causalSession != nil ||
+		restore.OutputOptions.IdCollisions == idCollisionsSkip ||
+		restore.OutputOptions.IdCollisions == idCollisionsReplace {
+		bulk = db.NewCommandInserter(
+			coll, restore.ToolOptions.BulkBufferSize, !restore.OutputOptions.StopOnError, restore.safety)
+	} else {
+		bulk = db.NewBufferedBulkInserter(
+			coll, restore.ToolOptions.BulkBufferSize, !restore.OutputOptions.StopOnError)
+	}
+	if commanded, ok := bulk.(*db.RetryableInserter); ok {
+		if restore.OutputOptions.IdCollisions == idCollisionsReplace {
+			commanded.ReplaceById()
+		}
+		commanded.SetComment(restore.comment)
+		if restore.causalSession != nil {
+			commanded.SetCausalSession(restore.causalSession)
+		}
+	}
+	return bulk, nil
+}
+
 // RestoreIntents iterates through all of the intents stored in the IntentManager, and restores them.
 func (restore *MongoRestore) RestoreIntents() error {
 	// start up the progress bar manager
 	restore.progressManager = progress.NewProgressBarManager(log.Writer(0), progressBarWaitTime)
 	restore.progressManager.Start()
 	defer restore.progressManager.Stop()
+	if restore.metrics != nil {
+		bar := &progress.Bar{
+			Name:      "total",
+			Watching:  restore.metrics,
+			BarLength: progressBarLength,
+			IsBytes:   true,
+			Started:   restore.metrics.started,
+		}
+		restore.progressManager.Attach(bar)
+		defer restore.progressManager.Detach(bar)
+	}
 
 	log.Logf(log.DebugLow, "restoring up to %v collections in parallel", restore.OutputOptions.NumParallelCollections)
 
+	var source intentSource = restore.manager
+	if restore.shardLimiter != nil {
+		source = restore.shardLimiter
+	}
+
 	if restore.OutputOptions.NumParallelCollections > 0 {
 		resultChan := make(chan error)
 
@@ -36,7 +97,7 @@ func (restore *MongoRestore) RestoreIntents() error {
 			go func(id int) {
 				log.Logf(log.DebugHigh, "starting restore routine with id=%v", id)
 				for {
-					intent := restore.manager.Pop()
+					intent := source.Pop()
 					if intent == nil {
 						log.Logf(log.DebugHigh, "ending restore routine with id=%v, no more work to do", id)
 						resultChan <- nil // done
@@ -47,7 +108,7 @@ func (restore *MongoRestore) RestoreIntents() error {
 						resultChan <- fmt.Errorf("%v: %v", intent.Namespace(), err)
 						return
 					}
-					restore.manager.Finish(intent)
+					source.Finish(intent)
 				}
 			}(i)
 		}
@@ -63,7 +124,7 @@ func (restore *MongoRestore) RestoreIntents() error {
 
 	// single-threaded
 	for {
-		intent := restore.manager.Pop()
+		intent := source.Pop()
 		if intent == nil {
 			return nil
 		}
@@ -71,7 +132,7 @@ func (restore *MongoRestore) RestoreIntents() error {
 		if err != nil {
 			return fmt.Errorf("%v: %v", intent.Namespace(), err)
 		}
-		restore.manager.Finish(intent)
+		source.Finish(intent)
 	}
 	return nil
 }
@@ -84,6 +145,15 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		return fmt.Errorf("error reading database: %v", err)
 	}
 
+	skip, err := restore.skipMissingTarget(intent, collectionExists)
+	if err != nil || skip {
+		return err
+	}
+	skip, err = restore.skipNonEmpty(intent, collectionExists)
+	if err != nil || skip {
+		return err
+	}
+
 	if restore.safety == nil && !restore.OutputOptions.Drop && collectionExists {
 		log.Logf(log.Always, "restoring to existing collection %v without dropping", intent.Namespace())
 		log.Log(log.Always, "Important: restored data will be inserted without raising errors; check your server log")
@@ -91,7 +161,15 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 
 	if restore.OutputOptions.Drop {
 		if collectionExists {
-			if strings.HasPrefix(intent.C, "system.") {
+			if intent.IsTimeseriesBuckets() {
+				log.Logf(log.Info, "dropping time-series collection %v.%v before restoring its buckets",
+					intent.DB, intent.TimeseriesCollection())
+				err = restore.DropTimeseriesCollection(intent)
+				if err != nil {
+					return err
+				}
+				collectionExists = false
+			} else if strings.HasPrefix(intent.C, "system.") {
 				log.Logf(log.Always, "cannot drop system collection %v, skipping", intent.Namespace())
 			} else {
 				log.Logf(log.Info, "dropping collection %v before restoring", intent.Namespace())
@@ -104,22 +182,36 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		} else {
 			log.Logf(log.DebugLow, "collection %v doesn't exist, skipping drop command", intent.Namespace())
 		}
+		if spill, ok := restore.spillArrays[intent.Namespace()]; ok {
+			err = restore.dropSpillChild(intent, spill)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	var options bson.D
 	var indexes []IndexDocument
+	var shardKey bson.D
+	collectionCreated := false
+
+	ignoreMetadata := restore.IgnoresMetadata(intent)
+	if ignoreMetadata {
+		log.Logf(log.Info, "ignoring options and indexes for %v", intent.Namespace())
+	}
 
 	// get indexes from system.indexes dump if we have it but don't have metadata files
-	if intent.MetadataPath == "" {
+	if intent.MetadataPath == "" && !ignoreMetadata {
 		if _, ok := restore.dbCollectionIndexes[intent.DB]; ok {
 			if indexes, ok = restore.dbCollectionIndexes[intent.DB][intent.C]; ok {
 				log.Logf(log.Always, "no metadata; falling back to system.indexes")
+				_, indexes = restore.idIndexOptions(intent, nil, indexes)
 			}
 		}
 	}
 
 	// first create the collection with options from the metadata file
-	if intent.MetadataPath != "" {
+	if intent.MetadataPath != "" && !ignoreMetadata {
 		err = intent.MetadataFile.Open()
 		if err != nil {
 			return err
@@ -135,14 +227,30 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		if err != nil {
 			return fmt.Errorf("error parsing metadata from %v: %v", intent.Location, err)
 		}
+		indexes = dedupeIntentIndexes(intent, indexes)
+		options, indexes = restore.idIndexOptions(intent, options, indexes)
+		if restore.OutputOptions.AutoShard {
+			shardKey, err = shardKeyFromJSON(metadata)
+			if err != nil {
+				return fmt.Errorf("error parsing shard key from %v: %v", intent.Location, err)
+			}
+		}
 		if !restore.OutputOptions.NoOptionsRestore {
 			if options != nil {
-				if !collectionExists {
+				if !collectionExists && intent.IsTimeseriesBuckets() {
+					// the buckets are inserted as they were dumped, into the
+					// collection the server creates for them
+					err = restore.CreateTimeseriesCollection(intent, options)
+					if err != nil {
+						return fmt.Errorf("error creating time-series collection for %v: %v", intent.Namespace(), err)
+					}
+				} else if !collectionExists {
 					log.Logf(log.Info, "creating collection %v using options from metadata", intent.Namespace())
-					err = restore.CreateCollection(intent, options)
+					err = restore.CreateCollection(intent, restore.preallocationOptions(intent, options))
 					if err != nil {
 						return fmt.Errorf("error creating collection %v: %v", intent.Namespace(), err)
 					}
+					collectionCreated = true
 				} else {
 					log.Logf(log.Info, "collection %v already exists", intent.Namespace())
 				}
@@ -154,7 +262,29 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		}
 	}
 
+	if restore.OutputOptions.Preallocate && !collectionCreated && !collectionExists &&
+		!intent.IsTimeseriesBuckets() && intent.Size > 0 {
+		log.Logf(log.Info, "creating collection %v preallocated for %v bytes", intent.Namespace(), intent.Size)
+		err = restore.CreateCollection(intent, restore.preallocationOptions(intent, nil))
+		if err != nil {
+			return fmt.Errorf("error creating collection %v: %v", intent.Namespace(), err)
+		}
+	}
+
+	if reshard := restore.getReshardKey(intent); reshard != nil {
+		err = restore.ShardCollection(intent, reshard.Key)
+		if err != nil {
+			return err
+		}
+	} else if shardKey != nil {
+		err = restore.autoShardCollection(intent, shardKey)
+		if err != nil {
+			return err
+		}
+	}
+
 	var documentCount int64
+	var result *RestoreResult
 	if intent.BSONPath != "" {
 		err = intent.BSONFile.Open()
 		if err != nil {
@@ -167,34 +297,93 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(intent.BSONFile))
 		defer bsonSource.Close()
 
-		documentCount, err = restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSource, intent.Size)
+		transform, err := restore.getDocumentTransform(intent)
+		if err != nil {
+			return err
+		}
+		insertStart := time.Now()
+		documentCount, err = restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSource, intent.Size, transform)
 		if err != nil {
 			return fmt.Errorf("error restoring from %v: %v", intent.BSONPath, err)
 		}
+		result = &RestoreResult{
+			DB:         intent.DB,
+			C:          intent.C,
+			Documents:  documentCount,
+			InsertTime: time.Since(insertStart),
+			Errors:     restore.writeFailuresOf(intent.Namespace()),
+		}
+		if expired := restore.expiredCount(intent.Namespace()); expired > 0 {
+			log.Logf(log.Always, "skipped %v expired %v of %v", expired,
+				util.Pluralize(int(expired), "document", "documents"), intent.Namespace())
+		}
+	}
+
+	if err = restore.failpoint.check(failpointBeforeIndexes, intent.Namespace()); err != nil {
+		return err
 	}
 
 	// finally, add indexes
+	indexes = restore.overrideTTL(intent, indexes)
 	if len(indexes) > 0 && !restore.OutputOptions.NoIndexRestore {
 		log.Logf(log.Always, "restoring indexes for collection %v from metadata", intent.Namespace())
+		indexStart := time.Now()
 		err = restore.CreateIndexes(intent, indexes)
 		if err != nil {
 			return fmt.Errorf("error creating indexes for %v: %v", intent.Namespace(), err)
 		}
+		if result != nil {
+			result.IndexTime = time.Since(indexStart)
+		}
 	} else {
 		log.Log(log.Always, "no indexes to restore")
 	}
+	if result != nil {
+		log.Logf(log.Info, "restored %v in %v", intent.Namespace(), result.timing())
+		restore.recordResult(*result)
+	}
+
+	if restore.OutputOptions.StampRestoreInfo != "" {
+		err = restore.stampRestoreInfo(intent)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = restore.runPostRestoreCommands(intent)
+	if err != nil {
+		return err
+	}
 
 	log.Logf(log.Always, "finished restoring %v (%v %v)",
 		intent.Namespace(), documentCount, util.Pluralize(int(documentCount), "document", "documents"))
-	return nil
+	return restore.failpoint.check(failpointAfterCollection, intent.Namespace())
+}
+
+// insertionWorkers returns the number of workers that insert the documents of the
+// namespace. Documents whose order matters are inserted by a single worker, as
+// are all documents with --deterministicBatching, since which documents each of
+// several workers batches together depends on timing.
+func (restore *MongoRestore) insertionWorkers(ns string) int {
+	// renumbered ids are inserted in order
+	if restore.OutputOptions.MaintainInsertionOrder || restore.OutputOptions.Shuffle ||
+		restore.OutputOptions.DeterministicBatching || restore.renumberNamespaces[ns] {
+		return 1
+	}
+	return restore.OutputOptions.NumInsertionWorkers
 }
 
-// RestoreCollectionToDB pipes the given BSON data into the database.
+// RestoreCollectionToDB pipes the given BSON data into the database,
+// passing each document through transform first, if it is non-nil.
 // Returns the number of documents restored and any errors that occured.
 func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
-	bsonSource *db.DecodedBSONSource, fileSize int64) (int64, error) {
+	bsonSource *db.DecodedBSONSource, fileSize int64, transform documentTransform) (int64, error) {
 
-	var termErr error
+	if restore.DocumentSink != nil {
+		return restore.writeCollectionToSink(dbName+"."+colName, bsonSource, fileSize, transform)
+	}
+
+	var termErr, transformErr error
 	session, err := restore.SessionProvider.GetSession()
 	if err != nil {
 		return int64(0), fmt.Errorf("error establishing connection: %v", err)
@@ -214,17 +403,35 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 	}
 	restore.progressManager.Attach(bar)
 	defer restore.progressManager.Detach(bar)
+	restore.metrics.attach(bar.Name, watchProgressor)
+	defer restore.metrics.detach(bar.Name)
 
-	maxInsertWorkers := restore.OutputOptions.NumInsertionWorkers
-	if restore.OutputOptions.MaintainInsertionOrder {
-		maxInsertWorkers = 1
+	maxInsertWorkers := restore.insertionWorkers(dbName + "." + colName)
+
+	var splitTargets *splitTargets
+	if field, ok := restore.splitFields[dbName+"."+colName]; ok {
+		splitTargets = newSplitTargets(dbName+"."+colName, field, restore.OutputOptions.SplitByMaxTargets)
+	}
+	var spill *spillCounts
+	if spillArray, ok := restore.spillArrays[dbName+"."+colName]; ok {
+		spill = &spillCounts{spillArray: spillArray, nextId: restore.newObjectIds(dbName + "." + spillArray.child)}
 	}
 
 	docChan := make(chan bson.Raw, insertBufferFactor)
 	resultChan := make(chan error, maxInsertWorkers)
 
+	sampler := restore.newVerifySampler()
+	checkpoints := restore.newDocCheckpoints(dbName + "." + colName)
+
 	// stream documents for this collection on docChan
 	go func() {
+		shuffle := restore.newShuffler()
+		send := func(rawBytes []byte) {
+			restore.inFlight.acquire(int64(len(rawBytes)))
+			sampler.offer(rawBytes)
+			docChan <- bson.Raw{Data: rawBytes}
+			documentCount++
+		}
 		doc := bson.Raw{}
 		for bsonSource.Next(&doc) {
 			select {
@@ -236,10 +443,27 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 			default:
 				rawBytes := make([]byte, len(doc.Data))
 				copy(rawBytes, doc.Data)
-				docChan <- bson.Raw{Data: rawBytes}
-				documentCount++
+				if transform != nil {
+					rawBytes, transformErr = transform(rawBytes)
+					if transformErr != nil {
+						close(docChan)
+						return
+					}
+					if rawBytes == nil {
+						// the transform filtered this document out
+						continue
+					}
+				}
+				if rawBytes = shuffle.push(rawBytes); rawBytes == nil {
+					// held in the shuffle window for now
+					continue
+				}
+				send(rawBytes)
 			}
 		}
+		for _, rawBytes := range shuffle.drain() {
+			send(rawBytes)
+		}
 		close(docChan)
 	}()
 
@@ -251,36 +475,77 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 			s := session.Copy()
 			defer s.Close()
 
-			coll := collection.With(s)
-			bulk := db.NewBufferedBulkInserter(
-				coll, restore.ToolOptions.BulkBufferSize, !restore.OutputOptions.StopOnError)
+			var bulk documentInserter
+			if splitTargets != nil {
+				bulk = newSplitInserter(colName, splitTargets.field, splitTargets, func(target string) (documentInserter, error) {
+					return restore.newDocumentInserter(s.DB(dbName).C(target))
+				})
+			} else {
+				var err error
+				bulk, err = restore.newDocumentInserter(collection.With(s))
+				if err != nil {
+					resultChan <- err
+					return
+				}
+			}
+			if spill != nil {
+				bulk = &spillInserter{
+					documentInserter: bulk,
+					counts:           spill,
+					newInserter: func() (documentInserter, error) {
+						return restore.newDocumentInserter(s.DB(dbName).C(spill.child))
+					},
+				}
+			}
+			if restore.inFlight != nil {
+				budgeted := &budgetedInserter{
+					documentInserter: bulk,
+					budget:           restore.inFlight,
+					waiting:          docChan,
+					batchSize:        restore.ToolOptions.BulkBufferSize,
+				}
+				// the bytes of documents that aren't inserted are released too
+				defer budgeted.releaseHeld()
+				bulk = budgeted
+			}
+			if checkpoints != nil {
+				bulk = &checkpointInserter{
+					documentInserter: bulk,
+					checkpoints:      checkpoints,
+					batchSize:        restore.ToolOptions.BulkBufferSize,
+				}
+			}
 			for rawDoc := range docChan {
 				if restore.objCheck {
 					err := bson.Unmarshal(rawDoc.Data, &bson.D{})
 					if err != nil {
+						restore.inFlight.release(int64(len(rawDoc.Data)))
 						resultChan <- fmt.Errorf("invalid object: %v", err)
 						return
 					}
 				}
-				if err := bulk.Insert(rawDoc); err != nil {
-					if db.IsConnectionError(err) || restore.OutputOptions.StopOnError {
+				if err := restore.skipDuplicateIds(dbName+"."+colName, bulk.Insert(rawDoc)); err != nil {
+					if _, overSplit := err.(*splitLimitError); overSplit ||
+						db.IsConnectionError(err) || restore.OutputOptions.StopOnError {
 						// Propagate this error, since it's either a fatal connection error
 						// or the user has turned on --stopOnError
 						resultChan <- err
-					} else {
-						// Otherwise just log the error but don't propagate it.
-						log.Logf(log.Always, "error: %v", err)
+					} else if err = restore.logInsertError(dbName+"."+colName, err); err != nil {
+						// Otherwise just log the error but don't propagate it,
+						// unless more errors than --maxErrors allows have been logged.
+						resultChan <- err
+						return
 					}
 				}
 				watchProgressor.Inc(int64(len(rawDoc.Data)))
+				restore.metrics.addDocuments(1)
 			}
-			err := bulk.Flush()
+			err := restore.skipDuplicateIds(dbName+"."+colName, bulk.Flush())
 			if err != nil {
 				if !db.IsConnectionError(err) && !restore.OutputOptions.StopOnError {
 					// Suppress this error since it's not a severe connection error and
 					// the user has not specified --stopOnError
-					log.Logf(log.Always, "error: %v", err)
-					err = nil
+					err = restore.logInsertError(dbName+"."+colName, err)
 				}
 			}
 			resultChan <- err
@@ -295,6 +560,12 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 	for done := 0; done < maxInsertWorkers; done++ {
 		err := <-resultChan
 		if err != nil {
+			// release the bytes of the documents no worker is left to insert
+			go func() {
+				for rawDoc := range docChan {
+					restore.inFlight.release(int64(len(rawDoc.Data)))
+				}
+			}()
 			return int64(0), fmt.Errorf("insertion error: %v", err)
 		}
 	}
@@ -303,5 +574,78 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 	if err = bsonSource.Err(); err != nil {
 		return int64(0), fmt.Errorf("reading bson input: %v", err)
 	}
+	if transformErr != nil {
+		return int64(0), fmt.Errorf("transforming document: %v", transformErr)
+	}
+	if termErr == nil {
+		if _, err = restore.verifySample(dbName, colName, sampler); err != nil {
+			return documentCount, err
+		}
+	}
+	restore.logDuplicateIdsSkipped(dbName + "." + colName)
+	if spill != nil {
+		log.Logf(log.Info, "spilled the %v arrays of %v documents of %v.%v in to %v child documents of %v.%v",
+			spill.field, spill.parents, dbName, colName, spill.children, dbName, spill.child)
+	}
+	if splitTargets != nil {
+		names := splitTargets.names()
+		log.Logf(log.Info, "split %v.%v by %v in to %v %v: %v", dbName, colName, splitTargets.field,
+			len(names), util.Pluralize(len(names), "collection", "collections"), strings.Join(names, ", "))
+	}
 	return documentCount, termErr
 }
+
+// writeCollectionToSink writes the documents of the given BSON data to the
+// DocumentSink, passing each through transform first, if it is non-nil.
+// Returns the number of documents written and any errors that occured.
+func (restore *MongoRestore) writeCollectionToSink(ns string, bsonSource *db.DecodedBSONSource,
+	fileSize int64, transform documentTransform) (int64, error) {
+
+	watchProgressor := progress.NewCounter(fileSize)
+	restore.metrics.attach(ns, watchProgressor)
+	defer restore.metrics.detach(ns)
+
+	checkpoints := restore.newDocCheckpoints(ns)
+	documentCount := int64(0)
+	write := func(rawBytes []byte) error {
+		if _, err := restore.DocumentSink.Write(rawBytes); err != nil {
+			return fmt.Errorf("writing document to sink: %v", err)
+		}
+		restore.metrics.addDocuments(1)
+		checkpoints.add(1)
+		documentCount++
+		return nil
+	}
+	shuffle := restore.newShuffler()
+	doc := bson.Raw{}
+	for bsonSource.Next(&doc) {
+		rawBytes := make([]byte, len(doc.Data))
+		copy(rawBytes, doc.Data)
+		if transform != nil {
+			var err error
+			rawBytes, err = transform(rawBytes)
+			if err != nil {
+				return documentCount, fmt.Errorf("transforming document: %v", err)
+			}
+			if rawBytes == nil {
+				continue
+			}
+		}
+		watchProgressor.Inc(int64(len(doc.Data)))
+		if rawBytes = shuffle.push(rawBytes); rawBytes == nil {
+			continue
+		}
+		if err := write(rawBytes); err != nil {
+			return documentCount, err
+		}
+	}
+	if err := bsonSource.Err(); err != nil {
+		return documentCount, fmt.Errorf("reading bson input: %v", err)
+	}
+	for _, rawBytes := range shuffle.drain() {
+		if err := write(rawBytes); err != nil {
+			return documentCount, err
+		}
+	}
+	return documentCount, nil
+}
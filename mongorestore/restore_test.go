@@ -0,0 +1,117 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// renameField creates a documentTransform that renames a top level field.
+func renameField(from, to string) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		for i := range doc {
+			if doc[i].Name == from {
+				doc[i].Name = to
+			}
+		}
+		return bson.Marshal(doc)
+	}
+}
+
+// bsonSourceOf creates a DecodedBSONSource reading the given documents.
+func bsonSourceOf(docs ...bson.D) *db.DecodedBSONSource {
+	buf := &bytes.Buffer{}
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		So(err, ShouldBeNil)
+		buf.Write(raw)
+	}
+	return db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(buf)))
+}
+
+// sinkDocuments decodes the documents written to a DocumentSink.
+func sinkDocuments(sink io.Reader) []bson.D {
+	written := db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(sink)))
+	docs := []bson.D{}
+	doc := bson.D{}
+	for written.Next(&doc) {
+		docs = append(docs, doc)
+		doc = bson.D{}
+	}
+	So(written.Err(), ShouldBeNil)
+	return docs
+}
+
+// sinkIds returns the _ids of the documents written to a DocumentSink.
+func sinkIds(sink io.Reader) []interface{} {
+	ids := []interface{}{}
+	for _, doc := range sinkDocuments(sink) {
+		ids = append(ids, doc.Map()["_id"])
+	}
+	return ids
+}
+
+func TestDocumentSink(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a MongoRestore writing to a DocumentSink", t, func() {
+		sink := &bytes.Buffer{}
+		restore := &MongoRestore{DocumentSink: sink}
+		bsonSource := bsonSourceOf(
+			bson.D{{"_id", 1}, {"name", "a"}},
+			bson.D{{"_id", 2}, {"name", "b"}, {"x", 1}},
+		)
+
+		Convey("the transformed documents should arrive at the sink instead of being inserted", func() {
+			count, err := restore.RestoreCollectionToDB("db1", "c1", bsonSource, 0, renameField("name", "title"))
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+
+			So(sinkDocuments(sink), ShouldResemble, []bson.D{
+				{{"_id", 1}, {"title", "a"}},
+				{{"_id", 2}, {"title", "b"}, {"x", 1}},
+			})
+		})
+
+		Convey("documents the transform skips should not arrive at the sink", func() {
+			skipSecond := func(raw []byte) ([]byte, error) {
+				doc := bson.M{}
+				if err := bson.Unmarshal(raw, &doc); err != nil {
+					return nil, err
+				}
+				if doc["_id"] == 2 {
+					return nil, nil
+				}
+				return raw, nil
+			}
+			count, err := restore.RestoreCollectionToDB("db1", "c1", bsonSource, 0, skipSecond)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestDeterministicBatching(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With several insertion workers per collection", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{NumInsertionWorkers: 4}}
+		So(restore.insertionWorkers("db1.c1"), ShouldEqual, 4)
+
+		Convey("--deterministicBatching should insert with one worker", func() {
+			restore.OutputOptions.DeterministicBatching = true
+			So(restore.insertionWorkers("db1.c1"), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,340 @@
+package mongorestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Modes of --clientSchemaMode.
+const (
+	clientSchemaSkip  = "skip"
+	clientSchemaAbort = "abort"
+)
+
+// clientSchema is a JSON Schema that the documents of a namespace are checked
+// against before they're inserted, for --clientSchema. Only the keywords of the
+// schemas the server's $jsonSchema validator takes that describe single values
+// are supported: type, bsonType, enum, required, properties,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// pattern, minimum and maximum. Other keywords are ignored.
+type clientSchema struct {
+	ns     string
+	schema map[string]interface{}
+}
+
+// parseClientSchema parses an argument to --clientSchema, of the form
+// "db.coll:schema.json", reading the schema from the file. The schema may be
+// given bare or, like a collection validator, as {$jsonSchema: <schema>}.
+func parseClientSchema(arg string) (*clientSchema, error) {
+	colon := strings.Index(arg, ":")
+	if colon < 0 {
+		return nil, fmt.Errorf("expected the form db.coll:schema.json")
+	}
+	ns, path := arg[:colon], arg[colon+1:]
+	if err := validateFlattenNamespace(ns); err != nil {
+		return nil, err
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema: %v", err)
+	}
+	schema := map[string]interface{}{}
+	if err = json.Unmarshal(contents, &schema); err != nil {
+		return nil, fmt.Errorf("error parsing schema %v: %v", path, err)
+	}
+	if wrapped, ok := schema["$jsonSchema"].(map[string]interface{}); ok {
+		schema = wrapped
+	}
+	// compile the patterns up front, so that bad ones are found before restoring
+	// and each is compiled only once
+	if err = compileSchemaPatterns(schema); err != nil {
+		return nil, fmt.Errorf("invalid schema %v: %v", path, err)
+	}
+	return &clientSchema{ns: ns, schema: schema}, nil
+}
+
+// compileSchemaPatterns compiles the patterns of the schema and its subschemas,
+// replacing each with its *regexp.Regexp.
+func compileSchemaPatterns(schema map[string]interface{}) error {
+	if pattern, ok := schema["pattern"].(string); ok {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		schema["pattern"] = compiled
+	}
+	subschemas := []interface{}{schema["items"], schema["additionalProperties"]}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		for _, property := range properties {
+			subschemas = append(subschemas, property)
+		}
+	}
+	for _, subschema := range subschemas {
+		if sub, ok := subschema.(map[string]interface{}); ok {
+			if err := compileSchemaPatterns(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getClientSchemaTransforms returns the transforms that check the intent's
+// documents against the schemas given to --clientSchema for its collection.
+func (restore *MongoRestore) getClientSchemaTransforms(intent *intents.Intent) []documentTransform {
+	transforms := []documentTransform{}
+	for _, schema := range restore.clientSchemas {
+		if schema.ns == intent.Namespace() {
+			transforms = append(transforms,
+				checkClientSchema(schema, restore.OutputOptions.ClientSchemaMode == clientSchemaAbort))
+		}
+	}
+	return transforms
+}
+
+// checkClientSchema creates a documentTransform that checks each document against
+// the schema, logging and skipping those that don't conform, or, with abort,
+// stopping the restore at the first one.
+func checkClientSchema(schema *clientSchema, abort bool) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.M{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		violation := validateSchema(schema.schema, doc, "")
+		if violation == nil {
+			return raw, nil
+		}
+		if abort {
+			return nil, fmt.Errorf("document with _id %v of %v does not match its schema: %v",
+				doc["_id"], schema.ns, violation)
+		}
+		log.Logf(log.Always, "skipping document with _id %v of %v that does not match its schema: %v",
+			doc["_id"], schema.ns, violation)
+		return nil, nil
+	}
+}
+
+// validateSchema checks the value against the schema, returning an error
+// naming the path of the first part of the value that doesn't conform.
+func validateSchema(schema map[string]interface{}, value interface{}, path string) error {
+	at := func(format string, args ...interface{}) error {
+		if path == "" {
+			return fmt.Errorf(format, args...)
+		}
+		return fmt.Errorf("%v: %v", path, fmt.Sprintf(format, args...))
+	}
+
+	if types, ok := schema["type"]; ok && !matchesAnyType(types, value, jsonSchemaType) {
+		return at("expected type %v", types)
+	}
+	if types, ok := schema["bsonType"]; ok && !matchesAnyType(types, value, bsonSchemaType) {
+		return at("expected bsonType %v", types)
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if schemaValuesEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return at("value %v is not one of %v", value, enum)
+		}
+	}
+	if number, ok := schemaNumber(value); ok {
+		if minimum, ok := schema["minimum"].(float64); ok && number < minimum {
+			return at("%v is less than the minimum of %v", value, minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && number > maximum {
+			return at("%v is more than the maximum of %v", value, maximum)
+		}
+	}
+	if s, ok := value.(string); ok {
+		length := float64(utf8.RuneCountInString(s))
+		if minLength, ok := schema["minLength"].(float64); ok && length < minLength {
+			return at("string is shorter than %v", minLength)
+		}
+		if maxLength, ok := schema["maxLength"].(float64); ok && length > maxLength {
+			return at("string is longer than %v", maxLength)
+		}
+		if pattern, ok := schema["pattern"].(*regexp.Regexp); ok {
+			if !pattern.MatchString(s) {
+				return at("'%v' does not match the pattern %v", s, pattern)
+			}
+		}
+	}
+	if array, ok := value.([]interface{}); ok {
+		length := float64(len(array))
+		if minItems, ok := schema["minItems"].(float64); ok && length < minItems {
+			return at("array has fewer than %v items", minItems)
+		}
+		if maxItems, ok := schema["maxItems"].(float64); ok && length > maxItems {
+			return at("array has more than %v items", maxItems)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range array {
+				if err := validateSchema(items, item, joinSchemaPath(path, fmt.Sprint(i))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if doc, ok := value.(bson.M); ok {
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := doc[fmt.Sprint(name)]; !ok {
+					return at("missing required field %v", name)
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, fieldValue := range doc {
+			fieldPath := joinSchemaPath(path, name)
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				if err := validateSchema(property, fieldValue, fieldPath); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, ok := properties[name]; ok {
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return at("field %v is not allowed", name)
+				}
+			case map[string]interface{}:
+				if err := validateSchema(additional, fieldValue, fieldPath); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func joinSchemaPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// matchesAnyType returns true if the value is of the type named by types, or of
+// one of the types if it is a list of names.
+func matchesAnyType(types interface{}, value interface{}, matches func(string, interface{}) bool) bool {
+	switch t := types.(type) {
+	case string:
+		return matches(t, value)
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok && matches(s, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonSchemaType returns true if the value is of the JSON Schema type.
+func jsonSchemaType(name string, value interface{}) bool {
+	switch name {
+	case "object":
+		_, ok := value.(bson.M)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := schemaNumber(value)
+		return ok
+	case "integer":
+		number, ok := schemaNumber(value)
+		return ok && number == math.Trunc(number)
+	}
+	return false
+}
+
+// bsonSchemaType returns true if the value is of the type named by its bsonType alias.
+func bsonSchemaType(name string, value interface{}) bool {
+	switch name {
+	case "double":
+		_, ok := value.(float64)
+		return ok
+	case "int":
+		_, ok := value.(int)
+		return ok
+	case "long":
+		_, ok := value.(int64)
+		return ok
+	case "bool":
+		name = "boolean"
+	case "objectId":
+		_, ok := value.(bson.ObjectId)
+		return ok
+	case "date":
+		_, ok := value.(time.Time)
+		return ok
+	case "binData":
+		_, ok := value.(bson.Binary)
+		if !ok {
+			_, ok = value.([]byte)
+		}
+		return ok
+	case "timestamp":
+		_, ok := value.(bson.MongoTimestamp)
+		return ok
+	case "regex":
+		_, ok := value.(bson.RegEx)
+		return ok
+	}
+	return jsonSchemaType(name, value)
+}
+
+// schemaNumber returns the value as a float64 if it is a number.
+func schemaNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// schemaValuesEqual compares a value from a schema, as parsed from JSON, with
+// one from a document, treating numbers of all types as equal by value.
+func schemaValuesEqual(expected, value interface{}) bool {
+	if number, ok := schemaNumber(value); ok {
+		expectedNumber, ok := expected.(float64)
+		return ok && expectedNumber == number
+	}
+	switch value.(type) {
+	case string, bool, nil:
+		return expected == value
+	}
+	return false
+}
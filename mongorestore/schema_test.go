@@ -0,0 +1,120 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+const testClientSchema = `{"$jsonSchema": {
+	"bsonType": "object",
+	"required": ["name", "age"],
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"bsonType": ["int", "long"], "minimum": 0, "maximum": 150},
+		"status": {"enum": ["active", "retired"]},
+		"tags": {"type": "array", "items": {"type": "string"}}
+	}
+}}`
+
+func TestClientSchema(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a schema file for a collection", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_schema")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "schema.json")
+		So(ioutil.WriteFile(path, []byte(testClientSchema), 0644), ShouldBeNil)
+
+		schema, err := parseClientSchema("db1.people:" + path)
+		So(err, ShouldBeNil)
+		So(schema.ns, ShouldEqual, "db1.people")
+
+		docs := []bson.D{
+			{{"_id", 1}, {"name", "ann"}, {"age", 31}, {"status", "active"}},
+			{{"_id", 2}, {"name", "bob"}},
+			{{"_id", 3}, {"name", "cy"}, {"age", int64(70)}, {"tags", []interface{}{"a", "b"}}},
+			{{"_id", 4}, {"name", ""}, {"age", 40}},
+			{{"_id", 5}, {"name", "di"}, {"age", 200}},
+			{{"_id", 6}, {"name", "ed"}, {"age", 5.5}},
+			{{"_id", 7}, {"name", "flo"}, {"age", 52}, {"status", "away"}},
+			{{"_id", 8}, {"name", "gus"}, {"age", 60}, {"tags", []interface{}{"a", 2}}},
+		}
+		restoreAll := func(transform documentTransform) ([]int, error) {
+			restored := []int{}
+			for _, doc := range docs {
+				raw, err := bson.Marshal(doc)
+				So(err, ShouldBeNil)
+				out, err := transform(raw)
+				if err != nil {
+					return restored, err
+				}
+				if out != nil {
+					restored = append(restored, doc[0].Value.(int))
+				}
+			}
+			return restored, nil
+		}
+
+		Convey("documents that don't conform should be skipped", func() {
+			restored, err := restoreAll(checkClientSchema(schema, false))
+			So(err, ShouldBeNil)
+			So(restored, ShouldResemble, []int{1, 3})
+		})
+
+		Convey("with abort, the first document that doesn't conform should be an error", func() {
+			restored, err := restoreAll(checkClientSchema(schema, true))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "_id 2")
+			So(err.Error(), ShouldContainSubstring, "age")
+			So(restored, ShouldResemble, []int{1})
+		})
+	})
+
+	Convey("With a schema with a pattern", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_schema")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "schema.json")
+		So(ioutil.WriteFile(path, []byte(`{"properties": {"code": {"pattern": "^[A-Z]{3}$"}}}`), 0644), ShouldBeNil)
+
+		schema, err := parseClientSchema("db1.codes:" + path)
+		So(err, ShouldBeNil)
+
+		Convey("the pattern should be compiled when the schema is parsed", func() {
+			code := schema.schema["properties"].(map[string]interface{})["code"].(map[string]interface{})
+			So(code["pattern"], ShouldHaveSameTypeAs, &regexp.Regexp{})
+		})
+
+		Convey("strings should be matched against it", func() {
+			So(validateSchema(schema.schema, bson.M{"code": "ABC"}, ""), ShouldBeNil)
+			err := validateSchema(schema.schema, bson.M{"code": "abcd"}, "")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "'abcd' does not match the pattern ^[A-Z]{3}$")
+		})
+
+		Convey("an invalid pattern should be an error", func() {
+			So(ioutil.WriteFile(path, []byte(`{"pattern": "(unclosed"}`), 0644), ShouldBeNil)
+			_, err := parseClientSchema("db1.codes:" + path)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("A violation should name the path to the field", t, func() {
+		schema := map[string]interface{}{
+			"properties": map[string]interface{}{
+				"tags": map[string]interface{}{"items": map[string]interface{}{"type": "string"}},
+			},
+		}
+		err := validateSchema(schema, bson.M{"tags": []interface{}{"a", 2}}, "")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "tags.1:")
+	})
+}
@@ -0,0 +1,213 @@
+package mongorestore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// seenIdsMagic starts a --seenIdsBloom file.
+const seenIdsMagic = "MRSEEN01"
+
+// seenIdsFalsePositiveRate is the rate of false positives that a new --seenIdsBloom
+// filter is sized for, once it holds --seenIdsBloomCapacity ids.
+const seenIdsFalsePositiveRate = 0.01
+
+// seenIdsFilter is a bloom filter of the namespaces and _ids of the documents
+// restored, kept across runs for --seenIdsBloom. It is safe for concurrent use.
+type seenIdsFilter struct {
+	mutex   sync.Mutex
+	bits    []uint64
+	hashes  uint32
+	skipped map[string]int64
+}
+
+// newSeenIdsFilter returns an empty filter sized to hold capacity ids with a 1%
+// rate of false positives.
+func newSeenIdsFilter(capacity int64) *seenIdsFilter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	bits := math.Ceil(-float64(capacity) * math.Log(seenIdsFalsePositiveRate) / (math.Ln2 * math.Ln2))
+	hashes := math.Max(1, math.Round(bits/float64(capacity)*math.Ln2))
+	return &seenIdsFilter{
+		bits:    make([]uint64, (int64(bits)+63)/64),
+		hashes:  uint32(hashes),
+		skipped: map[string]int64{},
+	}
+}
+
+// loadSeenIdsFilter reads the filter saved at path by an earlier run, or returns
+// a new one sized for capacity ids if there isn't one yet.
+func loadSeenIdsFilter(path string, capacity int64) (*seenIdsFilter, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newSeenIdsFilter(capacity), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading seen _ids filter: %v", err)
+	}
+	header := len(seenIdsMagic) + 4
+	if len(contents) < header || string(contents[:len(seenIdsMagic)]) != seenIdsMagic ||
+		(len(contents)-header)%8 != 0 || len(contents) == header {
+		return nil, fmt.Errorf("%v is not a seen _ids filter", path)
+	}
+	filter := &seenIdsFilter{
+		hashes:  binary.LittleEndian.Uint32(contents[len(seenIdsMagic):header]),
+		bits:    make([]uint64, (len(contents)-header)/8),
+		skipped: map[string]int64{},
+	}
+	err = binary.Read(bytes.NewReader(contents[header:]), binary.LittleEndian, filter.bits)
+	if err != nil {
+		return nil, fmt.Errorf("error reading seen _ids filter: %v", err)
+	}
+	return filter, nil
+}
+
+// save writes the filter to path atomically, by writing it to a temporary file
+// in the same directory and renaming that over path.
+func (filter *seenIdsFilter) save(path string) error {
+	filter.mutex.Lock()
+	defer filter.mutex.Unlock()
+	out, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error saving seen _ids filter: %v", err)
+	}
+	defer os.Remove(out.Name())
+	buffer := &bytes.Buffer{}
+	buffer.WriteString(seenIdsMagic)
+	binary.Write(buffer, binary.LittleEndian, filter.hashes)
+	binary.Write(buffer, binary.LittleEndian, filter.bits)
+	_, err = out.Write(buffer.Bytes())
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("error saving seen _ids filter: %v", err)
+	}
+	return nil
+}
+
+// positions returns the bits of the key, by double hashing.
+func (filter *seenIdsFilter) positions(key []byte) []uint64 {
+	hash := fnv.New64a()
+	hash.Write(key)
+	h1 := hash.Sum64()
+	hash.Write([]byte{0})
+	h2 := hash.Sum64() | 1
+	size := uint64(len(filter.bits)) * 64
+	positions := make([]uint64, filter.hashes)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % size
+	}
+	return positions
+}
+
+// contains returns true if the key was probably added to the filter.
+func (filter *seenIdsFilter) contains(key []byte) bool {
+	filter.mutex.Lock()
+	defer filter.mutex.Unlock()
+	for _, position := range filter.positions(key) {
+		if filter.bits[position/64]&(1<<(position%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (filter *seenIdsFilter) add(key []byte) {
+	filter.mutex.Lock()
+	defer filter.mutex.Unlock()
+	for _, position := range filter.positions(key) {
+		filter.bits[position/64] |= 1 << (position % 64)
+	}
+}
+
+func (filter *seenIdsFilter) countSkipped(ns string) {
+	filter.mutex.Lock()
+	defer filter.mutex.Unlock()
+	filter.skipped[ns]++
+}
+
+// seenIdKey returns the key of a document's _id in the namespace, or nil if the
+// document has no _id.
+func seenIdKey(ns string, raw []byte) ([]byte, error) {
+	doc := struct {
+		ID bson.Raw `bson:"_id"`
+	}{}
+	err := bson.Unmarshal(raw, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.ID.Kind == 0 {
+		return nil, nil
+	}
+	key := append([]byte(ns), 0, doc.ID.Kind)
+	return append(key, doc.ID.Data...), nil
+}
+
+// getSeenIdsTransforms returns, with --seenIdsBloom, the transform that skips the
+// documents whose _ids an earlier run probably restored, and the transform that
+// records the _ids of the documents that are restored.
+func (restore *MongoRestore) getSeenIdsTransforms(intent *intents.Intent) (documentTransform, documentTransform) {
+	filter := restore.seenIds
+	if filter == nil {
+		return nil, nil
+	}
+	ns := intent.Namespace()
+	skip := func(raw []byte) ([]byte, error) {
+		key, err := seenIdKey(ns, raw)
+		if err != nil || key == nil || !filter.contains(key) {
+			return raw, err
+		}
+		filter.countSkipped(ns)
+		return nil, nil
+	}
+	record := func(raw []byte) ([]byte, error) {
+		key, err := seenIdKey(ns, raw)
+		if err != nil || key == nil {
+			return raw, err
+		}
+		filter.add(key)
+		return raw, nil
+	}
+	return skip, record
+}
+
+// saveSeenIds saves the --seenIdsBloom filter, logging the documents it skipped,
+// unless documents failed to insert, since they were recorded as seen anyway.
+func (restore *MongoRestore) saveSeenIds(path string) error {
+	namespaces := []string{}
+	for ns := range restore.seenIds.skipped {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		skipped := restore.seenIds.skipped[ns]
+		log.Logf(log.Always, "skipped %v %v of %v already restored according to %v",
+			skipped, util.Pluralize(int(skipped), "document", "documents"), ns, path)
+	}
+	if atomic.LoadInt64(&restore.insertErrors) > 0 {
+		log.Logf(log.Always, "warning: not saving %v, since some documents failed to insert", path)
+		return nil
+	}
+	return restore.seenIds.save(path)
+}
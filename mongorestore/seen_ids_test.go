@@ -0,0 +1,90 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSeenIdsBloom(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a --seenIdsBloom file", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_seen_ids")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "seen.bloom")
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+
+		// run restores the documents with the given _ids as a run of the restore
+		// would, returning the _ids of those that would be inserted
+		run := func(ids ...interface{}) []interface{} {
+			restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+			restore.seenIds, err = loadSeenIdsFilter(path, 1000)
+			So(err, ShouldBeNil)
+			skip, record := restore.getSeenIdsTransforms(intent)
+			transform := chainTransforms([]documentTransform{skip, record})
+			inserted := []interface{}{}
+			for _, id := range ids {
+				raw, err := bson.Marshal(bson.D{{"_id", id}, {"x", 1}})
+				So(err, ShouldBeNil)
+				out, err := transform(raw)
+				So(err, ShouldBeNil)
+				if out != nil {
+					inserted = append(inserted, id)
+				}
+			}
+			So(restore.saveSeenIds(path), ShouldBeNil)
+			return inserted
+		}
+
+		Convey("a second run should skip the ids of the first and insert new ones", func() {
+			So(run(1, 2, "three"), ShouldResemble, []interface{}{1, 2, "three"})
+			So(run(2, "three", 4, "five"), ShouldResemble, []interface{}{4, "five"})
+			So(run(1, 4, 6), ShouldResemble, []interface{}{6})
+		})
+
+		Convey("the same _id in another collection should not be skipped", func() {
+			So(run(1), ShouldResemble, []interface{}{1})
+			intent = &intents.Intent{DB: "db1", C: "c2"}
+			So(run(1), ShouldResemble, []interface{}{1})
+		})
+
+		Convey("the filter should be saved in place, without a temporary file", func() {
+			run(1)
+			entries, err := ioutil.ReadDir(dir)
+			So(err, ShouldBeNil)
+			So(len(entries), ShouldEqual, 1)
+			So(entries[0].Name(), ShouldEqual, "seen.bloom")
+		})
+
+		Convey("a file that isn't a filter should be an error", func() {
+			So(ioutil.WriteFile(path, []byte("not a filter"), 0644), ShouldBeNil)
+			_, err := loadSeenIdsFilter(path, 1000)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("A filter sized for its ids should rarely report ids it doesn't hold", t, func() {
+		filter := newSeenIdsFilter(1000)
+		for i := 0; i < 1000; i++ {
+			filter.add([]byte(fmt.Sprintf("held-%v", i)))
+		}
+		falsePositives := 0
+		for i := 0; i < 10000; i++ {
+			if filter.contains([]byte(fmt.Sprintf("other-%v", i))) {
+				falsePositives++
+			}
+		}
+		So(falsePositives, ShouldBeLessThan, 300)
+	})
+}
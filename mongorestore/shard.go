@@ -0,0 +1,167 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// reshardKey is a parsed --reshardKey argument of the form "db.coll={key:1}".
+type reshardKey struct {
+	DB  string
+	C   string
+	Key bson.D
+}
+
+// parseReshardKey parses an argument to --reshardKey.
+func parseReshardKey(arg string) (*reshardKey, error) {
+	equals := strings.Index(arg, "=")
+	if equals < 0 {
+		return nil, fmt.Errorf("expected the form db.coll={key:1}")
+	}
+	ns, keyJSON := arg[:equals], arg[equals+1:]
+	dot := strings.Index(ns, ".")
+	if dot <= 0 || dot == len(ns)-1 {
+		return nil, fmt.Errorf("'%v' is not a namespace of the form db.coll", ns)
+	}
+	key := bson.D{}
+	err := json.Unmarshal([]byte(keyJSON), &key)
+	if err != nil {
+		return nil, fmt.Errorf("shard key '%v' is not valid JSON: %v", keyJSON, err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("shard key must have at least one field")
+	}
+	key, err = bsonutil.GetExtendedBsonD(key)
+	if err != nil {
+		return nil, fmt.Errorf("extended json in shard key '%v': %v", keyJSON, err)
+	}
+	return &reshardKey{DB: ns[:dot], C: ns[dot+1:], Key: key}, nil
+}
+
+// getReshardKey returns the --reshardKey for the intent's namespace, or nil if it has none.
+func (restore *MongoRestore) getReshardKey(intent *intents.Intent) *reshardKey {
+	for _, reshard := range restore.reshardKeys {
+		if reshard.DB == intent.DB && reshard.C == intent.C {
+			return reshard
+		}
+	}
+	return nil
+}
+
+// shardCollectionCommand builds the command that shards the intent's collection on key.
+func shardCollectionCommand(intent *intents.Intent, key bson.D) bson.D {
+	return bson.D{
+		{"shardCollection", intent.Namespace()},
+		{"key", key},
+	}
+}
+
+// ShardCollection enables sharding for the intent's database, if needed, and then
+// shards its collection with the given key, ignoring any shard key it was dumped with.
+func (restore *MongoRestore) ShardCollection(intent *intents.Intent, key bson.D) error {
+	runner := restore.getRunner()
+	err := runner.Run(bson.D{{"enableSharding", intent.DB}}, &bson.M{}, "admin")
+	if err != nil && !strings.Contains(err.Error(), "already enabled") {
+		return fmt.Errorf("error enabling sharding for %v: %v", intent.DB, err)
+	}
+
+	log.Logf(log.Info, "sharding collection %v with key %v", intent.Namespace(), key)
+	res := bson.M{}
+	err = runner.Run(shardCollectionCommand(intent, key), &res, "admin")
+	if err != nil {
+		return fmt.Errorf("error running shardCollection command: %v", err)
+	}
+	if ok, found := res["ok"]; found && util.IsFalsy(ok) {
+		return fmt.Errorf("shardCollection command: %v", res["errmsg"])
+	}
+	return nil
+}
+
+// shardKeyFromJSON returns the shard key recorded in a collection's metadata,
+// or nil if the collection wasn't sharded when it was dumped.
+func shardKeyFromJSON(jsonBytes []byte) (bson.D, error) {
+	if len(jsonBytes) == 0 {
+		return nil, nil
+	}
+	meta := &Metadata{}
+	err := json.Unmarshal(jsonBytes, meta)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.ShardKey) == 0 {
+		return nil, nil
+	}
+	key, err := bsonutil.GetExtendedBsonD(meta.ShardKey)
+	if err != nil {
+		return nil, fmt.Errorf("extended json in 'shardKey': %v", err)
+	}
+	return key, nil
+}
+
+// autoShardCollection shards the intent's collection with the shard key it was
+// dumped with, for --autoShard. It does nothing if the target isn't sharded, and
+// leaves collections that are already sharded as they are.
+func (restore *MongoRestore) autoShardCollection(intent *intents.Intent, key bson.D) error {
+	if !restore.isMongos {
+		log.Logf(log.DebugLow, "not sharding %v: not connected to a mongos", intent.Namespace())
+		return nil
+	}
+	err := restore.ShardCollection(intent, key)
+	// mongos reports "sharding already enabled for collection" for these
+	if err != nil && strings.Contains(err.Error(), "already") {
+		log.Logf(log.Info, "collection %v is already sharded", intent.Namespace())
+		return nil
+	}
+	return err
+}
+
+// hasField returns true if the document has a value for the possibly dotted field name.
+func hasField(doc bson.M, field string) bool {
+	_, ok := lookupField(doc, field)
+	return ok
+}
+
+// lookupField returns the value of the possibly dotted field name in the
+// document, and whether it has one.
+func lookupField(doc bson.M, field string) (interface{}, bool) {
+	parts := strings.Split(field, ".")
+	for i, part := range parts {
+		value, ok := doc[part]
+		if !ok {
+			return nil, false
+		}
+		if i == len(parts)-1 {
+			return value, true
+		}
+		if doc, ok = value.(bson.M); !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// requireShardKey creates a documentTransform that skips the documents that
+// are missing any of the fields of the shard key.
+func requireShardKey(key bson.D, ns string) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.M{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range key {
+			if !hasField(doc, field.Name) {
+				log.Logf(log.Always, "skipping document with _id %v in %v: missing shard key field '%v'",
+					doc["_id"], ns, field.Name)
+				return nil, nil
+			}
+		}
+		return raw, nil
+	}
+}
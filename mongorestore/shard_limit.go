@@ -0,0 +1,143 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"sync"
+)
+
+// intentSource hands out the intents for the restore workers to restore.
+// It is implemented by intents.Manager and shardLimiter.
+type intentSource interface {
+	Pop() *intents.Intent
+	Finish(*intents.Intent)
+}
+
+// shardLimiter wraps an intentSource, holding back the intents of any shard that
+// already has limit collections being restored in to it until one of them finishes.
+// Intents whose shard is unknown are never held back.
+type shardLimiter struct {
+	source  intentSource
+	shardOf map[string]string
+	limit   int
+
+	mutex     sync.Mutex
+	changed   *sync.Cond
+	active    map[string]int
+	held      []*intents.Intent
+	exhausted bool
+}
+
+func newShardLimiter(source intentSource, shardOf map[string]string, limit int) *shardLimiter {
+	limiter := &shardLimiter{
+		source:  source,
+		shardOf: shardOf,
+		limit:   limit,
+		active:  map[string]int{},
+	}
+	limiter.changed = sync.NewCond(&limiter.mutex)
+	return limiter
+}
+
+// hasRoom returns true if the intent's shard can take another collection.
+func (limiter *shardLimiter) hasRoom(intent *intents.Intent) bool {
+	shard := limiter.shardOf[intent.Namespace()]
+	return shard == "" || limiter.active[shard] < limiter.limit
+}
+
+// Pop returns the next intent whose shard has room, waiting for another intent to
+// finish if every remaining one is held back. It returns nil when there are none left.
+func (limiter *shardLimiter) Pop() *intents.Intent {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	for {
+		for i, intent := range limiter.held {
+			if limiter.hasRoom(intent) {
+				limiter.held = append(limiter.held[:i], limiter.held[i+1:]...)
+				limiter.active[limiter.shardOf[intent.Namespace()]]++
+				return intent
+			}
+		}
+		if !limiter.exhausted {
+			intent := limiter.source.Pop()
+			if intent == nil {
+				limiter.exhausted = true
+				continue
+			}
+			if limiter.hasRoom(intent) {
+				limiter.active[limiter.shardOf[intent.Namespace()]]++
+				return intent
+			}
+			log.Logf(log.DebugHigh, "holding back %v until shard %v has room",
+				intent.Namespace(), limiter.shardOf[intent.Namespace()])
+			limiter.held = append(limiter.held, intent)
+			continue
+		}
+		if len(limiter.held) == 0 {
+			return nil
+		}
+		limiter.changed.Wait()
+	}
+}
+
+// Finish frees the intent's place on its shard.
+func (limiter *shardLimiter) Finish(intent *intents.Intent) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.active[limiter.shardOf[intent.Namespace()]]--
+	limiter.source.Finish(intent)
+	limiter.changed.Broadcast()
+}
+
+// GetShardTopology returns the shard that each intent's namespace will mostly be
+// restored in to: the shard holding the most chunks of the collection if it is
+// sharded, or otherwise the primary shard of its database. It must be called
+// while connected to a mongos, before the intent manager is finalized.
+func (restore *MongoRestore) GetShardTopology() (map[string]string, error) {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return nil, fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+	config := session.DB("config")
+
+	shardOf := map[string]string{}
+	primaries := map[string]string{}
+	for _, intent := range restore.manager.Intents() {
+		ns := intent.Namespace()
+		chunkCounts := []struct {
+			Shard string `bson:"_id"`
+			N     int    `bson:"n"`
+		}{}
+		err = config.C("chunks").Pipe([]bson.M{
+			{"$match": bson.M{"ns": ns}},
+			{"$group": bson.M{"_id": "$shard", "n": bson.M{"$sum": 1}}},
+			{"$sort": bson.M{"n": -1}},
+			{"$limit": 1},
+		}).All(&chunkCounts)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the chunks of %v: %v", ns, err)
+		}
+		if len(chunkCounts) > 0 {
+			shardOf[ns] = chunkCounts[0].Shard
+			continue
+		}
+		primary, ok := primaries[intent.DB]
+		if !ok {
+			database := struct {
+				Primary string `bson:"primary"`
+			}{}
+			err = config.C("databases").FindId(intent.DB).One(&database)
+			if err != nil && err != mgo.ErrNotFound {
+				return nil, fmt.Errorf("error finding the primary shard of %v: %v", intent.DB, err)
+			}
+			primary = database.Primary
+			primaries[intent.DB] = primary
+		}
+		shardOf[ns] = primary
+	}
+	return shardOf, nil
+}
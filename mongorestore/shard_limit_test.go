@@ -0,0 +1,97 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sliceSource is an intentSource handing out intents in order.
+type sliceSource struct {
+	mutex   sync.Mutex
+	intents []*intents.Intent
+}
+
+func (source *sliceSource) Pop() *intents.Intent {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	if len(source.intents) == 0 {
+		return nil
+	}
+	intent := source.intents[0]
+	source.intents = source.intents[1:]
+	return intent
+}
+
+func (source *sliceSource) Finish(*intents.Intent) {}
+
+func TestShardLimiter(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With twelve collections, most of them on one shard", t, func() {
+		source := &sliceSource{}
+		shardOf := map[string]string{}
+		for i := 0; i < 12; i++ {
+			intent := &intents.Intent{DB: "db1", C: fmt.Sprintf("c%v", i)}
+			source.intents = append(source.intents, intent)
+			switch {
+			case i < 8:
+				shardOf[intent.Namespace()] = "shard0"
+			case i < 11:
+				shardOf[intent.Namespace()] = "shard1"
+			}
+			// the last collection's shard is unknown
+		}
+		limiter := newShardLimiter(source, shardOf, 2)
+
+		Convey("six workers should never restore more than two collections in to a shard at once", func() {
+			var mutex sync.Mutex
+			running := map[string]int{}
+			maxRunning := map[string]int{}
+			restored := 0
+			done := make(chan struct{})
+			for w := 0; w < 6; w++ {
+				go func() {
+					for intent := limiter.Pop(); intent != nil; intent = limiter.Pop() {
+						shard := shardOf[intent.Namespace()]
+						mutex.Lock()
+						running[shard]++
+						if running[shard] > maxRunning[shard] {
+							maxRunning[shard] = running[shard]
+						}
+						mutex.Unlock()
+						time.Sleep(5 * time.Millisecond)
+						mutex.Lock()
+						running[shard]--
+						restored++
+						mutex.Unlock()
+						limiter.Finish(intent)
+					}
+					done <- struct{}{}
+				}()
+			}
+			for w := 0; w < 6; w++ {
+				<-done
+			}
+			So(restored, ShouldEqual, 12)
+			So(maxRunning["shard0"], ShouldEqual, 2)
+			So(maxRunning["shard1"], ShouldBeLessThanOrEqualTo, 2)
+		})
+
+		Convey("intents held back should be handed out once their shard has room", func() {
+			first, second := limiter.Pop(), limiter.Pop()
+			So(first.C, ShouldEqual, "c0")
+			So(second.C, ShouldEqual, "c1")
+			// shard0 is full, so the next intent comes from shard1
+			third := limiter.Pop()
+			So(third.C, ShouldEqual, "c8")
+			limiter.Finish(first)
+			So(limiter.Pop().C, ShouldEqual, "c2")
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestReshardKey(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a --reshardKey argument", t, func() {
+		reshard, err := parseReshardKey("db.users={region:1,userId:\"hashed\"}")
+		So(err, ShouldBeNil)
+		So(reshard.DB, ShouldEqual, "db")
+		So(reshard.C, ShouldEqual, "users")
+		So(reshard.Key, ShouldResemble, bson.D{{"region", int32(1)}, {"userId", "hashed"}})
+
+		restore := &MongoRestore{reshardKeys: []*reshardKey{reshard}}
+		intent := &intents.Intent{DB: "db", C: "users"}
+
+		Convey("only its namespace should be resharded", func() {
+			So(restore.getReshardKey(intent), ShouldEqual, reshard)
+			So(restore.getReshardKey(&intents.Intent{DB: "db", C: "other"}), ShouldBeNil)
+		})
+
+		Convey("the shardCollection command should use the new key", func() {
+			So(shardCollectionCommand(intent, reshard.Key), ShouldResemble, bson.D{
+				{"shardCollection", "db.users"},
+				{"key", bson.D{{"region", int32(1)}, {"userId", "hashed"}}},
+			})
+		})
+
+		Convey("documents missing the key should be skipped", func() {
+			transform := requireShardKey(reshard.Key, intent.Namespace())
+			raw, _ := bson.Marshal(bson.D{{"_id", 1}, {"region", "eu"}, {"userId", 5}})
+			kept, err := transform(raw)
+			So(err, ShouldBeNil)
+			So(kept, ShouldResemble, raw)
+
+			raw, _ = bson.Marshal(bson.D{{"_id", 2}, {"userId", 6}})
+			kept, err = transform(raw)
+			So(err, ShouldBeNil)
+			So(kept, ShouldBeNil)
+		})
+
+		Convey("dotted key fields should be looked up in subdocuments", func() {
+			transform := requireShardKey(bson.D{{"a.b", 1}}, intent.Namespace())
+			raw, _ := bson.Marshal(bson.D{{"_id", 1}, {"a", bson.D{{"b", 2}}}})
+			kept, err := transform(raw)
+			So(err, ShouldBeNil)
+			So(kept, ShouldNotBeNil)
+
+			raw, _ = bson.Marshal(bson.D{{"_id", 1}, {"a", 2}})
+			kept, err = transform(raw)
+			So(err, ShouldBeNil)
+			So(kept, ShouldBeNil)
+		})
+	})
+
+	Convey("Malformed --reshardKey arguments should error", t, func() {
+		for _, arg := range []string{"db.users", "users={a:1}", "db.users={}", "db.users={a:"} {
+			_, err := parseReshardKey(arg)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestAutoShard(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With metadata recording the shard key a collection was dumped with", t, func() {
+		metadata := []byte(`{"options":{},"indexes":[],"shardKey":{"region":1,"_id":{"$numberLong":"1"}}}`)
+		key, err := shardKeyFromJSON(metadata)
+		So(err, ShouldBeNil)
+		So(key, ShouldResemble, bson.D{{"region", int32(1)}, {"_id", int64(1)}})
+
+		runner := &stubRunner{}
+		restore := &MongoRestore{runner: runner, isMongos: true}
+		intent := &intents.Intent{DB: "db", C: "users"}
+
+		Convey("the database and collection should be sharded through the mongos", func() {
+			So(restore.autoShardCollection(intent, key), ShouldBeNil)
+			So(runner.count(), ShouldEqual, 2)
+			So(runner.databases, ShouldResemble, []string{"admin", "admin"})
+			So(runner.commands[0], ShouldResemble, bson.D{{"enableSharding", "db"}})
+			So(runner.commands[1], ShouldResemble, bson.D{{"shardCollection", "db.users"}, {"key", key}})
+		})
+
+		Convey("nothing should be run unless connected to a mongos", func() {
+			restore.isMongos = false
+			So(restore.autoShardCollection(intent, key), ShouldBeNil)
+			So(runner.count(), ShouldEqual, 0)
+		})
+
+		Convey("collections that are already sharded should be skipped", func() {
+			runner.err = fmt.Errorf("sharding already enabled for collection db.users")
+			So(restore.autoShardCollection(intent, key), ShouldBeNil)
+		})
+	})
+
+	Convey("Metadata without a shard key should not shard the collection", t, func() {
+		key, err := shardKeyFromJSON([]byte(`{"options":{},"indexes":[]}`))
+		So(err, ShouldBeNil)
+		So(key, ShouldBeNil)
+	})
+}
@@ -0,0 +1,56 @@
+package mongorestore
+
+import (
+	"math/rand"
+)
+
+// shuffler reorders the documents of a collection for --shuffle, reproducibly
+// for a given seed, while holding no more than a window of them in memory. Its
+// methods pass documents through unchanged on a nil *shuffler.
+type shuffler struct {
+	rand   *rand.Rand
+	window [][]byte
+	size   int
+}
+
+// newShuffler returns a shuffler for --shuffle, or nil without it. Each
+// collection gets its own, so that each is shuffled the same way on every run.
+func (restore *MongoRestore) newShuffler() *shuffler {
+	if restore.OutputOptions == nil || !restore.OutputOptions.Shuffle {
+		return nil
+	}
+	return &shuffler{
+		rand: rand.New(rand.NewSource(restore.OutputOptions.ShuffleSeed)),
+		size: restore.OutputOptions.ShuffleBufferSize,
+	}
+}
+
+// push adds doc to the window. Until the window is full it returns nil; after
+// that, it returns a document taken from the window at random, whose place doc takes.
+func (s *shuffler) push(doc []byte) []byte {
+	if s == nil {
+		return doc
+	}
+	if len(s.window) < s.size {
+		s.window = append(s.window, doc)
+		return nil
+	}
+	i := s.rand.Intn(len(s.window))
+	out := s.window[i]
+	s.window[i] = doc
+	return out
+}
+
+// drain empties the window, returning the documents left in it in random order.
+func (s *shuffler) drain() [][]byte {
+	if s == nil {
+		return nil
+	}
+	docs := s.window
+	s.window = nil
+	for i := len(docs) - 1; i > 0; i-- {
+		j := s.rand.Intn(i + 1)
+		docs[i], docs[j] = docs[j], docs[i]
+	}
+	return docs
+}
@@ -0,0 +1,70 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"sort"
+	"testing"
+)
+
+// shuffledIds restores documents with the _ids 0 to n-1 into a DocumentSink
+// with --shuffle, returning the _ids in the order they were written.
+func shuffledIds(n int, seed int64, bufferSize int) []int {
+	sink := &bytes.Buffer{}
+	restore := &MongoRestore{
+		DocumentSink:  sink,
+		OutputOptions: &OutputOptions{Shuffle: true, ShuffleSeed: seed, ShuffleBufferSize: bufferSize},
+	}
+	docs := []bson.D{}
+	for i := 0; i < n; i++ {
+		docs = append(docs, bson.D{{"_id", i}})
+	}
+	count, err := restore.RestoreCollectionToDB("db1", "c1", bsonSourceOf(docs...), 0, nil)
+	So(err, ShouldBeNil)
+	So(count, ShouldEqual, n)
+
+	ids := []int{}
+	for _, id := range sinkIds(sink) {
+		ids = append(ids, id.(int))
+	}
+	return ids
+}
+
+func TestShuffle(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With documents restored with --shuffle and a window of 5", t, func() {
+		ids := shuffledIds(20, 42, 5)
+
+		Convey("every document should be written once, in a shuffled order", func() {
+			sorted := append([]int{}, ids...)
+			sort.Ints(sorted)
+			for i := range sorted {
+				So(sorted[i], ShouldEqual, i)
+			}
+			So(sort.IntsAreSorted(ids), ShouldBeFalse)
+		})
+
+		Convey("no document should be written before it could have been in the window", func() {
+			for position, id := range ids {
+				So(id, ShouldBeLessThan, position+5)
+			}
+		})
+
+		Convey("the order should be the same for the same seed and window", func() {
+			So(shuffledIds(20, 42, 5), ShouldResemble, ids)
+			So(shuffledIds(20, 7, 5), ShouldNotResemble, ids)
+			So(shuffledIds(20, 42, 10), ShouldNotResemble, ids)
+		})
+	})
+
+	Convey("Without --shuffle, documents should pass through a nil shuffler", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		shuffle := restore.newShuffler()
+		So(shuffle.push([]byte("doc")), ShouldResemble, []byte("doc"))
+		So(shuffle.drain(), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,88 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+// policies for documents that are missing the --since field
+const (
+	sinceMissingInclude = "include"
+	sinceMissingExclude = "exclude"
+)
+
+// sinceFilter is a parsed --since argument of the form "db.coll:field=date".
+// Only the documents of DB.C whose Field is a date after Since are restored.
+type sinceFilter struct {
+	DB    string
+	C     string
+	Field string
+	Since time.Time
+}
+
+// parseSinceFilter parses an argument to --since. The date is in RFC 3339
+// format, e.g. 2015-01-01T00:00:00Z.
+func parseSinceFilter(arg string) (*sinceFilter, error) {
+	equals := strings.Index(arg, "=")
+	if equals < 0 {
+		return nil, fmt.Errorf("expected the form db.coll:field=date")
+	}
+	spec, date := arg[:equals], arg[equals+1:]
+	colon := strings.LastIndex(spec, ":")
+	if colon < 0 || colon == len(spec)-1 {
+		return nil, fmt.Errorf("expected the form db.coll:field=date")
+	}
+	ns, field := spec[:colon], spec[colon+1:]
+	dot := strings.Index(ns, ".")
+	if dot <= 0 || dot == len(ns)-1 {
+		return nil, fmt.Errorf("'%v' is not a namespace of the form db.coll", ns)
+	}
+	since, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date '%v', expected a date like 2015-01-01T00:00:00Z", date)
+	}
+	return &sinceFilter{DB: ns[:dot], C: ns[dot+1:], Field: field, Since: since}, nil
+}
+
+// getSinceTransforms returns a transform filtering the intent's documents
+// for each --since argument for its namespace.
+func (restore *MongoRestore) getSinceTransforms(intent *intents.Intent) []documentTransform {
+	includeMissing := restore.OutputOptions.SinceMissing != sinceMissingExclude
+	transforms := []documentTransform{}
+	for _, filter := range restore.sinceFilters {
+		if filter.DB == intent.DB && filter.C == intent.C {
+			transforms = append(transforms, newerThan(filter.Field, filter.Since, includeMissing))
+		}
+	}
+	return transforms
+}
+
+// newerThan creates a documentTransform that skips the documents whose possibly
+// dotted date field isn't after since. Documents where the field is missing, or
+// isn't a date, are kept only if includeMissing is true.
+func newerThan(field string, since time.Time, includeMissing bool) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.M{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := lookupField(doc, field)
+		date, isDate := value.(time.Time)
+		if !ok || !isDate {
+			if includeMissing {
+				return raw, nil
+			}
+			log.Logf(log.DebugHigh, "skipping document with _id %v without a date in '%v'", doc["_id"], field)
+			return nil, nil
+		}
+		if !date.After(since) {
+			return nil, nil
+		}
+		return raw, nil
+	}
+}
@@ -0,0 +1,81 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestParseSinceFilter(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --since arguments", t, func() {
+
+		Convey("a valid argument should be parsed, including the colons in the date", func() {
+			filter, err := parseSinceFilter("db1.events:meta.ts=2015-01-01T00:00:00Z")
+			So(err, ShouldBeNil)
+			So(filter.DB, ShouldEqual, "db1")
+			So(filter.C, ShouldEqual, "events")
+			So(filter.Field, ShouldEqual, "meta.ts")
+			So(filter.Since.Equal(time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)), ShouldBeTrue)
+		})
+
+		Convey("invalid arguments should be rejected", func() {
+			for _, arg := range []string{
+				"db1.events:ts",
+				"db1.events=2015-01-01T00:00:00Z",
+				"db1.events:=2015-01-01T00:00:00Z",
+				"events:ts=2015-01-01T00:00:00Z",
+				"db1.events:ts=2015-01-01",
+			} {
+				_, err := parseSinceFilter(arg)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestNewerThan(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With documents dated before, at and after the watermark, and some without dates", t, func() {
+		since := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+		docs := []bson.D{
+			{{"_id", 1}, {"ts", since.Add(-time.Hour)}},
+			{{"_id", 2}, {"ts", since.Add(time.Hour)}},
+			{{"_id", 3}, {"ts", since}},
+			{{"_id", 4}},
+			{{"_id", 5}, {"ts", "yesterday"}},
+			{{"_id", 6}, {"ts", since.Add(24 * time.Hour)}},
+		}
+		restored := func(transform documentTransform) []int {
+			ids := []int{}
+			for _, doc := range docs {
+				raw, err := bson.Marshal(doc)
+				So(err, ShouldBeNil)
+				raw, err = transform(raw)
+				So(err, ShouldBeNil)
+				if raw != nil {
+					result := struct {
+						ID int `bson:"_id"`
+					}{}
+					So(bson.Unmarshal(raw, &result), ShouldBeNil)
+					ids = append(ids, result.ID)
+				}
+			}
+			return ids
+		}
+
+		Convey("only newer documents should be kept, along with those missing dates if included", func() {
+			So(restored(newerThan("ts", since, true)), ShouldResemble, []int{2, 4, 5, 6})
+		})
+
+		Convey("only newer documents should be kept if those missing dates are excluded", func() {
+			So(restored(newerThan("ts", since, false)), ShouldResemble, []int{2, 6})
+		})
+	})
+}
@@ -0,0 +1,28 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+// skipsFirstDocument returns true if the first document of the intent's data is
+// to be discarded, with --skipFirstDoc or a --skipFirstDocOf of its namespace.
+func (restore *MongoRestore) skipsFirstDocument(intent *intents.Intent) bool {
+	return restore.OutputOptions.SkipFirstDoc || restore.skipFirstDocNamespaces[intent.Namespace()]
+}
+
+// skipFirstDocument creates a documentTransform that skips the first document
+// it's given, such as the schema descriptor some custom exports put at the start
+// of each collection's data, and passes on the rest. It is not safe to call from
+// more than one goroutine.
+func skipFirstDocument(ns string) documentTransform {
+	skipped := false
+	return func(raw []byte) ([]byte, error) {
+		if skipped {
+			return raw, nil
+		}
+		skipped = true
+		log.Logf(log.Always, "skipping the first document of %v", ns)
+		return nil, nil
+	}
+}
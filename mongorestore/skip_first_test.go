@@ -0,0 +1,70 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSkipFirstDoc(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With dumps that start with a schema descriptor document", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_skip_first_doc")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+
+		sink := &bytes.Buffer{}
+		restore := &MongoRestore{
+			ToolOptions:      &commonOpts.ToolOptions{},
+			InputOptions:     &InputOptions{},
+			OutputOptions:    &OutputOptions{},
+			DocumentSink:     sink,
+			knownCollections: map[string][]string{"db1": {}},
+		}
+		intentFor := func(c string) *intents.Intent {
+			path := filepath.Join(dir, c+".bson")
+			data := []byte{}
+			for _, doc := range []bson.D{
+				{{"$schema", "export/v2"}, {"fields", []string{"_id", "name"}}},
+				{{"_id", 1}, {"name", "a"}},
+				{{"_id", 2}, {"name", "b"}},
+			} {
+				raw, err := bson.Marshal(doc)
+				So(err, ShouldBeNil)
+				data = append(data, raw...)
+			}
+			So(ioutil.WriteFile(path, data, 0644), ShouldBeNil)
+			intent := &intents.Intent{DB: "db1", C: c, BSONPath: path, Location: path}
+			intent.BSONFile = &realBSONFile{intent: intent}
+			return intent
+		}
+		restoredIds := func() []interface{} {
+			return sinkIds(sink)
+		}
+
+		Convey("--skipFirstDoc should skip the descriptor and restore the rest", func() {
+			restore.OutputOptions.SkipFirstDoc = true
+			So(restore.RestoreIntent(intentFor("c1")), ShouldBeNil)
+			So(restoredIds(), ShouldResemble, []interface{}{1, 2})
+		})
+
+		Convey("--skipFirstDocOf should skip it only for its collection", func() {
+			restore.skipFirstDocNamespaces = map[string]bool{"db1.c1": true}
+			So(restore.RestoreIntent(intentFor("c1")), ShouldBeNil)
+			So(restoredIds(), ShouldResemble, []interface{}{1, 2})
+			So(restore.RestoreIntent(intentFor("c2")), ShouldBeNil)
+			So(restoredIds(), ShouldResemble, []interface{}{nil, 1, 2})
+		})
+	})
+}
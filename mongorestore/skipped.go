@@ -0,0 +1,86 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"sync"
+)
+
+// skippedFile collects every document that a transform skips, across all of the
+// collections being restored, in a BSON file for --skippedTo, so that documents
+// left out by filters such as --idRange or --dropExpired can be inspected and
+// restored later. Each document is written, as it was dumped, in the doc field of
+// a document whose ns field is the namespace it was dumped from.
+type skippedFile struct {
+	mutex  sync.Mutex
+	file   *os.File
+	path   string
+	count  int64
+	closed bool
+}
+
+// newSkippedFile creates the file at path for the skipped documents.
+func newSkippedFile(path string) (*skippedFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the file of skipped documents: %v", err)
+	}
+	return &skippedFile{file: file, path: path}, nil
+}
+
+// write appends a skipped document of the namespace to the file.
+func (skipped *skippedFile) write(ns string, raw []byte) error {
+	wrapped, err := bson.Marshal(bson.D{{"ns", ns}, {"doc", bson.Raw{Kind: 0x03, Data: raw}}})
+	if err != nil {
+		return fmt.Errorf("error wrapping a skipped document of %v: %v", ns, err)
+	}
+	skipped.mutex.Lock()
+	defer skipped.mutex.Unlock()
+	if _, err := skipped.file.Write(wrapped); err != nil {
+		return fmt.Errorf("error writing a skipped document to %v: %v", skipped.path, err)
+	}
+	skipped.count++
+	return nil
+}
+
+// capture wraps the transform of the namespace so that each document it skips is
+// written to the file. It returns transform as it is if either is nil. Transforms
+// never modify the bytes they are given, so the document is still as it was dumped.
+func (skipped *skippedFile) capture(ns string, transform documentTransform) documentTransform {
+	if skipped == nil || transform == nil {
+		return transform
+	}
+	return func(raw []byte) ([]byte, error) {
+		out, err := transform(raw)
+		if err != nil || out != nil {
+			return out, err
+		}
+		if err = skipped.write(ns, raw); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+}
+
+// close closes the file and logs how many documents were written to it. It does
+// nothing on a nil *skippedFile, or one already closed.
+func (skipped *skippedFile) close() error {
+	if skipped == nil {
+		return nil
+	}
+	skipped.mutex.Lock()
+	defer skipped.mutex.Unlock()
+	if skipped.closed {
+		return nil
+	}
+	skipped.closed = true
+	if err := skipped.file.Close(); err != nil {
+		return fmt.Errorf("error closing the file of skipped documents: %v", err)
+	}
+	log.Logf(log.Always, "wrote %v skipped %v to %v", skipped.count,
+		util.Pluralize(int(skipped.count), "document", "documents"), skipped.path)
+	return nil
+}
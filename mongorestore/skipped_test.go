@@ -0,0 +1,81 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSkippedTo(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a collection whose header and extra documents are filtered out", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_skipped_to")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+
+		sink := &bytes.Buffer{}
+		restore := &MongoRestore{
+			ToolOptions:      &commonOpts.ToolOptions{},
+			InputOptions:     &InputOptions{},
+			OutputOptions:    &OutputOptions{SkipFirstDoc: true},
+			DocumentSink:     sink,
+			knownCollections: map[string][]string{"db1": {}},
+			documentLimits:   map[string]int64{"db1.c1": 2},
+		}
+		skippedPath := filepath.Join(dir, "skipped.bson")
+		restore.skipped, err = newSkippedFile(skippedPath)
+		So(err, ShouldBeNil)
+
+		dumped := [][]byte{}
+		for _, doc := range []bson.D{
+			{{"$schema", "export/v2"}},
+			{{"_id", 1}, {"name", "a"}},
+			{{"_id", 2}, {"name", "b"}, {"tags", []string{"x", "y"}}},
+			{{"_id", 3}, {"name", "c"}, {"nested", bson.D{{"n", 1.5}}}},
+			{{"_id", 4}, {"name", "d"}},
+		} {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			dumped = append(dumped, raw)
+		}
+		path := filepath.Join(dir, "c1.bson")
+		So(ioutil.WriteFile(path, bytes.Join(dumped, nil), 0644), ShouldBeNil)
+		intent := &intents.Intent{DB: "db1", C: "c1", BSONPath: path, Location: path}
+		intent.BSONFile = &realBSONFile{intent: intent}
+
+		Convey("the filtered-out documents should be written to the file as they were dumped", func() {
+			So(restore.RestoreIntent(intent), ShouldBeNil)
+			So(restore.skipped.close(), ShouldBeNil)
+
+			written, err := os.Open(skippedPath)
+			So(err, ShouldBeNil)
+			defer written.Close()
+			source := db.NewDecodedBSONSource(db.NewBSONSource(written))
+			skippedDocs := [][]byte{}
+			wrapper := struct {
+				NS  string   `bson:"ns"`
+				Doc bson.Raw `bson:"doc"`
+			}{}
+			for source.Next(&wrapper) {
+				So(wrapper.NS, ShouldEqual, "db1.c1")
+				skippedDocs = append(skippedDocs, append([]byte(nil), wrapper.Doc.Data...))
+			}
+			So(source.Err(), ShouldBeNil)
+			So(skippedDocs, ShouldResemble, [][]byte{dumped[0], dumped[3], dumped[4]})
+
+			So(sinkIds(sink), ShouldResemble, []interface{}{1, 2})
+		})
+	})
+}
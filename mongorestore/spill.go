@@ -0,0 +1,175 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The fields of the child documents of --spillArray.
+const (
+	spillParentField = "parentId"
+	spillIndexField  = "index"
+	spillValueField  = "value"
+)
+
+// spillArray is a parsed --spillArray argument: the array field of the documents
+// of a namespace whose elements are moved in to a child collection.
+type spillArray struct {
+	ns    string
+	field string
+	child string
+}
+
+// parseSpillArray parses an argument to --spillArray, of the form
+// "db.coll:field->childColl".
+func parseSpillArray(arg string) (*spillArray, error) {
+	arrow := strings.LastIndex(arg, "->")
+	if arrow < 0 {
+		return nil, fmt.Errorf("expected the form db.coll:field->childColl")
+	}
+	ns, field, err := parseSplitBy(arg[:arrow])
+	if err != nil {
+		return nil, fmt.Errorf("expected the form db.coll:field->childColl")
+	}
+	if err = validateTopLevelField(field); err != nil {
+		return nil, err
+	}
+	child := arg[arrow+2:]
+	if err = util.ValidateCollectionGrammar(child); err != nil {
+		return nil, fmt.Errorf("invalid child collection '%v': %v", child, err)
+	}
+	if ns[strings.Index(ns, ".")+1:] == child {
+		return nil, fmt.Errorf("the child collection must not be the collection itself")
+	}
+	return &spillArray{ns: ns, field: field, child: child}, nil
+}
+
+// spillCounts counts the documents and elements of a collection spilled by
+// --spillArray, and hands out the _ids of the child documents, for all of the
+// collection's insertion workers.
+type spillCounts struct {
+	*spillArray
+	parents  int64
+	children int64
+	idMutex  sync.Mutex
+	nextId   func() bson.ObjectId
+}
+
+func (counts *spillCounts) newId() bson.ObjectId {
+	counts.idMutex.Lock()
+	defer counts.idMutex.Unlock()
+	return counts.nextId()
+}
+
+// spillInserter is a documentInserter for --spillArray. When a document's field
+// is an array, the document is inserted without the field, and each element of the
+// array is inserted in to the child collection, in the same database, as a
+// document of its own that refers back to the document it came from:
+//
+//	{_id: <new ObjectId>, parentId: <the document's _id>, index: <the element's position>, value: <the element>}
+//
+// so that the array can be put back together by finding the child documents by
+// parentId, sorted by index. Documents whose field isn't an array are inserted
+// as they are. The child collection is created by its first insert, without any
+// indexes but that on _id, so an index on {parentId: 1, index: 1} should be
+// built for lookups.
+type spillInserter struct {
+	documentInserter
+	counts      *spillCounts
+	newInserter func() (documentInserter, error)
+	children    documentInserter
+}
+
+func (spill *spillInserter) Insert(doc interface{}) error {
+	raw, ok := doc.(bson.Raw)
+	if !ok {
+		return fmt.Errorf("can't spill the array of a document of type %T", doc)
+	}
+	fields := bson.D{}
+	if err := raw.Unmarshal(&fields); err != nil {
+		return err
+	}
+	var id interface{}
+	var elements []interface{}
+	trimmed := bson.D{}
+	spilled := false
+	for _, elem := range fields {
+		if elem.Name == "_id" {
+			id = elem.Value
+		}
+		if array, isArray := elem.Value.([]interface{}); isArray && elem.Name == spill.counts.field {
+			elements, spilled = array, true
+			continue
+		}
+		trimmed = append(trimmed, elem)
+	}
+	if !spilled {
+		return spill.documentInserter.Insert(doc)
+	}
+	if id == nil {
+		return fmt.Errorf("can't spill the array of a document of %v without an _id", spill.counts.ns)
+	}
+	data, err := bson.Marshal(trimmed)
+	if err != nil {
+		return err
+	}
+	if err = spill.documentInserter.Insert(bson.Raw{Kind: 3, Data: data}); err != nil {
+		return err
+	}
+	atomic.AddInt64(&spill.counts.parents, 1)
+	for i, element := range elements {
+		if spill.children == nil {
+			if spill.children, err = spill.newInserter(); err != nil {
+				return err
+			}
+		}
+		data, err := bson.Marshal(bson.D{
+			{"_id", spill.counts.newId()},
+			{spillParentField, id},
+			{spillIndexField, i},
+			{spillValueField, element},
+		})
+		if err != nil {
+			return err
+		}
+		if err = spill.children.Insert(bson.Raw{Kind: 3, Data: data}); err != nil {
+			return err
+		}
+		atomic.AddInt64(&spill.counts.children, 1)
+	}
+	return nil
+}
+
+// Flush flushes the documents and then the child documents, returning the first error.
+func (spill *spillInserter) Flush() error {
+	err := spill.documentInserter.Flush()
+	if spill.children != nil {
+		if childErr := spill.children.Flush(); err == nil {
+			err = childErr
+		}
+	}
+	return err
+}
+
+// dropSpillChild drops the child collection of the intent's --spillArray along
+// with the intent's collection, with --drop, so that the elements restored by
+// another run aren't added to those already there.
+func (restore *MongoRestore) dropSpillChild(intent *intents.Intent, spill *spillArray) error {
+	child := &intents.Intent{DB: intent.DB, C: spill.child}
+	exists, err := restore.CollectionExists(child)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	log.Logf(log.Info, "dropping collection %v, the --spillArray child of %v, before restoring",
+		child.Namespace(), intent.Namespace())
+	return restore.DropCollection(child)
+}
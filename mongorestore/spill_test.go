@@ -0,0 +1,78 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestSpillArray(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --spillArray db1.orders:items->order_items", t, func() {
+		spilled, err := parseSpillArray("db1.orders:items->order_items")
+		So(err, ShouldBeNil)
+		So(*spilled, ShouldResemble, spillArray{ns: "db1.orders", field: "items", child: "order_items"})
+
+		parents, children := &recordingInserter{}, &recordingInserter{}
+		counts := &spillCounts{spillArray: spilled, nextId: deterministicObjectIds("seed", "db1.order_items")}
+		spill := &spillInserter{
+			documentInserter: parents,
+			counts:           counts,
+			newInserter: func() (documentInserter, error) {
+				return children, nil
+			},
+		}
+		insert := func(doc bson.D) {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			So(spill.Insert(bson.Raw{Kind: 3, Data: raw}), ShouldBeNil)
+		}
+		unmarshal := func(docs []bson.Raw) []bson.D {
+			out := []bson.D{}
+			for _, raw := range docs {
+				doc := bson.D{}
+				So(raw.Unmarshal(&doc), ShouldBeNil)
+				out = append(out, doc)
+			}
+			return out
+		}
+
+		Convey("the parent should be trimmed and each element inserted with a back-reference", func() {
+			insert(bson.D{{"_id", 7}, {"items", []interface{}{"a", bson.D{{"sku", "b"}}}}, {"total", 3}})
+			So(spill.Flush(), ShouldBeNil)
+			So(unmarshal(parents.docs), ShouldResemble, []bson.D{{{"_id", 7}, {"total", 3}}})
+			ids := deterministicObjectIds("seed", "db1.order_items")
+			So(unmarshal(children.docs), ShouldResemble, []bson.D{
+				{{"_id", ids()}, {"parentId", 7}, {"index", 0}, {"value", "a"}},
+				{{"_id", ids()}, {"parentId", 7}, {"index", 1}, {"value", bson.D{{"sku", "b"}}}},
+			})
+			So(children.flushed, ShouldEqual, 2)
+			So(counts.parents, ShouldEqual, 1)
+			So(counts.children, ShouldEqual, 2)
+		})
+
+		Convey("documents whose field isn't an array should be inserted as they are", func() {
+			insert(bson.D{{"_id", 8}, {"items", "none"}})
+			insert(bson.D{{"_id", 9}})
+			So(unmarshal(parents.docs), ShouldResemble, []bson.D{{{"_id", 8}, {"items", "none"}}, {{"_id", 9}}})
+			So(children.docs, ShouldBeEmpty)
+		})
+
+		Convey("an empty array should be removed without any child documents", func() {
+			insert(bson.D{{"_id", 10}, {"items", []interface{}{}}})
+			So(unmarshal(parents.docs), ShouldResemble, []bson.D{{{"_id", 10}}})
+			So(children.docs, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Invalid --spillArray arguments should be rejected", t, func() {
+		for _, arg := range []string{"db1.orders:items", "db1.orders->order_items", "db1.orders:a.b->c",
+			"db1.orders:items->", "db1.orders:items->orders"} {
+			_, err := parseSpillArray(arg)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
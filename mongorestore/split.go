@@ -0,0 +1,159 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// parseSplitBy parses an argument to --splitBy, of the form "db.coll:field",
+// returning the namespace and the field.
+func parseSplitBy(arg string) (string, string, error) {
+	colon := strings.LastIndex(arg, ":")
+	if colon <= 0 || colon == len(arg)-1 {
+		return "", "", fmt.Errorf("expected the form db.coll:field")
+	}
+	ns, field := arg[:colon], arg[colon+1:]
+	if err := validateFlattenNamespace(ns); err != nil {
+		return "", "", err
+	}
+	return ns, field, nil
+}
+
+// splitTargetName returns the name of the collection a document whose field has
+// the value is restored in to: the collection's name, an underscore and the value.
+func splitTargetName(colName string, value interface{}) string {
+	switch v := value.(type) {
+	case bson.ObjectId:
+		return colName + "_" + v.Hex()
+	case nil:
+		return colName + "_null"
+	}
+	return fmt.Sprintf("%v_%v", colName, value)
+}
+
+// splitLimitError is returned when splitting a collection would make more target
+// collections than --splitByMaxTargets allows. It stops the restore even without
+// --stopOnError.
+type splitLimitError struct {
+	ns     string
+	field  string
+	limit  int
+	target string
+}
+
+func (err *splitLimitError) Error() string {
+	return fmt.Sprintf("splitting %v by %v would restore more than %v collections, starting with %v; "+
+		"raise --splitByMaxTargets if this is intended", err.ns, err.field, err.limit, err.target)
+}
+
+// splitTargets are the target collections that the documents of a collection
+// have been split in to so far, shared by all of its insertion workers.
+type splitTargets struct {
+	ns     string
+	field  string
+	limit  int
+	mutex  sync.Mutex
+	claims map[string]bool
+}
+
+func newSplitTargets(ns, field string, limit int) *splitTargets {
+	return &splitTargets{ns: ns, field: field, limit: limit, claims: map[string]bool{}}
+}
+
+// claim records a target collection, returning a splitLimitError if it's one
+// more than the limit.
+func (targets *splitTargets) claim(name string) error {
+	targets.mutex.Lock()
+	defer targets.mutex.Unlock()
+	if targets.claims[name] {
+		return nil
+	}
+	if len(targets.claims) >= targets.limit {
+		return &splitLimitError{ns: targets.ns, field: targets.field, limit: targets.limit, target: name}
+	}
+	targets.claims[name] = true
+	return nil
+}
+
+// names returns the target collections, sorted.
+func (targets *splitTargets) names() []string {
+	targets.mutex.Lock()
+	defer targets.mutex.Unlock()
+	names := []string{}
+	for name := range targets.claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitInserter is a documentInserter for --splitBy that sends each document to
+// an inserter for the target collection named by the value of its field. The
+// inserters are made when their collection gets its first document, and the
+// collections are created by their first inserts, without the options or
+// indexes of the collection being split. Documents without the field are
+// restored to the collection with the suffix "_null", like those with a null.
+type splitInserter struct {
+	colName     string
+	field       string
+	targets     *splitTargets
+	newInserter func(target string) (documentInserter, error)
+	inserters   map[string]documentInserter
+	order       []string
+}
+
+func newSplitInserter(colName, field string, targets *splitTargets,
+	newInserter func(target string) (documentInserter, error)) *splitInserter {
+	return &splitInserter{
+		colName:     colName,
+		field:       field,
+		targets:     targets,
+		newInserter: newInserter,
+		inserters:   map[string]documentInserter{},
+	}
+}
+
+func (split *splitInserter) Insert(doc interface{}) error {
+	raw, ok := doc.(bson.Raw)
+	if !ok {
+		return fmt.Errorf("can't split a document of type %T", doc)
+	}
+	fields := bson.M{}
+	if err := raw.Unmarshal(&fields); err != nil {
+		return err
+	}
+	value, _ := lookupField(fields, split.field)
+	target := splitTargetName(split.colName, value)
+	inserter, ok := split.inserters[target]
+	if !ok {
+		if err := util.ValidateCollectionGrammar(target); err != nil {
+			return fmt.Errorf("can't split a document in to '%v': %v", target, err)
+		}
+		if err := split.targets.claim(target); err != nil {
+			return err
+		}
+		var err error
+		inserter, err = split.newInserter(target)
+		if err != nil {
+			return err
+		}
+		split.inserters[target] = inserter
+		split.order = append(split.order, target)
+	}
+	return inserter.Insert(doc)
+}
+
+// Flush flushes the inserter of every target, returning the first error.
+func (split *splitInserter) Flush() error {
+	var firstErr error
+	for _, target := range split.order {
+		if err := split.inserters[target].Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,102 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+// recordingInserter stands in for the inserter of one target collection,
+// keeping the documents it's given and how many of them were flushed.
+type recordingInserter struct {
+	docs    []bson.Raw
+	flushed int
+}
+
+func (bulk *recordingInserter) Insert(doc interface{}) error {
+	bulk.docs = append(bulk.docs, doc.(bson.Raw))
+	return nil
+}
+
+func (bulk *recordingInserter) Flush() error {
+	bulk.flushed = len(bulk.docs)
+	return nil
+}
+
+func TestSplitBy(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With documents across three values of a field", t, func() {
+		docs := []bson.Raw{}
+		for i, region := range []string{"eu", "us", "eu", "apac", "us", "eu"} {
+			raw, err := bson.Marshal(bson.D{{"_id", i}, {"region", region}})
+			So(err, ShouldBeNil)
+			docs = append(docs, bson.Raw{Kind: 0x03, Data: raw})
+		}
+		inserters := map[string]*recordingInserter{}
+		newInserter := func(target string) (documentInserter, error) {
+			So(inserters[target], ShouldBeNil)
+			inserters[target] = &recordingInserter{}
+			return inserters[target], nil
+		}
+
+		Convey("they should be split in to three target collections", func() {
+			targets := newSplitTargets("db1.events", "region", 100)
+			split := newSplitInserter("events", "region", targets, newInserter)
+			for _, doc := range docs {
+				So(split.Insert(doc), ShouldBeNil)
+			}
+			So(split.Flush(), ShouldBeNil)
+
+			So(targets.names(), ShouldResemble, []string{"events_apac", "events_eu", "events_us"})
+			So(len(inserters), ShouldEqual, 3)
+			So(inserters["events_eu"].flushed, ShouldEqual, 3)
+			So(inserters["events_us"].flushed, ShouldEqual, 2)
+			So(inserters["events_apac"].flushed, ShouldEqual, 1)
+		})
+
+		Convey("more targets than the limit should be an error", func() {
+			targets := newSplitTargets("db1.events", "region", 2)
+			split := newSplitInserter("events", "region", targets, newInserter)
+			var err error
+			for _, doc := range docs {
+				if err = split.Insert(doc); err != nil {
+					break
+				}
+			}
+			So(err, ShouldHaveSameTypeAs, &splitLimitError{})
+			So(err.Error(), ShouldContainSubstring, "events_apac")
+			So(len(inserters), ShouldEqual, 2)
+		})
+
+		Convey("the limit should be shared by the inserters of all workers", func() {
+			targets := newSplitTargets("db1.events", "region", 2)
+			first := newSplitInserter("events", "region", targets, newInserter)
+			second := newSplitInserter("events", "region", targets, func(target string) (documentInserter, error) {
+				return &recordingInserter{}, nil
+			})
+			So(first.Insert(docs[0]), ShouldBeNil)
+			So(first.Insert(docs[1]), ShouldBeNil)
+			So(second.Insert(docs[2]), ShouldBeNil)
+			So(second.Insert(docs[3]), ShouldHaveSameTypeAs, &splitLimitError{})
+		})
+	})
+
+	Convey("Documents without the field should go to the _null collection", t, func() {
+		So(splitTargetName("events", nil), ShouldEqual, "events_null")
+		So(splitTargetName("events", 7), ShouldEqual, "events_7")
+	})
+
+	Convey("--splitBy arguments should be parsed", t, func() {
+		ns, field, err := parseSplitBy("db1.events:meta.region")
+		So(err, ShouldBeNil)
+		So(ns, ShouldEqual, "db1.events")
+		So(field, ShouldEqual, "meta.region")
+		_, _, err = parseSplitBy("events:region")
+		So(err, ShouldNotBeNil)
+		_, _, err = parseSplitBy("db1.events")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,59 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// the ways --stampRestoreInfo can record where a collection was restored from
+const (
+	stampComment = "comment"
+	stampMarker  = "marker"
+)
+
+// restoreInfoCollection is the collection of each database that --stampRestoreInfo=marker
+// inserts a document into for each collection restored into the database.
+const restoreInfoCollection = "mongorestore_restoreInfo"
+
+// restoreInfo returns the document recording when the intent's collection was
+// dumped and restored. The dump time is left out if it can't be determined.
+func (restore *MongoRestore) restoreInfo(intent *intents.Intent, restored time.Time) bson.D {
+	info := bson.D{{"collection", intent.C}}
+	if dumped, err := restore.getDumpTime(intent); err == nil {
+		info = append(info, bson.DocElem{"dumpTime", dumped})
+	} else {
+		log.Logf(log.DebugLow, "%v", err)
+	}
+	return append(info, bson.DocElem{"restoreTime", restored})
+}
+
+// stampRestoreInfo records the restore info of the intent's collection, as the
+// comment of a collMod of the collection or as a document in the database's
+// restoreInfoCollection, depending on --stampRestoreInfo.
+func (restore *MongoRestore) stampRestoreInfo(intent *intents.Intent) error {
+	runner := restore.getRunner()
+	info := restore.restoreInfo(intent, time.Now())
+
+	var command bson.D
+	switch restore.OutputOptions.StampRestoreInfo {
+	case stampComment:
+		command = bson.D{{"collMod", intent.C}, {"comment", info}}
+	case stampMarker:
+		command = bson.D{{"insert", restoreInfoCollection}, {"documents", []bson.D{info}}}
+	default:
+		return nil
+	}
+	if restore.metaWriteConcern != nil {
+		command = append(command, bson.DocElem{"writeConcern", restore.metaWriteConcern})
+	}
+	log.Logf(log.DebugLow, "recording restore info of %v as a %v", intent.Namespace(),
+		restore.OutputOptions.StampRestoreInfo)
+	err := runner.Run(command, &struct{}{}, intent.DB)
+	if err != nil {
+		return fmt.Errorf("error recording restore info of %v: %v", intent.Namespace(), err)
+	}
+	return nil
+}
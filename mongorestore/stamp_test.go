@@ -0,0 +1,82 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestStampRestoreInfo(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a collection restored from an archive with a dump timestamp", t, func() {
+		dumpTime := time.Date(2015, time.July, 4, 10, 30, 0, 0, time.UTC)
+		runner := &stubRunner{}
+		restore := &MongoRestore{
+			InputOptions:  &InputOptions{Archive: "dump.archive"},
+			OutputOptions: &OutputOptions{},
+			archive: &archive.Reader{
+				Prelude: &archive.Prelude{Header: &archive.Header{DumpTimestamp: dumpTime}},
+			},
+			runner: runner,
+		}
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+
+		// restoreInfoOf returns the restore info in the single command run
+		restoreInfoOf := func(command interface{}, field string) bson.D {
+			for _, elem := range command.(bson.D) {
+				if elem.Name == field {
+					if documents, ok := elem.Value.([]bson.D); ok {
+						So(len(documents), ShouldEqual, 1)
+						return documents[0]
+					}
+					return elem.Value.(bson.D)
+				}
+			}
+			return nil
+		}
+
+		Convey("the comment mechanism should collMod the collection", func() {
+			restore.OutputOptions.StampRestoreInfo = stampComment
+			So(restore.stampRestoreInfo(intent), ShouldBeNil)
+			So(runner.count(), ShouldEqual, 1)
+			So(runner.databases, ShouldResemble, []string{"db1"})
+			command := runner.commands[0].(bson.D)
+			So(command[0], ShouldResemble, bson.DocElem{"collMod", "c1"})
+
+			info := restoreInfoOf(command, "comment")
+			So(info[0], ShouldResemble, bson.DocElem{"collection", "c1"})
+			So(info[1], ShouldResemble, bson.DocElem{"dumpTime", dumpTime})
+			So(info[2].Name, ShouldEqual, "restoreTime")
+			So(time.Since(info[2].Value.(time.Time)), ShouldBeLessThan, time.Minute)
+		})
+
+		Convey("the marker mechanism should insert into the side collection", func() {
+			restore.OutputOptions.StampRestoreInfo = stampMarker
+			So(restore.stampRestoreInfo(intent), ShouldBeNil)
+			So(runner.count(), ShouldEqual, 1)
+			So(runner.databases, ShouldResemble, []string{"db1"})
+			command := runner.commands[0].(bson.D)
+			So(command[0], ShouldResemble, bson.DocElem{"insert", restoreInfoCollection})
+
+			info := restoreInfoOf(command, "documents")
+			So(info[0], ShouldResemble, bson.DocElem{"collection", "c1"})
+			So(info[1], ShouldResemble, bson.DocElem{"dumpTime", dumpTime})
+			So(info[2].Name, ShouldEqual, "restoreTime")
+		})
+
+		Convey("an unknown dump time should be left out", func() {
+			restore.OutputOptions.StampRestoreInfo = stampMarker
+			restore.archive.Prelude.Header.DumpTimestamp = time.Time{}
+			restore.InputOptions.Archive = "-"
+			info := restore.restoreInfo(intent, time.Now())
+			So(len(info), ShouldEqual, 2)
+			So(info[1].Name, ShouldEqual, "restoreTime")
+		})
+	})
+}
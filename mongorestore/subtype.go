@@ -0,0 +1,151 @@
+package mongorestore
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"strings"
+)
+
+// Binary subtypes of BSON with special handling in --rewriteBinarySubtype.
+const (
+	binarySubtypeGeneric = 0x00
+	binarySubtypeUUIDOld = 0x03
+	binarySubtypeUUID    = 0x04
+)
+
+// Byte orders of legacy (subtype 3) UUIDs for --rewriteBinarySubtype. The
+// standard order is the one the Python driver wrote, and that subtype 4 uses.
+const (
+	uuidOrderStandard = "standard"
+	uuidOrderJava     = "java"
+	uuidOrderCSharp   = "csharp"
+)
+
+// binarySubtypeRewrite is a parsed --rewriteBinarySubtype argument.
+type binarySubtypeRewrite struct {
+	From, To byte
+	// the byte order of legacy UUIDs, when rewriting between subtypes 3 and 4
+	UUIDOrder string
+}
+
+// parseBinarySubtypeRewrite parses an argument of the form "from->to", or
+// "3->4:order" to also convert legacy UUIDs from the given byte order.
+func parseBinarySubtypeRewrite(arg string) (*binarySubtypeRewrite, error) {
+	rewrite := &binarySubtypeRewrite{UUIDOrder: uuidOrderStandard}
+	if colon := strings.Index(arg, ":"); colon >= 0 {
+		arg, rewrite.UUIDOrder = arg[:colon], arg[colon+1:]
+	}
+	subtypes := strings.Split(arg, "->")
+	if len(subtypes) != 2 {
+		return nil, fmt.Errorf("expected the form from->to")
+	}
+	for i, subtype := range subtypes {
+		kind, err := strconv.ParseUint(strings.TrimSpace(subtype), 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("'%v' is not a binary subtype", subtype)
+		}
+		if i == 0 {
+			rewrite.From = byte(kind)
+		} else {
+			rewrite.To = byte(kind)
+		}
+	}
+	if rewrite.From == rewrite.To {
+		return nil, fmt.Errorf("the subtypes are the same")
+	}
+	switch rewrite.UUIDOrder {
+	case uuidOrderStandard:
+	case uuidOrderJava, uuidOrderCSharp:
+		if !rewrite.isUUIDRewrite() {
+			return nil, fmt.Errorf("a UUID byte order only applies between subtypes 3 and 4")
+		}
+	default:
+		return nil, fmt.Errorf("the UUID byte order must be '%v', '%v' or '%v'",
+			uuidOrderStandard, uuidOrderJava, uuidOrderCSharp)
+	}
+	return rewrite, nil
+}
+
+// isUUIDRewrite returns true if the rewrite is between legacy and standard UUIDs.
+func (rewrite *binarySubtypeRewrite) isUUIDRewrite() bool {
+	return rewrite.From == binarySubtypeUUIDOld && rewrite.To == binarySubtypeUUID ||
+		rewrite.From == binarySubtypeUUID && rewrite.To == binarySubtypeUUIDOld
+}
+
+// rewriteData returns the data of a binary value of the From subtype as it should
+// be with the To subtype. The byte orders of legacy UUIDs are their own inverse,
+// so the same swap converts in either direction.
+func (rewrite *binarySubtypeRewrite) rewriteData(data []byte) []byte {
+	if !rewrite.isUUIDRewrite() || len(data) != 16 {
+		return data
+	}
+	swapped := append([]byte{}, data...)
+	switch rewrite.UUIDOrder {
+	case uuidOrderJava:
+		// each half was written little endian
+		reverseBytes(swapped[0:8])
+		reverseBytes(swapped[8:16])
+	case uuidOrderCSharp:
+		// the first three fields were written little endian
+		reverseBytes(swapped[0:4])
+		reverseBytes(swapped[4:6])
+		reverseBytes(swapped[6:8])
+	}
+	return swapped
+}
+
+func reverseBytes(data []byte) {
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+}
+
+// rewriteBinarySubtype creates a documentTransform that gives the binary values
+// of the rewrite's From subtype the To subtype, at any depth of the document.
+func rewriteBinarySubtype(rewrite *binarySubtypeRewrite) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		if _, changed := rewrite.rewriteValue(doc); !changed {
+			return raw, nil
+		}
+		return bson.Marshal(doc)
+	}
+}
+
+// rewriteValue rewrites the binary values of the From subtype in value, in place
+// within documents and arrays, returning the value and whether anything changed.
+func (rewrite *binarySubtypeRewrite) rewriteValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case bson.Binary:
+		if v.Kind == rewrite.From {
+			return bson.Binary{Kind: rewrite.To, Data: rewrite.rewriteData(v.Data)}, true
+		}
+	case []byte:
+		// the driver decodes generic binary values as plain bytes
+		if rewrite.From == binarySubtypeGeneric {
+			return bson.Binary{Kind: rewrite.To, Data: v}, true
+		}
+	case bson.D:
+		changed := false
+		for i := range v {
+			var elemChanged bool
+			v[i].Value, elemChanged = rewrite.rewriteValue(v[i].Value)
+			changed = changed || elemChanged
+		}
+		return v, changed
+	case []interface{}:
+		changed := false
+		for i := range v {
+			var elemChanged bool
+			v[i], elemChanged = rewrite.rewriteValue(v[i])
+			changed = changed || elemChanged
+		}
+		return v, changed
+	}
+	return value, false
+}
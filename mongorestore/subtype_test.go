@@ -0,0 +1,87 @@
+package mongorestore
+
+import (
+	"encoding/hex"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestParseBinarySubtypeRewrite(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --rewriteBinarySubtype arguments", t, func() {
+
+		Convey("subtypes and a UUID byte order should be parsed", func() {
+			rewrite, err := parseBinarySubtypeRewrite("3->4")
+			So(err, ShouldBeNil)
+			So(rewrite, ShouldResemble, &binarySubtypeRewrite{From: 3, To: 4, UUIDOrder: uuidOrderStandard})
+			rewrite, err = parseBinarySubtypeRewrite("3->4:java")
+			So(err, ShouldBeNil)
+			So(rewrite.UUIDOrder, ShouldEqual, uuidOrderJava)
+			rewrite, err = parseBinarySubtypeRewrite("0x80->0")
+			So(err, ShouldBeNil)
+			So(rewrite, ShouldResemble, &binarySubtypeRewrite{From: 0x80, To: 0, UUIDOrder: uuidOrderStandard})
+		})
+
+		Convey("malformed arguments should be rejected", func() {
+			for _, arg := range []string{"3", "3->", "3->4->5", "x->4", "3->256", "4->4", "3->4:ruby", "0->5:java"} {
+				_, err := parseBinarySubtypeRewrite(arg)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestRewriteBinarySubtype(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a document holding a legacy UUID written by the Java driver", t, func() {
+		// the UUID 00112233-4455-6677-8899-aabbccddeeff, with each half little endian
+		legacy, err := hex.DecodeString("7766554433221100ffeeddccbbaa9988")
+		So(err, ShouldBeNil)
+		standard, err := hex.DecodeString("00112233445566778899aabbccddeeff")
+		So(err, ShouldBeNil)
+		raw, err := bson.Marshal(bson.D{
+			{"_id", bson.Binary{Kind: 3, Data: legacy}},
+			{"owners", []interface{}{bson.D{{"id", bson.Binary{Kind: 3, Data: legacy}}}}},
+			{"tag", bson.Binary{Kind: 0x80, Data: []byte("x")}},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("3->4:java should rewrite it to subtype 4 in the standard byte order, at any depth", func() {
+			out, err := rewriteBinarySubtype(&binarySubtypeRewrite{From: 3, To: 4, UUIDOrder: uuidOrderJava})(raw)
+			So(err, ShouldBeNil)
+			doc := bson.D{}
+			So(bson.Unmarshal(out, &doc), ShouldBeNil)
+			So(doc[0].Value, ShouldResemble, bson.Binary{Kind: 4, Data: standard})
+			owner := doc[1].Value.([]interface{})[0].(bson.D)
+			So(owner[0].Value, ShouldResemble, bson.Binary{Kind: 4, Data: standard})
+			So(doc[2].Value, ShouldResemble, bson.Binary{Kind: 0x80, Data: []byte("x")})
+		})
+
+		Convey("3->4:csharp should swap only the first three fields", func() {
+			csharp, err := hex.DecodeString("33221100554477668899aabbccddeeff")
+			So(err, ShouldBeNil)
+			rewrite := &binarySubtypeRewrite{From: 3, To: 4, UUIDOrder: uuidOrderCSharp}
+			So(rewrite.rewriteData(csharp), ShouldResemble, standard)
+		})
+
+		Convey("3->4 should keep the bytes as they are", func() {
+			out, err := rewriteBinarySubtype(&binarySubtypeRewrite{From: 3, To: 4, UUIDOrder: uuidOrderStandard})(raw)
+			So(err, ShouldBeNil)
+			doc := bson.D{}
+			So(bson.Unmarshal(out, &doc), ShouldBeNil)
+			So(doc[0].Value, ShouldResemble, bson.Binary{Kind: 4, Data: legacy})
+		})
+
+		Convey("documents without the subtype should be left as they are", func() {
+			out, err := rewriteBinarySubtype(&binarySubtypeRewrite{From: 5, To: 4, UUIDOrder: uuidOrderStandard})(raw)
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, raw)
+		})
+	})
+}
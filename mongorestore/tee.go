@@ -0,0 +1,95 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// archiveTee copies the raw bytes of the archive to a file as they are read, for
+// --teeArchive, so that a stream that can't be replayed can be restored again from
+// the file. Failing to write the copy doesn't fail the restore: the copy is
+// abandoned with a warning instead.
+type archiveTee struct {
+	in       io.ReadCloser
+	reader   io.Reader
+	file     *os.File
+	path     string
+	writeErr error
+	finished bool
+}
+
+// newArchiveTee creates the file at path and returns a reader of in that copies
+// what it reads to the file.
+func newArchiveTee(in io.ReadCloser, path string) (*archiveTee, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the copy of the archive: %v", err)
+	}
+	tee := &archiveTee{in: in, file: file, path: path}
+	tee.reader = io.TeeReader(in, tee.copier())
+	return tee, nil
+}
+
+func (tee *archiveTee) Read(p []byte) (int, error) {
+	return tee.reader.Read(p)
+}
+
+func (tee *archiveTee) Close() error {
+	return tee.in.Close()
+}
+
+// copier returns the writer the archive's bytes are copied to, which swallows
+// any error writing the file, so that the restore reading the archive goes on.
+func (tee *archiveTee) copier() io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		if tee.writeErr == nil {
+			if _, tee.writeErr = tee.file.Write(p); tee.writeErr != nil {
+				log.Logf(log.Always, "warning: abandoning the copy of the archive at %v: %v",
+					tee.path, tee.writeErr)
+			}
+		}
+		return len(p), nil
+	})
+}
+
+// writerFunc is an io.Writer that calls itself.
+type writerFunc func(p []byte) (int, error)
+
+func (write writerFunc) Write(p []byte) (int, error) {
+	return write(p)
+}
+
+// finish copies the rest of the archive, which the restore may not have needed
+// to read, to the file and closes it. It does nothing on a nil *archiveTee.
+func (tee *archiveTee) finish() error {
+	if tee == nil || tee.finished {
+		return nil
+	}
+	if _, err := io.Copy(ioutil.Discard, tee.reader); err != nil {
+		return fmt.Errorf("error reading the end of the archive: %v", err)
+	}
+	tee.finished = true
+	if err := tee.file.Close(); err != nil && tee.writeErr == nil {
+		tee.writeErr = err
+	}
+	if tee.writeErr != nil {
+		log.Logf(log.Always, "warning: the copy of the archive at %v is incomplete", tee.path)
+	} else {
+		log.Logf(log.Always, "wrote a copy of the archive to %v", tee.path)
+	}
+	return nil
+}
+
+// abandon closes the file if the restore stopped before the copy was finished.
+// It does nothing on a nil *archiveTee.
+func (tee *archiveTee) abandon() {
+	if tee == nil || tee.finished {
+		return
+	}
+	tee.finished = true
+	tee.file.Close()
+	log.Logf(log.Always, "warning: the copy of the archive at %v is incomplete", tee.path)
+}
@@ -0,0 +1,84 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// countArchiveDocuments reads the archive in, returning the number of documents
+// it holds for the intent.
+func countArchiveDocuments(in io.Reader, intent *intents.Intent) int {
+	prelude := &archive.Prelude{}
+	So(prelude.Read(in), ShouldBeNil)
+	demux := &archive.Demultiplexer{In: in, Prelude: prelude}
+	receiver := &archive.RegularCollectionReceiver{Intent: intent, Demux: demux}
+	So(receiver.Open(), ShouldBeNil)
+	countChan := make(chan int)
+	go func() {
+		bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(receiver))
+		count := 0
+		for bsonSource.Next(&bson.D{}) {
+			count++
+		}
+		countChan <- count
+	}()
+	So(demux.Run(), ShouldBeNil)
+	return <-countChan
+}
+
+func TestTeeArchive(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive streamed to standard input and --teeArchive", t, func() {
+		intent := &intents.Intent{DB: "db1", C: "c1", BSONPath: "db1/c1.bson"}
+		buf := &closingBuffer{}
+		So(writeTestArchive(buf, 100, intent), ShouldBeNil)
+		data := append([]byte{}, buf.Bytes()...)
+		// bytes after the archive's end, which the restore doesn't read
+		streamed := append(append([]byte{}, data...), "trailing"...)
+
+		dir, err := ioutil.TempDir("", "mongorestore_tee")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		teePath := filepath.Join(dir, "copy.archive")
+		restore := &MongoRestore{
+			InputOptions: &InputOptions{Archive: "-", TeeArchive: teePath},
+			stdin:        bytes.NewReader(streamed),
+		}
+		in, err := restore.getArchiveReader()
+		So(err, ShouldBeNil)
+
+		Convey("the copy should be byte-identical to the stream, and restorable", func() {
+			So(countArchiveDocuments(in, intent), ShouldEqual, 100)
+			So(restore.archiveTee.finish(), ShouldBeNil)
+			teed, err := ioutil.ReadFile(teePath)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(teed, streamed), ShouldBeTrue)
+
+			copied, err := os.Open(teePath)
+			So(err, ShouldBeNil)
+			defer copied.Close()
+			So(countArchiveDocuments(copied, intent), ShouldEqual, 100)
+		})
+
+		Convey("failing to write the copy should not fail the restore", func() {
+			restore.archiveTee.file.Close()
+			So(countArchiveDocuments(in, intent), ShouldEqual, 100)
+			So(restore.archiveTee.finish(), ShouldBeNil)
+			So(restore.archiveTee.writeErr, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,96 @@
+package mongorestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"text/template"
+)
+
+// templateField is a parsed --templateField argument: a field of the documents
+// of a namespace to set to the output of a template.
+type templateField struct {
+	ns       string
+	field    string
+	template *template.Template
+}
+
+// parseTemplateField parses an argument to --templateField, of the form
+// "db.coll:newField={{.existing}}-suffix". Templates fail on fields the
+// document doesn't have, rather than printing "<no value>".
+func parseTemplateField(arg string) (*templateField, error) {
+	colon := strings.Index(arg, ":")
+	if colon < 0 {
+		return nil, fmt.Errorf("expected the form db.coll:newField=template")
+	}
+	ns, assignment := arg[:colon], arg[colon+1:]
+	if err := validateFlattenNamespace(ns); err != nil {
+		return nil, err
+	}
+	equals := strings.Index(assignment, "=")
+	if equals <= 0 {
+		return nil, fmt.Errorf("expected the form db.coll:newField=template")
+	}
+	field := assignment[:equals]
+	if strings.HasPrefix(field, "$") || strings.Contains(field, ".") {
+		return nil, fmt.Errorf("'%v' is not a top level field name", field)
+	}
+	tmpl, err := template.New(field).Option("missingkey=error").Parse(assignment[equals+1:])
+	if err != nil {
+		return nil, err
+	}
+	return &templateField{ns: ns, field: field, template: tmpl}, nil
+}
+
+// getTemplateTransforms returns the transforms that set the fields given to
+// --templateField for the intent's collection.
+func (restore *MongoRestore) getTemplateTransforms(intent *intents.Intent) []documentTransform {
+	transforms := []documentTransform{}
+	for _, templated := range restore.templateFields {
+		if templated.ns == intent.Namespace() {
+			transforms = append(transforms, applyTemplateField(templated))
+		}
+	}
+	return transforms
+}
+
+// applyTemplateField creates a documentTransform that sets the field of each
+// document to the output of the template, run with the fields of the document
+// as its data, so that {{.name}} is the value of the name field. The field is
+// replaced in place if the document already has it, and is added at the end
+// otherwise. Documents the template fails on, such as those missing a field it
+// uses, are logged and skipped.
+func applyTemplateField(templated *templateField) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		data := bson.M{}
+		err := bson.Unmarshal(raw, &data)
+		if err != nil {
+			return nil, err
+		}
+		out := &bytes.Buffer{}
+		if err = templated.template.Execute(out, data); err != nil {
+			log.Logf(log.Always, "skipping document with _id %v of %v: error computing %v: %v",
+				data["_id"], templated.ns, templated.field, err)
+			return nil, nil
+		}
+
+		doc := bson.D{}
+		if err = bson.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		set := false
+		for i := range doc {
+			if doc[i].Name == templated.field {
+				doc[i].Value, set = out.String(), true
+				break
+			}
+		}
+		if !set {
+			doc = append(doc, bson.DocElem{templated.field, out.String()})
+		}
+		return bson.Marshal(doc)
+	}
+}
@@ -0,0 +1,65 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestTemplateField(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a template computing a field from two others", t, func() {
+		templated, err := parseTemplateField("db1.people:fullName={{.first}} {{.last}}")
+		So(err, ShouldBeNil)
+		So(templated.ns, ShouldEqual, "db1.people")
+		So(templated.field, ShouldEqual, "fullName")
+		transform := applyTemplateField(templated)
+
+		Convey("the derived field should be added to each document", func() {
+			raw, err := bson.Marshal(bson.D{{"_id", 1}, {"first", "Ada"}, {"last", "Lovelace"}})
+			So(err, ShouldBeNil)
+			out, err := transform(raw)
+			So(err, ShouldBeNil)
+			doc := bson.D{}
+			So(bson.Unmarshal(out, &doc), ShouldBeNil)
+			So(doc, ShouldResemble, bson.D{
+				{"_id", 1}, {"first", "Ada"}, {"last", "Lovelace"}, {"fullName", "Ada Lovelace"},
+			})
+		})
+
+		Convey("an existing field should be replaced in place", func() {
+			raw, err := bson.Marshal(bson.D{{"_id", 1}, {"fullName", "?"}, {"first", "Ada"}, {"last", "Lovelace"}})
+			So(err, ShouldBeNil)
+			out, err := transform(raw)
+			So(err, ShouldBeNil)
+			doc := bson.D{}
+			So(bson.Unmarshal(out, &doc), ShouldBeNil)
+			So(doc[1], ShouldResemble, bson.DocElem{"fullName", "Ada Lovelace"})
+			So(len(doc), ShouldEqual, 4)
+		})
+
+		Convey("a document missing a field the template uses should be skipped", func() {
+			raw, err := bson.Marshal(bson.D{{"_id", 2}, {"first", "Grace"}})
+			So(err, ShouldBeNil)
+			out, err := transform(raw)
+			So(err, ShouldBeNil)
+			So(out, ShouldBeNil)
+		})
+	})
+
+	Convey("Invalid --templateField arguments should be rejected", t, func() {
+		for _, arg := range []string{
+			"db1.people",
+			"people:name={{.first}}",
+			"db1.people:={{.first}}",
+			"db1.people:a.b={{.first}}",
+			"db1.people:name={{.first",
+		} {
+			_, err := parseTemplateField(arg)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
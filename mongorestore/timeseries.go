@@ -0,0 +1,59 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// timeseriesCreateOptions are the options of a buckets collection that are passed
+// on when creating its time-series collection. The others, such as its validator,
+// are set by the server itself.
+var timeseriesCreateOptions = []string{"timeseries", "expireAfterSeconds", "storageEngine", "collation"}
+
+// timeseriesCreateCommand builds the command that creates the time-series collection
+// whose buckets the intent is for, from the options the buckets were dumped with.
+func (restore *MongoRestore) timeseriesCreateCommand(intent *intents.Intent, options bson.D) (bson.D, error) {
+	command := bson.D{{"create", intent.TimeseriesCollection()}}
+	for _, name := range timeseriesCreateOptions {
+		for _, option := range options {
+			if option.Name == name {
+				command = append(command, option)
+			}
+		}
+	}
+	if len(command) == 1 || command[1].Name != "timeseries" {
+		return nil, fmt.Errorf("no time-series options in the metadata of %v", intent.Namespace())
+	}
+	if restore.metaWriteConcern != nil {
+		command = append(command, bson.DocElem{"writeConcern", restore.metaWriteConcern})
+	}
+	return command, nil
+}
+
+// CreateTimeseriesCollection creates the time-series collection whose buckets the
+// intent is for, which in turn creates the collection the buckets are restored into.
+func (restore *MongoRestore) CreateTimeseriesCollection(intent *intents.Intent, options bson.D) error {
+	command, err := restore.timeseriesCreateCommand(intent, options)
+	if err != nil {
+		return err
+	}
+	log.Logf(log.Info, "creating time-series collection %v.%v for buckets %v",
+		intent.DB, intent.TimeseriesCollection(), intent.Namespace())
+	err = restore.getRunner().Run(command, &bson.M{}, intent.DB)
+	if err != nil {
+		return fmt.Errorf("error running create command: %v", err)
+	}
+	return nil
+}
+
+// DropTimeseriesCollection drops the time-series collection whose buckets the
+// intent is for, which drops the buckets along with it.
+func (restore *MongoRestore) DropTimeseriesCollection(intent *intents.Intent) error {
+	err := restore.getRunner().Run(bson.D{{"drop", intent.TimeseriesCollection()}}, &bson.M{}, intent.DB)
+	if err != nil {
+		return fmt.Errorf("error dropping time-series collection: %v", err)
+	}
+	return nil
+}
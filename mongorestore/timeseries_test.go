@@ -0,0 +1,88 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/intents"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestTimeseriesBuckets(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive holding the buckets of a time-series collection", t, func() {
+		metadata := `{"options":{"validator":{"$jsonSchema":{}},"clusteredIndex":true,` +
+			`"timeseries":{"timeField":"t","metaField":"m","granularity":"hours"},` +
+			`"expireAfterSeconds":{"$numberLong":"3600"}},"indexes":[]}`
+		buf := &closingBuffer{}
+		So(writeTestArchive(buf, 5, &intents.Intent{
+			DB:           "db1",
+			C:            "system.buckets.weather",
+			BSONPath:     "db1/system.buckets.weather.bson",
+			MetadataFile: &archive.MetadataFile{Buffer: bytes.NewBufferString(metadata)},
+		}), ShouldBeNil)
+
+		runner := &stubRunner{}
+		sink := &bytes.Buffer{}
+		restore := &MongoRestore{
+			manager:          intents.NewIntentManager(),
+			InputOptions:     &InputOptions{Archive: "dump.archive"},
+			OutputOptions:    &OutputOptions{},
+			ToolOptions:      &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+			DocumentSink:     sink,
+			runner:           runner,
+			knownCollections: map[string][]string{"db1": {}},
+			archive:          &archive.Reader{In: buf, Prelude: &archive.Prelude{}},
+		}
+		So(restore.archive.Prelude.Read(buf), ShouldBeNil)
+		restore.archive.Demux = &archive.Demultiplexer{In: buf, NamespaceBufferSize: archiveNamespaceBufferSize}
+		target, err := restore.archive.Prelude.NewPreludeExplorer()
+		So(err, ShouldBeNil)
+		So(restore.CreateAllIntents(target, "", ""), ShouldBeNil)
+
+		intent := restore.manager.IntentForNamespace("db1.system.buckets.weather")
+		So(intent, ShouldNotBeNil)
+		So(intent.IsTimeseriesBuckets(), ShouldBeTrue)
+		So(intent.TimeseriesCollection(), ShouldEqual, "weather")
+
+		Convey("the buckets should be restored directly into their collection", func() {
+			So(intent.BSONFile.Open(), ShouldBeNil)
+			demuxErr := make(chan error)
+			go func() {
+				demuxErr <- restore.archive.Demux.Run()
+			}()
+			So(restore.RestoreIntent(intent), ShouldBeNil)
+			So(<-demuxErr, ShouldBeNil)
+
+			// the time-series collection is created with only the options it takes
+			So(runner.databases, ShouldResemble, []string{"db1"})
+			So(runner.count(), ShouldEqual, 1)
+			command := runner.commands[0].(bson.D)
+			So(len(command), ShouldEqual, 3)
+			So(command[0], ShouldResemble, bson.DocElem{"create", "weather"})
+			So(command[1].Name, ShouldEqual, "timeseries")
+			So(command[1].Value, ShouldResemble, map[string]interface{}{"timeField": "t", "metaField": "m", "granularity": "hours"})
+			So(command[2], ShouldResemble, bson.DocElem{"expireAfterSeconds", int64(3600)})
+
+			So(len(sinkDocuments(sink)), ShouldEqual, 5)
+		})
+	})
+
+	Convey("Buckets metadata without time-series options should be an error", t, func() {
+		restore := &MongoRestore{}
+		intent := &intents.Intent{DB: "db1", C: "system.buckets.weather"}
+		_, err := restore.timeseriesCreateCommand(intent, bson.D{{"clusteredIndex", true}})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Only system.buckets collections should be treated as buckets", t, func() {
+		So((&intents.Intent{DB: "db1", C: "weather"}).IsTimeseriesBuckets(), ShouldBeFalse)
+		So((&intents.Intent{DB: "db1", C: "system.buckets."}).IsTimeseriesBuckets(), ShouldBeFalse)
+		So((&intents.Intent{DB: "db1", C: "system.buckets.weather"}).TimeseriesCollection(), ShouldEqual, "weather")
+	})
+}
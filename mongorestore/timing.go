@@ -0,0 +1,57 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"sort"
+	"time"
+)
+
+// TotalTime returns how long the namespace took to restore, inserting its
+// documents and building its indexes.
+func (result RestoreResult) TotalTime() time.Duration {
+	return result.InsertTime + result.IndexTime
+}
+
+// timing describes how long the namespace took to restore.
+func (result RestoreResult) timing() string {
+	return fmt.Sprintf("%v (inserting %v, building indexes %v)",
+		result.TotalTime(), result.InsertTime, result.IndexTime)
+}
+
+// byTotalTimeDescending sorts results with the slowest namespaces first.
+type byTotalTimeDescending []RestoreResult
+
+func (results byTotalTimeDescending) Len() int      { return len(results) }
+func (results byTotalTimeDescending) Swap(i, j int) { results[i], results[j] = results[j], results[i] }
+func (results byTotalTimeDescending) Less(i, j int) bool {
+	return results[i].TotalTime() > results[j].TotalTime()
+}
+
+// timingSummary returns a line for each result describing how long its namespace
+// took to restore, slowest first.
+func timingSummary(results []RestoreResult) []string {
+	sorted := make([]RestoreResult, len(results))
+	copy(sorted, results)
+	sort.Stable(byTotalTimeDescending(sorted))
+	lines := []string{}
+	for _, result := range sorted {
+		lines = append(lines, fmt.Sprintf("%v.%v: %v", result.DB, result.C, result.timing()))
+	}
+	return lines
+}
+
+// logTimingSummary logs how long each restored namespace took, slowest first,
+// so that the collections slowing down a restore stand out.
+func (restore *MongoRestore) logTimingSummary() {
+	restore.resultsMutex.Lock()
+	lines := timingSummary(restore.results)
+	restore.resultsMutex.Unlock()
+	if len(lines) == 0 {
+		return
+	}
+	log.Log(log.Info, "time taken to restore each collection, slowest first:")
+	for _, line := range lines {
+		log.Logf(log.Info, "\t%v", line)
+	}
+}
@@ -0,0 +1,67 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimingSummary(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the results of three restored collections", t, func() {
+		results := []RestoreResult{
+			{DB: "db1", C: "small", InsertTime: time.Second, IndexTime: time.Second},
+			{DB: "db1", C: "indexed", InsertTime: 2 * time.Second, IndexTime: 8 * time.Second},
+			{DB: "db2", C: "large", InsertTime: 5 * time.Second, IndexTime: 0},
+		}
+
+		Convey("the summary should list them slowest first, with their insert and index times", func() {
+			So(timingSummary(results), ShouldResemble, []string{
+				"db1.indexed: 10s (inserting 2s, building indexes 8s)",
+				"db2.large: 5s (inserting 5s, building indexes 0s)",
+				"db1.small: 2s (inserting 1s, building indexes 1s)",
+			})
+			// the results themselves are left in the order they were restored
+			So(results[0].C, ShouldEqual, "small")
+		})
+	})
+
+	Convey("With a collection restored into a DocumentSink", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_timing")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "c1.bson")
+		raw, err := bson.Marshal(bson.D{{"_id", 1}})
+		So(err, ShouldBeNil)
+		So(ioutil.WriteFile(path, raw, 0644), ShouldBeNil)
+		intent := &intents.Intent{DB: "db1", C: "c1", BSONPath: path, Location: path}
+		intent.BSONFile = &realBSONFile{intent: intent}
+
+		restore := &MongoRestore{
+			InputOptions:     &InputOptions{},
+			OutputOptions:    &OutputOptions{},
+			DocumentSink:     &bytes.Buffer{},
+			knownCollections: map[string][]string{"db1": {}},
+		}
+
+		Convey("its result should record the time taken inserting", func() {
+			So(restore.RestoreIntent(intent), ShouldBeNil)
+			So(len(restore.results), ShouldEqual, 1)
+			So(restore.results[0].Documents, ShouldEqual, 1)
+			So(restore.results[0].InsertTime, ShouldBeGreaterThan, 0)
+			So(restore.results[0].IndexTime, ShouldEqual, 0)
+			So(len(timingSummary(restore.results)), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,190 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"time"
+)
+
+// documentTransform rewrites the raw bytes of a document read from
+// a dump before it is inserted into the target collection. A transform
+// returns nil bytes, and a nil error, to skip the document entirely.
+// It returns new bytes for a rewritten document, never modifying the
+// bytes it was given.
+type documentTransform func([]byte) ([]byte, error)
+
+// getDocumentTransform returns the transform to apply to each document of the
+// given intent, or nil if documents should be inserted as they were dumped.
+func (restore *MongoRestore) getDocumentTransform(intent *intents.Intent) (documentTransform, error) {
+	transforms := []documentTransform{}
+	// the first document isn't one of the collection's, so nothing should see it
+	if restore.skipsFirstDocument(intent) {
+		transforms = append(transforms, skipFirstDocument(intent.Namespace()))
+	}
+	// filter on the dates as they were dumped, before any are rebased
+	transforms = append(transforms, restore.getSinceTransforms(intent)...)
+	// repair strings before anything compares or copies them
+	if restore.OutputOptions.RepairUTF8 {
+		transforms = append(transforms,
+			repairUTF8(intent.Namespace(), restore.OutputOptions.RepairUTF8Mode == repairUTF8Strip))
+	}
+	// filter on the _ids as they were dumped, before any are replaced
+	if idRangeTransform := restore.getIdRangeTransform(intent); idRangeTransform != nil {
+		transforms = append(transforms, idRangeTransform)
+	}
+	// so that everything after sees the _ids as they'll be restored
+	if restore.OutputOptions.NormalizeIdType != "" {
+		transforms = append(transforms, normalizeIdType(intent.Namespace(), restore.OutputOptions.NormalizeIdType))
+	}
+	if restore.OutputOptions.TTLRebase != "" {
+		dumpTime, err := restore.getDumpTime(intent)
+		if err != nil {
+			return nil, fmt.Errorf("cannot use --ttlRebase: %v", err)
+		}
+		transforms = append(transforms,
+			rebaseDateField(restore.OutputOptions.TTLRebase, time.Now().Sub(dumpTime)))
+	}
+	// judge expiry by the dates the documents will have once restored
+	if dropExpiredTransform := restore.getDropExpiredTransform(intent); dropExpiredTransform != nil {
+		transforms = append(transforms, dropExpiredTransform)
+	}
+	if restore.binarySubtypeRewrite != nil {
+		transforms = append(transforms, rewriteBinarySubtype(restore.binarySubtypeRewrite))
+	}
+	// keep the original _ids before any are replaced
+	if moveIdTransform := restore.getMoveIdTransform(intent); moveIdTransform != nil {
+		transforms = append(transforms, moveIdTransform)
+	}
+	transforms = append(transforms, restore.getRefRewriteTransforms(intent)...)
+	// convert the references --rewriteRefs may have rewritten
+	if dbRefTransform := restore.getDBRefTransform(intent); dbRefTransform != nil {
+		transforms = append(transforms, dbRefTransform)
+	}
+	// the _ids of collections with references rewritten to them already have new ids,
+	// as do those moved by --moveIdTo
+	if _, ok := restore.idMaps[intent.Namespace()]; !ok &&
+		restore.OutputOptions.DeterministicIds != "" && restore.OutputOptions.MoveIdTo == "" {
+		transforms = append(transforms, replaceObjectIds(restore.newObjectIds(intent.Namespace())))
+	}
+	// check the documents as they were dumped, other than references and ids
+	transforms = append(transforms, restore.getClientSchemaTransforms(intent)...)
+	// compute fields from the values as they'll be restored, before any are encrypted
+	transforms = append(transforms, restore.getTemplateTransforms(intent)...)
+	transforms = append(transforms, restore.getEncryptTransforms(intent)...)
+	if reshard := restore.getReshardKey(intent); reshard != nil {
+		transforms = append(transforms, requireShardKey(reshard.Key, intent.Namespace()))
+	}
+	if restore.pruneKinds != nil {
+		transforms = append(transforms, pruneEmptyFields(restore.pruneKinds))
+	}
+	// flatten after the transforms above, which find fields by their paths
+	if flattenTransform := restore.getFlattenTransform(intent); flattenTransform != nil {
+		transforms = append(transforms, flattenTransform)
+	}
+	if restore.OutputOptions.LowercaseKeys {
+		transforms = append(transforms, lowercaseKeys(intent.Namespace(),
+			restore.OutputOptions.LowercaseKeysMode == lowercaseKeysLastWins))
+	}
+	// escape the field names flattening gave dots to as well
+	if restore.OutputOptions.EscapeKeys {
+		transforms = append(transforms, escapeKeys(intent.Namespace(),
+			restore.OutputOptions.EscapeKeysDot, restore.OutputOptions.EscapeKeysDollar))
+	}
+	skipSeenIds, recordSeenIds := restore.getSeenIdsTransforms(intent)
+	if skipSeenIds != nil {
+		transforms = append(transforms, skipSeenIds)
+	}
+	// count only the documents that would otherwise be restored
+	if limit, ok := restore.getDocumentLimit(intent); ok {
+		transforms = append(transforms, limitDocuments(limit, intent.Namespace()))
+	}
+	if failTransform := restore.failpoint.documentTransform(); failTransform != nil {
+		transforms = append(transforms, failTransform)
+	}
+	// record only the documents that make it this far
+	if recordSeenIds != nil {
+		transforms = append(transforms, recordSeenIds)
+	}
+	// after every transform that skips documents, so the numbering has no gaps
+	if renumberTransform := restore.getRenumberTransform(intent); renumberTransform != nil {
+		transforms = append(transforms, renumberTransform)
+	}
+	// hash the documents as they'll be restored
+	if restore.OutputOptions.HashField != "" {
+		transforms = append(transforms, hashDocuments(restore.OutputOptions.HashField))
+	}
+	// last, since the driver can't read the documents once they have decimals
+	if decimalTransform := restore.getDecimal128Transform(intent); decimalTransform != nil {
+		transforms = append(transforms, decimalTransform)
+	}
+	return restore.skipped.capture(intent.Namespace(), chainTransforms(transforms)), nil
+}
+
+// chainTransforms creates a documentTransform that applies each of the
+// transforms in order. It returns nil if there are no transforms.
+func chainTransforms(transforms []documentTransform) documentTransform {
+	switch len(transforms) {
+	case 0:
+		return nil
+	case 1:
+		return transforms[0]
+	}
+	return func(raw []byte) ([]byte, error) {
+		var err error
+		for _, transform := range transforms {
+			raw, err = transform(raw)
+			if err != nil || raw == nil {
+				return nil, err
+			}
+		}
+		return raw, nil
+	}
+}
+
+// getDumpTime returns when the data for the given intent was dumped. It uses the
+// timestamp recorded in the archive header when there is one, and otherwise falls
+// back to the modification time of the file the intent is read from.
+func (restore *MongoRestore) getDumpTime(intent *intents.Intent) (time.Time, error) {
+	path := intent.BSONPath
+	if restore.InputOptions.Archive != "" {
+		if dumpTime, ok := restore.archive.Prelude.DumpTime(); ok {
+			return dumpTime, nil
+		}
+		path = restore.InputOptions.Archive
+	}
+	if path == "-" {
+		return time.Time{}, fmt.Errorf("unable to determine the dump time of %v from standard input",
+			intent.Namespace())
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to determine the dump time of %v: %v", intent.Namespace(), err)
+	}
+	return stat.ModTime(), nil
+}
+
+// rebaseDateField creates a documentTransform that shifts the top level date
+// field by delta. Documents where the field is missing or not a date are left as is.
+func rebaseDateField(field string, delta time.Duration) documentTransform {
+	return func(raw []byte) ([]byte, error) {
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		for i, elem := range doc {
+			if elem.Name != field {
+				continue
+			}
+			date, ok := elem.Value.(time.Time)
+			if !ok {
+				return raw, nil
+			}
+			doc[i].Value = date.Add(delta)
+			return bson.Marshal(doc)
+		}
+		return raw, nil
+	}
+}
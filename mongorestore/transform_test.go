@@ -0,0 +1,48 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestRebaseDateField(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a transform rebasing the 'expires' field by one hour", t, func() {
+		delta := time.Hour
+		transform := rebaseDateField("expires", delta)
+		expires := time.Date(2015, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+		Convey("a date in that field should be shifted by the delta", func() {
+			raw, err := bson.Marshal(bson.D{{"_id", 1}, {"expires", expires}, {"x", "y"}})
+			So(err, ShouldBeNil)
+			raw, err = transform(raw)
+			So(err, ShouldBeNil)
+			doc := bson.D{}
+			So(bson.Unmarshal(raw, &doc), ShouldBeNil)
+			So(len(doc), ShouldEqual, 3)
+			So(doc[0].Name, ShouldEqual, "_id")
+			So(doc[1].Name, ShouldEqual, "expires")
+			So(doc[1].Value.(time.Time).Sub(expires), ShouldEqual, delta)
+			So(doc[2].Value, ShouldEqual, "y")
+		})
+
+		Convey("documents without a date in that field should be unchanged", func() {
+			raw, err := bson.Marshal(bson.D{{"_id", 1}, {"expires", "never"}})
+			So(err, ShouldBeNil)
+			transformed, err := transform(raw)
+			So(err, ShouldBeNil)
+			So(transformed, ShouldResemble, raw)
+
+			raw, err = bson.Marshal(bson.D{{"_id", 1}, {"created", expires}})
+			So(err, ShouldBeNil)
+			transformed, err = transform(raw)
+			So(err, ShouldBeNil)
+			So(transformed, ShouldResemble, raw)
+		})
+	})
+}
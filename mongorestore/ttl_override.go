@@ -0,0 +1,61 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"strings"
+)
+
+// ttlOverride is a parsed --ttlOverride argument: the expireAfterSeconds that the
+// TTL index on a date field of a namespace is built with.
+type ttlOverride struct {
+	ns      string
+	field   string
+	seconds int64
+}
+
+// parseTTLOverride parses an argument to --ttlOverride, of the form
+// "db.coll:field=seconds".
+func parseTTLOverride(arg string) (*ttlOverride, error) {
+	equals := strings.LastIndex(arg, "=")
+	if equals < 0 {
+		return nil, fmt.Errorf("expected the form db.coll:field=seconds")
+	}
+	ns, field, err := parseSplitBy(arg[:equals])
+	if err != nil {
+		return nil, fmt.Errorf("expected the form db.coll:field=seconds")
+	}
+	seconds, err := strconv.ParseInt(arg[equals+1:], 10, 32)
+	if err != nil || seconds < 0 {
+		return nil, fmt.Errorf("'%v' is not a number of seconds", arg[equals+1:])
+	}
+	return &ttlOverride{ns: ns, field: field, seconds: seconds}, nil
+}
+
+// overrideTTL returns the intent's indexes with the expireAfterSeconds of the
+// index on the --ttlOverride field set to the overridden seconds. The index is
+// made a TTL index if it wasn't one, and is added if the indexes have none on
+// the field alone.
+func (restore *MongoRestore) overrideTTL(intent *intents.Intent, indexes []IndexDocument) []IndexDocument {
+	override, ok := restore.ttlOverrides[intent.Namespace()]
+	if !ok {
+		return indexes
+	}
+	for _, index := range indexes {
+		if len(index.Key) == 1 && index.Key[0].Name == override.field {
+			log.Logf(log.Always, "overriding the expireAfterSeconds of index %v of %v from %v to %v",
+				index.Options["name"], intent.Namespace(), index.Options["expireAfterSeconds"], override.seconds)
+			index.Options["expireAfterSeconds"] = override.seconds
+			return indexes
+		}
+	}
+	name := override.field + "_1"
+	log.Logf(log.Always, "adding TTL index %v to %v with expireAfterSeconds %v", name, intent.Namespace(), override.seconds)
+	return append(indexes, IndexDocument{
+		Key:     bson.D{{override.field, 1}},
+		Options: bson.M{"name": name, "expireAfterSeconds": override.seconds},
+	})
+}
@@ -0,0 +1,92 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+// sentIndexes returns the indexes of the createIndexes command the indexes would
+// be built with, as the server would receive them.
+func sentIndexes(restore *MongoRestore, intent *intents.Intent, indexes []IndexDocument) []bson.M {
+	raw, err := bson.Marshal(restore.createIndexesCommand(intent, indexes))
+	So(err, ShouldBeNil)
+	command := struct {
+		Indexes []bson.M `bson:"indexes"`
+	}{}
+	So(bson.Unmarshal(raw, &command), ShouldBeNil)
+	return command.Indexes
+}
+
+func TestParseTTLOverride(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("A --ttlOverride argument should be parsed", t, func() {
+		override, err := parseTTLOverride("db1.sessions:lastSeen=3600")
+		So(err, ShouldBeNil)
+		So(override, ShouldResemble, &ttlOverride{ns: "db1.sessions", field: "lastSeen", seconds: 3600})
+
+		Convey("unless it's malformed", func() {
+			for _, arg := range []string{"db1.sessions:lastSeen", "db1.sessions=3600", "db1:lastSeen=3600",
+				"db1.sessions:lastSeen=-1", "db1.sessions:lastSeen=1h", "db1.sessions:=3600"} {
+				_, err = parseTTLOverride(arg)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestTTLOverride(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --ttlOverride for a collection", t, func() {
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{},
+			ttlOverrides: map[string]*ttlOverride{
+				"db1.sessions": {ns: "db1.sessions", field: "lastSeen", seconds: 60},
+			},
+		}
+		intent := &intents.Intent{DB: "db1", C: "sessions"}
+
+		Convey("the TTL index in the metadata should be built with the overridden seconds", func() {
+			_, indexes, err := restore.MetadataFromJSON([]byte(`{"indexes":[` +
+				`{"v":1,"key":{"_id":1},"name":"_id_"},` +
+				`{"v":1,"key":{"lastSeen":1},"name":"lastSeen_ttl","expireAfterSeconds":86400}]}`))
+			So(err, ShouldBeNil)
+			sent := sentIndexes(restore, intent, restore.overrideTTL(intent, indexes))
+			So(len(sent), ShouldEqual, 2)
+			So(sent[0]["expireAfterSeconds"], ShouldBeNil)
+			So(sent[1]["name"], ShouldEqual, "lastSeen_ttl")
+			So(sent[1]["expireAfterSeconds"], ShouldEqual, 60)
+		})
+
+		Convey("a TTL index should be added if the metadata lacks one", func() {
+			_, indexes, err := restore.MetadataFromJSON([]byte(`{"indexes":[` +
+				`{"v":1,"key":{"_id":1},"name":"_id_"},` +
+				`{"v":1,"key":{"lastSeen":1,"user":1},"name":"lastSeen_1_user_1"}]}`))
+			So(err, ShouldBeNil)
+			sent := sentIndexes(restore, intent, restore.overrideTTL(intent, indexes))
+			So(len(sent), ShouldEqual, 3)
+			So(sent[1]["expireAfterSeconds"], ShouldBeNil)
+			So(sent[2]["name"], ShouldEqual, "lastSeen_1")
+			So(sent[2]["key"], ShouldResemble, bson.M{"lastSeen": 1})
+			So(sent[2]["expireAfterSeconds"], ShouldEqual, 60)
+		})
+
+		Convey("a collection without metadata should get one too", func() {
+			sent := sentIndexes(restore, intent, restore.overrideTTL(intent, nil))
+			So(len(sent), ShouldEqual, 1)
+			So(sent[0]["expireAfterSeconds"], ShouldEqual, 60)
+		})
+
+		Convey("other collections should keep their indexes", func() {
+			other := &intents.Intent{DB: "db1", C: "events"}
+			indexes := []IndexDocument{{Key: bson.D{{"lastSeen", 1}}, Options: bson.M{"expireAfterSeconds": 10}}}
+			So(restore.overrideTTL(other, indexes), ShouldResemble, indexes)
+		})
+	})
+}
@@ -0,0 +1,72 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"unicode/utf8"
+)
+
+// Modes of --repairUTF8Mode.
+const (
+	repairUTF8Replace = "replace"
+	repairUTF8Strip   = "strip"
+)
+
+// repairUTF8 creates a documentTransform that repairs the invalid UTF-8 of the
+// string values of each document, at any depth, which the server would reject,
+// by replacing each run of invalid bytes with the Unicode replacement character,
+// or with nothing if strip is set. The _ids of the documents repaired are
+// logged. Documents that are valid are passed through as they are.
+func repairUTF8(ns string, strip bool) documentTransform {
+	replacement := string(utf8.RuneError)
+	if strip {
+		replacement = ""
+	}
+	return func(raw []byte) ([]byte, error) {
+		if utf8.Valid(raw) {
+			// no string in the document can be invalid
+			return raw, nil
+		}
+		doc := bson.D{}
+		err := bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return nil, err
+		}
+		repaired, changed := repairUTF8Value(doc, replacement)
+		if !changed {
+			return raw, nil
+		}
+		log.Logf(log.Info, "repaired invalid UTF-8 in document with _id %v of %v", doc.Map()["_id"], ns)
+		return bson.Marshal(repaired)
+	}
+}
+
+// repairUTF8Value returns the value with the invalid UTF-8 of its strings
+// replaced, and whether there was any.
+func repairUTF8Value(value interface{}, replacement string) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		if utf8.ValidString(v) {
+			return v, false
+		}
+		return strings.ToValidUTF8(v, replacement), true
+	case bson.D:
+		changed := false
+		for i := range v {
+			var elemChanged bool
+			v[i].Value, elemChanged = repairUTF8Value(v[i].Value, replacement)
+			changed = changed || elemChanged
+		}
+		return v, changed
+	case []interface{}:
+		changed := false
+		for i := range v {
+			var elemChanged bool
+			v[i], elemChanged = repairUTF8Value(v[i], replacement)
+			changed = changed || elemChanged
+		}
+		return v, changed
+	}
+	return value, false
+}
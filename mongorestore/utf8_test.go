@@ -0,0 +1,62 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRepairUTF8(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a document holding invalid UTF-8 at several depths", t, func() {
+		raw, err := bson.Marshal(bson.D{
+			{"_id", 1},
+			{"name", "caf\xe9"},
+			{"ok", "naïve"},
+			{"address", bson.D{{"city", "K\xf8benhavn"}}},
+			{"tags", []interface{}{"a\xff\xfeb", 3}},
+			{"data", bson.Binary{Kind: 0x00, Data: []byte{0xff, 0xfe}}},
+		})
+		So(err, ShouldBeNil)
+
+		repair := func(strip bool) bson.D {
+			out, err := repairUTF8("db1.c1", strip)(raw)
+			So(err, ShouldBeNil)
+			doc := bson.D{}
+			So(bson.Unmarshal(out, &doc), ShouldBeNil)
+			return doc
+		}
+
+		Convey("the invalid bytes should be replaced, leaving valid strings and binary data alone", func() {
+			doc := repair(false)
+			So(doc, ShouldResemble, bson.D{
+				{"_id", 1},
+				{"name", "caf�"},
+				{"ok", "naïve"},
+				{"address", bson.D{{"city", "K�benhavn"}}},
+				{"tags", []interface{}{"a�b", 3}},
+				{"data", []byte{0xff, 0xfe}},
+			})
+			So(utf8.ValidString(doc[1].Value.(string)), ShouldBeTrue)
+		})
+
+		Convey("with strip, the invalid bytes should be removed", func() {
+			doc := repair(true)
+			So(doc[1].Value, ShouldEqual, "caf")
+			So(doc[3].Value, ShouldResemble, bson.D{{"city", "Kbenhavn"}})
+			So(doc[4].Value, ShouldResemble, []interface{}{"ab", 3})
+		})
+	})
+
+	Convey("A valid document should be passed through", t, func() {
+		raw, err := bson.Marshal(bson.D{{"_id", 1}, {"name", "naïve"}, {"data", bson.Binary{Data: []byte{0xff}}}})
+		So(err, ShouldBeNil)
+		out, err := repairUTF8("db1.c1", false)(raw)
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, raw)
+	})
+}
@@ -0,0 +1,110 @@
+package mongorestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"time"
+)
+
+// RestoreResult records how many documents were restored in to a namespace,
+// how long inserting them and then building the namespace's indexes took, and
+// which of them the server refused.
+type RestoreResult struct {
+	DB         string
+	C          string
+	Documents  int64
+	InsertTime time.Duration
+	IndexTime  time.Duration
+	// the documents the server refused to insert, where it reported each of them
+	Errors []db.WriteFailure
+}
+
+// VerifyEntry compares the documents restored in to a namespace with
+// the number of documents the namespace holds after the restore.
+type VerifyEntry struct {
+	Namespace string `json:"ns"`
+	Restored  int64  `json:"restored"`
+	Count     int64  `json:"count"`
+	Match     bool   `json:"match"`
+}
+
+// VerifyReport is the document written by --verifyReport.
+type VerifyReport struct {
+	Matches    int           `json:"matches"`
+	Mismatches int           `json:"mismatches"`
+	Namespaces []VerifyEntry `json:"namespaces"`
+}
+
+// recordResult saves the document count of a restored namespace for --verifyReport.
+func (restore *MongoRestore) recordResult(result RestoreResult) {
+	restore.resultsMutex.Lock()
+	defer restore.resultsMutex.Unlock()
+	restore.results = append(restore.results, result)
+}
+
+// buildVerifyReport compares each result with the live count of its namespace,
+// as returned by the count function.
+func buildVerifyReport(results []RestoreResult, count func(dbName, colName string) (int64, error)) (*VerifyReport, error) {
+	report := &VerifyReport{Namespaces: []VerifyEntry{}}
+	for _, result := range results {
+		liveCount, err := count(result.DB, result.C)
+		if err != nil {
+			return nil, fmt.Errorf("error counting documents in %v.%v: %v", result.DB, result.C, err)
+		}
+		entry := VerifyEntry{
+			Namespace: result.DB + "." + result.C,
+			Restored:  result.Documents,
+			Count:     liveCount,
+			Match:     result.Documents == liveCount,
+		}
+		if entry.Match {
+			report.Matches++
+		} else {
+			report.Mismatches++
+		}
+		report.Namespaces = append(report.Namespaces, entry)
+	}
+	return report, nil
+}
+
+// WriteVerifyReport counts the documents in every restored namespace and
+// writes a JSON report comparing them with the documents restored to path.
+func (restore *MongoRestore) WriteVerifyReport(path string) error {
+	restore.resultsMutex.Lock()
+	results := restore.results
+	restore.resultsMutex.Unlock()
+
+	// count through the runner, so that with --causalConsistency the counts
+	// see everything restored
+	runner := restore.getRunner()
+	report, err := buildVerifyReport(results, func(dbName, colName string) (int64, error) {
+		result := struct {
+			N int64 `bson:"n"`
+		}{}
+		err := runner.Run(bson.D{{"count", colName}}, &result, dbName)
+		return result.N, err
+	})
+	if err != nil {
+		return err
+	}
+	if report.Mismatches > 0 {
+		log.Logf(log.Always, "verification found %v %v whose count does not match the documents restored",
+			report.Mismatches, util.Pluralize(report.Mismatches, "namespace", "namespaces"))
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path, out, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing verification report: %v", err)
+	}
+	log.Logf(log.Info, "wrote verification report to %v", path)
+	return nil
+}
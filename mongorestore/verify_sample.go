@@ -0,0 +1,130 @@
+package mongorestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"math/rand"
+	"time"
+)
+
+// verifySampler keeps a sample, chosen uniformly at random, of up to size of the
+// documents sent to be inserted in to a collection, for --verifySample. Its
+// methods do nothing on a nil *verifySampler.
+type verifySampler struct {
+	size int
+	seen int64
+	docs [][]byte
+	rand *rand.Rand
+}
+
+func (restore *MongoRestore) newVerifySampler() *verifySampler {
+	if restore.OutputOptions == nil || restore.OutputOptions.VerifySample <= 0 {
+		return nil
+	}
+	return &verifySampler{
+		size: restore.OutputOptions.VerifySample,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// offer adds the document to the sample in place of one already in it, if it's
+// chosen, once the sample is full.
+func (sampler *verifySampler) offer(doc []byte) {
+	if sampler == nil {
+		return
+	}
+	sampler.seen++
+	if len(sampler.docs) < sampler.size {
+		sampler.docs = append(sampler.docs, doc)
+	} else if i := sampler.rand.Int63n(sampler.seen); i < int64(sampler.size) {
+		sampler.docs[i] = doc
+	}
+}
+
+// fetchDocument returns the document of the collection with the given _id, or
+// nil if it has none.
+func (restore *MongoRestore) fetchDocument(dbName, colName string, id bson.Raw) ([]byte, error) {
+	if restore.documentFetcher != nil {
+		return restore.documentFetcher(dbName, colName, id)
+	}
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return nil, fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+	doc := bson.Raw{}
+	err = session.DB(dbName).C(colName).Find(bson.D{{"_id", id}}).One(&doc)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	return doc.Data, err
+}
+
+// idFirst returns the document with its _id moved to the front, where the server
+// stores it, and its other fields in the order they were in.
+func idFirst(raw []byte) ([]byte, error) {
+	doc := bson.RawD{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	for i, elem := range doc {
+		if elem.Name == "_id" {
+			copy(doc[1:i+1], doc[:i])
+			doc[0] = elem
+			break
+		}
+	}
+	return bson.Marshal(doc)
+}
+
+// verifySample reads back each sampled document of the collection by its _id and
+// compares it, byte for byte once both have their _id first, with what was sent,
+// logging each document that is
+// missing or doesn't match. It returns the number that don't. Documents without
+// an _id, and those the driver can't read, such as ones with decimal128 values,
+// can't be looked up and are skipped.
+func (restore *MongoRestore) verifySample(dbName, colName string, sampler *verifySampler) (int, error) {
+	if sampler == nil {
+		return 0, nil
+	}
+	ns := dbName + "." + colName
+	verified, mismatches := 0, 0
+	for _, sent := range sampler.docs {
+		doc := struct {
+			ID bson.Raw `bson:"_id"`
+		}{}
+		if err := bson.Unmarshal(sent, &doc); err != nil || doc.ID.Kind == 0 {
+			continue
+		}
+		var id interface{}
+		doc.ID.Unmarshal(&id)
+		found, err := restore.fetchDocument(dbName, colName, doc.ID)
+		if err != nil {
+			return mismatches, fmt.Errorf("error reading back document %v of %v: %v", id, ns, err)
+		}
+		verified++
+		if found != nil {
+			if found, err = idFirst(found); err == nil {
+				sent, err = idFirst(sent)
+			}
+			if err != nil {
+				return mismatches, fmt.Errorf("error reading back document %v of %v: %v", id, ns, err)
+			}
+		}
+		switch {
+		case found == nil:
+			log.Logf(log.Always, "verification sample of %v: document %v is missing", ns, id)
+			mismatches++
+		case !bytes.Equal(found, sent):
+			log.Logf(log.Always, "verification sample of %v: document %v doesn't match the document inserted", ns, id)
+			mismatches++
+		}
+	}
+	log.Logf(log.Always, "verified a sample of %v %v of %v: %v mismatched", verified,
+		util.Pluralize(verified, "document", "documents"), ns, mismatches)
+	return mismatches, nil
+}
@@ -0,0 +1,126 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"testing"
+)
+
+func TestVerifySampler(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a sampler of 3 documents", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{VerifySample: 3}}
+		sampler := restore.newVerifySampler()
+
+		Convey("fewer documents than that should all be kept", func() {
+			sampler.offer([]byte("a"))
+			sampler.offer([]byte("b"))
+			So(sampler.docs, ShouldResemble, [][]byte{[]byte("a"), []byte("b")})
+		})
+
+		Convey("of many documents, 3 different ones should be kept", func() {
+			for i := 0; i < 100; i++ {
+				sampler.offer([]byte{byte(i)})
+			}
+			So(len(sampler.docs), ShouldEqual, 3)
+			So(sampler.docs[0], ShouldNotResemble, sampler.docs[1])
+			So(sampler.docs[1], ShouldNotResemble, sampler.docs[2])
+			So(sampler.docs[0], ShouldNotResemble, sampler.docs[2])
+		})
+	})
+
+	Convey("Without --verifySample nothing should be sampled", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		sampler := restore.newVerifySampler()
+		So(sampler, ShouldBeNil)
+		sampler.offer([]byte("a"))
+		mismatches, err := restore.verifySample("db1", "c1", sampler)
+		So(err, ShouldBeNil)
+		So(mismatches, ShouldEqual, 0)
+	})
+}
+
+func TestVerifySample(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a sample of the documents inserted in to a collection", t, func() {
+		logged := &bytes.Buffer{}
+		log.SetWriter(logged)
+		Reset(func() {
+			log.SetWriter(os.Stderr)
+		})
+
+		restore := &MongoRestore{OutputOptions: &OutputOptions{VerifySample: 10}}
+		sampler := restore.newVerifySampler()
+		stored := map[int][]byte{}
+		for i := 1; i <= 3; i++ {
+			raw, err := bson.Marshal(bson.D{{"_id", i}, {"amount", 1.5}})
+			So(err, ShouldBeNil)
+			sampler.offer(raw)
+			stored[i] = raw
+		}
+		restore.documentFetcher = func(dbName, colName string, id bson.Raw) ([]byte, error) {
+			So(dbName+"."+colName, ShouldEqual, "db1.c1")
+			var key int
+			So(id.Unmarshal(&key), ShouldBeNil)
+			return stored[key], nil
+		}
+
+		Convey("documents stored as they were sent should match", func() {
+			mismatches, err := restore.verifySample("db1", "c1", sampler)
+			So(err, ShouldBeNil)
+			So(mismatches, ShouldEqual, 0)
+			So(logged.String(), ShouldContainSubstring, "verified a sample of 3 documents of db1.c1: 0 mismatched")
+		})
+
+		Convey("a document the server moved the _id of to the front should match", func() {
+			sent, err := bson.Marshal(bson.D{{"amount", 2.5}, {"_id", 4}, {"note", "x"}})
+			So(err, ShouldBeNil)
+			sampler.offer(sent)
+			stored[4], err = bson.Marshal(bson.D{{"_id", 4}, {"amount", 2.5}, {"note", "x"}})
+			So(err, ShouldBeNil)
+			mismatches, err := restore.verifySample("db1", "c1", sampler)
+			So(err, ShouldBeNil)
+			So(mismatches, ShouldEqual, 0)
+		})
+
+		Convey("a document with its other fields reordered should be reported", func() {
+			sent, err := bson.Marshal(bson.D{{"_id", 5}, {"a", 1}, {"b", 2}})
+			So(err, ShouldBeNil)
+			sampler.offer(sent)
+			stored[5], err = bson.Marshal(bson.D{{"_id", 5}, {"b", 2}, {"a", 1}})
+			So(err, ShouldBeNil)
+			mismatches, err := restore.verifySample("db1", "c1", sampler)
+			So(err, ShouldBeNil)
+			So(mismatches, ShouldEqual, 1)
+		})
+
+		Convey("a document the server altered should be reported", func() {
+			// the server coerced the double to an int
+			altered, err := bson.Marshal(bson.D{{"_id", 2}, {"amount", 1}})
+			So(err, ShouldBeNil)
+			stored[2] = altered
+			mismatches, err := restore.verifySample("db1", "c1", sampler)
+			So(err, ShouldBeNil)
+			So(mismatches, ShouldEqual, 1)
+			So(logged.String(), ShouldContainSubstring,
+				"verification sample of db1.c1: document 2 doesn't match the document inserted")
+			So(logged.String(), ShouldContainSubstring, "1 mismatched")
+		})
+
+		Convey("a missing document should be reported", func() {
+			delete(stored, 3)
+			mismatches, err := restore.verifySample("db1", "c1", sampler)
+			So(err, ShouldBeNil)
+			So(mismatches, ShouldEqual, 1)
+			So(logged.String(), ShouldContainSubstring, "verification sample of db1.c1: document 3 is missing")
+		})
+	})
+}
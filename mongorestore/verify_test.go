@@ -0,0 +1,42 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestBuildVerifyReport(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With results for two restored collections", t, func() {
+		results := []RestoreResult{
+			{DB: "db1", C: "c1", Documents: 10},
+			{DB: "db1", C: "c2", Documents: 5},
+		}
+
+		Convey("a collection that skipped a duplicate key should be reported as a mismatch", func() {
+			live := map[string]int64{"db1.c1": 10, "db1.c2": 4}
+			report, err := buildVerifyReport(results, func(dbName, colName string) (int64, error) {
+				return live[dbName+"."+colName], nil
+			})
+			So(err, ShouldBeNil)
+			So(report.Matches, ShouldEqual, 1)
+			So(report.Mismatches, ShouldEqual, 1)
+			So(report.Namespaces, ShouldResemble, []VerifyEntry{
+				{Namespace: "db1.c1", Restored: 10, Count: 10, Match: true},
+				{Namespace: "db1.c2", Restored: 5, Count: 4, Match: false},
+			})
+		})
+
+		Convey("an error counting a collection should be returned", func() {
+			_, err := buildVerifyReport(results, func(dbName, colName string) (int64, error) {
+				return 0, fmt.Errorf("not authorized")
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "db1.c1")
+		})
+	})
+}
@@ -0,0 +1,65 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestPhaseWriteConcerns(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a restore connected to a replica set", t, func() {
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{WriteConcern: "majority"},
+		}
+		intent := &intents.Intent{DB: "db1", C: "c1"}
+		indexes := []IndexDocument{{Key: bson.D{{"a", 1}}}}
+
+		Convey("without phase write concerns, inserts should use --writeConcern "+
+			"and metadata commands the server's default", func() {
+			So(restore.buildWriteConcerns(db.ReplSet), ShouldBeNil)
+			So(restore.safety.WMode, ShouldEqual, "majority")
+			So(restore.createIndexesCommand(intent, indexes), ShouldResemble,
+				bson.D{{"createIndexes", "c1"}, {"indexes", indexes}})
+			So(restore.createCommand(intent, bson.D{{"capped", true}}), ShouldResemble,
+				bson.D{{"create", "c1"}, {"capped", true}})
+		})
+
+		Convey("with --dataWriteConcern and --metaWriteConcern, each phase should use its own", func() {
+			restore.OutputOptions.DataWriteConcern = "w:1"
+			restore.OutputOptions.MetaWriteConcern = "{w:'majority',j:true}"
+			So(restore.buildWriteConcerns(db.ReplSet), ShouldBeNil)
+			So(restore.safety.W, ShouldEqual, 1)
+			So(restore.safety.WMode, ShouldEqual, "")
+
+			metaWriteConcern := bson.D{{"w", "majority"}, {"j", true}}
+			So(restore.createIndexesCommand(intent, indexes), ShouldResemble, bson.D{
+				{"createIndexes", "c1"},
+				{"indexes", indexes},
+				{"writeConcern", metaWriteConcern},
+			})
+			So(restore.createCommand(intent, bson.D{{"capped", true}}), ShouldResemble, bson.D{
+				{"create", "c1"},
+				{"capped", true},
+				{"writeConcern", metaWriteConcern},
+			})
+		})
+
+		Convey("a --dataWriteConcern document without braces should be parsed like JSON", func() {
+			restore.OutputOptions.DataWriteConcern = "w:1,j:true"
+			So(restore.buildWriteConcerns(db.ReplSet), ShouldBeNil)
+			So(restore.safety.W, ShouldEqual, 1)
+			So(restore.safety.J, ShouldBeTrue)
+		})
+
+		Convey("an invalid --metaWriteConcern should be an error", func() {
+			restore.OutputOptions.MetaWriteConcern = "{w:-1}"
+			So(restore.buildWriteConcerns(db.ReplSet), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,87 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// maxErrorsError is the error that aborts the restore once more documents have
+// failed to insert than --maxErrors allows.
+type maxErrorsError struct {
+	count       int64
+	max         int64
+	byNamespace map[string]int64
+}
+
+func (err *maxErrorsError) Error() string {
+	namespaces := []string{}
+	for ns := range err.byNamespace {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	counts := []string{}
+	for _, ns := range namespaces {
+		counts = append(counts, fmt.Sprintf("%v: %v", ns, err.byNamespace[ns]))
+	}
+	return fmt.Sprintf("aborting after %v documents failed to insert, more than the %v allowed by --maxErrors (%v)",
+		err.count, err.max, strings.Join(counts, ", "))
+}
+
+// logInsertError logs an error inserting in to the namespace that doesn't stop
+// the restore. When the server reported each document it refused, as it does
+// for insert commands, each is logged with its _id and kept for the namespace's
+// RestoreResult. Other errors, such as the failure of a bulk insert, are logged
+// as they are. Each document refused counts towards --maxErrors, as does each
+// other error, and once more have failed than it allows, the returned error
+// aborts the restore.
+func (restore *MongoRestore) logInsertError(ns string, err error) error {
+	failures, ok := err.(*db.WriteFailures)
+	if ok {
+		for _, failure := range failures.Failures {
+			log.Logf(log.Always, "error: failed to insert document with _id %v in to %v (document %v of its batch): %v",
+				failure.ID, ns, failure.Index, failure.ErrMsg)
+		}
+	} else {
+		log.Logf(log.Always, "error: %v", err)
+	}
+
+	errors := int64(1)
+	if ok {
+		errors = int64(len(failures.Failures))
+	}
+	total := atomic.AddInt64(&restore.insertErrors, errors)
+
+	restore.writeFailuresMutex.Lock()
+	defer restore.writeFailuresMutex.Unlock()
+	if restore.insertErrorCounts == nil {
+		restore.insertErrorCounts = map[string]int64{}
+	}
+	restore.insertErrorCounts[ns] += errors
+	if ok {
+		if restore.writeFailures == nil {
+			restore.writeFailures = map[string][]db.WriteFailure{}
+		}
+		restore.writeFailures[ns] = append(restore.writeFailures[ns], failures.Failures...)
+	}
+
+	max := restore.OutputOptions.MaxErrors
+	if max <= 0 || total <= max {
+		return nil
+	}
+	byNamespace := map[string]int64{}
+	for errNS, count := range restore.insertErrorCounts {
+		byNamespace[errNS] = count
+	}
+	return &maxErrorsError{count: total, max: max, byNamespace: byNamespace}
+}
+
+// writeFailuresOf returns the documents the server refused to insert in to the namespace.
+func (restore *MongoRestore) writeFailuresOf(ns string) []db.WriteFailure {
+	restore.writeFailuresMutex.Lock()
+	defer restore.writeFailuresMutex.Unlock()
+	return restore.writeFailures[ns]
+}
@@ -0,0 +1,145 @@
+package mongorestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteFailureReport(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a batch whose 3rd and 7th documents were refused", t, func() {
+		logged := &bytes.Buffer{}
+		log.SetWriter(logged)
+		Reset(func() {
+			log.SetWriter(os.Stderr)
+		})
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		failures := &db.WriteFailures{Failures: []db.WriteFailure{
+			{Index: 2, ID: "order-3", Code: 11000, ErrMsg: "E11000 duplicate key error"},
+			{Index: 6, ID: "order-7", Code: 121, ErrMsg: "Document failed validation"},
+		}}
+
+		Convey("the report should name the _id of each, and keep them for the result", func() {
+			So(restore.logInsertError("db1.orders", failures), ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(logged.String()), "\n")
+			So(len(lines), ShouldEqual, 2)
+			So(lines[0], ShouldContainSubstring, "_id order-3 in to db1.orders (document 2 of its batch): E11000")
+			So(lines[1], ShouldContainSubstring, "_id order-7 in to db1.orders (document 6 of its batch): Document failed validation")
+			So(restore.writeFailuresOf("db1.orders"), ShouldResemble, failures.Failures)
+			So(restore.writeFailuresOf("db1.other"), ShouldBeEmpty)
+		})
+
+		Convey("other errors should be logged as they are", func() {
+			So(restore.logInsertError("db1.orders", fmt.Errorf("oops")), ShouldBeNil)
+			So(logged.String(), ShouldContainSubstring, "error: oops")
+			So(restore.writeFailuresOf("db1.orders"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestInsertErrorReporting(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a collection to restore in to", t, func() {
+		log.SetWriter(&bytes.Buffer{})
+		Reset(func() {
+			log.SetWriter(os.Stderr)
+		})
+		coll := &mgo.Collection{Database: &mgo.Database{Name: "db1"}, Name: "c1", FullName: "db1.c1"}
+		restore := &MongoRestore{
+			ToolOptions:   &options.ToolOptions{HiddenOptions: &options.HiddenOptions{BulkBufferSize: 1000}},
+			OutputOptions: &OutputOptions{IdCollisions: idCollisionsError},
+		}
+
+		Convey("the default options should insert in bulk, whose failure counts as one error", func() {
+			bulk, err := restore.newDocumentInserter(coll)
+			So(err, ShouldBeNil)
+			_, ok := bulk.(*db.BufferedBulkInserter)
+			So(ok, ShouldBeTrue)
+			So(restore.logInsertError("db1.c1", fmt.Errorf("E11000 duplicate key error")), ShouldBeNil)
+			So(restore.insertErrors, ShouldEqual, 1)
+			So(restore.writeFailuresOf("db1.c1"), ShouldBeEmpty)
+		})
+
+		Convey("options that need insert commands should report each document refused", func() {
+			for _, set := range []func(){
+				func() { restore.OutputOptions.RetryWrites = true },
+				func() { restore.comment = "nightly" },
+				func() { restore.OutputOptions.IdCollisions = idCollisionsSkip },
+				func() { restore.OutputOptions.IdCollisions = idCollisionsReplace },
+			} {
+				restore.OutputOptions = &OutputOptions{IdCollisions: idCollisionsError}
+				restore.comment = ""
+				set()
+				bulk, err := restore.newDocumentInserter(coll)
+				So(err, ShouldBeNil)
+				_, ok := bulk.(*db.RetryableInserter)
+				So(ok, ShouldBeTrue)
+			}
+		})
+	})
+}
+
+func TestMaxErrors(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --maxErrors=3 and errors injected from parallel workers", t, func() {
+		log.SetWriter(&bytes.Buffer{})
+		Reset(func() {
+			log.SetWriter(os.Stderr)
+		})
+		restore := &MongoRestore{OutputOptions: &OutputOptions{MaxErrors: 3}}
+		refused := func(ids ...string) error {
+			failures := &db.WriteFailures{}
+			for i, id := range ids {
+				failures.Failures = append(failures.Failures, db.WriteFailure{Index: i, ID: id, Code: 11000})
+			}
+			return failures
+		}
+
+		Convey("errors up to the limit should be tolerated", func() {
+			So(restore.logInsertError("db1.a", refused("a1", "a2")), ShouldBeNil)
+			So(restore.logInsertError("db1.b", fmt.Errorf("oops")), ShouldBeNil)
+
+			Convey("and crossing it should abort with the count of each namespace", func() {
+				err := restore.logInsertError("db1.b", refused("b1", "b2"))
+				So(err, ShouldNotBeNil)
+				maxErr, ok := err.(*maxErrorsError)
+				So(ok, ShouldBeTrue)
+				So(maxErr.count, ShouldEqual, 5)
+				So(err.Error(), ShouldEqual, "aborting after 5 documents failed to insert, "+
+					"more than the 3 allowed by --maxErrors (db1.a: 2, db1.b: 3)")
+			})
+		})
+
+		Convey("the errors of concurrent workers should all be counted", func() {
+			aborted := make(chan bool, 8)
+			for i := 0; i < 8; i++ {
+				go func(i int) {
+					aborted <- restore.logInsertError(fmt.Sprintf("db1.c%v", i%2), fmt.Errorf("oops")) != nil
+				}(i)
+			}
+			abortedCount := 0
+			for i := 0; i < 8; i++ {
+				if <-aborted {
+					abortedCount++
+				}
+			}
+			So(abortedCount, ShouldEqual, 5)
+			So(restore.insertErrors, ShouldEqual, 8)
+		})
+	})
+}